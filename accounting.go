@@ -0,0 +1,306 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/urfave/cli/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Day layout used in sender statistics keys
+const AccountingDay = "2006-01-02"
+
+// Rejection reasons of mails which are not printed at all
+const (
+	RejectSender      = "sender not allowed"
+	RejectNoAttach    = "no attachments"
+	RejectNoValidType = "no valid attachments"
+	RejectMailSize    = "mail too large"
+	RejectQuota       = "quota exceeded"
+	RejectUnauth      = "sender not authenticated"
+)
+
+// SenderStats counts the outcome of mails of a single sender on a single day
+type SenderStats struct {
+	Mails    int            `json:"mails"`
+	Printed  int            `json:"printed"`
+	Rejected int            `json:"rejected"`
+	Failed   int            `json:"failed"`
+	Reasons  map[string]int `json:"reasons"`
+}
+
+// add sums up s and o
+func (s *SenderStats) add(o *SenderStats) {
+	s.Mails += o.Mails
+	s.Printed += o.Printed
+	s.Rejected += o.Rejected
+	s.Failed += o.Failed
+	for reason, n := range o.Reasons {
+		s.Reasons[reason] += n
+	}
+}
+
+// rate returns the share of rejected and failed mails in percent
+func (s *SenderStats) rate() int {
+	if s.Mails == 0 {
+		return 0
+	}
+	return (s.Rejected + s.Failed) * 100 / s.Mails
+}
+
+// rejection returns the reason why m is not printed at all
+func (m *Mail) rejection(f filter.Filter) string {
+	switch {
+	case !m.isValidSender(f):
+		return RejectSender
+	case !m.hasAttachments():
+		return RejectNoAttach
+	case !m.validAttachments(f):
+		return RejectNoValidType
+	}
+	return ""
+}
+
+// account records the outcome of mails per sender in the state database
+func (cmd *Command) account(mails []*Mail) {
+
+	if cmd.DryRun {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	day := time.Now().Format(AccountingDay)
+
+	for _, m := range mails {
+
+		if m.Canary != "" || m.Quiet || m.From == "" {
+			continue
+		}
+
+		key := day + "|" + strings.ToLower(m.From)
+
+		stats := &SenderStats{Reasons: map[string]int{}}
+		if _, err := db.get(BucketSenders, key, stats); err != nil {
+			cmd.logpad("State DB", err.Error())
+			continue
+		}
+		if stats.Reasons == nil {
+			stats.Reasons = map[string]int{}
+		}
+
+		stats.Mails++
+		switch {
+		case m.Rejected != "":
+			stats.Rejected++
+			stats.Reasons[m.Rejected]++
+		case m.printed():
+			stats.Printed++
+		default:
+			stats.Failed++
+			for _, e := range m.Errors {
+				// Drop the attachment name so equal problems are counted together
+				if i := strings.Index(e, ": "); i >= 0 {
+					e = e[i+2:]
+				}
+				stats.Reasons[e]++
+			}
+		}
+
+		if err := db.put(BucketSenders, key, stats); err != nil {
+			cmd.logpad("State DB", err.Error())
+		}
+	}
+}
+
+// senderStats returns the statistics of all senders within the digest window and prunes older entries
+func (cmd *Command) senderStats() (map[string]*SenderStats, error) {
+
+	db, err := cmd.store()
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-cmd.cfg.Digest.Window).Format(AccountingDay)
+	senders := map[string]*SenderStats{}
+
+	var expired []string
+
+	err = db.each(BucketSenders, func(key string, data []byte) error {
+		parts := strings.SplitN(key, "|", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		if parts[0] < since {
+			expired = append(expired, key)
+			return nil
+		}
+		var stats SenderStats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return err
+		}
+		if _, ok := senders[parts[1]]; !ok {
+			senders[parts[1]] = &SenderStats{Reasons: map[string]int{}}
+		}
+		senders[parts[1]].add(&stats)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !cmd.DryRun {
+		for _, key := range expired {
+			_ = db.del(BucketSenders, key)
+		}
+	}
+
+	return senders, nil
+}
+
+// digestReport returns a plain text report of rejection rates and reasons per sender
+func (cmd *Command) digestReport() (string, error) {
+
+	senders, err := cmd.senderStats()
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for name := range senders {
+		names = append(names, name)
+	}
+
+	// Senders with the most problems first
+	sort.Slice(names, func(i, j int) bool {
+		a, b := senders[names[i]], senders[names[j]]
+		if a.Rejected+a.Failed != b.Rejected+b.Failed {
+			return a.Rejected+a.Failed > b.Rejected+b.Failed
+		}
+		return names[i] < names[j]
+	})
+
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf(tr("Print statistics of the last %s"), cmd.cfg.Digest.Window) + "\n\n")
+
+	if len(names) == 0 {
+		b.WriteString(tr("No mails processed.") + "\n")
+		return b.String(), nil
+	}
+
+	b.WriteString(fmt.Sprintf("%-40s %6s %8s %9s %7s %5s\n", tr("Sender"), tr("Mails"), tr("Printed"), tr("Rejected"), tr("Failed"), tr("Rate")))
+
+	for _, name := range names {
+		s := senders[name]
+		b.WriteString(fmt.Sprintf("%-40s %6d %8d %9d %7d %4d%%\n", name, s.Mails, s.Printed, s.Rejected, s.Failed, s.rate()))
+		var reasons []string
+		for reason := range s.Reasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			return s.Reasons[reasons[i]] > s.Reasons[reasons[j]]
+		})
+		for _, reason := range reasons {
+			b.WriteString(fmt.Sprintf("    %4dx %s\n", s.Reasons[reason], tr(reason)))
+		}
+	}
+
+	return b.String(), nil
+}
+
+// digestSend mails the digest report if the digest interval has elapsed
+func (cmd *Command) digestSend() {
+
+	if cmd.cfg.Digest.Interval <= 0 || cmd.DryRun {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	var last time.Time
+	if ok, _ := db.get(BucketDigest, "last", &last); ok && time.Since(last) < cmd.cfg.Digest.Interval {
+		return
+	}
+
+	if err := cmd.digestMail(); err != nil {
+		cmd.logpad("Digest", err.Error())
+		return
+	}
+
+	if err := db.put(BucketDigest, "last", time.Now()); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// digestMail sends the digest report to the digest recipients
+func (cmd *Command) digestMail() error {
+
+	to := cmd.cfg.Digest.To
+	if len(to) == 0 {
+		to = cmd.cfg.Alert.Email
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no digest recipients configured")
+	}
+
+	report, err := cmd.digestReport()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.sendmail(to, tr("IMAPPrint digest"), report); err != nil {
+		return err
+	}
+
+	cmd.logpad("Digest", tr("Sent to"), strings.Join(to, ", "))
+
+	return nil
+}
+
+// digest is used as callable for the digest sub command
+func (cmd *Command) digest(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	if c.Bool("send") {
+		if err := cmd.digestMail(); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		return nil
+	}
+
+	report, err := cmd.digestReport()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	fmt.Print(report)
+
+	return nil
+}
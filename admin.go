@@ -0,0 +1,107 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// notifyAdmin sends a summary (and optionally the original message) of every rejected or failed mail to the admin
+func (cmd *Command) notifyAdmin(mails []*Mail) {
+
+	if len(cmd.cfg.Admin.Email) == 0 || cmd.NoNotify {
+		return
+	}
+
+	for _, m := range mails {
+
+		if m.Canary != "" || m.Quiet || (m.Rejected == "" && m.printed()) {
+			continue
+		}
+
+		if err := cmd.smtpsend(cmd.cfg.Admin.Email, cmd.adminMessage(m)); err != nil {
+			cmd.logpad("Admin", err.Error())
+			continue
+		}
+
+		cmd.logverb("Admin", tr("Notified about"), m.Tracking)
+	}
+}
+
+// adminMessage builds the notification mail about m, attaching the original message if available
+func (cmd *Command) adminMessage(m *Mail) []byte {
+
+	reason := tr("print failed")
+	if m.Rejected != "" {
+		reason = tr(m.Rejected)
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(tr("A mail has not been printed: %s"), reason) + "\r\n\r\n")
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("From")+":", m.From))
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("Subject")+":", m.Subject))
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("Date")+":", m.Date.Format(time.RFC1123)))
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("Tracking")+":", m.Tracking))
+	for _, e := range m.Errors {
+		text.WriteString(" - " + e + "\r\n")
+	}
+
+	return cmd.originalMessage(cmd.cfg.Admin.Email, fmt.Sprintf(tr("Not printed: %s"), m.Subject), text.String(), m.Raw)
+}
+
+// originalMessage builds a mail with text and the original message raw attached if not nil
+func (cmd *Command) originalMessage(to []string, subject string, text string, raw []byte, headers ...string) []byte {
+
+	var msg bytes.Buffer
+
+	msg.WriteString("From: " + cmd.cfg.SMTP.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString(AutoSubmittedHeader + ": auto-generated\r\n")
+	for _, h := range headers {
+		msg.WriteString(h + "\r\n")
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if raw == nil {
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.WriteString(text)
+		return msg.Bytes()
+	}
+
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	boundary := "admin-" + hex.EncodeToString(id)
+
+	msg.WriteString("Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(text)
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: message/rfc822\r\n")
+	msg.WriteString("Content-Disposition: attachment; filename=\"original.eml\"\r\n\r\n")
+	msg.Write(raw)
+	msg.WriteString("\r\n--" + boundary + "--\r\n")
+
+	return msg.Bytes()
+}
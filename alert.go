@@ -0,0 +1,126 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Alert is a notification sent to operators via the configured channels
+type Alert struct {
+	Key     string            `json:"key"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	Time    time.Time         `json:"time"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// alerting reports if at least one alert channel is configured
+func (cmd *Command) alerting() bool {
+	a := cmd.cfg.Alert
+	return a.Webhook != "" || a.Slack != "" || len(a.Email) > 0
+}
+
+// alert sends an alert to all configured channels unless an alert with the same key was sent within cooldown
+func (cmd *Command) alert(key string, subject string, text string) {
+
+	if !cmd.alerting() {
+		return
+	}
+
+	cmd.logpad("Alert", subject)
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+	} else {
+		var last time.Time
+		if ok, _ := db.get(BucketAlerts, key, &last); ok && time.Since(last) < cmd.cfg.Alert.Cooldown {
+			cmd.logverb("Alert Cooldown", key, "until", last.Add(cmd.cfg.Alert.Cooldown))
+			return
+		}
+	}
+
+	if cmd.NoNotify {
+		return
+	}
+
+	a := &Alert{
+		Key:     key,
+		Subject: subject,
+		Text:    text,
+		Time:    time.Now(),
+		Fields:  cmd.fields(nil),
+	}
+
+	sent := false
+
+	if cmd.cfg.Alert.Webhook != "" {
+		if err := postJSON(cmd.cfg.Alert.Webhook, a); err != nil {
+			cmd.logpad("Alert Webhook", err.Error())
+		} else {
+			sent = true
+		}
+	}
+
+	if cmd.cfg.Alert.Slack != "" {
+		if err := postJSON(cmd.cfg.Alert.Slack, map[string]string{"text": "*" + subject + "*\n" + text}); err != nil {
+			cmd.logpad("Alert Slack", err.Error())
+		} else {
+			sent = true
+		}
+	}
+
+	if len(cmd.cfg.Alert.Email) > 0 {
+		if err := cmd.sendmail(cmd.cfg.Alert.Email, "[IMAPPrint] "+subject, text); err != nil {
+			cmd.logpad("Alert Email", err.Error())
+		} else {
+			sent = true
+		}
+	}
+
+	if sent && db != nil {
+		if err := db.put(BucketAlerts, key, a.Time); err != nil {
+			cmd.logpad("State DB", err.Error())
+		}
+	}
+}
+
+// postJSON posts v as JSON document to url
+func postJSON(url string, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// Timeout for the broker to confirm a published entry
+const AMQPConfirmTimeout = 30 * time.Second
+
+// ErrNotConfirmed is returned if the broker did not confirm a published entry
+var ErrNotConfirmed = errors.New("entry not confirmed by broker")
+
+// amqpQueue is a queue on an AMQP broker like RabbitMQ
+type amqpQueue struct {
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	name   string
+	tmpdir string
+	logpad func(title string, v ...interface{})
+}
+
+// dialAMQP connects to the broker at url and declares the durable queue name,
+// pulled documents are stored in tmpdir and problems with entries are logged by logpad
+func dialAMQP(url string, name string, tmpdir string, logpad func(title string, v ...interface{})) (*amqpQueue, error) {
+
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	q := &amqpQueue{conn: conn, ch: ch, name: name, tmpdir: tmpdir, logpad: logpad}
+
+	if _, err := ch.QueueDeclare(name, true, false, false, false, nil); err != nil {
+		_ = q.close()
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		_ = q.close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// push publishes q with its documents embedded and waits for the broker to confirm it
+func (a *amqpQueue) push(q *QueuedMail) error {
+
+	for _, att := range q.Attachments {
+		data, err := ioutil.ReadFile(att.Path)
+		if err != nil {
+			return err
+		}
+		att.Data = data
+	}
+
+	body, err := json.Marshal(q)
+
+	for _, att := range q.Attachments {
+		att.Data = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), AMQPConfirmTimeout)
+	defer cancel()
+
+	confirm, err := a.ch.PublishWithDeferredConfirmWithContext(ctx, "", a.name, true, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    q.Tracking,
+		Timestamp:    q.Enqueued,
+		Body:         body,
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- confirm.Wait()
+	}()
+
+	select {
+	case ok := <-done:
+		if !ok {
+			return ErrNotConfirmed
+		}
+		return nil
+	case <-ctx.Done():
+		return ErrNotConfirmed
+	}
+}
+
+// pull gets up to limit (0 = all) waiting entries without acknowledging them and writes their documents
+// to the temp dir
+func (a *amqpQueue) pull(limit int) ([]*QueuedMail, error) {
+
+	var entries []*QueuedMail
+
+	for limit <= 0 || len(entries) < limit {
+
+		msg, ok, err := a.ch.Get(a.name, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return entries, nil
+		}
+
+		var q QueuedMail
+		if err := json.Unmarshal(msg.Body, &q); err != nil {
+			a.logpad("Queue", msg.MessageId, err.Error())
+			// Undecodable entries would be redelivered forever
+			_ = msg.Reject(false)
+			continue
+		}
+
+		q.tag = msg.DeliveryTag
+
+		for _, att := range q.Attachments {
+			att.Path = filepath.Join(a.tmpdir, filepath.Base(att.File))
+			if err := ioutil.WriteFile(att.Path, att.Data, 0600); err != nil {
+				return nil, err
+			}
+			att.Data = nil
+		}
+
+		entries = append(entries, &q)
+	}
+
+	return entries, nil
+}
+
+// done acknowledges q, unacknowledged entries are redelivered
+func (a *amqpQueue) done(q *QueuedMail) error {
+	return a.ch.Ack(q.tag, false)
+}
+
+// retry returns q to the broker to be delivered again
+func (a *amqpQueue) retry(q *QueuedMail) error {
+	return a.ch.Nack(q.tag, false, true)
+}
+
+// close closes channel and connection to the broker
+func (a *amqpQueue) close() error {
+	_ = a.ch.Close()
+	return a.conn.Close()
+}
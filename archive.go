@@ -0,0 +1,167 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"github.com/mrccnt/imap-print/filter"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Archive errors
+var (
+	ErrArchiveEntries = errors.New("archive contains too many entries")
+	ErrArchiveSize    = errors.New("archive exceeds maximum size")
+)
+
+// isArchive checks if name is a supported archive
+func isArchive(name string) bool {
+	n := strings.ToLower(name)
+	return strings.HasSuffix(n, ".zip") || strings.HasSuffix(n, ".tar.gz") || strings.HasSuffix(n, ".tgz")
+}
+
+// extract extracts the allowed files of archive file into the temp dir and returns them as attachments
+func (cmd *Command) extract(m *Mail, file string, name string) ([]*Attachment, error) {
+
+	var attachments []*Attachment
+
+	entries := 0
+	var size int64
+
+	add := func(entry string, r io.Reader) error {
+
+		// Limits of 0 are unlimited like every other limit
+		entries++
+		if limit := cmd.cfg.Archive.MaxEntries; limit > 0 && entries > limit {
+			return ErrArchiveEntries
+		}
+
+		// Only base names are used, paths inside archives are never trusted
+		base := path.Base(strings.Replace(entry, "\\", "/", -1))
+		if !cmd.filters(m).Extension(filter.FileExt(base)) {
+			cmd.logverb("Archive", name, "skipping", entry)
+			return nil
+		}
+
+		out, err := ioutil.TempFile(cmd.TmpDir, "*_"+base)
+		if err != nil {
+			return err
+		}
+
+		src := r
+		if limit := cmd.cfg.Archive.MaxSize; limit > 0 {
+			src = io.LimitReader(r, limit-size+1)
+		}
+		n, err := io.Copy(out, src)
+		_ = out.Close()
+		size += n
+		if err != nil {
+			return err
+		}
+		if limit := cmd.cfg.Archive.MaxSize; limit > 0 && size > limit {
+			return ErrArchiveSize
+		}
+
+		cmd.logverb("Archive", name, "extracted", entry)
+
+		attachments = append(attachments, &Attachment{File: out.Name(), Name: base})
+
+		return nil
+	}
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		err = unzip(file, add)
+	} else {
+		err = untargz(file, add)
+	}
+
+	if err != nil {
+		for _, a := range attachments {
+			_ = os.Remove(a.File)
+		}
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// unzip calls fn for each regular file of zip archive file
+func unzip(file string, fn func(string, io.Reader) error) error {
+
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(f.Name, rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// untargz calls fn for each regular file of gzipped tar archive file
+func untargz(file string, fn func(string, io.Reader) error) error {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tarball := tar.NewReader(gz)
+
+	for {
+		hdr, err := tarball.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(hdr.Name, tarball); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/mailauth"
+)
+
+// ErrUnauthenticated is recorded on mails whose sender domain is not authenticated by DKIM or SPF
+var ErrUnauthenticated = errors.New("sender domain not authenticated")
+
+// authenticate checks that the domain of the From address of m is authenticated by an aligned DKIM signature
+// or, if accepted, an aligned SPF pass of the host which handed over the raw message
+func (cmd *Command) authenticate(m *Mail, raw []byte) error {
+
+	domains, err := mailauth.VerifyDKIM(raw)
+	for _, domain := range domains {
+		if mailauth.Aligned(m.From, domain) {
+			cmd.logverb("DKIM", m.From, domain)
+			return nil
+		}
+	}
+
+	reason := "DKIM: " + fmt.Sprint(domains)
+	if err != nil {
+		reason = "DKIM: " + err.Error()
+	}
+
+	if cmd.cfg.Auth.SPF {
+		domain := mailauth.ReturnPath(raw)
+		ip := mailauth.SendingIP(raw)
+		if domain != "" && ip != nil && mailauth.Aligned(m.From, domain) {
+			result := mailauth.CheckSPF(ip, domain)
+			if result == mailauth.SPFPass {
+				cmd.logverb("SPF", m.From, domain, ip)
+				return nil
+			}
+			reason += ", SPF: " + domain + " " + ip.String() + " " + result
+		} else {
+			reason += ", SPF: " + mailauth.SPFNone
+		}
+	}
+
+	return fmt.Errorf("%w (%s)", ErrUnauthenticated, reason)
+}
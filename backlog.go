@@ -0,0 +1,223 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/mrccnt/imap-print/imapfetch"
+	"strings"
+	"time"
+)
+
+// MalformedError is returned for a mail which can't be parsed, retrying it in later runs gives the same result
+type MalformedError struct {
+	Err error
+}
+
+// Error implements error
+func (e *MalformedError) Error() string {
+	return "malformed mail: " + e.Err.Error()
+}
+
+// Unwrap returns the parser error
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// Failure is a mail that could not be fetched or parsed in this run
+type Failure struct {
+	Mail *Mail
+	Seq  uint32
+	Err  error
+}
+
+// Backlog records the failed runs of a mail staying in the mailbox
+type Backlog struct {
+	Runs    int       `json:"runs"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Reason  string    `json:"reason"`
+	Alerted bool      `json:"alerted"`
+}
+
+// backlog records the failures of this run and returns the mails of seqset to remove and
+// the UIDs of persistently failing mails to move into the backlog folder
+func (cmd *Command) backlog(seqset *imap.SeqSet, failures []*Failure) (*imap.SeqSet, *imap.SeqSet) {
+
+	stuck := new(imap.SeqSet)
+
+	// Without retries failed mails are removed with everything else
+	if cmd.cfg.Backlog.Runs <= 0 || len(failures) == 0 || cmd.DryRun {
+		return seqset, stuck
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return seqset, stuck
+	}
+
+	now := time.Now()
+	failed := map[uint32]bool{}
+
+	for _, f := range failures {
+
+		failed[f.Seq] = true
+
+		// The mail is not to blame if the login failed
+		if refused(f.Err) {
+			continue
+		}
+
+		// Malformed mails are shelved right away, the next runs would fail the same way
+		var me *MalformedError
+		malformed := errors.As(f.Err, &me)
+		if malformed && cmd.cfg.Backlog.Quarantine != "" {
+			continue
+		}
+
+		key := fmt.Sprintf("%s:%d:%d", cmd.mbox.Name, cmd.mbox.UidValidity, f.Mail.UID)
+
+		b := Backlog{First: now}
+		if _, err := db.get(BucketBacklog, key, &b); err != nil {
+			cmd.logpad("State DB", err.Error())
+		}
+		b.Runs++
+		b.Last = now
+		b.Reason = f.Err.Error()
+
+		cmd.logpad("Backlog", f.Mail.From, f.Mail.Subject, b.Runs, tr("of"), cmd.cfg.Backlog.Runs)
+
+		if b.Runs >= cmd.cfg.Backlog.Runs || malformed {
+			if !b.Alerted {
+				cmd.alert("backlog:"+key, tr("Unprocessable mail in mailbox"), backlogText(f, &b))
+				b.Alerted = true
+			}
+			if cmd.cfg.Backlog.Folder != "" {
+				stuck.AddNum(f.Mail.UID)
+			}
+		}
+
+		if err := db.put(BucketBacklog, key, b); err != nil {
+			cmd.logpad("State DB", err.Error())
+		}
+	}
+
+	// Records of mails which got processed or removed by now are dropped after the dedup retention
+	var expired []string
+	_ = db.each(BucketBacklog, func(key string, data []byte) error {
+		var b Backlog
+		if err := json.Unmarshal(data, &b); err != nil || now.Sub(b.Last) > cmd.cfg.Dedup.Retention {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	for _, key := range expired {
+		_ = db.del(BucketBacklog, key)
+	}
+
+	return imapfetch.Without(seqset, failed), stuck
+}
+
+// quarantined returns the mails of seqset to remove without the mails which can't be parsed or of which an
+// attachment can't be converted, and their UIDs to move into the quarantine folder
+func (cmd *Command) quarantined(seqset *imap.SeqSet, mails []*Mail, failures []*Failure) (*imap.SeqSet, *imap.SeqSet) {
+
+	uids := new(imap.SeqSet)
+	if cmd.cfg.Backlog.Quarantine == "" {
+		return seqset, uids
+	}
+
+	seqs := map[uint32]bool{}
+	quarantine := func(m *Mail, seq uint32, reason string) {
+		cmd.logpad("Quarantine", m.From, m.Subject, reason)
+		seqs[seq] = true
+		uids.AddNum(m.UID)
+	}
+
+	for _, f := range failures {
+		var me *MalformedError
+		if f.Mail != nil && errors.As(f.Err, &me) {
+			quarantine(f.Mail, f.Seq, f.Err.Error())
+		}
+	}
+
+	// Print failures are only known after the mails are removed, failed outcomes are conversion failures by now
+	for _, m := range mails {
+		if m.Rejected != "" || m.Held {
+			continue
+		}
+		for _, o := range m.Outcomes {
+			if o.Status == OutcomeFailed {
+				quarantine(m, m.Seq, o.Name+": "+o.Reason)
+				break
+			}
+		}
+	}
+
+	if len(seqs) == 0 {
+		return seqset, uids
+	}
+
+	return imapfetch.Without(seqset, seqs), uids
+}
+
+// isolate moves the mails with uids into the quarantine folder
+func (cmd *Command) isolate(uids *imap.SeqSet) {
+	cmd.moveMails(uids, cmd.cfg.Backlog.Quarantine, "Quarantine")
+}
+
+// shelve moves the persistently failing mails with uids into the backlog folder
+func (cmd *Command) shelve(uids *imap.SeqSet) {
+
+	cmd.moveMails(uids, cmd.cfg.Backlog.Folder, "Backlog")
+}
+
+// moveMails moves the mails with uids into folder, which is created on first use
+func (cmd *Command) moveMails(uids *imap.SeqSet, folder string, title string) {
+
+	if uids.Empty() || cmd.NoModify {
+		return
+	}
+
+	cmd.logpad(title, tr("Moving to"), folder)
+
+	err := cmd.retry(title, func(c *client.Client) error {
+		err := imapfetch.Move(c, cmd.caps, uids, folder)
+		if err != nil && c.Create(folder) == nil {
+			err = imapfetch.Move(c, cmd.caps, uids, folder)
+		}
+		return err
+	})
+	if err != nil {
+		cmd.logpad("IMAP Move Error", err.Error())
+	}
+}
+
+// backlogText returns the alert text describing the persistently failing mail f
+func backlogText(f *Failure, b *Backlog) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(tr("A mail failed processing in %d runs since %s"), b.Runs, b.First.Format(time.RFC1123)) + "\n\n")
+	text.WriteString(fmt.Sprintf("%-12s %s\n", tr("From")+":", f.Mail.From))
+	text.WriteString(fmt.Sprintf("%-12s %s\n", tr("Subject")+":", f.Mail.Subject))
+	text.WriteString(fmt.Sprintf("%-12s %s\n", tr("Date")+":", f.Mail.Date.Format(time.RFC1123)))
+	text.WriteString(fmt.Sprintf("%-12s %d\n", "UID:", f.Mail.UID))
+	text.WriteString(fmt.Sprintf("%-12s %s\n", tr("Error")+":", f.Err.Error()))
+	return text.String()
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"html"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Name of rendered body documents
+const BodyName = "body.pdf"
+
+// Expressions used to reduce HTML to plain text
+var (
+	reHTMLBlocks = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	reHTMLBreaks = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/h[1-6]|/li)[^>]*>`)
+	reHTMLTags   = regexp.MustCompile(`(?s)<[^>]*>`)
+	reBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// renderBody renders the inline text of m into a PDF document inside the temp dir
+func (cmd *Command) renderBody(m *Mail) (*Attachment, error) {
+
+	file, err := ioutil.TempFile(cmd.TmpDir, "*_"+BodyName)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+
+	if m.HTML != "" && cmd.cfg.HTMLRenderer != RendererNone && cmd.cfg.Body.Layout != LayoutLetter && !cmd.cfg.Body.Strip {
+		err := cmd.renderHTMLString(m.HTML, file.Name())
+		if err == nil {
+			return &Attachment{File: file.Name(), Name: BodyName, Body: true}, nil
+		}
+		cmd.logpad("Render HTML", err.Error())
+	}
+
+	text := m.Body
+	if text == "" {
+		text = htmltext(m.HTML)
+	}
+
+	doc := newPDFDoc(m.Subject)
+	if cmd.cfg.Body.Layout == LayoutLetter {
+		doc = cmd.letter(m, text)
+	} else if cmd.cfg.Body.Strip {
+		doc.text(cmd.strip(m, text))
+	} else {
+		doc.text(text)
+	}
+
+	if err := doc.write(file.Name()); err != nil {
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &Attachment{File: file.Name(), Name: BodyName, Body: true}, nil
+}
+
+// htmltext reduces an HTML document to readable plain text
+func htmltext(s string) string {
+	s = reHTMLBlocks.ReplaceAllString(s, "")
+	s = reHTMLBreaks.ReplaceAllString(s, "\n")
+	s = reHTMLTags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = reBlankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Canary related constants
+const (
+	CanaryHeader = "X-IMAPPrint-Canary"
+	CanaryName   = "canary.txt"
+)
+
+// Canary is an in-flight end-to-end test message
+type Canary struct {
+	ID   string    `json:"id"`
+	Sent time.Time `json:"sent"`
+}
+
+// canaryPending checks if the last canary is overdue and raises an alert
+func (cmd *Command) canaryPending() {
+
+	if cmd.cfg.Canary.Interval <= 0 {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	var c Canary
+	if ok, _ := db.get(BucketCanary, "pending", &c); !ok {
+		return
+	}
+
+	cmd.canary = c.ID
+	cmd.logverb("Canary Pending", c.ID, "sent", c.Sent)
+
+	if time.Since(c.Sent) < cmd.cfg.Canary.SLA {
+		return
+	}
+
+	cmd.alert(
+		"canary",
+		tr("Canary overdue"),
+		fmt.Sprintf(
+			tr("Canary message %s was sent at %s but has not been processed within %s. Mail delivery, fetching or printing may be broken."),
+			c.ID, c.Sent.Format(time.RFC1123), cmd.cfg.Canary.SLA,
+		),
+	)
+}
+
+// canaryOf returns the canary id of a mail with the canary header value, empty unless it is the pending canary, so
+// the header can't be used to bypass the filters
+func (cmd *Command) canaryOf(value string) string {
+	if value == "" {
+		return ""
+	}
+	if cmd.canary == "" || value != cmd.canary {
+		cmd.logverb("Canary", "Ignoring unknown canary", value)
+		return ""
+	}
+	return value
+}
+
+// canaryPrint submits a received canary attachment to a dir backend in the temp dir, so the print path is exercised
+// without wasting paper, and verifies the written document
+func (cmd *Command) canaryPrint(attachment *Attachment) {
+
+	dir := filepath.Join(cmd.TmpDir, "canary")
+	defer os.RemoveAll(dir)
+
+	p, err := printer.NewDir(dir, "{{.Name}}")
+	if err != nil {
+		cmd.logpad("Canary", err.Error())
+		return
+	}
+
+	ctx, cancel := cmd.printContext()
+	defer cancel()
+
+	if _, err := p.Submit(ctx, attachment.File, printer.Options{JobName: attachment.jobName(), Name: CanaryName}); err != nil {
+		cmd.logpad("Canary", "Printing canary", attachment.Canary, "failed:", err.Error())
+		return
+	}
+
+	cmd.canaryDone(attachment.Canary, filepath.Join(dir, CanaryName))
+}
+
+// canaryDone verifies the printed canary document file and marks the canary as completed
+func (cmd *Command) canaryDone(id string, file string) {
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	var c Canary
+	if ok, _ := db.get(BucketCanary, "pending", &c); !ok || c.ID != id {
+		cmd.logpad("Canary", "Ignoring unknown canary", id)
+		return
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil || strings.TrimSpace(string(data)) != c.ID {
+		cmd.logpad("Canary", "Attachment of canary", c.ID, "is corrupt")
+		return
+	}
+
+	cmd.logpad("Canary", c.ID, "completed after", time.Since(c.Sent).Round(time.Second))
+
+	if cmd.DryRun {
+		return
+	}
+
+	_ = db.del(BucketCanary, "pending")
+	if err := db.put(BucketCanary, "last", time.Now()); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// canarySend sends a new canary message if none is in flight and the interval has elapsed
+func (cmd *Command) canarySend() {
+
+	if cmd.cfg.Canary.Interval <= 0 || cmd.DryRun {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	var pending Canary
+	if ok, _ := db.get(BucketCanary, "pending", &pending); ok {
+		return
+	}
+
+	var last time.Time
+	if ok, _ := db.get(BucketCanary, "last", &last); ok && time.Since(last) < cmd.cfg.Canary.Interval {
+		return
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		cmd.logpad("Canary", err.Error())
+		return
+	}
+
+	c := &Canary{ID: hex.EncodeToString(id), Sent: time.Now()}
+
+	to := cmd.cfg.Canary.To
+	if to == "" {
+		to = cmd.cfg.IMAP.User
+	}
+
+	if err := cmd.smtpsend([]string{to}, canaryMessage(c, cmd.cfg.SMTP.From, to)); err != nil {
+		cmd.logpad("Canary", err.Error())
+		cmd.alert("canary-send", tr("Canary could not be sent"), err.Error())
+		return
+	}
+
+	cmd.logpad("Canary", "Sent", c.ID, "to", to)
+	cmd.canary = c.ID
+
+	if err := db.put(BucketCanary, "pending", c); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// canaryMessage builds the raw canary email with a tiny attachment containing the canary id
+func canaryMessage(c *Canary, from string, to string) []byte {
+
+	var msg bytes.Buffer
+
+	boundary := "imapprint-" + c.ID
+
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: IMAPPrint canary " + c.ID + "\r\n")
+	msg.WriteString("Date: " + c.Sent.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString(CanaryHeader + ": " + c.ID + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString("End-to-end monitoring message of IMAPPrint. It is processed and deleted automatically.\r\n")
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Disposition: attachment; filename=\"" + CanaryName + "\"\r\n\r\n")
+	msg.WriteString(c.ID + "\r\n")
+	msg.WriteString("--" + boundary + "--\r\n")
+
+	return msg.Bytes()
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/emersion/go-imap/client"
+	"github.com/phin1x/go-ipp"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// chaosHit reports if a simulated failure with probability rate should happen now
+func (cmd *Command) chaosHit(rate float64, what string) bool {
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	cmd.logpad("Chaos", what)
+	return true
+}
+
+// chaosIMAP randomly drops the connection of IMAP client c
+func (cmd *Command) chaosIMAP(c *client.Client) {
+	if c != nil && cmd.chaosHit(cmd.cfg.Chaos.IMAPDrop, "Dropping IMAP connection") {
+		_ = c.Terminate()
+	}
+}
+
+// chaosIPP randomly returns a simulated IPP server error
+func (cmd *Command) chaosIPP() error {
+	if cmd.chaosHit(cmd.cfg.Chaos.IPPError, "Simulating IPP server error") {
+		return ipp.HTTPError{Code: http.StatusServiceUnavailable}
+	}
+	return nil
+}
+
+// chaosSlow delays converters by the configured duration
+func (cmd *Command) chaosSlow() {
+	if cmd.cfg.Chaos.Slow > 0 {
+		cmd.logpad("Chaos", "Slowing down converter by", cmd.cfg.Chaos.Slow)
+		time.Sleep(cmd.cfg.Chaos.Slow)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Size of the chunks streamed to clamd
+const clamdChunk = 64 * 1024
+
+// Error variables
+var (
+	ErrInfected   = errors.New("infected")
+	ErrClamdReply = errors.New("unexpected clamd reply")
+)
+
+// scan checks attachment with clamd and quarantines it if infected, it reports if the attachment may be printed
+func (cmd *Command) scan(attachment *Attachment) bool {
+
+	if cmd.cfg.ClamAV.Addr == "" {
+		return true
+	}
+
+	signature, err := cmd.clamdScan(attachment.File)
+	if err != nil {
+		// Files that could not be scanned are never printed
+		cmd.logpad("ClamAV", attachment.Name, err.Error())
+		attachment.failed(fmt.Errorf("virus scan: %w", err))
+		return false
+	}
+	if signature == "" {
+		cmd.logverb("ClamAV", attachment.Name, "OK")
+		return true
+	}
+
+	cmd.logpad("ClamAV", attachment.Name, signature)
+	attachment.failed(fmt.Errorf("%w: %s", ErrInfected, signature))
+
+	dest, err := cmd.quarantine(attachment)
+	if err != nil {
+		cmd.logpad("Quarantine", attachment.Name, err.Error())
+	} else {
+		cmd.logverb("Quarantine", dest)
+	}
+
+	var from, tracking string
+	if attachment.Mail != nil {
+		from, tracking = attachment.Mail.From, attachment.Mail.Tracking
+	}
+	cmd.alert(
+		"clamav:"+tracking+":"+attachment.Name,
+		fmt.Sprintf(tr("Infected attachment from %s"), from),
+		fmt.Sprintf(tr("Attachment %s of mail %s from %s contains %s and has been quarantined to %s."), attachment.Name, tracking, from, signature, dest),
+	)
+
+	return false
+}
+
+// quarantine moves the file of attachment into the quarantine dir and returns its new path
+func (cmd *Command) quarantine(attachment *Attachment) (string, error) {
+
+	if err := os.MkdirAll(cmd.cfg.ClamAV.Quarantine, 0700); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(attachment.File)
+	if attachment.Mail != nil {
+		name = attachment.Mail.Tracking + "-" + name
+	}
+	dest := filepath.Join(cmd.cfg.ClamAV.Quarantine, name)
+
+	if err := os.Rename(attachment.File, dest); err != nil {
+		// The temp dir may be on another device
+		if err := copyFile(attachment.File, dest); err != nil {
+			return "", err
+		}
+		_ = os.Remove(attachment.File)
+	}
+
+	return dest, os.Chmod(dest, 0400)
+}
+
+// clamdScan streams file to clamd and returns the found signature, empty if the file is clean
+func (cmd *Command) clamdScan(file string) (string, error) {
+
+	network, addr, err := clamdAddr(cmd.cfg.ClamAV.Addr)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.DialTimeout(network, addr, cmd.cfg.ClamAV.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if cmd.cfg.ClamAV.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(cmd.cfg.ClamAV.Timeout))
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, clamdChunk)
+	size := make([]byte, 4)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return "", err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return clamdResult(strings.TrimRight(reply, "\x00\n"))
+}
+
+// clamdResult parses a clamd INSTREAM reply like "stream: OK" or "stream: Eicar-Signature FOUND"
+func clamdResult(reply string) (string, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return "", errors.New(strings.TrimSuffix(reply, " ERROR"))
+	}
+	return "", fmt.Errorf("%w: %q", ErrClamdReply, reply)
+}
+
+// clamdAddr returns network and address of "tcp://host:port", "unix:///path" or a plain socket path
+func clamdAddr(addr string) (string, string, error) {
+	if strings.HasPrefix(addr, "/") {
+		return "unix", addr, nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return "tcp", u.Host, nil
+	case "unix":
+		return "unix", u.Path, nil
+	}
+	return "", "", fmt.Errorf("unsupported clamd address %q", addr)
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// LabelPrefix marks the match of routing rules applying to documents classified with a label, e.g. "label=invoice"
+const LabelPrefix = "label="
+
+// ClassifyRequest is posted to the classification endpoint or passed as JSON on stdin to the classifier command
+type ClassifyRequest struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Tracking    string    `json:"tracking"`
+	From        string    `json:"from"`
+	Subject     string    `json:"subject"`
+	Date        time.Time `json:"date"`
+	Text        string    `json:"text"`
+}
+
+// ClassifyResponse is the answer of the classifier
+type ClassifyResponse struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// classify labels attachment with the document class returned by the classifier and reports if it may be printed
+func (cmd *Command) classify(attachment *Attachment) bool {
+
+	if cmd.cfg.Classify.Hook == "" || attachment.Label != "" {
+		return true
+	}
+
+	req := &ClassifyRequest{
+		Name:        attachment.Name,
+		ContentType: attachment.ContentType,
+		Text:        cmd.extractText(attachment.File),
+	}
+	if m := attachment.Mail; m != nil {
+		req.Tracking = m.Tracking
+		req.From = m.From
+		req.Subject = m.Subject
+		req.Date = m.Date
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.Classify.Timeout)
+	defer cancel()
+
+	var resp *ClassifyResponse
+	var err error
+	if strings.HasPrefix(cmd.cfg.Classify.Hook, "http://") || strings.HasPrefix(cmd.cfg.Classify.Hook, "https://") {
+		resp, err = cmd.classifyHTTP(ctx, req)
+	} else {
+		resp, err = cmd.classifyExec(ctx, attachment.File, req)
+	}
+
+	// Classification is a hint only, documents are printed as before if it fails
+	if err != nil {
+		cmd.logpad("Classify", attachment.jobName(), err.Error())
+		return true
+	}
+
+	attachment.Label = strings.ToLower(strings.TrimSpace(resp.Label))
+	cmd.logverb("Classify", attachment.jobName(), attachment.Label, resp.Confidence)
+
+	if attachment.Label != "" && inArrStr(attachment.Label, cmd.cfg.Classify.Skip) {
+		cmd.logpad("Skipping", attachment.jobName(), attachment.Label)
+		attachment.skipped(fmt.Sprintf(tr("classified as %s"), attachment.Label))
+		return false
+	}
+
+	return true
+}
+
+// classifyHTTP posts req as JSON to the classification endpoint
+func (cmd *Command) classifyHTTP(ctx context.Context, req *ClassifyRequest) (*ClassifyResponse, error) {
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequest(http.MethodPost, cmd.cfg.Classify.Hook, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	if cmd.cfg.Classify.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+cmd.cfg.Classify.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var res ClassifyResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// classifyExec runs the classifier command with req as JSON on stdin, it answers with a JSON object or the plain
+// label on the first line of its output
+func (cmd *Command) classifyExec(ctx context.Context, file string, req *ClassifyRequest) (*ClassifyResponse, error) {
+
+	var args []string
+	for _, arg := range strings.Fields(cmd.cfg.Classify.Hook) {
+		args = append(args, strings.Replace(arg, "{in}", file, -1))
+	}
+
+	stdin, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdin = bytes.NewReader(stdin)
+
+	out, err := c.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var res ClassifyResponse
+	if json.Unmarshal(out, &res) == nil {
+		return &res, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	if scanner.Scan() {
+		res.Label = scanner.Text()
+	}
+
+	return &res, nil
+}
+
+// ruleMatches checks if the match of a routing rule applies to attachment, either by its label or by its sender
+func ruleMatches(match string, attachment *Attachment) bool {
+
+	if strings.HasPrefix(match, LabelPrefix) {
+		return strings.EqualFold(strings.TrimPrefix(match, LabelPrefix), attachment.Label)
+	}
+
+	sender := ""
+	if attachment.Mail != nil {
+		sender = attachment.Mail.From
+	}
+
+	return senderMatches(match, sender)
+}
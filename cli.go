@@ -0,0 +1,1111 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/mrccnt/imap-print/config"
+	"github.com/urfave/cli/v2"
+	"strings"
+)
+
+// Some constants
+const (
+	// Options/Argument names
+	ArgAddr       = "addr"
+	ArgUser       = "user"
+	ArgPass       = "pass"
+	ArgMbox       = "mbox"
+	ArgPrt        = "printer"
+	ArgDry        = "dry-run"
+	ArgAllowed    = "allowed"
+	ArgExtensions = "extensions"
+	ArgVerbose    = "verbose"
+	ArgStateDB    = "state-db"
+	ArgAlertHook  = "alert-webhook"
+	ArgEventHook  = "event-webhook"
+	ArgAlertSlack = "alert-slack"
+	ArgAlertEmail = "alert-email"
+	ArgSMTPAddr   = "smtp-addr"
+	ArgSMTPUser   = "smtp-user"
+	ArgSMTPPass   = "smtp-pass"
+	ArgSMTPFrom   = "smtp-from"
+	ArgPrintBody  = "print-body"
+	ArgNoAttach   = "no-attachments"
+	ArgCanary     = "canary-interval"
+	ArgRenderer   = "html-renderer"
+	ArgChaosIMAP  = "chaos-imap-drop"
+	ArgChaosIPP   = "chaos-ipp-error"
+	ArgChaosSlow  = "chaos-slow"
+	ArgOffice     = "office-converter"
+	ArgImageMode  = "image-mode"
+	ArgPaper      = "paper"
+	ArgLocale     = "locale"
+	ArgMDN        = "mdn"
+	ArgArchives   = "extract-archives"
+	ArgMaxAttach  = "max-attachment-size"
+	ArgMaxMail    = "max-mail-size"
+	ArgMaxPages   = "max-pages"
+	ArgDuplex     = "duplex"
+	ArgCover      = "cover"
+	ArgSeparator  = "separator"
+	ArgStamp      = "stamp"
+	ArgConfig     = "config"
+	ArgBandwidth  = "max-bandwidth"
+	ArgConfirm    = "confirm"
+	ArgAdminEmail = "admin-email"
+	ArgPolicy     = "policy"
+	ArgLayout     = "body-layout"
+	ArgKeep       = "keep"
+	ArgUnseen     = "unseen"
+	ArgSince      = "since"
+	ArgRole       = "role"
+	ArgLimit      = "limit"
+	ArgIMAPTime   = "imap-timeout"
+	ArgCACert     = "imap-ca-cert"
+	ArgClientCert = "imap-client-cert"
+	ArgClientKey  = "imap-client-key"
+	ArgInsecure   = "imap-insecure-skip-verify"
+	ArgTLSMin     = "imap-tls-min"
+	ArgProxy      = "imap-proxy"
+	ArgPrintTime  = "print-timeout"
+	ArgBackend    = "print-backend"
+	ArgOutput     = "output-dir"
+	ArgNotify     = "notify"
+	ArgHookPre    = "hook-pre-print"
+	ArgClassify   = "classify"
+	ArgClamd      = "clamd"
+	ArgFolders    = "folders"
+	ArgDedupDocs  = "dedup-content"
+	ArgDKIM       = "require-dkim"
+	ArgSPF        = "accept-spf"
+	ArgNoModify   = "no-modify"
+	ArgNoPrint    = "no-print"
+	ArgNoArchive  = "no-archive"
+	ArgNoNotify   = "no-notify"
+	ArgSMIMECert  = "smime-cert"
+	ArgSMIMEKey   = "smime-key"
+	ArgPauseFile  = "pause-file"
+	ArgReport     = "report-file"
+	ArgMetrics    = "metrics-file"
+	ArgDropURL    = "drop-url"
+	ArgHoldDelay  = "hold-delay"
+	ArgPGPHome    = "pgp-home"
+	ArgForce      = "force"
+	ArgAccept     = "accept-risk"
+	// Default mailbox name
+	MailboxName = "INBOX"
+)
+
+// Main runs the imap-print command line application with args
+func Main(args []string) error {
+
+	if err := config.Dotenv(); err != nil {
+		return err
+	}
+
+	setLocale(detectLocale(args))
+
+	cmd := &Command{}
+
+	app := cli.NewApp()
+	app.Name = "IMAPPrint"
+	app.Version = "1.0.0"
+	app.Usage = tr("Query emails and print attachments")
+	app.Before = cmd.bootstrap
+	app.Action = cmd.action
+	app.Flags = cmd.flags()
+	app.Commands = cmd.commands()
+
+	return app.Run(args)
+}
+
+// action is used as callable for applications Action()
+//goland:noinspection GoUnusedParameter
+func (cmd *Command) action(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	if code, err := cmd.exit(cmd.Run()); code != ExitOK {
+		return cli.NewExitError(err, code)
+	}
+
+	return nil
+}
+
+// dryRunScope lists the enabled dry-run scopes
+func (cmd *Command) dryRunScope() []string {
+	var scope []string
+	for _, s := range []struct {
+		on   bool
+		name string
+	}{
+		{cmd.NoModify, ArgNoModify},
+		{cmd.NoPrint, ArgNoPrint},
+		{cmd.NoArchive, ArgNoArchive},
+		{cmd.NoNotify, ArgNoNotify},
+	} {
+		if s.on {
+			scope = append(scope, s.name)
+		}
+	}
+	return scope
+}
+
+// bootstrap is used as callable for applications Before()
+func (cmd *Command) bootstrap(c *cli.Context) error {
+
+	cmd.c = c
+	cmd.DryRun = c.Bool(ArgDry)
+	cmd.NoModify = c.Bool(ArgNoModify)
+	cmd.NoPrint = c.Bool(ArgNoPrint)
+	cmd.NoArchive = c.Bool(ArgNoArchive)
+	cmd.NoNotify = c.Bool(ArgNoNotify)
+	cmd.Verbose = c.Bool(ArgVerbose)
+
+	if err := cmd.config(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if err := cmd.init(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logverb("IMAP Addr", cmd.cfg.IMAP.Addr)
+	cmd.logverb("IMAP User", cmd.cfg.IMAP.User)
+	cmd.logverb("IMAP Pass", "*****")
+	cmd.logverb("IMAP TLS", cmd.cfg.IMAP.CACert, cmd.cfg.IMAP.ClientCert, cmd.cfg.IMAP.Insecure, cmd.cfg.IMAP.TLSMin)
+	cmd.logverb("IMAP Proxy", cmd.cfg.IMAP.Proxy != "")
+	cmd.logverb("OAuth", cmd.cfg.OAuth.TokenURL)
+	cmd.logverb("Mailbox", cmd.cfg.IMAP.Mailbox)
+	cmd.logverb("Folders", cmd.cfg.IMAP.Folders)
+	cmd.logverb("Printer", cmd.cfg.Cups.Printer)
+	cmd.logverb("Print Backend", cmd.cfg.Cups.Backend, cmd.cfg.Cups.Output)
+	if cmd.NoModify || cmd.NoPrint || cmd.NoArchive || cmd.NoNotify {
+		cmd.logpad("Dry-Run", cmd.DryRun, cmd.dryRunScope())
+	} else {
+		cmd.logverb("Dry-Run", cmd.DryRun)
+	}
+	cmd.logverb("TmpDir", cmd.TmpDir)
+	cmd.logverb("Policy", cmd.cfg.Filter.Policy)
+	cmd.logverb("Allowed", cmd.cfg.Filter.Allowed)
+	cmd.logverb("Denied", cmd.cfg.Filter.Denied)
+	cmd.logverb("Extensions", cmd.cfg.Filter.Extensions)
+	cmd.logverb("Denied Extensions", cmd.cfg.Filter.DeniedExtensions)
+	cmd.logverb("Allowed MIME", cmd.cfg.Filter.AllowedMime)
+	cmd.logverb("Log Fields", cmd.cfg.LogFields)
+	cmd.logverb("Print Body", cmd.cfg.PrintBody)
+	cmd.logverb("No Attachments", cmd.cfg.NoAttach, cmd.cfg.NoAttachTo)
+	cmd.logverb("Body Layout", cmd.cfg.Body.Layout)
+	cmd.logverb("HTML Renderer", cmd.cfg.HTMLRenderer)
+	cmd.logverb("Office Converter", cmd.cfg.Office.Converter)
+	cmd.logverb("Pre-Print Hook", cmd.cfg.Hook.PrePrint)
+	cmd.logverb("Classify", cmd.cfg.Classify.Hook, cmd.cfg.Classify.Skip)
+	cmd.logverb("ClamAV", cmd.cfg.ClamAV.Addr, cmd.cfg.ClamAV.Quarantine)
+	cmd.logverb("Image Mode", cmd.cfg.Image.Mode)
+	cmd.logverb("MDN", cmd.cfg.MDN)
+	cmd.logverb("Confirm", cmd.cfg.Confirm)
+	cmd.logverb("Notify", cmd.cfg.Notify)
+	cmd.logverb("Dedup Content", cmd.cfg.Dedup.Content)
+	cmd.logverb("Sender Auth", cmd.cfg.Auth.RequireDKIM, cmd.cfg.Auth.SPF)
+	cmd.logverb("S/MIME", cmd.cfg.SMIME.Cert)
+	cmd.logverb("PGP", cmd.cfg.PGP.Home, cmd.cfg.PGP.Passphrase != "")
+	cmd.logverb("Keep", cmd.cfg.Keep.Enabled, cmd.cfg.Keep.Flag)
+	cmd.logverb("Search", *cmd.cfg.Search)
+	cmd.logverb("Role", cmd.cfg.Queue.Role, cmd.cfg.Queue.Dir)
+	cmd.logverb("Maintenance", cmd.cfg.Maintenance)
+	cmd.logverb("Admin Email", cmd.cfg.Admin.Email)
+	cmd.logverb("Extract Archives", cmd.cfg.Archive.Extract)
+	cmd.logverb("Max Attachment Size", cmd.cfg.MaxAttachmentSize)
+	cmd.logverb("Max Mail Size", cmd.cfg.MaxMailSize)
+	cmd.logverb("Max Pages", cmd.cfg.Pages.Max, cmd.cfg.Pages.Mode)
+	cmd.logverb("Duplex", cmd.cfg.Duplex.Mode, cmd.cfg.Duplex.Rules)
+	cmd.logverb("Cover", cmd.cfg.Cover.Enabled, cmd.cfg.Cover.Template)
+	cmd.logverb("Separator", cmd.cfg.Separator.Enabled, cmd.cfg.Separator.Template)
+	cmd.logverb("Stamp", cmd.cfg.Stamp.Text)
+	cmd.logverb("Max Bandwidth", cmd.cfg.MaxBandwidth)
+	cmd.logverb("Limit", cmd.cfg.Limit)
+	cmd.logverb("Timeouts", cmd.cfg.IMAP.Timeout, cmd.cfg.Cups.Timeout)
+	cmd.logverb("Quota", cmd.cfg.Quota.Jobs, cmd.cfg.Quota.Pages)
+	cmd.logverb("Paper Size", cmd.cfg.Paper)
+	cmd.logverb("State DB", cmd.cfg.StateDB)
+	cmd.logverb("Pause File", cmd.cfg.PauseFile)
+	cmd.logverb("Report File", cmd.cfg.Report)
+	cmd.logverb("Metrics File", cmd.cfg.Metrics)
+	cmd.logverb("Drop Folder", cmd.dropFolder(), cmd.cfg.Drop.Sender)
+	cmd.logverb("Hold", cmd.cfg.Hold.Delay, cmd.cfg.Hold.Match)
+	cmd.logverb("Accepted Risks", cmd.cfg.Force, cmd.cfg.AcceptRisks)
+	cmd.logverb("S3", cmd.cfg.S3.Endpoint, cmd.cfg.S3.Bucket, cmd.cfg.S3.Prefix)
+	cmd.logverb("SMTP Addr", cmd.cfg.SMTP.Addr)
+	cmd.logverb("Alert Webhook", cmd.cfg.Alert.Webhook != "")
+	cmd.logverb("Event Webhook", cmd.cfg.Events.Webhook != "", cmd.cfg.Events.Secret != "")
+	cmd.logverb("Alert Slack", cmd.cfg.Alert.Slack != "")
+	cmd.logverb("Alert Email", cmd.cfg.Alert.Email)
+	cmd.logverb("Canary", cmd.cfg.Canary.Interval)
+	if *cmd.cfg.Chaos != (config.ChaosConfig{}) {
+		cmd.logpad("Chaos", *cmd.cfg.Chaos)
+	}
+
+	return nil
+}
+
+// config loads the configuration and applies the command line flags
+func (cmd *Command) config() error {
+
+	if file := cmd.c.String(ArgConfig); file != "" {
+		if err := config.File(file); err != nil {
+			return err
+		}
+	}
+
+	if err := config.Secrets(); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	cmd.cfg = cfg
+
+	cmd.setarg(ArgAddr)
+	cmd.setarg(ArgUser)
+	cmd.setarg(ArgPrt)
+	cmd.setarg(ArgMbox)
+	cmd.setarg(ArgFolders)
+	cmd.setarg(ArgPrt)
+	cmd.setarg(ArgAllowed)
+	cmd.setarg(ArgExtensions)
+	cmd.setarg(ArgStateDB)
+	cmd.setarg(ArgPauseFile)
+	cmd.setarg(ArgReport)
+	cmd.setarg(ArgMetrics)
+	cmd.setarg(ArgDropURL)
+	cmd.setarg(ArgForce)
+	cmd.setarg(ArgAccept)
+	cmd.setarg(ArgAlertHook)
+	cmd.setarg(ArgEventHook)
+	cmd.setarg(ArgHookPre)
+	cmd.setarg(ArgClassify)
+	cmd.setarg(ArgClamd)
+	cmd.setarg(ArgAlertSlack)
+	cmd.setarg(ArgAlertEmail)
+	cmd.setarg(ArgSMTPAddr)
+	cmd.setarg(ArgSMTPUser)
+	cmd.setarg(ArgSMTPPass)
+	cmd.setarg(ArgSMTPFrom)
+	cmd.setarg(ArgPrintBody)
+	cmd.setarg(ArgNoAttach)
+	cmd.setarg(ArgCanary)
+	cmd.setarg(ArgRenderer)
+	cmd.setarg(ArgOffice)
+	cmd.setarg(ArgMDN)
+	cmd.setarg(ArgNotify)
+	cmd.setarg(ArgDedupDocs)
+	cmd.setarg(ArgDKIM)
+	cmd.setarg(ArgSPF)
+	cmd.setarg(ArgSMIMECert)
+	cmd.setarg(ArgSMIMEKey)
+	cmd.setarg(ArgPGPHome)
+	cmd.setarg(ArgConfirm)
+	cmd.setarg(ArgAdminEmail)
+	cmd.setarg(ArgArchives)
+	cmd.setarg(ArgMaxAttach)
+	cmd.setarg(ArgMaxMail)
+	cmd.setarg(ArgMaxPages)
+	cmd.setarg(ArgDuplex)
+	cmd.setarg(ArgCover)
+	cmd.setarg(ArgSeparator)
+	cmd.setarg(ArgStamp)
+	cmd.setarg(ArgBandwidth)
+	cmd.setarg(ArgImageMode)
+	cmd.setarg(ArgPaper)
+	cmd.setarg(ArgPolicy)
+	cmd.setarg(ArgLayout)
+	cmd.setarg(ArgKeep)
+	cmd.setarg(ArgUnseen)
+	cmd.setarg(ArgSince)
+	cmd.setarg(ArgRole)
+	cmd.setarg(ArgLimit)
+	cmd.setarg(ArgIMAPTime)
+	cmd.setarg(ArgCACert)
+	cmd.setarg(ArgClientCert)
+	cmd.setarg(ArgClientKey)
+	cmd.setarg(ArgInsecure)
+	cmd.setarg(ArgTLSMin)
+	cmd.setarg(ArgProxy)
+	cmd.setarg(ArgPrintTime)
+	cmd.setarg(ArgHoldDelay)
+	cmd.setarg(ArgBackend)
+	cmd.setarg(ArgOutput)
+	cmd.setarg(ArgChaosIMAP)
+	cmd.setarg(ArgChaosIPP)
+	cmd.setarg(ArgChaosSlow)
+
+	return nil
+}
+
+// setarg fetches current command flags from cli context and overwrites settings where applicable
+func (cmd *Command) setarg(name string) {
+
+	v := strings.TrimSpace(cmd.c.String(name))
+	if v == "" {
+		return
+	}
+
+	switch true {
+	case name == ArgAddr && v != "":
+		cmd.cfg.IMAP.Addr = v
+	case name == ArgUser && v != "":
+		cmd.cfg.IMAP.User = v
+	case name == ArgPass && v != "":
+		cmd.cfg.IMAP.Pass = v
+	case name == ArgMbox && v != "" && v != MailboxName:
+		cmd.cfg.IMAP.Mailbox = v
+	case name == ArgFolders && v != "":
+		cmd.cfg.IMAP.Folders = strings.Split(v, ";")
+	case name == ArgPrt && v != "":
+		cmd.cfg.Cups.Printer = v
+	case name == ArgAllowed && v != "":
+		cmd.cfg.Filter.Allowed = strings.Split(v, ":")
+	case name == ArgExtensions && v != "":
+		cmd.cfg.Filter.Extensions = strings.Split(v, ":")
+	case name == ArgStateDB && v != "":
+		cmd.cfg.StateDB = v
+	case name == ArgPauseFile && v != "":
+		cmd.cfg.PauseFile = v
+	case name == ArgReport && v != "":
+		cmd.cfg.Report = v
+	case name == ArgMetrics && v != "":
+		cmd.cfg.Metrics = v
+	case name == ArgDropURL && v != "":
+		cmd.cfg.Drop.URL = v
+	case name == ArgAccept && v != "":
+		cmd.cfg.AcceptRisks = strings.Split(v, ":")
+	case name == ArgEventHook && v != "":
+		cmd.cfg.Events.Webhook = v
+	case name == ArgHookPre && v != "":
+		cmd.cfg.Hook.PrePrint = v
+	case name == ArgClassify && v != "":
+		cmd.cfg.Classify.Hook = v
+	case name == ArgClamd && v != "":
+		cmd.cfg.ClamAV.Addr = v
+	case name == ArgSMIMECert && v != "":
+		cmd.cfg.SMIME.Cert = v
+	case name == ArgSMIMEKey && v != "":
+		cmd.cfg.SMIME.Key = v
+	case name == ArgPGPHome && v != "":
+		cmd.cfg.PGP.Home = v
+	case name == ArgAlertHook && v != "":
+		cmd.cfg.Alert.Webhook = v
+	case name == ArgAlertSlack && v != "":
+		cmd.cfg.Alert.Slack = v
+	case name == ArgAlertEmail && v != "":
+		cmd.cfg.Alert.Email = strings.Split(v, ":")
+	case name == ArgAdminEmail && v != "":
+		cmd.cfg.Admin.Email = strings.Split(v, ":")
+	case name == ArgSMTPAddr && v != "":
+		cmd.cfg.SMTP.Addr = v
+	case name == ArgSMTPUser && v != "":
+		cmd.cfg.SMTP.User = v
+	case name == ArgSMTPPass && v != "":
+		cmd.cfg.SMTP.Pass = v
+	case name == ArgSMTPFrom && v != "":
+		cmd.cfg.SMTP.From = v
+	case name == ArgPrintBody && cmd.c.IsSet(name):
+		cmd.cfg.PrintBody = cmd.c.Bool(name)
+	case name == ArgNoAttach && v != "":
+		cmd.cfg.NoAttach = v
+	case name == ArgRenderer && v != "":
+		cmd.cfg.HTMLRenderer = v
+	case name == ArgOffice && v != "":
+		cmd.cfg.Office.Converter = v
+	case name == ArgImageMode && v != "":
+		cmd.cfg.Image.Mode = v
+	case name == ArgPaper && v != "":
+		cmd.cfg.Paper = strings.ToLower(v)
+	case name == ArgLayout && v != "":
+		cmd.cfg.Body.Layout = strings.ToLower(v)
+	case name == ArgRole && v != "":
+		cmd.cfg.Queue.Role = strings.ToLower(v)
+	case name == ArgPolicy && v != "":
+		cmd.cfg.Filter.Policy = strings.ToLower(v)
+	case name == ArgChaosIMAP && cmd.c.IsSet(name):
+		cmd.cfg.Chaos.IMAPDrop = cmd.c.Float64(name)
+	case name == ArgChaosIPP && cmd.c.IsSet(name):
+		cmd.cfg.Chaos.IPPError = cmd.c.Float64(name)
+	case name == ArgChaosSlow && cmd.c.IsSet(name):
+		cmd.cfg.Chaos.Slow = cmd.c.Duration(name)
+	case name == ArgArchives && cmd.c.IsSet(name):
+		cmd.cfg.Archive.Extract = cmd.c.Bool(name)
+	case name == ArgMaxAttach && cmd.c.IsSet(name):
+		cmd.cfg.MaxAttachmentSize = cmd.c.Int64(name)
+	case name == ArgMaxMail && cmd.c.IsSet(name):
+		cmd.cfg.MaxMailSize = cmd.c.Int64(name)
+	case name == ArgStamp && v != "":
+		cmd.cfg.Stamp.Text = v
+	case name == ArgSeparator && cmd.c.IsSet(name):
+		cmd.cfg.Separator.Enabled = cmd.c.Bool(name)
+	case name == ArgCover && cmd.c.IsSet(name):
+		cmd.cfg.Cover.Enabled = cmd.c.Bool(name)
+	case name == ArgDuplex && v != "":
+		cmd.cfg.Duplex.Mode = v
+	case name == ArgMaxPages && cmd.c.IsSet(name):
+		cmd.cfg.Pages.Max = cmd.c.Int(name)
+	case name == ArgLimit && cmd.c.IsSet(name):
+		cmd.cfg.Limit = cmd.c.Int(name)
+	case name == ArgIMAPTime && cmd.c.IsSet(name):
+		cmd.cfg.IMAP.Timeout = cmd.c.Duration(name)
+	case name == ArgCACert && v != "":
+		cmd.cfg.IMAP.CACert = v
+	case name == ArgClientCert && v != "":
+		cmd.cfg.IMAP.ClientCert = v
+	case name == ArgClientKey && v != "":
+		cmd.cfg.IMAP.ClientKey = v
+	case name == ArgInsecure && cmd.c.IsSet(name):
+		cmd.cfg.IMAP.Insecure = cmd.c.Bool(name)
+	case name == ArgTLSMin && v != "":
+		cmd.cfg.IMAP.TLSMin = v
+	case name == ArgProxy && v != "":
+		cmd.cfg.IMAP.Proxy = v
+	case name == ArgPrintTime && cmd.c.IsSet(name):
+		cmd.cfg.Cups.Timeout = cmd.c.Duration(name)
+	case name == ArgHoldDelay && cmd.c.IsSet(name):
+		cmd.cfg.Hold.Delay = cmd.c.Duration(name)
+	case name == ArgBackend && v != "":
+		cmd.cfg.Cups.Backend = v
+	case name == ArgOutput && v != "":
+		cmd.cfg.Cups.Output = v
+	case name == ArgBandwidth && cmd.c.IsSet(name):
+		cmd.cfg.MaxBandwidth = cmd.c.Int64(name)
+	case name == ArgKeep && cmd.c.IsSet(name):
+		cmd.cfg.Keep.Enabled = cmd.c.Bool(name)
+	case name == ArgUnseen && cmd.c.IsSet(name):
+		cmd.cfg.Search.Unseen = cmd.c.Bool(name)
+	case name == ArgSince && cmd.c.IsSet(name):
+		cmd.cfg.Search.Since = cmd.c.Duration(name)
+	case name == ArgConfirm && cmd.c.IsSet(name):
+		cmd.cfg.Confirm = cmd.c.Bool(name)
+	case name == ArgMDN && cmd.c.IsSet(name):
+		cmd.cfg.MDN = cmd.c.Bool(name)
+	case name == ArgForce && cmd.c.IsSet(name):
+		cmd.cfg.Force = cmd.c.Bool(name)
+	case name == ArgNotify && cmd.c.IsSet(name):
+		cmd.cfg.Notify = cmd.c.Bool(name)
+	case name == ArgDedupDocs && cmd.c.IsSet(name):
+		cmd.cfg.Dedup.Content = cmd.c.Bool(name)
+	case name == ArgDKIM && cmd.c.IsSet(name):
+		cmd.cfg.Auth.RequireDKIM = cmd.c.Bool(name)
+	case name == ArgSPF && cmd.c.IsSet(name):
+		cmd.cfg.Auth.SPF = cmd.c.Bool(name)
+	case name == ArgCanary && cmd.c.IsSet(name):
+		cmd.cfg.Canary.Interval = cmd.c.Duration(name)
+	}
+}
+
+// flags retutns current command flags
+func (cmd *Command) flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     ArgConfig,
+			Usage:    tr("Load settings from the YAML or JSON `FILE`, environment and flags take precedence"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAddr,
+			Aliases:  []string{"a"},
+			Usage:    tr("The IMAP server address `HOST:PORT`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgUser,
+			Aliases:  []string{"u"},
+			Usage:    tr("The IMAP account `USER`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgPass,
+			Aliases:  []string{"p"},
+			Usage:    tr("The IMAP account `PASS`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgMbox,
+			Aliases:  []string{"m"},
+			Usage:    tr("The mailbox `NAME`"),
+			Required: false,
+			Value:    MailboxName,
+		},
+		&cli.StringFlag{
+			Name:     ArgFolders,
+			Usage:    tr("Process the semicolon separated `FOLDERS` (NAME[:PRIORITY[:BUDGET]]) lowest priority first instead of the mailbox"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgPrt,
+			Aliases:  []string{"prt"},
+			Usage:    tr("The cups `PRINTER` name"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAllowed,
+			Aliases:  []string{"all"},
+			Usage:    tr("List of allowed sender email `ADRESSES` seperated by \":\""),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgExtensions,
+			Aliases:  []string{"xt"},
+			Usage:    tr("List of allowed `EXTENSIONS` seperated by \":\""),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgStateDB,
+			Usage:    tr("State database `FILE` (alert cooldowns, ...)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgPauseFile,
+			Usage:    tr("Fetch and print nothing while `FILE` exists"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgReport,
+			Usage:    tr("Write a JSON record of the run (decisions, jobs, errors, timings) to `FILE`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgMetrics,
+			Usage:    tr("Write Prometheus metrics of all runs to `FILE`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgDropURL,
+			Usage:    tr("Also print the documents of the FTP, FTPS or SFTP drop folder `URL`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAccept,
+			Usage:    tr("Acknowledge the colon separated risky configuration `RULES` found by the lint pass"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgForce,
+			Usage:    tr("Run despite risky configurations found by the lint pass"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAlertHook,
+			Usage:    tr("Alerts are posted as JSON to webhook `URL`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgEventHook,
+			Usage:    tr("Job lifecycle events are posted as JSON to webhook `URL`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgHookPre,
+			Usage:    tr("Run `CMD` for every attachment before printing, a non-zero exit skips it"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgClassify,
+			Usage:    tr("Classify every attachment with the HTTP endpoint or command `HOOK` (experimental)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgClamd,
+			Usage:    tr("Scan every attachment with clamd at `ADDR` (tcp://host:port or unix socket path)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgSMIMECert,
+			Usage:    tr("Decrypt S/MIME encrypted mails addressed to the PEM certificate `FILE`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgSMIMEKey,
+			Usage:    tr("PEM private key `FILE` of the S/MIME certificate"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgPGPHome,
+			Usage:    tr("Decrypt OpenPGP encrypted mails and attachments with the GnuPG keyring in `DIR`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAlertSlack,
+			Usage:    tr("Alerts are posted to slack incoming webhook `URL`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAlertEmail,
+			Usage:    tr("Alerts are mailed to `ADDRESSES` seperated by \":\""),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgSMTPAddr,
+			Usage:    tr("The SMTP server address `HOST:PORT` for outgoing mail"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgSMTPUser,
+			Usage:    tr("The SMTP account `USER`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgSMTPPass,
+			Usage:    tr("The SMTP account `PASS`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgSMTPFrom,
+			Usage:    tr("The sender `ADDRESS` of outgoing mail"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgPrintBody,
+			Usage:    tr("Print the email text of mails without attachments"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgNoAttach,
+			Usage:    tr("Handle mails of allowed senders without printable attachments by `POLICY` (delete, ignore, keep, forward, body)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgLayout,
+			Usage:    tr("Print mail bodies in `LAYOUT` plain or letter (letterhead, quotes stripped)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgRenderer,
+			Usage:    tr("The `RENDERER` converting HTML to PDF (wkhtmltopdf, chrome, none)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgOffice,
+			Usage:    tr("Convert office documents to PDF with `CONVERTER` (libreoffice, unoconv or a command)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgImageMode,
+			Usage:    tr("Place images on the page by `MODE` (fit, fill, dpi)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgPolicy,
+			Usage:    tr("Filter `POLICY`: strict (print allowed only), lenient (print all but denied), report (log decisions only)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgPaper,
+			Usage:    tr("The paper `SIZE` of generated documents (a3, a4, a5, letter, legal)"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgArchives,
+			Usage:    tr("Extract .zip and .tar.gz attachments and print the contained files"),
+			Required: false,
+		},
+		&cli.Int64Flag{
+			Name:     ArgMaxAttach,
+			Usage:    tr("Skip attachments larger than `BYTES` (0 = unlimited)"),
+			Required: false,
+		},
+		&cli.Int64Flag{
+			Name:     ArgMaxMail,
+			Usage:    tr("Reject mails larger than `BYTES` (0 = unlimited)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgStamp,
+			Usage:    tr("Stamp every page of PDF documents with `TEXT`, a template with the fields of cover pages"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgSeparator,
+			Usage:    tr("Print a separator page with sender and subject between the documents of a run"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgCover,
+			Usage:    tr("Print a cover page with sender, subject, date and page count before every document"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgDuplex,
+			Usage:    tr("Duplex `MODE`: off, long or short binding edge, auto (short edge for landscape documents)"),
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     ArgMaxPages,
+			Usage:    tr("Skip (or truncate, see MAX_PAGES_MODE) PDF documents with more than `PAGES` pages (0 = unlimited)"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgKeep,
+			Aliases:  []string{"no-delete"},
+			Usage:    tr("Keep mails on the server and mark them with KEEP_FLAG (default $Printed) instead of deleting them"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgUnseen,
+			Usage:    tr("Only fetch mails not marked as seen"),
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     ArgSince,
+			Usage:    tr("Only fetch mails received within the last `DURATION`"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgRole,
+			Usage:    tr("Run as `ROLE` all, fetch (queue documents) or print (print queued documents)"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgConfirm,
+			Usage:    tr("Reply to allowed senders whether their mail has been printed"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgAdminEmail,
+			Usage:    tr("Rejected and failed mails are reported to `ADDRESSES` seperated by \":\""),
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     ArgLimit,
+			Usage:    tr("Process the mailbox in batches of `N` mails (0 = all at once)"),
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     ArgIMAPTime,
+			Usage:    tr("Give up on IMAP dial, login and commands after `DURATION` (0 = never)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgCACert,
+			Usage:    tr("Trust the CAs of PEM bundle `FILE` for the IMAP server in addition to the system roots"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgClientCert,
+			Usage:    tr("Present the PEM certificate `FILE` to the IMAP server (mutual TLS)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgClientKey,
+			Usage:    tr("PEM key `FILE` of the IMAP client certificate"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgInsecure,
+			Usage:    tr("Do not verify the certificate of the IMAP server"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgTLSMin,
+			Usage:    tr("Require at least TLS `VERSION` (1.0, 1.1, 1.2, 1.3) for IMAP"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgProxy,
+			Usage:    tr("Connect to the IMAP server through the SOCKS5 or HTTP proxy `URL` (none ignores ALL_PROXY)"),
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     ArgPrintTime,
+			Usage:    tr("Give up on IPP requests to cups after `DURATION` (0 = never)"),
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     ArgHoldDelay,
+			Usage:    tr("Submit print jobs held and let the print server release them after `DURATION` (0 = print right away)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgBackend,
+			Usage:    tr("Submit documents with `BACKEND` (cups, lp, dir, ipp)"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgOutput,
+			Usage:    tr("Write documents into `DIR` instead of printing them (dir backend)"),
+			Required: false,
+		},
+		&cli.Int64Flag{
+			Name:     ArgBandwidth,
+			Usage:    tr("Limit IMAP downloads to `BYTES` per second (0 = unlimited)"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgMDN,
+			Usage:    tr("Send read receipts (MDN) to allowed senders requesting them"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgNotify,
+			Usage:    tr("Show desktop notifications for printed and failed mails when run in a terminal"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgDedupDocs,
+			Usage:    tr("Print documents with the same content only once, later copies are linked to the first job"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgDKIM,
+			Usage:    tr("Only accept mails with a valid DKIM signature of the sender domain"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgSPF,
+			Usage:    tr("With --require-dkim also accept mails passing SPF for the sender domain"),
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     ArgCanary,
+			Usage:    tr("Send a canary mail to ourself every `DURATION` and alert if it is not processed in time"),
+			Required: false,
+		},
+		&cli.Float64Flag{
+			Name:     ArgChaosIMAP,
+			Usage:    tr("Developer: drop IMAP connections with `PROBABILITY` (0-1)"),
+			Required: false,
+			Hidden:   true,
+		},
+		&cli.Float64Flag{
+			Name:     ArgChaosIPP,
+			Usage:    tr("Developer: fail print submissions with `PROBABILITY` (0-1)"),
+			Required: false,
+			Hidden:   true,
+		},
+		&cli.DurationFlag{
+			Name:     ArgChaosSlow,
+			Usage:    tr("Developer: slow down converters by `DURATION`"),
+			Required: false,
+			Hidden:   true,
+		},
+		&cli.BoolFlag{
+			Name:     ArgDry,
+			Aliases:  []string{"d"},
+			Usage:    tr("Execute a dry-run"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgNoModify,
+			Usage:    tr("Dry-run scope: leave mails untouched on the server"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgNoPrint,
+			Usage:    tr("Dry-run scope: do not submit print jobs"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgNoArchive,
+			Usage:    tr("Dry-run scope: do not upload to the object storage archive"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgNoNotify,
+			Usage:    tr("Dry-run scope: send no replies, receipts, notifications, alerts or events"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     ArgLocale,
+			Usage:    tr("The `LOCALE` of help and messages (en, de)"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     ArgVerbose,
+			Aliases:  []string{"vv"},
+			Usage:    tr("Verbose output"),
+			Required: false,
+		},
+	}
+}
+
+// commands returns available sub commands
+func (cmd *Command) commands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  tr("Preview what would be printed from the pending mails without touching flags or printers"),
+			Action: cmd.list,
+		},
+		{
+			Name:   "printers",
+			Usage:  tr("List the printers of the cups server with state, media and duplex support"),
+			Action: cmd.printers,
+		},
+		{
+			Name:   "status",
+			Usage:  tr("Show the last runs, mail counts, queued mails and unfinished print jobs"),
+			Action: cmd.status,
+		},
+		{
+			Name:      "test-print",
+			Usage:     tr("Print a test page or FILE with the configured print options, without IMAP"),
+			ArgsUsage: "[FILE]",
+			Action:    cmd.testprint,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     ArgPrt,
+					Aliases:  []string{"prt"},
+					Usage:    tr("The cups `PRINTER` name"),
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:   "testpage",
+			Usage:  tr("Print a diagnostic page (device attributes, connectivity, config hash)"),
+			Action: cmd.testpage,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     ArgPrt,
+					Aliases:  []string{"prt"},
+					Usage:    tr("The cups `PRINTER` name"),
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:  "history",
+			Usage: tr("Search the history of printed documents"),
+			Subcommands: []*cli.Command{
+				{
+					Name:      "search",
+					Usage:     tr("Find printed documents containing all TERMS (text, sender, subject, file name or tracking id)"),
+					ArgsUsage: "TERMS",
+					Action:    cmd.historySearch,
+				},
+			},
+		},
+		{
+			Name:  "jobs",
+			Usage: tr("Manage print jobs submitted held"),
+			Subcommands: []*cli.Command{
+				{
+					Name:   "held",
+					Usage:  tr("List the held print jobs waiting to be released"),
+					Action: cmd.jobsHeld,
+				},
+				{
+					Name:      "release",
+					Usage:     tr("Print the held job JOB right away"),
+					ArgsUsage: "JOB",
+					Action:    cmd.jobsRelease,
+				},
+				{
+					Name:      "cancel",
+					Usage:     tr("Cancel the held job JOB before it is released"),
+					ArgsUsage: "JOB",
+					Action:    cmd.jobsCancel,
+				},
+			},
+		},
+		{
+			Name:  "auth",
+			Usage: tr("Manage the OAuth authorization of the IMAP account"),
+			Subcommands: []*cli.Command{
+				{
+					Name:   "login",
+					Usage:  tr("Authorize with the device code flow, e.g. on a headless machine"),
+					Action: cmd.authLogin,
+				},
+				{
+					Name:   "renew",
+					Usage:  tr("Authorize again with the device code flow after the refresh token was revoked"),
+					Action: cmd.authRenew,
+				},
+			},
+		},
+		{
+			Name:   "migrate",
+			Usage:  tr("Upgrade the state database and queue directory written by older versions"),
+			Action: cmd.migrateCommand,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:     ArgDry,
+					Usage:    tr("Only list the pending migrations"),
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:  "config",
+			Usage: tr("Check or create the configuration"),
+			Subcommands: []*cli.Command{
+				{
+					Name:   "validate",
+					Usage:  tr("Check the configuration, IMAP login, mailboxes and printer without processing mails"),
+					Action: cmd.configValidate,
+				},
+				{
+					Name:   "init",
+					Usage:  tr("Write a commented configuration template"),
+					Action: cmd.configInit,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "output",
+							Value:    ".env",
+							Usage:    tr("Write the template to `FILE`"),
+							Required: false,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "metrics",
+			Usage: tr("Export monitoring resources for the metrics of METRICS_FILE"),
+			Subcommands: []*cli.Command{
+				{
+					Name:   "dashboard",
+					Usage:  tr("Print a Grafana dashboard of the metrics as JSON"),
+					Action: cmd.metricsDashboard,
+				},
+			},
+		},
+		{
+			Name:   "support-bundle",
+			Usage:  tr("Collect redacted config, logs, history and probes into a tarball for bug reports"),
+			Action: cmd.supportBundle,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "output",
+					Usage:    tr("Write the bundle to `FILE`"),
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:   "digest",
+			Usage:  tr("Show rejection rates and reasons per sender"),
+			Action: cmd.digest,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:     "send",
+					Usage:    tr("Send the digest by email instead of printing it"),
+					Required: false,
+				},
+			},
+		},
+	}
+}
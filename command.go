@@ -0,0 +1,1326 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message/mail"
+	"github.com/mrccnt/imap-print/config"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/mrccnt/imap-print/imapfetch"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/mrccnt/imap-print/smime"
+	"github.com/urfave/cli/v2"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaWarn is the used percentage of the mailbox quota logged as warning
+const QuotaWarn = 90
+
+// Command is the main action and its resources
+type Command struct {
+	c       *cli.Context
+	cfg     *config.Config
+	mclient *client.Client
+	mbox    *imap.MailboxStatus
+	db      *Store
+	mq      Queue
+	caps    *imapfetch.Capabilities
+	smime   *smime.Recipient
+	TmpDir  string
+
+	// Id of the canary message in flight, mails with another canary header are processed like any other
+	canary string
+
+	// Device URIs of the cups queues printed to directly after they rejected a document format
+	fallbacks map[string]string
+
+	// Fields of LOG_FIELDS added to log lines, events, alerts and run reports
+	logFields []*logField
+
+	// Sender profiles of PROFILES
+	profiles []*Profile
+
+	// Run fields rendered once per folder, log lines are written by the converter goroutines as well
+	logMu     sync.Mutex
+	logFolder string
+	logRun    string
+	hostname  string
+
+	// Record of the current run written to the report file
+	runReport *RunReport
+
+	// Outcome of the current run recorded in the state database
+	runState *RunState
+
+	DryRun  bool
+	Verbose bool
+
+	// Scopes of a partial dry-run, all of them are set by DryRun
+	NoModify  bool
+	NoPrint   bool
+	NoArchive bool
+	NoNotify  bool
+}
+
+// Mail is a reduced/simplified mail message
+type Mail struct {
+	Tracking      string
+	UID           uint32
+	Seq           uint32
+	Date          time.Time
+	From          string
+	Subject       string
+	Body          string
+	HTML          string
+	MessageID     string
+	MDNTo         string
+	Canary        string
+	Rejected      string
+	AutoSubmitted string
+	Attachments   []*Attachment
+	Raw           []byte
+	Jobs          []printer.JobID
+	Pages         int
+	Errors        []string
+	Outcomes      []*Outcome
+	Queued        bool
+	Held          bool
+	Quiet         bool
+}
+
+// Attachment is a downloaded email attachment
+type Attachment struct {
+	File        string
+	Name        string
+	ContentType string
+	Type        string
+	Body        bool
+	Canary      string
+	Hash        string
+	DuplicateOf string
+	Label       string
+	Orientation string
+	Seq         int
+	Lead        int
+	Failed      bool
+	Mail        *Mail
+}
+
+// Error variables
+var (
+	ErrNoAttachment  = errors.New("no attachment")
+	ErrInvalidSender = errors.New("invalid sender")
+	ErrAttachSize    = errors.New("attachment too large")
+)
+
+// New returns a Command running with cfg, Close must be called when done
+func New(cfg *config.Config) (*Command, error) {
+
+	cmd := &Command{cfg: cfg}
+	if err := cmd.init(); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// dryRunScopes enables every scope of a partial dry-run if a complete dry-run is requested
+func (cmd *Command) dryRunScopes() {
+	if cmd.DryRun {
+		cmd.NoModify, cmd.NoPrint, cmd.NoArchive, cmd.NoNotify = true, true, true, true
+	}
+}
+
+// init prepares the resources needed by every run
+func (cmd *Command) init() error {
+
+	var err error
+
+	// Report mode never prints or deletes anything
+	if cmd.cfg.Filter.Policy == filter.PolicyReport {
+		cmd.DryRun = true
+	}
+
+	cmd.dryRunScopes()
+
+	if cmd.logFields, err = parseLogFields(cmd.cfg.LogFields); err != nil {
+		return err
+	}
+	if cmd.profiles, err = loadProfiles(cmd.cfg.Profiles); err != nil {
+		return fmt.Errorf("invalid profiles: %s", err.Error())
+	}
+
+	cmd.hostname, _ = os.Hostname()
+	cmd.snapshotFields()
+
+	cmd.TmpDir, err = ioutil.TempDir("", "imap-print-")
+
+	return err
+}
+
+// Run fetches the mails of the configured mailbox and prints their attachments,
+// or prints the queued documents in the print role
+func (cmd *Command) Run() (err error) {
+
+	// DryRun may have been set after New
+	cmd.dryRunScopes()
+
+	paused := false
+
+	cmd.startReport()
+	cmd.startRun()
+	defer func() {
+		cmd.writeReport(err)
+		cmd.recordRun(err)
+		cmd.writeMetrics(err)
+		if !paused {
+			cmd.checkSilence()
+		}
+	}()
+
+	// A paused run is a successful run, nothing is fetched or printed
+	if paused = cmd.paused(); paused {
+		return nil
+	}
+
+	if err := cmd.checkLint(); err != nil {
+		return err
+	}
+
+	if cmd.cfg.Queue.Role == RolePrint {
+		return cmd.printQueue()
+	}
+
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// Without an IMAP server only the drop folder is processed
+	var folders []imapfetch.Folder
+	if !cmd.dropOnly() {
+		if folders, err = cmd.folders(); err != nil {
+			return err
+		}
+	}
+
+	// Loaded before the mails are converted concurrently
+	if err := cmd.loadRecipient(); err != nil {
+		return err
+	}
+
+	if !cmd.dropOnly() {
+		if err := cmd.connect(); err != nil {
+			var oe *OAuthError
+			if errors.As(err, &oe) {
+				cmd.logpad("OAuth", err.Error())
+			}
+			return err
+		}
+	}
+
+	cmd.checkSupplies()
+	cmd.jobsPending()
+	if !cmd.dropOnly() {
+		cmd.canaryPending()
+		cmd.canarySend()
+	}
+
+	if cmd.diskLow() {
+		cmd.logpad("Disk", tr("Processing paused"))
+		return nil
+	}
+
+	// Mails stay on the server while the printer is under maintenance
+	if cmd.cfg.Queue.Role != RoleFetch && !cmd.route() {
+		cmd.logpad("Maintenance", tr("Processing held"))
+		return nil
+	}
+
+	for _, folder := range folders {
+		if err := cmd.processFolder(folder); err != nil {
+			return err
+		}
+	}
+
+	if cmd.dropping() {
+		if err := cmd.processDrop(); err != nil {
+			return err
+		}
+	}
+
+	cmd.historyPrune()
+	cmd.digestSend()
+
+	return nil
+}
+
+// validate validates the configuration of the fetching roles
+func (cmd *Command) validate() error {
+
+	// The fetch role never talks to a printer
+	var except []string
+	if cmd.cfg.Queue.Role == RoleFetch || cmd.printerless() {
+		except = append(except, "Cups.Printer")
+	}
+	if cmd.oauth() {
+		except = append(except, "IMAP.Pass")
+	}
+	if cmd.dropOnly() {
+		except = append(except, "IMAP.Addr", "IMAP.User", "IMAP.Pass")
+	}
+
+	return config.Validate(cmd.cfg, except...)
+}
+
+// folders returns the configured folders in processing order, the mailbox alone if none are configured
+func (cmd *Command) folders() ([]imapfetch.Folder, error) {
+	if len(cmd.cfg.IMAP.Folders) == 0 {
+		return []imapfetch.Folder{{Name: cmd.cfg.IMAP.Mailbox}}, nil
+	}
+	return imapfetch.ParseFolders(cmd.cfg.IMAP.Folders)
+}
+
+// processFolder selects folder and processes its mails until done or its time budget is used up
+func (cmd *Command) processFolder(folder imapfetch.Folder) error {
+
+	defer cmd.reportFolder(folder.Name)()
+
+	if err := cmd.selectFolder(folder.Name); err != nil {
+		return err
+	}
+
+	cmd.logverb("Folder", folder.Name, folder.Priority, folder.Budget)
+
+	if cmd.mbox.Messages == 0 {
+		cmd.logpad("No Messages", tr("Nothing to do..."))
+		return nil
+	}
+
+	var deadline time.Time
+	if folder.Budget > 0 {
+		deadline = time.Now().Add(folder.Budget)
+	}
+
+	// Large mailboxes are processed in batches of LIMIT mails to keep memory and temp dir bounded
+	var last uint32
+	for {
+		count, more, err := cmd.process()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if last > 0 && count >= last {
+			cmd.logpad("Limit", tr("No progress, stopping"))
+			break
+		}
+		// The remaining mails of a folder over budget wait for the next cycle
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			cmd.logpad("Folder", folder.Name, tr("Time budget used up"))
+			break
+		}
+		last = count
+		cmd.cleanup()
+		if err := cmd.selectFolder(folder.Name); err != nil {
+			return err
+		}
+	}
+
+	cmd.cleanup()
+
+	return nil
+}
+
+// selectFolder selects folder read-write, reconnecting if the connection got lost
+func (cmd *Command) selectFolder(folder string) error {
+	return cmd.retry("Select", func(c *client.Client) error {
+		mbox, err := c.Select(folder, false)
+		if err != nil {
+			return err
+		}
+		cmd.setMailbox(mbox)
+		return nil
+	})
+}
+
+// process fetches, prints and removes a batch of at most LIMIT candidate mails,
+// it returns the number of candidates and if more than the batch are left
+func (cmd *Command) process() (uint32, bool, error) {
+
+	var seqset *imap.SeqSet
+	var count uint32
+	err := cmd.retry("Search", func(c *client.Client) (err error) {
+		seqset, count, err = cmd.candidates(c)
+		return err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if count == 0 {
+		cmd.logpad("No Messages", tr("Nothing to do..."))
+		return 0, false, nil
+	}
+
+	total := count
+	more := false
+	if limit := uint32(cmd.cfg.Limit); limit > 0 && count > limit {
+		seqset, count = imapfetch.FirstN(seqset, limit), limit
+		// Nothing is removed without deleting, the next batch would be the same
+		more = !cmd.NoModify
+		cmd.logpad("Limit", count, tr("of"), total)
+	}
+
+	mails, failures, err := cmd.getMails(cmd.mclient, seqset, count)
+	if err != nil {
+		return total, false, err
+	}
+
+	attachments := cmd.getAttachments(mails)
+	cmd.mailEvents(mails)
+
+	if cmd.cfg.Queue.Role == RoleFetch {
+		if attachments, err = cmd.enqueue(attachments); err != nil {
+			return total, false, err
+		}
+	}
+
+	// Recorded before printing, a crash must not lead to printing twice
+	cmd.markProcessed(mails)
+
+	// Failed mails stay in the mailbox to be retried, persistently failing ones are moved aside
+	remove, stuck := cmd.backlog(seqset, failures)
+	remove, held := cmd.held(remove, mails)
+	remove, broken := cmd.quarantined(remove, mails, failures)
+	cmd.delexpunge(remove)
+	cmd.shelve(stuck)
+	cmd.hold(held)
+	cmd.isolate(broken)
+	cmd.doprint(attachments)
+
+	// Queued mails are followed up by the print role
+	all := mails
+	mails = unqueued(mails)
+
+	cmd.sendMDNs(mails)
+	cmd.confirm(mails)
+	cmd.notifyAdmin(mails)
+	cmd.notifyDesktop(mails)
+	cmd.account(mails)
+	cmd.reportMails(all)
+
+	return total, more, nil
+}
+
+// connect dials and logs into the IMAP server and selects the configured mailbox
+func (cmd *Command) connect() error {
+
+	var err error
+
+	cmd.mclient, err = cmd.dial()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.negotiate(cmd.mclient); err != nil {
+		cmd.logpad("Capabilities", err.Error())
+	}
+
+	mbox, err := cmd.mclient.Select(cmd.cfg.IMAP.Mailbox, false)
+	if err != nil {
+		_ = cmd.mclient.Logout()
+		_ = cmd.mclient.Close()
+		cmd.mclient = nil
+		return err
+	}
+	cmd.setMailbox(mbox)
+
+	cmd.mailboxQuota(cmd.mclient)
+
+	return nil
+}
+
+// dial returns a new logged in IMAP client
+func (cmd *Command) dial() (*client.Client, error) {
+
+	c, err := imapfetch.Dial(imapfetch.Options{
+		Addr:      cmd.cfg.IMAP.Addr,
+		Timeout:   cmd.cfg.IMAP.Timeout,
+		Bandwidth: cmd.cfg.MaxBandwidth,
+		TLS: imapfetch.TLSOptions{
+			CACert:             cmd.cfg.IMAP.CACert,
+			ClientCert:         cmd.cfg.IMAP.ClientCert,
+			ClientKey:          cmd.cfg.IMAP.ClientKey,
+			InsecureSkipVerify: cmd.cfg.IMAP.Insecure,
+			MinVersion:         cmd.cfg.IMAP.TLSMin,
+		},
+		Proxy: cmd.cfg.IMAP.Proxy,
+	})
+	if err != nil {
+		return nil, &ConnectError{Err: err}
+	}
+
+	if err := cmd.login(c); err != nil {
+		lost := imapfetch.Lost(c, err)
+		_ = c.Close()
+		if lost {
+			return nil, &ConnectError{Err: err}
+		}
+		return nil, &LoginError{Err: err}
+	}
+
+	return c, nil
+}
+
+// negotiate detects and logs the capabilities of the logged in server and the fallbacks used for missing ones
+func (cmd *Command) negotiate(c *client.Client) error {
+
+	caps, err := imapfetch.Negotiate(c)
+	if err != nil {
+		return err
+	}
+	cmd.caps = caps
+
+	cmd.logverb("Capabilities", strings.Join(caps.Names(), " "))
+
+	for _, f := range imapfetch.Fallbacks {
+		if !caps.Has(f.Name) {
+			cmd.logverb("Fallback", f.Name, f.Fallback)
+		}
+	}
+
+	return nil
+}
+
+// mailboxQuota logs the storage usage of the selected mailbox and warns above QuotaWarn percent
+func (cmd *Command) mailboxQuota(c *client.Client) {
+
+	if !cmd.caps.Has(imapfetch.CapQuota) {
+		return
+	}
+
+	used, limit, err := imapfetch.Quota(c, cmd.cfg.IMAP.Mailbox)
+	if err != nil {
+		cmd.logverb("Mailbox Quota", err.Error())
+		return
+	}
+	if limit == 0 {
+		return
+	}
+
+	percent := int(uint64(used) * 100 / uint64(limit))
+	usage := fmt.Sprintf("%d / %d KiB (%d%%)", used, limit, percent)
+	if percent >= QuotaWarn {
+		cmd.logpad("Mailbox Quota", usage, tr("Mailbox almost full"))
+		return
+	}
+	cmd.logverb("Mailbox Quota", usage)
+}
+
+// getMails fetches emails via IMAP and returns array of simpified *Mail objects and the mails failing to be fetched or parsed
+func (cmd *Command) getMails(c *client.Client, seqset *imap.SeqSet, msgcount uint32) ([]*Mail, []*Failure, error) {
+
+	var section imap.BodySectionName
+	items := []imap.FetchItem{section.FetchItem(), imap.FetchUid}
+
+	var envelopes []*imap.Message
+	err := cmd.retry("Fetch", func(c *client.Client) (err error) {
+		envelopes, err = cmd.fetchEnvelopes(c, seqset, msgcount)
+		return err
+	})
+	if err != nil {
+		return []*Mail{}, nil, err
+	}
+
+	// Bodies are converted by a pool of workers while fetching continues
+	pool := cmd.newConverter(cmd.cfg.Fetch.Workers)
+
+	// Bodies are only fetched for mails passing the filters, large ones separately in chunks
+	// and of mails with attachments only the attachments
+	var large, partial []*imap.Message
+	var bulk []uint32
+	seen := map[uint32]*Mail{}
+	for _, msg := range envelopes {
+		m := cmd.envelopeMail(msg)
+		seen[msg.SeqNum] = m
+		if cmd.isProcessed(m) {
+			continue
+		}
+		if reason := cmd.prefilter(m, msg); reason != "" {
+			cmd.logverb("Prefilter", m.From, m.Subject, reason)
+			m.Rejected = reason
+			if reason == RejectMailSize {
+				cmd.oversized(m, msg.Size)
+			}
+			cmd.unprintable(m)
+			pool.done(m, msg.SeqNum)
+			continue
+		}
+		if cmd.attachmentParts(msg) != nil {
+			partial = append(partial, msg)
+			continue
+		}
+		if cmd.cfg.Fetch.ChunkSize > 0 && msg.Size > uint32(cmd.cfg.Fetch.ChunkSize) {
+			large = append(large, msg)
+			continue
+		}
+		bulk = append(bulk, msg.SeqNum)
+	}
+
+	cmd.chaosIMAP(cmd.mclient)
+
+	// Messages are handed to the workers as they arrive, batches keep the server responses small
+	for _, batch := range imapfetch.Batches(bulk, cmd.cfg.Fetch.BatchSize) {
+
+		// After a lost connection only the mails not received yet are fetched again
+		pending := batch
+		err := cmd.retry("Fetch", func(c *client.Client) error {
+
+			messages := make(chan *imap.Message, cmd.cfg.Fetch.Workers)
+			done := make(chan error, 1)
+
+			go func() {
+				done <- c.Fetch(pending, items, messages)
+			}()
+
+			received := map[uint32]bool{}
+			for msg := range messages {
+				pool.add(msg.SeqNum, msg.Uid, msg.GetBody(&section))
+				received[msg.SeqNum] = true
+			}
+
+			err := <-done
+			pending = imapfetch.Without(pending, received)
+			return err
+		})
+		if err != nil {
+			pool.wait()
+			return []*Mail{}, nil, err
+		}
+	}
+
+	for _, msg := range large {
+		cmd.logpad("Fetch", tr("Chunked"), msg.Uid, msg.Size)
+		body, err := cmd.fetchChunked(msg.Uid, msg.Size)
+		if err != nil {
+			cmd.logpad("Error", err.Error())
+			pool.fail(msg.SeqNum, err)
+			continue
+		}
+		pool.add(msg.SeqNum, msg.Uid, body)
+	}
+
+	for _, msg := range partial {
+		var body *bytes.Buffer
+		err := cmd.retry("Fetch", func(c *client.Client) (err error) {
+			body, err = cmd.fetchParts(c, msg, cmd.attachmentParts(msg))
+			return err
+		})
+		if err != nil {
+			cmd.logpad("Error", err.Error())
+			pool.fail(msg.SeqNum, err)
+			continue
+		}
+		pool.add(msg.SeqNum, msg.Uid, body)
+	}
+
+	mails := pool.wait()
+
+	for _, f := range pool.fails {
+		f.Mail = seen[f.Seq]
+	}
+
+	if mails == nil {
+		return []*Mail{}, pool.fails, nil
+	}
+
+	return mails, pool.fails, nil
+}
+
+// getAttachments returns array of *Attachment from given array of *Mail
+func (cmd *Command) getAttachments(mails []*Mail) []*Attachment {
+
+	var attachments []*Attachment
+
+	for _, m := range mails {
+		if m.Canary != "" {
+			attachments = append(attachments, m.Attachments...)
+			continue
+		}
+		cmd.logmail(m)
+		if m.Rejected != "" {
+			continue
+		}
+		cmd.report(m)
+		f := cmd.filters(m)
+		if !m.isValid(f) {
+			m.Rejected = m.rejection(f)
+			cmd.unprintable(m)
+			continue
+		}
+		var prepared []*Attachment
+		for _, attachment := range m.Attachments {
+
+			if !attachment.isValid(f) {
+				cmd.logpad("Skipping", attachment.Name, attachment.Type)
+				reason := fmt.Sprintf(tr("unsupported file type %s"), attachment.Type)
+				m.Errors = append(m.Errors, attachment.Name+": "+reason)
+				m.outcome(attachment.Name, OutcomeSkipped, 0, reason)
+				continue
+			}
+
+			if !cmd.scan(attachment) {
+				continue
+			}
+
+			attachment, err := cmd.prepare(attachment)
+			if err != nil {
+				cmd.logpad("Convert", attachment.Name, err.Error())
+				m.Errors = append(m.Errors, attachment.Name+": "+err.Error())
+				m.outcome(attachment.Name, OutcomeFailed, 0, err.Error())
+				continue
+			}
+
+			prepared = append(prepared, cmd.splitPages(attachment)...)
+		}
+		prepared = cmd.duplicates(m, prepared)
+		if err := cmd.quota(m, prepared); err != nil {
+			cmd.logpad("Quota", m.From, err.Error())
+			m.Rejected = RejectQuota
+			m.Errors = append(m.Errors, err.Error())
+			continue
+		}
+		attachments = append(attachments, prepared...)
+	}
+
+	if attachments == nil {
+		return []*Attachment{}
+	}
+
+	return attachments
+}
+
+// sniff detects the content type of attachment and adds a file extension if it has none
+func (cmd *Command) sniff(attachment *Attachment) *Attachment {
+
+	sniffed, err := filter.Sniff(attachment.File)
+	if err != nil {
+		cmd.logpad("Sniff", attachment.Name, err.Error())
+		return attachment
+	}
+
+	attachment.Type = sniffed
+
+	// A document named like another printable type, e.g. a JPEG named .pdf by a buggy app, gets the extension of its
+	// content, so it is filtered, converted and printed as what it is
+	ext := filter.FileExt(attachment.File)
+	switch {
+	case ext == "":
+		ext = filter.TypeExtension(sniffed, attachment.ContentType)
+	case printer.DocumentFormats[sniffed] && !filter.MatchesType(ext, sniffed):
+		ext = filter.TypeExtension(sniffed, "")
+	default:
+		return attachment
+	}
+	if ext == "" {
+		return attachment
+	}
+
+	if err := os.Rename(attachment.File, attachment.File+"."+ext); err != nil {
+		cmd.logpad("Sniff", attachment.Name, err.Error())
+		return attachment
+	}
+
+	attachment.File += "." + ext
+	if attachment.Name == "" {
+		attachment.Name = "attachment." + ext
+	}
+
+	cmd.logverb("Sniff", attachment.Name, sniffed)
+
+	return attachment
+}
+
+// prepare runs conversion steps on attachment before printing
+func (cmd *Command) prepare(attachment *Attachment) (*Attachment, error) {
+
+	steps := []func(*Attachment) (*Attachment, error){
+		cmd.renderAttachment,
+		cmd.convertOffice,
+		cmd.normalizeImage,
+		cmd.unlockPDF,
+		cmd.limitPages,
+		cmd.rotatePages,
+		cmd.stampPDF,
+	}
+
+	for _, step := range steps {
+		converted, err := step(attachment)
+		if err != nil {
+			return attachment, err
+		}
+		attachment = converted
+	}
+
+	return attachment, nil
+}
+
+// convert converts the raw message r into simplified *Mail objects
+func (cmd *Command) convert(r imap.Literal) (m *Mail, err error) {
+
+	// A mail crashing the parser fails alone instead of the whole run
+	defer func() {
+		if p := recover(); p != nil {
+			m, err = nil, &MalformedError{fmt.Errorf("%v", p)}
+		}
+	}()
+
+	if r == nil {
+		return nil, ErrNoBody
+	}
+
+	// Measured before anything reads the literal and independent of decryption; bodies of partially fetched mails
+	// are smaller, their RFC822.SIZE was checked by the prefilter
+	size := r.Len()
+
+	// Keep a copy of the original message to forward it to the admin, to verify its signatures or to decrypt it
+	var raw []byte
+	var decryptErr error
+	forward := (len(cmd.cfg.Admin.Email) > 0 && cmd.cfg.Admin.Forward) || cmd.cfg.NoAttach == NoAttachForward
+	if forward || cmd.cfg.Auth.RequireDKIM || cmd.smime != nil || cmd.pgp() {
+		var err error
+		if raw, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+		r = bytes.NewBuffer(raw)
+		decrypted, err := cmd.decryptSMIME(raw)
+		if err == nil && decrypted == nil && cmd.pgp() {
+			decrypted, err = cmd.decryptPGPMIME(raw)
+		}
+		if err != nil {
+			decryptErr = err
+		} else if decrypted != nil {
+			r = bytes.NewBuffer(decrypted)
+		}
+	}
+
+	// Create a new mail reader
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return nil, &MalformedError{err}
+	}
+
+	m = &Mail{
+		Tracking:    trackingID(),
+		Date:        time.Now(),
+		From:        "",
+		Subject:     "",
+		Body:        "",
+		Attachments: []*Attachment{},
+	}
+
+	header := mr.Header
+
+	if date, err := header.Date(); err == nil {
+		m.Date = date
+	}
+	if from, err := header.AddressList("From"); err == nil {
+		for _, f := range from {
+			m.From = f.Address
+			break
+		}
+	}
+	if subject, err := header.Subject(); err == nil {
+		m.Subject = subject
+	}
+	m.Canary = cmd.canaryOf(header.Get(CanaryHeader))
+	m.AutoSubmitted = header.Get(AutoSubmittedHeader)
+	if id, err := header.MessageID(); err == nil {
+		m.MessageID = id
+	}
+	m.MDNTo = cmd.mdnRecipient(header, m.From)
+	if forward {
+		m.Raw = raw
+	}
+	if decryptErr != nil {
+		cmd.logpad("Decrypt", m.Subject, decryptErr.Error())
+		m.Errors = append(m.Errors, tr("Decrypt")+": "+decryptErr.Error())
+	}
+
+	// A forged From header must not pass the allow list
+	if cmd.cfg.Auth.RequireDKIM && m.Canary == "" {
+		if err := cmd.authenticate(m, raw); err != nil {
+			cmd.logpad("Sender Auth", m.From, err.Error())
+			m.Rejected = RejectUnauth
+			m.Errors = append(m.Errors, err.Error())
+			return m, nil
+		}
+	}
+
+	if max := cmd.cfg.MaxMailSize; max > 0 && int64(size) > max {
+		cmd.logpad("Mail Size", m.Subject, size, ">", max)
+		m.Rejected = RejectMailSize
+		m.Errors = append(m.Errors, fmt.Sprintf(tr("mail too large (%d > %d bytes)"), size, max))
+		return m, nil
+	}
+
+	// Process each message's parts
+	for {
+
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			cmd.logpad("Read Message Part", err.Error())
+			break
+		}
+
+		switch h := p.Header.(type) {
+
+		case *mail.InlineHeader:
+
+			// This is the message's text (can be plain-text or HTML)
+			b, err := ioutil.ReadAll(p.Body)
+			if err != nil {
+				cmd.logpad("Read Message Text", err.Error())
+				continue
+			}
+			if ct, _, _ := h.ContentType(); ct == "text/html" {
+				m.HTML = strings.TrimSpace(string(b))
+			} else {
+				m.Body = strings.TrimSpace(string(b))
+			}
+
+		case *mail.AttachmentHeader:
+
+			filename, _ := h.Filename()
+
+			file, err := ioutil.TempFile(cmd.TmpDir, "*_"+filename)
+			if err != nil {
+				cmd.logpad("Create TempFiler", err.Error())
+				continue
+			}
+
+			// Never write more than one byte beyond the limit to disk
+			var body io.Reader = p.Body
+			max := cmd.cfg.MaxAttachmentSize
+			if max > 0 {
+				body = io.LimitReader(p.Body, max+1)
+			}
+
+			n, err := io.Copy(file, body)
+			if err != nil {
+				cmd.logpad("Write Attachment", err.Error())
+				_ = file.Close()
+				continue
+			}
+
+			_ = file.Close()
+			path := file.Name()
+
+			if max > 0 && n > max {
+				_ = os.Remove(path)
+				cmd.logpad("Attachment Size", filename, ">", max)
+				m.Errors = append(m.Errors, filename+": "+fmt.Sprintf(tr("%s (limit %d bytes)"), tr(ErrAttachSize.Error()), max))
+				continue
+			}
+
+			ctype, _, _ := h.ContentType()
+
+			// Encrypted attachments are decrypted before anything looks at their type
+			if cmd.pgp() && isPGPFile(path, filename) {
+				decrypted, name, err := cmd.decryptPGPFile(path, filename)
+				_ = os.Remove(path)
+				if err != nil {
+					cmd.logpad("Decrypt", filename, err.Error())
+					m.Errors = append(m.Errors, filename+": "+err.Error())
+					continue
+				}
+				cmd.logverb("Decrypt", filename, name)
+				path, filename, ctype = decrypted, name, ""
+			}
+
+			if cmd.cfg.Archive.Extract && isArchive(filename) {
+				extracted, err := cmd.extract(m, path, filename)
+				_ = os.Remove(path)
+				if err != nil {
+					cmd.logpad("Archive", filename, err.Error())
+					m.Errors = append(m.Errors, filename+": "+err.Error())
+					continue
+				}
+				for _, a := range extracted {
+					a.Canary = m.Canary
+					a.Mail = m
+					cmd.sniff(a)
+				}
+				m.Attachments = append(m.Attachments, extracted...)
+				continue
+			}
+
+			m.Attachments = append(
+				m.Attachments,
+				cmd.sniff(&Attachment{
+					File:        path,
+					Name:        filename,
+					ContentType: ctype,
+					Canary:      m.Canary,
+					Mail:        m,
+				}),
+			)
+
+		default:
+			cmd.logpad("Unhandled Header", h)
+
+		}
+
+	}
+
+	if cmd.printBody(m) && (m.Body != "" || m.HTML != "") {
+		attachment, err := cmd.renderBody(m)
+		if err != nil {
+			cmd.logpad("Render Body", err.Error())
+		} else {
+			attachment.Mail = m
+			m.Attachments = append(m.Attachments, attachment)
+		}
+	}
+
+	return m, nil
+}
+
+// delexpunge flags read emails as deleted and expunges
+func (cmd *Command) delexpunge(seqset *imap.SeqSet) {
+
+	cmd.logverb("Cleanup", tr("Deleting email(s)"))
+
+	if cmd.NoModify || seqset.Empty() {
+		return
+	}
+
+	cmd.chaosIMAP(cmd.mclient)
+
+	// Sequence numbers are only valid until the next expunge, a retry after reconnecting works on UIDs
+	var uids *imap.SeqSet
+	err := cmd.retry("Cleanup", func(c *client.Client) (err error) {
+		uids, err = imapfetch.UIDs(c, seqset)
+		return err
+	})
+	if err != nil {
+		cmd.logpad("IMAP Fetch Error", err.Error())
+		return
+	}
+
+	if cmd.cfg.Keep.Enabled {
+		cmd.flag(uids)
+		return
+	}
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	flags := []interface{}{imap.DeletedFlag}
+
+	err = cmd.retry("Cleanup", func(c *client.Client) error {
+		return c.UidStore(uids, item, flags, nil)
+	})
+	if err != nil {
+		cmd.logverb("IMAP Store Error", err.Error())
+		return
+	}
+
+	err = cmd.retry("Cleanup", func(c *client.Client) error {
+		return imapfetch.ExpungeUIDs(c, cmd.caps, uids)
+	})
+	if err != nil {
+		cmd.logpad("IMAP Expunge Error", err.Error())
+	}
+}
+
+// doprint loops through attachments and triggers the print
+func (cmd *Command) doprint(attachments []*Attachment) {
+
+	if attachments == nil {
+		cmd.logpad("Printing", tr("Nothing to do"))
+		return
+	}
+
+	// Separator pages go between the documents printed in this run
+	printed := 0
+
+	for _, attachment := range attachments {
+
+		if attachment.Canary != "" {
+			cmd.canaryPrint(attachment)
+			continue
+		}
+
+		if cmd.alreadyPrinted(attachment) {
+			continue
+		}
+
+		cmd.logpad("Printing", attachment.jobName())
+
+		if cmd.NoPrint {
+			cmd.logverb("JobID", "123456")
+			continue
+		}
+
+		if !cmd.classify(attachment) {
+			continue
+		}
+
+		if !cmd.prePrint(attachment) {
+			continue
+		}
+
+		if err := cmd.chaosIPP(); err != nil {
+			cmd.logverb("JobID", err.Error())
+			attachment.failed(err)
+			continue
+		}
+
+		job, err := cmd.printfile(cmd.withLeadingPages(attachment, printed > 0))
+		cmd.jobEvent(attachment, job, err)
+		if err != nil {
+			cmd.logverb("JobID", err.Error())
+			attachment.failed(err)
+			if printer.Unreachable(err) && cmd.runState != nil {
+				cmd.runState.PrinterDown = true
+			}
+			continue
+		}
+
+		cmd.logverb("JobID", job)
+		printed++
+		if attachment.Mail != nil {
+			attachment.Mail.outcome(attachment.Name, OutcomePrinted, job, "")
+			attachment.Mail.Jobs = append(attachment.Mail.Jobs, job)
+			attachment.Mail.Pages += pageCount(attachment.File)
+		}
+		cmd.fingerprint(attachment, job)
+		cmd.record(attachment, job)
+		cmd.archive(attachment, job)
+	}
+}
+
+// printer returns the printer name of the configured print backend
+func (cmd *Command) printer(name string) (printer.Printer, error) {
+	return printer.New(name, cmd.cfg.Cups)
+}
+
+// printerless reports if the configured print backend works without a printer name
+func (cmd *Command) printerless() bool {
+	return cmd.cfg.Cups.Backend == printer.BackendDir
+}
+
+// validatePrinter validates the print settings needed by the configured backend
+func (cmd *Command) validatePrinter() error {
+	if cmd.printerless() {
+		return config.Validate(cmd.cfg.Cups, "Printer")
+	}
+	return config.Validate(cmd.cfg.Cups)
+}
+
+// printContext returns the context of a print submission giving up after the print timeout
+func (cmd *Command) printContext() (context.Context, context.CancelFunc) {
+	if cmd.cfg.Cups.Timeout > 0 {
+		return context.WithTimeout(context.Background(), cmd.cfg.Cups.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// device returns the printer name if the configured print backend reports device attributes
+func (cmd *Command) device(name string) (printer.Device, error) {
+	p, err := cmd.printer(name)
+	if err != nil {
+		return nil, err
+	}
+	dev, ok := p.(printer.Device)
+	if !ok {
+		return nil, printer.ErrNoDevice
+	}
+	return dev, nil
+}
+
+// cleanup removes the files of processed mails from the temp dir
+func (cmd *Command) cleanup() {
+	files, _ := filepath.Glob(filepath.Join(cmd.TmpDir, "*"))
+	for _, file := range files {
+		_ = os.RemoveAll(file)
+	}
+}
+
+// Close releases the connections, the state DB and the temp dir
+func (cmd *Command) Close() {
+	if cmd.mclient != nil {
+		_ = cmd.mclient.Logout()
+		_ = cmd.mclient.Close()
+	}
+	if cmd.db != nil {
+		_ = cmd.db.close()
+	}
+	if cmd.mq != nil {
+		_ = cmd.mq.close()
+	}
+	if cmd.TmpDir != "" && cmd.TmpDir != os.TempDir() {
+		_ = os.RemoveAll(cmd.TmpDir)
+	}
+
+}
+
+// logmail prints out *Mail related details
+func (cmd *Command) logmail(m *Mail) {
+	cmd.logverb("----- BEGIN MAIL -----")
+	cmd.logverb("Tracking", m.Tracking)
+	cmd.logverb("Date", m.Date)
+	cmd.logverb("From", m.From)
+	cmd.logverb("Subject", m.Subject)
+	cmd.logverb("Text", m.Body)
+	cmd.logverb("Attachments", len(m.Attachments))
+	cmd.logverb("ValidSender", m.isValidSender(cmd.filters(m)))
+	cmd.logverb("HasAttachments", m.hasAttachments())
+	cmd.logverb("ValidAttachments", m.validAttachments(cmd.filters(m)))
+	if m.isValid(cmd.filters(m)) {
+		cmd.logverb("Status", tr("Ok!"))
+	} else {
+		cmd.logverb("Status", tr("Will be ignored..."))
+	}
+	cmd.logverb("----- END MAIL -----")
+}
+
+// logpad prints out a predefined key-value output
+func (cmd *Command) logpad(title string, v ...interface{}) {
+
+	t := tr(strings.TrimSpace(title))
+
+	var items []interface{}
+
+	if prefix := cmd.logPrefix(); prefix != "" {
+		items = append(items, prefix)
+	}
+
+	if v == nil || len(v) == 0 {
+		log.Println(append(items, t)...)
+		return
+	}
+
+	if !strings.HasSuffix(t, ":") {
+		t += ": "
+	}
+
+	if len(t) < 20 {
+		t += strings.Repeat(" ", 20-len(t))
+	}
+
+	items = append(items, t)
+
+	// Values may be mail data, callers translate their fixed texts themselves
+	items = append(items, v...)
+
+	log.Println(items...)
+}
+
+// logverb prints out a predefined key-value output if run in verbose
+func (cmd *Command) logverb(title string, v ...interface{}) {
+	if cmd.Verbose {
+		cmd.logpad(title, v...)
+	}
+}
+
+// skipped records on its mail that attachment is deliberately not printed for reason
+func (a *Attachment) skipped(reason string) {
+	if a.Mail != nil {
+		a.Mail.Errors = append(a.Mail.Errors, a.Name+": "+reason)
+		a.Mail.outcome(a.Name, OutcomeSkipped, 0, reason)
+	}
+}
+
+// failed records a print error of attachment on its mail
+func (a *Attachment) failed(err error) {
+	a.Failed = true
+	if a.Mail != nil {
+		a.Mail.Errors = append(a.Mail.Errors, a.Name+": "+err.Error())
+		a.Mail.outcome(a.Name, OutcomeFailed, 0, err.Error())
+	}
+}
+
+// printed checks if all attachments of *Mail have been printed
+func (m *Mail) printed() bool {
+	return len(m.Jobs) > 0 && len(m.Errors) == 0
+}
+
+// isValid checks if mail is valid for printing
+func (m *Mail) isValid(f filter.Filter) bool {
+	return m.hasAttachments() && m.validAttachments(f) && m.isValidSender(f)
+}
+
+// hasAttachments checks if *Mail has attachments
+func (m *Mail) hasAttachments() bool {
+	return len(m.Attachments) > 0
+}
+
+// validAttachments checks if *Mail has any valid attachment
+func (m *Mail) validAttachments(f filter.Filter) bool {
+	if len(m.Attachments) == 0 {
+		return false
+	}
+	for _, attachment := range m.Attachments {
+		if attachment.isValid(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// isValid checks if *Attachment has an allowed extension and content type matching its content
+func (a *Attachment) isValid(f filter.Filter) bool {
+	if a.Body {
+		return true
+	}
+	return f.Document(filter.FileExt(a.File), a.Type) && f.MimeType(a.mimeType())
+}
+
+// mimeType returns the content type declared by the mail part, the sniffed type for files extracted from archives
+func (a *Attachment) mimeType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	return a.Type
+}
+
+// isValidSender checks if *Mail has a valid sender
+func (m *Mail) isValidSender(f filter.Filter) bool {
+	return f.Sender(m.From)
+}
+
+func inArrStr(s string, a []string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,500 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the configuration of imap-print loaded from the environment
+package config
+
+import (
+	"github.com/caarlos0/env"
+	"github.com/joho/godotenv"
+	"gopkg.in/go-playground/validator.v9"
+	"os"
+	"time"
+)
+
+// Config is our main configuration store
+type Config struct {
+	IMAP      *IMAPConfig
+	Cups      *CupsConfig
+	SMTP      *SMTPConfig
+	Alert     *AlertConfig
+	Canary    *CanaryConfig
+	Chaos     *ChaosConfig
+	Office    *OfficeConfig
+	Image     *ImageConfig
+	Archive   *ArchiveConfig
+	Digest    *DigestConfig
+	Fetch     *FetchConfig
+	Pages     *PagesConfig
+	Quota     *QuotaConfig
+	Disk      *DiskConfig
+	Admin     *AdminConfig
+	Filter    *FilterConfig
+	Body      *BodyConfig
+	Dedup     *DedupConfig
+	Keep      *KeepConfig
+	History   *HistoryConfig
+	Search    *SearchConfig
+	Queue     *QueueConfig
+	Reject    *RejectConfig
+	Backlog   *BacklogConfig
+	OAuth     *OAuthConfig
+	S3        *S3Config
+	Events    *EventsConfig
+	Hook      *HookConfig
+	Classify  *ClassifyConfig
+	ClamAV    *ClamAVConfig
+	Auth      *AuthConfig
+	SMIME     *SMIMEConfig
+	PGP       *PGPConfig
+	PDF       *PDFConfig
+	Duplex    *DuplexConfig
+	Cover     *CoverConfig
+	Separator *SeparatorConfig
+	Stamp     *StampConfig
+	Drop      *DropConfig
+	Hold      *HoldConfig
+	StateDB   string `env:"STATE_DB" envDefault:"imap-print.db"`
+	PrintBody bool   `env:"PRINT_BODY"`
+	NoAttach  string `env:"NO_ATTACHMENTS" envDefault:"delete" validate:"oneof=delete ignore keep forward body"`
+	Paper     string `env:"PAPER_SIZE" envDefault:"a4" validate:"oneof=a3 a4 a5 letter legal"`
+	MDN       bool   `env:"MDN"`
+	Confirm   bool   `env:"CONFIRM"`
+	Notify    bool   `env:"NOTIFY"`
+	PauseFile string `env:"PAUSE_FILE"`
+	Report    string `env:"REPORT_FILE"`
+	Metrics   string `env:"METRICS_FILE"`
+	Force     bool   `env:"FORCE"`
+
+	AcceptRisks []string `env:"ACCEPT_RISKS" envSeparator:":"`
+	NoAttachTo  []string `env:"NO_ATTACHMENTS_FORWARD" envSeparator:":"`
+
+	MaxAttachmentSize int64 `env:"MAX_ATTACHMENT_SIZE" validate:"min=0"`
+	MaxMailSize       int64 `env:"MAX_MAIL_SIZE"       validate:"min=0"`
+	MaxBandwidth      int64 `env:"MAX_BANDWIDTH"       validate:"min=0"`
+
+	MailSizeFolder string `env:"MAX_MAIL_SIZE_FOLDER"`
+	MailSizeReply  bool   `env:"MAX_MAIL_SIZE_REPLY"`
+
+	Maintenance []string `env:"MAINTENANCE" envSeparator:";"`
+	Limit       int      `env:"LIMIT"       validate:"min=0"`
+	Profiles    string   `env:"PROFILES"`
+	LogFields   []string `env:"LOG_FIELDS"  envSeparator:";"`
+
+	HTMLRenderer    string        `env:"HTML_RENDERER"     envDefault:"wkhtmltopdf" validate:"oneof=wkhtmltopdf chrome none"`
+	HTMLRendererBin string        `env:"HTML_RENDERER_BIN"`
+	HTMLTimeout     time.Duration `env:"HTML_TIMEOUT"      envDefault:"1m"`
+}
+
+// IMAPConfig holds IMAP related configurations
+type IMAPConfig struct {
+	Addr    string        `env:"IMAP_ADDR"                    validate:"required"`
+	User    string        `env:"IMAP_USER"                    validate:"required"`
+	Pass    string        `env:"IMAP_PASS"                    validate:"required" json:"-"`
+	Mailbox string        `env:"IMAP_MBOX" envDefault:"INBOX" validate:"required"`
+	Folders []string      `env:"IMAP_FOLDERS" envSeparator:";"`
+	Timeout time.Duration `env:"IMAP_TIMEOUT"`
+	Retries int           `env:"IMAP_RETRIES" envDefault:"3"  validate:"min=0"`
+	Backoff time.Duration `env:"IMAP_BACKOFF" envDefault:"2s"`
+
+	CACert     string `env:"IMAP_CA_CERT"              validate:"omitempty,file"`
+	ClientCert string `env:"IMAP_CLIENT_CERT"          validate:"omitempty,file"`
+	ClientKey  string `env:"IMAP_CLIENT_KEY"           validate:"required_with=ClientCert,omitempty,file"`
+	Insecure   bool   `env:"IMAP_INSECURE_SKIP_VERIFY"`
+	TLSMin     string `env:"IMAP_TLS_MIN"              validate:"omitempty,oneof=1.0 1.1 1.2 1.3"`
+	Proxy      string `env:"IMAP_PROXY"                json:"-"`
+}
+
+// OAuthConfig holds the OAuth client used to log in with OAUTHBEARER or XOAUTH2 instead of a password
+type OAuthConfig struct {
+	TokenURL     string        `env:"OAUTH_TOKEN_URL"     validate:"omitempty,url"`
+	DeviceURL    string        `env:"OAUTH_DEVICE_URL"    validate:"omitempty,url"`
+	ClientID     string        `env:"OAUTH_CLIENT_ID"     validate:"required_with=TokenURL"`
+	ClientSecret string        `env:"OAUTH_CLIENT_SECRET" json:"-"`
+	RefreshToken string        `env:"OAUTH_REFRESH_TOKEN" json:"-"`
+	Scope        string        `env:"OAUTH_SCOPE"`
+	Mechanism    string        `env:"OAUTH_MECHANISM"     envDefault:"auto" validate:"oneof=auto oauthbearer xoauth2"`
+	Retries      int           `env:"OAUTH_RETRIES"       envDefault:"3"    validate:"min=0"`
+	Backoff      time.Duration `env:"OAUTH_BACKOFF"       envDefault:"5s"`
+}
+
+// CupsConfig holds cups related configurations
+type CupsConfig struct {
+	Printer string        `env:"CUPS_PRINTER"    validate:"required"`
+	User    string        `env:"CUPS_USER"`
+	Pass    string        `env:"CUPS_PASS"       json:"-"`
+	Backend string        `env:"PRINT_BACKEND"   envDefault:"cups" validate:"oneof=cups lp dir ipp"`
+	Timeout time.Duration `env:"PRINT_TIMEOUT"`
+	Output  string        `env:"OUTPUT_DIR"`
+	Naming  string        `env:"OUTPUT_TEMPLATE" envDefault:"{{.Day}}/{{.From}}/{{.Name}}"`
+
+	Driverless  bool   `env:"DRIVERLESS_FALLBACK" envDefault:"true"`
+	Ghostscript string `env:"GHOSTSCRIPT_BIN"     envDefault:"gs"`
+}
+
+// SMTPConfig holds SMTP related configurations used for outgoing mail
+type SMTPConfig struct {
+	Addr string `env:"SMTP_ADDR"`
+	User string `env:"SMTP_USER"`
+	Pass string `env:"SMTP_PASS" json:"-"`
+	From string `env:"SMTP_FROM" validate:"omitempty,email"`
+}
+
+// CanaryConfig holds end-to-end self monitoring related configurations
+type CanaryConfig struct {
+	Interval time.Duration `env:"CANARY_INTERVAL"`
+	SLA      time.Duration `env:"CANARY_SLA"      envDefault:"15m"`
+	To       string        `env:"CANARY_TO"`
+}
+
+// OfficeConfig holds office document conversion related configurations
+type OfficeConfig struct {
+	Converter  string        `env:"OFFICE_CONVERTER"`
+	Timeout    time.Duration `env:"OFFICE_TIMEOUT"    envDefault:"2m"`
+	Extensions []string      `env:"OFFICE_EXTENSIONS" envDefault:"doc:docx:xls:xlsx:ppt:pptx:odt:ods:odp:rtf" envSeparator:":"`
+}
+
+// ImageConfig holds image normalization related configurations
+type ImageConfig struct {
+	Mode          string        `env:"IMAGE_MODE"           validate:"omitempty,oneof=fit fill dpi"`
+	DPI           int           `env:"IMAGE_DPI"            envDefault:"300" validate:"min=1"`
+	Margin        float64       `env:"IMAGE_MARGIN"         envDefault:"10"  validate:"min=0"`
+	Extensions    []string      `env:"IMAGE_EXTENSIONS"     envDefault:"jpg:jpeg:png:heic:heif" envSeparator:":"`
+	HEICConverter string        `env:"IMAGE_HEIC_CONVERTER" envDefault:"heif-convert {in} {out}"`
+	Timeout       time.Duration `env:"IMAGE_TIMEOUT"        envDefault:"1m"`
+	MaxPixels     int64         `env:"IMAGE_MAX_PIXELS"     envDefault:"50000000" validate:"min=0"`
+}
+
+// ArchiveConfig holds archive extraction related configurations
+type ArchiveConfig struct {
+	Extract    bool  `env:"ARCHIVE_EXTRACT"`
+	MaxSize    int64 `env:"ARCHIVE_MAX_SIZE"    envDefault:"104857600" validate:"min=0"`
+	MaxEntries int   `env:"ARCHIVE_MAX_ENTRIES" envDefault:"50"        validate:"min=0"`
+}
+
+// HistoryConfig holds print history related configurations
+type HistoryConfig struct {
+	Retention time.Duration `env:"HISTORY_RETENTION" envDefault:"2160h"`
+	Extractor string        `env:"HISTORY_EXTRACTOR" envDefault:"pdftotext -q -enc UTF-8 {in} -"`
+	Timeout   time.Duration `env:"HISTORY_TIMEOUT"   envDefault:"1m"`
+	TextMax   int           `env:"HISTORY_TEXT_MAX"  envDefault:"65536" validate:"min=0"`
+}
+
+// S3Config holds the S3 compatible bucket and the per sender destinations printed attachments are archived in
+type S3Config struct {
+	Endpoint  string `env:"S3_ENDPOINT"   validate:"omitempty,url"`
+	Bucket    string `env:"S3_BUCKET"     validate:"required_with=Endpoint"`
+	Region    string `env:"S3_REGION"     envDefault:"us-east-1"`
+	Prefix    string `env:"S3_PREFIX"`
+	AccessKey string `env:"S3_ACCESS_KEY" validate:"required_with=Endpoint"`
+	SecretKey string `env:"S3_SECRET_KEY" validate:"required_with=Endpoint" json:"-"`
+	Rules     string `env:"ARCHIVE_RULES"`
+}
+
+// EventsConfig holds the webhook receiving job lifecycle events
+type EventsConfig struct {
+	Webhook string `env:"EVENT_WEBHOOK" validate:"omitempty,url"`
+	Secret  string `env:"EVENT_SECRET"  json:"-"`
+}
+
+// HookConfig holds the external commands run for every attachment
+type HookConfig struct {
+	PrePrint string        `env:"HOOK_PRE_PRINT"`
+	Timeout  time.Duration `env:"HOOK_TIMEOUT"   envDefault:"1m"`
+}
+
+// ClassifyConfig holds the experimental classifier labelling documents for routing rules
+type ClassifyConfig struct {
+	Hook    string        `env:"CLASSIFY"`
+	Token   string        `env:"CLASSIFY_TOKEN"   json:"-"`
+	Timeout time.Duration `env:"CLASSIFY_TIMEOUT" envDefault:"30s"`
+	Skip    []string      `env:"CLASSIFY_SKIP"    envSeparator:":"`
+}
+
+// ClamAVConfig holds the clamd daemon scanning every attachment
+type ClamAVConfig struct {
+	Addr       string        `env:"CLAMD_ADDR"`
+	Timeout    time.Duration `env:"CLAMD_TIMEOUT"    envDefault:"1m"`
+	Quarantine string        `env:"CLAMD_QUARANTINE" envDefault:"imap-print-quarantine"`
+}
+
+// AuthConfig holds sender domain authentication related configurations
+type AuthConfig struct {
+	RequireDKIM bool `env:"REQUIRE_DKIM"`
+	SPF         bool `env:"AUTH_ACCEPT_SPF"`
+}
+
+// SMIMEConfig holds the recipient certificate and key used to decrypt S/MIME encrypted mails
+type SMIMEConfig struct {
+	Cert string `env:"SMIME_CERT"`
+	Key  string `env:"SMIME_KEY"  validate:"required_with=Cert"`
+}
+
+// PGPConfig holds the keyring used to decrypt OpenPGP encrypted mails and attachments
+type PGPConfig struct {
+	Home       string        `env:"PGP_HOME"`
+	Passphrase string        `env:"PGP_PASSPHRASE" json:"-"`
+	Bin        string        `env:"PGP_BIN"        envDefault:"gpg"`
+	Timeout    time.Duration `env:"PGP_TIMEOUT"    envDefault:"1m"`
+}
+
+// DuplexConfig holds simplex and duplex printing related configurations
+type DuplexConfig struct {
+	Mode  string `env:"DUPLEX"       validate:"omitempty,oneof=off long short auto"`
+	Rules string `env:"DUPLEX_RULES"`
+}
+
+// CoverConfig holds cover page related configurations
+type CoverConfig struct {
+	Enabled  bool   `env:"COVER"`
+	Template string `env:"COVER_TEMPLATE"`
+}
+
+// SeparatorConfig holds separator page related configurations
+type SeparatorConfig struct {
+	Enabled  bool   `env:"SEPARATOR"`
+	Template string `env:"SEPARATOR_TEMPLATE"`
+}
+
+// StampConfig holds the text stamped on every page of printed PDF documents, by default in small gray letters
+// in the bottom left corner
+type StampConfig struct {
+	Text  string `env:"STAMP_TEXT"`
+	Style string `env:"STAMP_STYLE" envDefault:"points:8, position:bl, offset:20 10, scalefactor:1 abs, rotation:0, fillcolor:#808080"`
+}
+
+// DropConfig holds the FTP or SFTP drop folder documents are printed from in addition to or instead of the mailbox,
+// the sender of a file is the address of the first matching glob=address entry of Senders or Sender otherwise
+type DropConfig struct {
+	URL     string        `env:"DROP_URL"     json:"-"`
+	Senders []string      `env:"DROP_SENDERS" envSeparator:";"`
+	Sender  string        `env:"DROP_SENDER"  validate:"omitempty,email"`
+	Settle  time.Duration `env:"DROP_SETTLE"  envDefault:"5s"`
+	Timeout time.Duration `env:"DROP_TIMEOUT" envDefault:"1m"`
+	SFTPBin string        `env:"SFTP_BIN"     envDefault:"sftp"`
+}
+
+// HoldConfig holds the veto window of print jobs submitted held and released by the print server after Delay,
+// only jobs matching one of the Match rules are held if any are set
+type HoldConfig struct {
+	Delay time.Duration `env:"HOLD_DELAY"`
+	Match []string      `env:"HOLD_MATCH" envSeparator:";"`
+}
+
+// PDFConfig holds the passwords tried to open encrypted PDF documents
+type PDFConfig struct {
+	Passwords []string `env:"PDF_PASSWORDS" envSeparator:":" json:"-"`
+}
+
+// RejectConfig holds rejection reply related configurations
+type RejectConfig struct {
+	Template string `env:"REJECT_TEMPLATE"`
+	Rules    string `env:"REJECT_RULES"`
+}
+
+// QueueConfig holds split deployment related configurations
+type QueueConfig struct {
+	Role string `env:"ROLE"      envDefault:"all"              validate:"oneof=all fetch print"`
+	Dir  string `env:"QUEUE_DIR"  envDefault:"imap-print-queue" validate:"required"`
+	URL  string `env:"QUEUE_URL"  json:"-"`
+	Name string `env:"QUEUE_NAME" envDefault:"imap-print"       validate:"required"`
+}
+
+// SearchConfig holds IMAP search related configurations selecting the mails to fetch
+type SearchConfig struct {
+	Unseen  bool          `env:"SEARCH_UNSEEN"`
+	Since   time.Duration `env:"SEARCH_SINCE"   validate:"min=0"`
+	From    []string      `env:"SEARCH_FROM"    envSeparator:":"`
+	Subject string        `env:"SEARCH_SUBJECT"`
+}
+
+// KeepConfig holds keep mode related configurations
+type KeepConfig struct {
+	Enabled bool   `env:"KEEP"`
+	Flag    string `env:"KEEP_FLAG" envDefault:"$Printed" validate:"required"`
+}
+
+// DedupConfig holds duplicate detection related configurations
+type DedupConfig struct {
+	Retention time.Duration `env:"DEDUP_RETENTION" envDefault:"720h"`
+	Content   bool          `env:"DEDUP_CONTENT"`
+
+	Attachments   string        `env:"DEDUP_ATTACHMENTS"    envDefault:"pages" validate:"oneof=off hash pages"`
+	Distance      int           `env:"DEDUP_DISTANCE"       envDefault:"16"    validate:"min=0,max=256"`
+	PDFRenderer   string        `env:"DEDUP_PDF_RENDERER"   envDefault:"gs -q -dNOPAUSE -dBATCH -dSAFER -sDEVICE=pnggray -r20 -sOutputFile={out} {in}"`
+	ImageRenderer string        `env:"DEDUP_IMAGE_RENDERER" envDefault:"convert {in} {out}"`
+	Timeout       time.Duration `env:"DEDUP_TIMEOUT"        envDefault:"1m"`
+}
+
+// BacklogConfig holds configurations about mails failing to be fetched or parsed in several runs, and about mails
+// which can't be parsed or converted at all
+type BacklogConfig struct {
+	Runs       int    `env:"BACKLOG_RUNS"      envDefault:"3" validate:"min=0"`
+	Folder     string `env:"BACKLOG_FOLDER"`
+	Quarantine string `env:"QUARANTINE_FOLDER" envDefault:"Quarantine"`
+}
+
+// BodyConfig holds mail body printing related configurations
+type BodyConfig struct {
+	Layout    string `env:"BODY_LAYOUT"    envDefault:"plain" validate:"oneof=plain letter"`
+	Signature bool   `env:"BODY_SIGNATURE"`
+	Strip     bool   `env:"BODY_STRIP"`
+	Footers   string `env:"BODY_FOOTERS"`
+}
+
+// FilterConfig holds sender and attachment filter related configurations
+type FilterConfig struct {
+	Policy           string   `env:"POLICY"            envDefault:"strict" validate:"oneof=strict lenient report"`
+	Allowed          []string `env:"ALLOWED"           envSeparator:":"`
+	Denied           []string `env:"DENIED"            envSeparator:":"`
+	Extensions       []string `env:"EXTENSIONS"        envSeparator:":"`
+	DeniedExtensions []string `env:"DENIED_EXTENSIONS" envSeparator:":"`
+	AllowedMime      []string `env:"ALLOWED_MIME"      envSeparator:":"`
+}
+
+// AdminConfig holds administrator notification related configurations
+type AdminConfig struct {
+	Email   []string `env:"ADMIN_EMAIL"   envSeparator:":"`
+	Forward bool     `env:"ADMIN_FORWARD"`
+}
+
+// DiskConfig holds free disk space related configurations
+type DiskConfig struct {
+	MinFree int64    `env:"DISK_MIN_FREE" validate:"min=0"`
+	Paths   []string `env:"DISK_PATHS"    envSeparator:":"`
+}
+
+// QuotaConfig holds per sender quota related configurations
+type QuotaConfig struct {
+	Jobs  int  `env:"QUOTA_JOBS"  validate:"min=0"`
+	Pages int  `env:"QUOTA_PAGES" validate:"min=0"`
+	Reply bool `env:"QUOTA_REPLY"`
+}
+
+// PagesConfig holds page limit and page orientation related configurations
+type PagesConfig struct {
+	Max         int    `env:"MAX_PAGES"         validate:"min=0"`
+	Mode        string `env:"MAX_PAGES_MODE"    envDefault:"skip" validate:"oneof=skip truncate"`
+	Orientation string `env:"MIXED_ORIENTATION" envDefault:"off"  validate:"oneof=off rotate split"`
+}
+
+// FetchConfig holds IMAP download related configurations
+type FetchConfig struct {
+	ChunkSize int `env:"FETCH_CHUNK_SIZE" envDefault:"4194304" validate:"min=0"`
+	Retries   int `env:"FETCH_RETRIES"    envDefault:"5"       validate:"min=0"`
+	Workers   int `env:"FETCH_WORKERS"    envDefault:"4"       validate:"min=1"`
+	BatchSize int `env:"FETCH_BATCH_SIZE" envDefault:"50"      validate:"min=1"`
+}
+
+// DigestConfig holds sender statistics digest related configurations
+type DigestConfig struct {
+	Interval time.Duration `env:"DIGEST_INTERVAL"`
+	To       []string      `env:"DIGEST_TO"       envSeparator:":"`
+	Window   time.Duration `env:"DIGEST_WINDOW"   envDefault:"168h" validate:"min=0"`
+}
+
+// ChaosConfig holds developer settings to simulate failures
+type ChaosConfig struct {
+	IMAPDrop float64       `env:"CHAOS_IMAP_DROP" validate:"min=0,max=1"`
+	IPPError float64       `env:"CHAOS_IPP_ERROR" validate:"min=0,max=1"`
+	Slow     time.Duration `env:"CHAOS_SLOW"`
+}
+
+// AlertConfig holds operator alerting related configurations
+type AlertConfig struct {
+	Webhook     string        `env:"ALERT_WEBHOOK"      validate:"omitempty,url" json:"-"`
+	Slack       string        `env:"ALERT_SLACK"        validate:"omitempty,url" json:"-"`
+	Email       []string      `env:"ALERT_EMAIL"        envSeparator:":"`
+	Cooldown    time.Duration `env:"ALERT_COOLDOWN"     envDefault:"24h"`
+	MarkerLevel int           `env:"ALERT_MARKER_LEVEL" envDefault:"10"`
+	Thresholds  []string      `env:"ALERT_THRESHOLDS"   envSeparator:":"`
+	MediaEmpty  time.Duration `env:"ALERT_MEDIA_EMPTY"  envDefault:"30m"`
+	Stalled     time.Duration `env:"ALERT_STALLED"`
+	Quiet       time.Duration `env:"ALERT_QUIET"`
+	Hours       string        `env:"ALERT_HOURS"`
+
+	// MarkerLevelSet is true if ALERT_MARKER_LEVEL is configured and not just its default
+	MarkerLevelSet bool `json:"-"`
+}
+
+// Load returns the configuration read from the environment
+func Load() (*Config, error) {
+
+	cfg := &Config{
+		IMAP:      &IMAPConfig{},
+		Cups:      &CupsConfig{},
+		SMTP:      &SMTPConfig{},
+		Alert:     &AlertConfig{},
+		Canary:    &CanaryConfig{},
+		Chaos:     &ChaosConfig{},
+		Office:    &OfficeConfig{},
+		Image:     &ImageConfig{},
+		Archive:   &ArchiveConfig{},
+		Digest:    &DigestConfig{},
+		Fetch:     &FetchConfig{},
+		Pages:     &PagesConfig{},
+		Quota:     &QuotaConfig{},
+		Disk:      &DiskConfig{},
+		Admin:     &AdminConfig{},
+		Filter:    &FilterConfig{Allowed: []string{}},
+		Body:      &BodyConfig{},
+		Dedup:     &DedupConfig{},
+		Keep:      &KeepConfig{},
+		History:   &HistoryConfig{},
+		Search:    &SearchConfig{},
+		Queue:     &QueueConfig{},
+		Reject:    &RejectConfig{},
+		Backlog:   &BacklogConfig{},
+		OAuth:     &OAuthConfig{},
+		S3:        &S3Config{},
+		Events:    &EventsConfig{},
+		Hook:      &HookConfig{},
+		Classify:  &ClassifyConfig{},
+		ClamAV:    &ClamAVConfig{},
+		Auth:      &AuthConfig{},
+		SMIME:     &SMIMEConfig{},
+		PGP:       &PGPConfig{},
+		PDF:       &PDFConfig{},
+		Duplex:    &DuplexConfig{},
+		Cover:     &CoverConfig{},
+		Separator: &SeparatorConfig{},
+		Stamp:     &StampConfig{},
+		Drop:      &DropConfig{},
+		Hold:      &HoldConfig{},
+	}
+
+	if err := env.Parse(cfg); err != nil {
+		return nil, err
+	}
+
+	_, cfg.Alert.MarkerLevelSet = os.LookupEnv("ALERT_MARKER_LEVEL")
+
+	return cfg, nil
+}
+
+// Dotenv loads environment variables from .env in the current working directory
+func Dotenv() error {
+	if _, err := os.Stat(".env"); err == nil {
+		return godotenv.Load()
+	}
+	return nil
+}
+
+// Validate validates a configuration struct except the given fields
+func Validate(v interface{}, except ...string) error {
+	if len(except) > 0 {
+		return validator.New().StructExcept(v, except...)
+	}
+	return validator.New().Struct(v)
+}
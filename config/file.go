@@ -0,0 +1,135 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// File loads the settings of the YAML (or JSON) file path into the environment, variables already set in the
+// environment or by .env take precedence. Keys are the names of the environment variables, case insensitive and
+// optionally nested, e.g. "cups: {printer: office}" sets CUPS_PRINTER. Lists are joined with the separator of the
+// setting, lists of rules with newlines.
+func File(path string) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	known := settings(reflect.TypeOf(Config{}), map[string]string{})
+	for _, name := range secrets(reflect.TypeOf(Config{}), nil) {
+		known[name+"_FILE"] = "\n"
+	}
+
+	values := map[string]interface{}{}
+	flatten("", doc, values)
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sep, ok := known[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %s", path, name)
+		}
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		if err := os.Setenv(name, value(values[name], sep)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// settings collects the environment variables of the configuration struct t with the separator of their lists,
+// a newline for plain strings
+func settings(t reflect.Type, known map[string]string) map[string]string {
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		name, ok := f.Tag.Lookup("env")
+		switch {
+		case ok && ft.Kind() == reflect.Slice:
+			sep := f.Tag.Get("envSeparator")
+			if sep == "" {
+				sep = ","
+			}
+			known[name] = sep
+		case ok:
+			known[name] = "\n"
+		case ft.Kind() == reflect.Struct:
+			settings(ft, known)
+		}
+	}
+
+	return known
+}
+
+// flatten adds the values of the nested map m to values, keyed by their upper case path joined with "_"
+func flatten(prefix string, m map[string]interface{}, values map[string]interface{}) {
+	for k, v := range m {
+		name := strings.ToUpper(prefix + k)
+		switch v := v.(type) {
+		case map[interface{}]interface{}:
+			nested := map[string]interface{}{}
+			for nk, nv := range v {
+				nested[fmt.Sprint(nk)] = nv
+			}
+			flatten(name+"_", nested, values)
+		default:
+			values[name] = v
+		}
+	}
+}
+
+// value returns v as environment variable value, lists joined with sep
+func value(v interface{}, sep string) string {
+	if list, ok := v.([]interface{}); ok {
+		s := make([]string, len(list))
+		for i, e := range list {
+			s[i] = fmt.Sprint(e)
+		}
+		// A single rule is still told apart from the name of a rules file
+		if sep == "\n" {
+			return strings.Join(s, sep) + sep
+		}
+		return strings.Join(s, sep)
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
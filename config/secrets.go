@@ -0,0 +1,210 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VaultPrefix marks secrets to be read from a HashiCorp Vault KV engine, e.g. "vault:secret/data/imap#password"
+const VaultPrefix = "vault:"
+
+// VaultTimeout is the time given to Vault to answer a single lookup
+const VaultTimeout = 10 * time.Second
+
+// Secrets resolves the secret settings (passwords, tokens and keys) not given as plain value. Unset secrets are read
+// from the file named by <NAME>_FILE or from the systemd credential <NAME> in $CREDENTIALS_DIRECTORY, values of the
+// form "vault:<path>#<field>" are looked up in Vault at $VAULT_ADDR with $VAULT_TOKEN.
+func Secrets() error {
+
+	names := secrets(reflect.TypeOf(Config{}), nil)
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		v, set := os.LookupEnv(name)
+
+		if !set {
+			file, err := secretFile(name)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				continue
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+			// Editors and echo leave a trailing newline which is never part of the secret
+			v = strings.TrimRight(string(data), "\r\n")
+		}
+
+		if strings.HasPrefix(v, VaultPrefix) {
+			var err error
+			if v, err = vault(strings.TrimPrefix(v, VaultPrefix)); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+
+		if err := os.Setenv(name, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// secrets collects the environment variables of the configuration struct t hidden from JSON output
+func secrets(t reflect.Type, names []string) []string {
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		name, ok := f.Tag.Lookup("env")
+		switch {
+		case ok && f.Tag.Get("json") == "-":
+			names = append(names, name)
+		case !ok && ft.Kind() == reflect.Struct:
+			names = secrets(ft, names)
+		}
+	}
+
+	return names
+}
+
+// secretFile returns the file holding the secret name, empty if there is none
+func secretFile(name string) (string, error) {
+
+	if file := os.Getenv(name + "_FILE"); file != "" {
+		return file, nil
+	}
+
+	// Credentials passed by systemd with LoadCredential=NAME:/path
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return "", nil
+	}
+
+	file := filepath.Join(dir, name)
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+
+	return file, nil
+}
+
+// vault returns the field of the secret ref ("<path>#<field>") of the KV engine (version 1 or 2) of Vault
+func vault(ref string) (string, error) {
+
+	i := strings.LastIndex(ref, "#")
+	if i < 1 || i == len(ref)-1 {
+		return "", fmt.Errorf("invalid vault reference %q, expected <path>#<field>", ref)
+	}
+	path, field := ref[:i], ref[i+1:]
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR not set")
+	}
+
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := (&http.Client{Timeout: VaultTimeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault %s: %s", path, resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("vault %s: %s", path, err)
+	}
+
+	// Version 2 of the KV engine nests the fields in data.data
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, direct := data[field]; !direct {
+			data = nested
+		}
+	}
+
+	v, ok := data[field]
+	if !ok || v == nil {
+		return "", fmt.Errorf("vault %s: no field %s", path, field)
+	}
+
+	return fmt.Sprint(v), nil
+}
+
+// vaultToken returns the Vault token of $VAULT_TOKEN, $VAULT_TOKEN_FILE or the token helper file ~/.vault-token
+func vaultToken() (string, error) {
+
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	file := os.Getenv("VAULT_TOKEN_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("VAULT_TOKEN not set")
+		}
+		file = filepath.Join(home, ".vault-token")
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("VAULT_TOKEN not set")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Template returns a commented .env file listing every setting with its default value; required settings are
+// left uncommented to be filled in
+func Template() []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString("# imap-print configuration, see README.md for a description of all settings.\n")
+	b.WriteString("# Environment variables override the values of this file.\n")
+
+	t := reflect.TypeOf(Config{})
+
+	// Plain settings of Config itself come first, then one section per sub configuration
+	b.WriteString("\n# General\n")
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := t.Field(i).Tag.Lookup("env"); ok {
+			templateLine(&b, name, t.Field(i).Tag)
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.Ptr || f.Type.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		fmt.Fprintf(&b, "\n# %s\n", f.Name)
+		st := f.Type.Elem()
+		for j := 0; j < st.NumField(); j++ {
+			if name, ok := st.Field(j).Tag.Lookup("env"); ok {
+				templateLine(&b, name, st.Field(j).Tag)
+			}
+		}
+	}
+
+	return b.Bytes()
+}
+
+// templateLine writes the setting name with its default value, commented out unless it is required
+func templateLine(b *bytes.Buffer, name string, tag reflect.StructTag) {
+	required := false
+	for _, rule := range strings.Split(tag.Get("validate"), ",") {
+		if rule == "required" {
+			required = true
+		}
+	}
+	prefix := "# "
+	if required {
+		prefix = ""
+	}
+	value := tag.Get("envDefault")
+	if strings.ContainsAny(value, " #") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, "%s%s=%s\n", prefix, name, value)
+}
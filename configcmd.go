@@ -0,0 +1,139 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap/client"
+	"github.com/mrccnt/imap-print/config"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/phin1x/go-ipp"
+	"github.com/urfave/cli/v2"
+	"os"
+	"time"
+)
+
+// ErrCheckFailed is returned by config validate if any check failed
+var ErrCheckFailed = errors.New("configuration check failed")
+
+// configValidate is used as callable for the config validate sub command; it checks the configuration, the IMAP login,
+// the mailboxes and the printer without processing any mail
+func (cmd *Command) configValidate(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	failed := false
+
+	check := func(name string, fn func() error) {
+		start := time.Now()
+		status := "ok"
+		if err := fn(); err != nil {
+			status = "FAILED: " + err.Error()
+			failed = true
+		}
+		fmt.Printf("%-22s %s (%s)\n", name+":", status, time.Since(start).Round(time.Millisecond))
+	}
+
+	check(tr("Configuration"), cmd.validate)
+
+	for _, f := range cmd.lint() {
+		fmt.Printf("%-22s %s (%s)\n", tr("Warning")+":", f.Text, f.Rule)
+	}
+
+	if cmd.cfg.Queue.Role != RolePrint {
+		var imap *client.Client
+		check(tr("IMAP Login"), func() error {
+			var err error
+			imap, err = cmd.dial()
+			return err
+		})
+		if imap != nil {
+			folders, err := cmd.folders()
+			check(tr("Mailboxes"), func() error {
+				return err
+			})
+			for _, folder := range folders {
+				check(fmt.Sprintf(tr("Mailbox %s"), folder.Name), func() error {
+					_, err := imap.Select(folder.Name, true)
+					return err
+				})
+			}
+			_ = imap.Logout()
+		}
+	}
+
+	if cmd.cfg.Queue.Role != RoleFetch {
+		check(tr("Printer"), cmd.checkPrinter)
+	}
+
+	if failed {
+		return cli.NewExitError(tr(ErrCheckFailed.Error()), 1)
+	}
+
+	return nil
+}
+
+// checkPrinter checks if the configured printer is available
+func (cmd *Command) checkPrinter() error {
+
+	if err := cmd.validatePrinter(); err != nil {
+		return err
+	}
+
+	if cmd.cfg.Cups.Backend == printer.BackendDir {
+		return os.MkdirAll(cmd.cfg.Cups.Output, 0755)
+	}
+
+	dev, err := cmd.device(cmd.cfg.Cups.Printer)
+	if err == printer.ErrNoDevice {
+		// Backends without device attributes can't tell before the first job
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Unknown printers are reported by the print server
+	_, err = dev.Attributes([]string{ipp.AttributePrinterState})
+
+	return err
+}
+
+// configInit is used as callable for the config init sub command writing a commented configuration template
+func (cmd *Command) configInit(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	file := c.String("output")
+
+	// An existing configuration is never overwritten
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	_, err = f.Write(config.Template())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logpad("Config", file)
+
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"strconv"
+	"strings"
+)
+
+// Auto-Submitted header name (RFC 3834)
+const AutoSubmittedHeader = "Auto-Submitted"
+
+// Outcomes of single attachments
+const (
+	OutcomePrinted = "printed"
+	OutcomeSkipped = "skipped"
+	OutcomeFailed  = "failed"
+)
+
+// Outcome is what came out of a single attachment of a mail
+type Outcome struct {
+	Name   string        `json:"name"`
+	Status string        `json:"status"`
+	Job    printer.JobID `json:"job,omitempty"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// outcome records the outcome of the attachment name of m
+func (m *Mail) outcome(name string, status string, job printer.JobID, reason string) {
+	m.Outcomes = append(m.Outcomes, &Outcome{Name: name, Status: status, Job: job, Reason: reason})
+}
+
+// unprintedByScope checks if m was not printed only because of --no-print, its sender is not told about that
+func (cmd *Command) unprintedByScope(m *Mail) bool {
+	return cmd.NoPrint && m.Rejected == ""
+}
+
+// confirm replies to the senders of mails with the outcome of their print request
+func (cmd *Command) confirm(mails []*Mail) {
+
+	if cmd.NoNotify {
+		return
+	}
+
+	for _, m := range mails {
+
+		// Never answer robots to avoid mail loops
+		if m.Canary != "" || m.Quiet || m.automated() || cmd.unprintedByScope(m) {
+			continue
+		}
+
+		var rule *RejectRule
+		if m.Rejected != "" {
+			rule = cmd.rejectRule(m)
+		}
+
+		if rule == nil && !cmd.cfg.Confirm && !(cmd.cfg.Quota.Reply && m.Rejected == RejectQuota) && !(cmd.cfg.MailSizeReply && m.Rejected == RejectMailSize) {
+			continue
+		}
+
+		// Unknown and forged senders are never answered to avoid backscatter, additional recipients of rules are
+		var to, cc []string
+		if m.isValidSender(cmd.filters(m)) && m.Rejected != RejectUnauth {
+			to = []string{m.From}
+		}
+		if rule != nil {
+			cc = rule.CC
+		}
+		if len(to) == 0 {
+			to, cc = cc, nil
+		}
+		if len(to) == 0 {
+			continue
+		}
+
+		subject, text := cmd.confirmation(m)
+		if rule != nil {
+			var err error
+			if subject, text, err = rule.reply(m); err != nil {
+				cmd.logpad("Reject Rules", err.Error())
+				continue
+			}
+		}
+
+		headers := []string{AutoSubmittedHeader + ": auto-replied"}
+		if m.MessageID != "" {
+			headers = append(headers, "In-Reply-To: <"+m.MessageID+">", "References: <"+m.MessageID+">")
+		}
+		if len(cc) > 0 {
+			headers = append(headers, "Cc: "+strings.Join(cc, ", "))
+		}
+
+		if err := cmd.smtpsend(append(to, cc...), cmd.message(to, subject, text, headers...)); err != nil {
+			cmd.logpad("Confirm", strings.Join(to, ", "), err.Error())
+			continue
+		}
+
+		cmd.logverb("Confirm", strings.Join(append(to, cc...), ", "), subject)
+	}
+}
+
+// confirmation returns subject and text of the confirmation reply for m
+func (cmd *Command) confirmation(m *Mail) (string, string) {
+
+	var b strings.Builder
+	var subject string
+
+	switch {
+	case m.Rejected != "":
+		subject = fmt.Sprintf(tr("Not printed: %s"), m.Subject)
+		b.WriteString(fmt.Sprintf(tr("Your message %q has been rejected: %s"), m.Subject, tr(m.Rejected)) + "\n")
+	case len(m.Jobs) == 0:
+		subject = fmt.Sprintf(tr("Not printed: %s"), m.Subject)
+		b.WriteString(fmt.Sprintf(tr("Your message %q could not be printed."), m.Subject) + "\n")
+	default:
+		subject = fmt.Sprintf(tr("Printed: %s"), m.Subject)
+		var jobs []string
+		for _, job := range m.Jobs {
+			jobs = append(jobs, strconv.Itoa(int(job)))
+		}
+		b.WriteString(fmt.Sprintf(tr("Your message %q has been printed: %d pages on %s, job %s."), m.Subject, m.Pages, cmd.target(&Attachment{Mail: m}), strings.Join(jobs, ", ")) + "\n")
+	}
+
+	// Every attachment is listed with its own outcome, errors of the mail itself follow
+	var lines []string
+	for _, o := range m.Outcomes {
+		lines = append(lines, o.String())
+	}
+	for _, e := range m.Errors {
+		if !m.hasOutcome(e) {
+			lines = append(lines, e)
+		}
+	}
+
+	if len(lines) > 0 {
+		b.WriteString("\n")
+		for _, line := range lines {
+			b.WriteString(" - " + line + "\n")
+		}
+	}
+
+	b.WriteString("\n" + fmt.Sprintf(tr("Tracking ID: %s"), m.Tracking) + "\n")
+
+	return subject, b.String()
+}
+
+// String returns the outcome as line of confirmation replies
+func (o *Outcome) String() string {
+	switch {
+	case o.Status == OutcomePrinted && o.Reason != "":
+		return fmt.Sprintf(tr("%s: printed, job %d (%s)"), o.Name, o.Job, o.Reason)
+	case o.Status == OutcomePrinted:
+		return fmt.Sprintf(tr("%s: printed, job %d"), o.Name, o.Job)
+	case o.Status == OutcomeSkipped:
+		return fmt.Sprintf(tr("%s: skipped: %s"), o.Name, o.Reason)
+	}
+	return fmt.Sprintf(tr("%s: failed: %s"), o.Name, o.Reason)
+}
+
+// hasOutcome checks if the error e of m belongs to an attachment listed with its outcome
+func (m *Mail) hasOutcome(e string) bool {
+	for _, o := range m.Outcomes {
+		if e == o.Name+": "+o.Reason {
+			return true
+		}
+	}
+	return false
+}
+
+// automated checks if m was sent automatically and must not be answered
+func (m *Mail) automated() bool {
+	return m.AutoSubmitted != "" && !strings.EqualFold(m.AutoSubmitted, "no")
+}
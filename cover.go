@@ -0,0 +1,177 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// CoverData is passed to cover and separator page templates
+type CoverData struct {
+	Tracking string
+	From     string
+	Subject  string
+	Date     time.Time
+	Printed  time.Time
+	Name     string
+	Pages    int
+}
+
+// coverData returns the template data describing attachment
+func coverData(attachment *Attachment) *CoverData {
+
+	data := &CoverData{
+		Printed: time.Now(),
+		Name:    attachment.Name,
+		Pages:   pageCount(attachment.File),
+	}
+	if m := attachment.Mail; m != nil {
+		data.Tracking = m.Tracking
+		data.From = m.From
+		data.Subject = m.Subject
+		data.Date = m.Date
+	}
+
+	return data
+}
+
+// coverTemplate returns the configured cover page template or the default one
+func (cmd *Command) coverTemplate() (*template.Template, error) {
+
+	if cmd.cfg.Cover.Template != "" {
+		return template.ParseFiles(cmd.cfg.Cover.Template)
+	}
+
+	// The first line is printed as heading
+	return template.New("cover").Parse(fmt.Sprintf(
+		"{{.From}}\n\n%-10s {{.Subject}}\n%-10s {{.Date.Format \"2006-01-02 15:04\"}}\n%-10s {{.Printed.Format \"2006-01-02 15:04\"}}\n%-10s {{.Name}}\n%-10s {{.Pages}}\n%-10s {{.Tracking}}\n",
+		tr("Subject")+":", tr("Date")+":", tr("Printed")+":", tr("Document")+":", tr("Pages")+":", tr("Tracking")+":",
+	))
+}
+
+// coverPage renders the cover page of attachment into a PDF file inside the temp dir
+func (cmd *Command) coverPage(attachment *Attachment) (string, error) {
+
+	tmpl, err := cmd.coverTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, coverData(attachment)); err != nil {
+		return "", err
+	}
+
+	lines := strings.SplitN(b.String(), "\n", 2)
+
+	doc := newPDFDoc(tr("Cover Page"))
+	doc.heading(lines[0], 18)
+	doc.rule()
+	if len(lines) == 2 {
+		doc.text(lines[1])
+	}
+
+	return cmd.leadingPage(doc, attachment)
+}
+
+// leadingPage writes doc printed ahead of attachment into a PDF file inside the temp dir
+func (cmd *Command) leadingPage(doc *PDFDoc, attachment *Attachment) (string, error) {
+
+	// On duplex printers the document starts on a sheet of its own
+	if sides := cmd.sides(attachment); sides != "" && sides != printer.SidesOneSided {
+		doc.pagebreak()
+	}
+
+	file, err := ioutil.TempFile(cmd.TmpDir, "*_lead.pdf")
+	if err != nil {
+		return "", err
+	}
+	_ = file.Close()
+
+	return file.Name(), doc.write(file.Name())
+}
+
+// leadingPages returns the separator and cover pages printed ahead of attachment, separators are only printed
+// between documents
+func (cmd *Command) leadingPages(attachment *Attachment, between bool) ([]string, error) {
+
+	var pages []string
+
+	if cmd.cfg.Separator.Enabled && between {
+		page, err := cmd.separatorPage(attachment)
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, page)
+	}
+
+	if cmd.cfg.Cover.Enabled {
+		page, err := cmd.coverPage(attachment)
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, page)
+	}
+
+	return pages, nil
+}
+
+// withLeadingPages returns attachment to be printed with its separator and cover pages; PDF documents get them
+// prepended, other documents are preceded by a job of its own. Without such pages attachment is returned as is.
+func (cmd *Command) withLeadingPages(attachment *Attachment, between bool) *Attachment {
+
+	pages, err := cmd.leadingPages(attachment, between)
+	if err != nil {
+		cmd.logpad("Cover", attachment.Name, err.Error())
+	}
+	if len(pages) == 0 {
+		return attachment
+	}
+
+	if filter.FileExt(attachment.File) != "pdf" {
+		for i, page := range pages {
+			c := *attachment
+			c.File = page
+			c.Lead = i + 1
+			job, err := cmd.printfile(&c)
+			if err != nil {
+				cmd.logpad("Cover", attachment.Name, err.Error())
+				return attachment
+			}
+			cmd.logverb("Cover", job)
+		}
+		return attachment
+	}
+
+	out := strings.TrimSuffix(attachment.File, ".pdf") + ".lead.pdf"
+	if err := api.MergeCreateFile(append(pages, attachment.File), out, pdfcpu.NewDefaultConfiguration()); err != nil {
+		cmd.logpad("Cover", attachment.Name, err.Error())
+		return attachment
+	}
+
+	covered := *attachment
+	covered.File = out
+
+	return &covered
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"time"
+)
+
+// Processed records when a mail has been processed
+type Processed struct {
+	Time     time.Time     `json:"time"`
+	Tracking string        `json:"tracking"`
+	Job      printer.JobID `json:"job,omitempty"`
+}
+
+// processedKeys returns the state keys identifying m by Message-ID and UID
+func (cmd *Command) processedKeys(m *Mail) []string {
+	var keys []string
+	if m.MessageID != "" {
+		keys = append(keys, "msgid:"+m.MessageID)
+	}
+	if m.UID != 0 && cmd.mbox != nil {
+		keys = append(keys, fmt.Sprintf("uid:%s:%d:%d", cmd.mbox.Name, cmd.mbox.UidValidity, m.UID))
+	}
+	return keys
+}
+
+// isProcessed checks if m has already been processed by a previous run
+func (cmd *Command) isProcessed(m *Mail) bool {
+
+	if m.Canary != "" {
+		return false
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return false
+	}
+
+	for _, key := range cmd.processedKeys(m) {
+		var p Processed
+		if ok, _ := db.get(BucketProcessed, key, &p); ok {
+			cmd.logpad("Duplicate", m.Subject, tr("processed"), p.Time.Format(time.RFC1123), p.Tracking)
+			return true
+		}
+	}
+
+	return false
+}
+
+// markProcessed records mails as processed so they are never printed twice and prunes expired records
+func (cmd *Command) markProcessed(mails []*Mail) {
+
+	// Mails not printed because of --no-print are still to be printed by a real run
+	if cmd.NoPrint {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	for _, m := range mails {
+		// Held mails stay in the mailbox and are looked at again
+		if m.Canary != "" || m.Held {
+			continue
+		}
+		for _, key := range cmd.processedKeys(m) {
+			if err := db.put(BucketProcessed, key, Processed{Time: now, Tracking: m.Tracking}); err != nil {
+				cmd.logpad("State DB", err.Error())
+			}
+		}
+	}
+
+	cmd.pruneProcessed(db)
+}
+
+// consumed checks if the document with hash of the mail with tracking id has already been printed from the queue
+func (cmd *Command) consumed(tracking string, hash string) bool {
+
+	if cmd.DryRun {
+		return false
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return false
+	}
+
+	key := "doc:" + tracking + ":" + hash
+
+	var p Processed
+	ok, _ := db.get(BucketProcessed, key, &p)
+
+	return ok
+}
+
+// consume records the queued document with hash of the mail tracking as printed
+func (cmd *Command) consume(tracking string, hash string) {
+
+	if cmd.NoPrint {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	key := "doc:" + tracking + ":" + hash
+
+	if err := db.put(BucketProcessed, key, Processed{Time: time.Now(), Tracking: tracking}); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// alreadyPrinted checks if a document with the same content as attachment has been printed before,
+// the mail of attachment is then satisfied by the earlier job and linked to it in the history
+func (cmd *Command) alreadyPrinted(attachment *Attachment) bool {
+
+	if !cmd.cfg.Dedup.Content {
+		return false
+	}
+
+	hash, err := fileHash(attachment.File)
+	if err != nil {
+		cmd.logpad("Fingerprint", attachment.Name, err.Error())
+		return false
+	}
+	attachment.Hash = hash
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return false
+	}
+
+	var p Processed
+	if ok, _ := db.get(BucketProcessed, "sha256:"+hash, &p); !ok {
+		return false
+	}
+
+	cmd.logpad("Already Printed", attachment.jobName(), p.Tracking, p.Time.Format(time.RFC1123))
+
+	if cmd.DryRun {
+		return true
+	}
+
+	attachment.DuplicateOf = p.Tracking
+	if attachment.Mail != nil {
+		attachment.Mail.outcome(attachment.Name, OutcomePrinted, p.Job, fmt.Sprintf(tr("already printed for %s"), p.Tracking))
+		attachment.Mail.Jobs = append(attachment.Mail.Jobs, p.Job)
+	}
+	cmd.record(attachment, p.Job)
+
+	return true
+}
+
+// fingerprint records the content of the printed attachment so copies arriving by other routes are not printed again
+func (cmd *Command) fingerprint(attachment *Attachment, job printer.JobID) {
+
+	if attachment.Hash == "" {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	p := Processed{Time: time.Now(), Job: job}
+	if attachment.Mail != nil {
+		p.Tracking = attachment.Mail.Tracking
+	}
+	if err := db.put(BucketProcessed, "sha256:"+attachment.Hash, p); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// pruneProcessed removes records older than the retention time
+func (cmd *Command) pruneProcessed(db *Store) {
+
+	now := time.Now()
+
+	var expired []string
+	_ = db.each(BucketProcessed, func(key string, data []byte) error {
+		var p Processed
+		if err := json.Unmarshal(data, &p); err != nil || now.Sub(p.Time) > cmd.cfg.Dedup.Retention {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	for _, key := range expired {
+		_ = db.del(BucketProcessed, key)
+	}
+}
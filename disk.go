@@ -0,0 +1,62 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// ErrDiskUnsupported is returned if free disk space can't be determined on this platform
+var ErrDiskUnsupported = errors.New("free disk space not supported on this platform")
+
+// diskLow checks free space of the work directories and reports if processing has to be paused
+func (cmd *Command) diskLow() bool {
+
+	min := cmd.cfg.Disk.MinFree
+	if min <= 0 {
+		return false
+	}
+
+	paths := append([]string{cmd.TmpDir, filepath.Dir(cmd.cfg.StateDB)}, cmd.cfg.Disk.Paths...)
+
+	low := false
+
+	for _, path := range paths {
+
+		free, err := freeSpace(path)
+		if err != nil {
+			cmd.logverb("Disk", path, err.Error())
+			continue
+		}
+
+		cmd.logverb("Disk", path, free, tr("bytes free"))
+
+		if free >= uint64(min) {
+			continue
+		}
+
+		low = true
+		cmd.logpad("Disk", path, free, "<", min)
+		cmd.alert(
+			"disk:"+path,
+			fmt.Sprintf(tr("Low disk space on %s"), path),
+			fmt.Sprintf(tr("Only %d bytes are free on %s (minimum %d). Processing is paused until space is freed."), free, path, min),
+		)
+	}
+
+	return low
+}
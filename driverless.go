@@ -0,0 +1,64 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/mrccnt/imap-print/printer"
+)
+
+// target returns the printer the jobs of attachment are submitted to, the printer of the profile of its sender if
+// set; the device URI of a queue that fell back to driverless printing
+func (cmd *Command) target(attachment *Attachment) string {
+	prt := cmd.cfg.Cups.Printer
+	if attachment != nil {
+		if p := cmd.profile(attachment); p != nil && p.Printer != "" {
+			prt = p.Printer
+		}
+	}
+	return cmd.resolve(prt)
+}
+
+// resolve returns the printer jobs for the printer prt go to, the IPP Everywhere printer if prt fell back to it
+func (cmd *Command) resolve(prt string) string {
+	if uri, ok := cmd.fallbacks[prt]; ok {
+		return uri
+	}
+	return prt
+}
+
+// driverless returns the IPP Everywhere printer behind the cups queue p after it rejected the format of a document,
+// nil if there is none; later jobs of the run go to the printer directly
+func (cmd *Command) driverless(p printer.Printer) *printer.IPP {
+
+	queue, ok := p.(*printer.CUPS)
+	if !ok || !cmd.cfg.Cups.Driverless {
+		return nil
+	}
+
+	dev, err := queue.Driverless(cmd.cfg.Cups.Ghostscript)
+	if err != nil {
+		cmd.logpad("Driverless", queue.Name, err.Error())
+		return nil
+	}
+
+	cmd.logpad("Driverless", queue.Name, tr("Falling back to"), dev.URI)
+
+	if cmd.fallbacks == nil {
+		cmd.fallbacks = map[string]string{}
+	}
+	cmd.fallbacks[queue.Name] = dev.URI
+
+	return dev
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/mrccnt/imap-print/dropfetch"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DropFolder is the folder name of drop folder documents in logs and reports
+const DropFolder = "drop"
+
+// dropping checks if a drop folder is configured
+func (cmd *Command) dropping() bool {
+	return cmd.cfg.Drop.URL != ""
+}
+
+// dropOnly checks if the drop folder replaces the mailbox
+func (cmd *Command) dropOnly() bool {
+	return cmd.dropping() && cmd.cfg.IMAP.Addr == ""
+}
+
+// dropFolder returns the drop folder URL without credentials for logging
+func (cmd *Command) dropFolder() string {
+	u, err := url.Parse(cmd.cfg.Drop.URL)
+	if err != nil || cmd.cfg.Drop.URL == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// processDrop prints the documents of the drop folder like mails with a single attachment each,
+// the files are removed from the drop folder once recorded as processed
+func (cmd *Command) processDrop() error {
+
+	defer cmd.reportFolder(DropFolder)()
+
+	src, err := dropfetch.Open(cmd.cfg.Drop.URL, dropfetch.Options{
+		Timeout: cmd.cfg.Drop.Timeout,
+		SFTPBin: cmd.cfg.Drop.SFTPBin,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	files, err := cmd.dropFiles(src)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		cmd.logpad("No Documents", tr("Nothing to do..."))
+		return nil
+	}
+
+	if limit := cmd.cfg.Limit; limit > 0 && len(files) > limit {
+		cmd.logpad("Limit", limit, tr("of"), len(files))
+		files = files[:limit]
+	}
+
+	var mails []*Mail
+	var names []string
+	for _, f := range files {
+		m, err := cmd.dropMail(src, f)
+		if err != nil {
+			// Left in the drop folder and retried next run
+			cmd.logpad("Drop", f.Name, err.Error())
+			continue
+		}
+		if cmd.isProcessed(m) {
+			cmd.removeDrop(src, f.Name)
+			continue
+		}
+		mails = append(mails, m)
+		names = append(names, f.Name)
+	}
+
+	attachments := cmd.getAttachments(mails)
+	cmd.mailEvents(mails)
+
+	if cmd.cfg.Queue.Role == RoleFetch {
+		if attachments, err = cmd.enqueue(attachments); err != nil {
+			return err
+		}
+	}
+
+	// Recorded before printing, a crash must not lead to printing twice
+	cmd.markProcessed(mails)
+
+	for i, m := range mails {
+		if !m.Held {
+			cmd.removeDrop(src, names[i])
+		}
+	}
+
+	cmd.doprint(attachments)
+
+	// Queued mails are followed up by the print role
+	all := mails
+	mails = unqueued(mails)
+
+	cmd.confirm(mails)
+	cmd.notifyAdmin(mails)
+	cmd.notifyDesktop(mails)
+	cmd.account(mails)
+	cmd.reportMails(all)
+
+	cmd.cleanup()
+
+	return nil
+}
+
+// dropFiles lists the drop folder twice DROP_SETTLE apart and returns the files whose size did not change,
+// scanners writing slowly must not have half uploaded documents printed
+func (cmd *Command) dropFiles(src dropfetch.Source) ([]dropfetch.File, error) {
+
+	files, err := src.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 || cmd.cfg.Drop.Settle <= 0 {
+		return files, nil
+	}
+
+	time.Sleep(cmd.cfg.Drop.Settle)
+
+	after, err := src.List()
+	if err != nil {
+		return nil, err
+	}
+
+	stable := dropfetch.Stable(files, after)
+	if n := len(after) - len(stable); n > 0 {
+		cmd.logverb("Drop", n, tr("Still uploading"))
+	}
+
+	return stable, nil
+}
+
+// dropMail downloads f into the temp dir and wraps it into a mail from the sender attributed to its file name,
+// the Message-ID is derived from the content so a document dropped twice is printed once
+func (cmd *Command) dropMail(src dropfetch.Source, f dropfetch.File) (*Mail, error) {
+
+	m := &Mail{
+		Tracking:    trackingID(),
+		Date:        time.Now(),
+		From:        cmd.dropSender(f.Name),
+		Subject:     f.Name,
+		Attachments: []*Attachment{},
+	}
+
+	if max := cmd.cfg.MaxAttachmentSize; max > 0 && f.Size > max {
+		cmd.logpad("Attachment Size", f.Name, ">", max)
+		m.MessageID = fmt.Sprintf("%s-%d@%s", f.Name, f.Size, DropFolder)
+		m.Errors = append(m.Errors, f.Name+": "+fmt.Sprintf(tr("%s (limit %d bytes)"), tr(ErrAttachSize.Error()), max))
+		return m, nil
+	}
+
+	file, err := ioutil.TempFile(cmd.TmpDir, "*_"+f.Name)
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+	_ = file.Close()
+
+	if err := src.Fetch(f.Name, path); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	sum, err := fileHash(path)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	m.MessageID = sum + "@" + DropFolder
+
+	cmd.logverb("Drop", f.Name, m.From)
+
+	m.Attachments = append(m.Attachments, cmd.sniff(&Attachment{
+		File: path,
+		Name: f.Name,
+		Mail: m,
+	}))
+
+	return m, nil
+}
+
+// dropSender returns the address of the first DROP_SENDERS glob matching name case insensitively, DROP_SENDER otherwise
+func (cmd *Command) dropSender(name string) string {
+
+	for _, entry := range cmd.cfg.Drop.Senders {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			continue
+		}
+		glob := strings.ToLower(strings.TrimSpace(entry[:i]))
+		if ok, _ := filepath.Match(glob, strings.ToLower(name)); ok {
+			return strings.TrimSpace(entry[i+1:])
+		}
+	}
+
+	return cmd.cfg.Drop.Sender
+}
+
+// removeDrop deletes the processed file name from the drop folder unless deleting is disabled
+func (cmd *Command) removeDrop(src dropfetch.Source, name string) {
+
+	if cmd.NoModify {
+		return
+	}
+
+	if err := src.Remove(name); err != nil {
+		cmd.logpad("Drop", name, err.Error())
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dropfetch
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FTPPort is the default FTP control port
+const FTPPort = "21"
+
+// ErrPassive is returned if the server's passive mode reply cannot be parsed
+var ErrPassive = errors.New("invalid passive mode reply")
+
+var (
+	epsvPort = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+	pasvAddr = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+)
+
+// FTP is a drop folder on an FTP server, with explicit TLS (AUTH TLS) for ftps:// URLs
+type FTP struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	host    string
+	tls     *tls.Config
+	timeout time.Duration
+}
+
+// dialFTP connects, logs in and changes to the directory of u
+func dialFTP(u *url.URL, secure bool, timeout time.Duration) (*FTP, error) {
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), FTPPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FTP{conn: conn, text: textproto.NewConn(conn), host: u.Hostname(), timeout: timeout}
+
+	if err := f.login(u, secure); err != nil {
+		_ = f.conn.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// login greets the server, upgrades to TLS if secure and logs in anonymously if u has no user
+func (f *FTP) login(u *url.URL, secure bool) error {
+
+	f.deadline()
+	if _, _, err := f.text.ReadResponse(2); err != nil {
+		return err
+	}
+
+	if secure {
+		if _, err := f.cmd(2, "AUTH TLS"); err != nil {
+			return err
+		}
+		// Data connections resume the TLS session of the control connection, some servers insist on it
+		f.tls = &tls.Config{ServerName: f.host, ClientSessionCache: tls.NewLRUClientSessionCache(0)}
+		f.conn = tls.Client(f.conn, f.tls)
+		f.text = textproto.NewConn(f.conn)
+	}
+
+	user, pass := "anonymous", "anonymous"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+
+	code, err := f.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		if _, err := f.cmd(2, "PASS %s", pass); err != nil {
+			return err
+		}
+	} else if code/100 != 2 {
+		return &textproto.Error{Code: code, Msg: "USER"}
+	}
+
+	if secure {
+		if _, err := f.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err := f.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.cmd(2, "TYPE I"); err != nil {
+		return err
+	}
+
+	if dir := strings.TrimPrefix(u.Path, "/"); dir != "" {
+		if _, err := f.cmd(2, "CWD %s", dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List returns the regular files of the drop folder, entries without a size are directories
+func (f *FTP) List() ([]File, error) {
+
+	r, err := f.transfer("NLST")
+	if err != nil {
+		// Some servers answer an empty directory with "no files found"
+		var te *textproto.Error
+		if errors.As(err, &te) && te.Code == 450 {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	lines := textproto.NewReader(bufio.NewReader(r))
+	for {
+		line, err := lines.ReadLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		if name := path.Base(strings.TrimSpace(line)); name != "" && name != "." && name != ".." {
+			names = append(names, name)
+		}
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, name := range names {
+		code, msg, err := f.reply("SIZE %s", name)
+		if err != nil {
+			return nil, err
+		}
+		if code != 213 {
+			continue
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: name, Size: size})
+	}
+
+	return files, nil
+}
+
+// Fetch downloads the file name to dst
+func (f *FTP) Fetch(name string, dst string) error {
+
+	r, err := f.transfer("RETR %s", name)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		_ = r.Close()
+		return err
+	}
+
+	_, err = io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Remove deletes the file name
+func (f *FTP) Remove(name string) error {
+	_, err := f.cmd(2, "DELE %s", name)
+	return err
+}
+
+// Close logs out and closes the control connection
+func (f *FTP) Close() error {
+	_, _ = f.cmd(2, "QUIT")
+	return f.conn.Close()
+}
+
+// deadline limits the next exchange on the control connection to the timeout
+func (f *FTP) deadline() {
+	if f.timeout > 0 {
+		_ = f.conn.SetDeadline(time.Now().Add(f.timeout))
+	}
+}
+
+// reply sends a command and returns the reply whatever its code
+func (f *FTP) reply(format string, args ...interface{}) (int, string, error) {
+
+	f.deadline()
+
+	id, err := f.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	f.text.StartResponse(id)
+	defer f.text.EndResponse(id)
+
+	return f.text.ReadResponse(0)
+}
+
+// cmd sends a command and expects a reply starting with the digit expect, any reply if 0
+func (f *FTP) cmd(expect int, format string, args ...interface{}) (int, error) {
+
+	f.deadline()
+
+	id, err := f.text.Cmd(format, args...)
+	if err != nil {
+		return 0, err
+	}
+	f.text.StartResponse(id)
+	defer f.text.EndResponse(id)
+
+	code, _, err := f.text.ReadResponse(expect)
+
+	return code, err
+}
+
+// transfer opens a passive data connection and starts the transfer command on it,
+// closing the returned reader waits for the server to confirm the transfer
+func (f *FTP) transfer(format string, args ...interface{}) (io.ReadCloser, error) {
+
+	data, err := f.passive()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.cmd(1, format, args...); err != nil {
+		_ = data.Close()
+		return nil, err
+	}
+
+	if f.tls != nil {
+		data = tls.Client(data, f.tls)
+	}
+	if f.timeout > 0 {
+		_ = data.SetDeadline(time.Now().Add(f.timeout))
+	}
+
+	return &dataConn{Conn: data, f: f}, nil
+}
+
+// passive opens a data connection with EPSV, falling back to PASV for old servers
+func (f *FTP) passive() (net.Conn, error) {
+
+	host, _, err := net.SplitHostPort(f.conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	var port string
+	code, msg, err := f.reply("EPSV")
+	if err == nil && code == 229 {
+		m := epsvPort.FindStringSubmatch(msg)
+		if m == nil {
+			return nil, ErrPassive
+		}
+		port = m[1]
+	} else {
+		code, msg, err = f.reply("PASV")
+		if err != nil {
+			return nil, err
+		}
+		if code != 227 {
+			return nil, &textproto.Error{Code: code, Msg: msg}
+		}
+		m := pasvAddr.FindStringSubmatch(msg)
+		if m == nil {
+			return nil, ErrPassive
+		}
+		// The advertised address is ignored, servers behind NAT often announce their private one
+		hi, _ := strconv.Atoi(m[5])
+		lo, _ := strconv.Atoi(m[6])
+		port = strconv.Itoa(hi<<8 | lo)
+	}
+
+	return net.DialTimeout("tcp", net.JoinHostPort(host, port), f.timeout)
+}
+
+// dataConn is the data connection of a running transfer
+type dataConn struct {
+	net.Conn
+	f *FTP
+}
+
+// Close closes the data connection and reads the final reply of the transfer
+func (d *dataConn) Close() error {
+
+	if err := d.Conn.Close(); err != nil {
+		return err
+	}
+
+	d.f.deadline()
+	_, _, err := d.f.text.ReadResponse(2)
+
+	return err
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dropfetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors of sftp:// drop folders
+var (
+	ErrSFTPPassword = errors.New("sftp drop folders need key authentication, passwords are not supported")
+	ErrSFTPName     = errors.New("file name not supported by sftp batch mode")
+	ErrSFTPTimeout  = errors.New("sftp timed out")
+)
+
+// lsLong matches the regular files of "ls -l" in sftp, group 1 is the size and group 2 the name
+var lsLong = regexp.MustCompile(`^-\S+\s+\d+\s+\S+\s+\S+\s+(\d+)\s+\w{3}\s+\d+\s+[\d:]+\s+(.+)$`)
+
+// SFTP is a drop folder on an SSH server, accessed in batch mode of the OpenSSH sftp client
+// with the keys of the ssh agent, ~/.ssh or the identity query parameter
+type SFTP struct {
+	Bin     string
+	Timeout time.Duration
+	dir     string
+	args    []string
+}
+
+// newSFTP prepares the sftp arguments of u, no connection is kept open between the operations
+func newSFTP(u *url.URL, bin string, timeout time.Duration) (*SFTP, error) {
+
+	if _, ok := u.User.Password(); ok {
+		return nil, ErrSFTPPassword
+	}
+
+	if bin == "" {
+		bin = "sftp"
+	}
+
+	args := []string{"-b", "-", "-oBatchMode=yes"}
+	if timeout > 0 {
+		args = append(args, fmt.Sprintf("-oConnectTimeout=%d", int(timeout.Seconds())))
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-P", port)
+	}
+	if identity := u.Query().Get("identity"); identity != "" {
+		args = append(args, "-i", identity)
+	}
+
+	host := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		host = u.User.Username() + "@" + host
+	}
+	args = append(args, host)
+
+	dir := strings.TrimPrefix(u.Path, "/")
+	if dir == "" {
+		dir = "."
+	}
+	if strings.ContainsAny(dir, "\"\n") {
+		return nil, ErrSFTPName
+	}
+
+	return &SFTP{Bin: bin, Timeout: timeout, dir: dir, args: args}, nil
+}
+
+// List implements Source
+func (s *SFTP) List() ([]File, error) {
+
+	out, err := s.run(fmt.Sprintf("cd \"%s\"\nls -l\n", s.dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, line := range strings.Split(out, "\n") {
+		m := lsLong.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		size, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: path.Base(m[2]), Size: size})
+	}
+
+	return files, nil
+}
+
+// Fetch implements Source
+func (s *SFTP) Fetch(name string, dst string) error {
+
+	if strings.ContainsAny(name+dst, "\"\n") {
+		return ErrSFTPName
+	}
+
+	_, err := s.run(fmt.Sprintf("get \"%s\" \"%s\"\n", path.Join(s.dir, name), dst))
+
+	return err
+}
+
+// Remove implements Source
+func (s *SFTP) Remove(name string) error {
+
+	if strings.ContainsAny(name, "\"\n") {
+		return ErrSFTPName
+	}
+
+	_, err := s.run(fmt.Sprintf("rm \"%s\"\n", path.Join(s.dir, name)))
+
+	return err
+}
+
+// Close implements Source, every operation runs its own session
+func (s *SFTP) Close() error {
+	return nil
+}
+
+// run executes the batch script in a new sftp session and returns its output
+func (s *SFTP) run(script string) (string, error) {
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Bin, s.args...)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ErrSFTPTimeout
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"image"
+	"os"
+	"strings"
+)
+
+// Duplex modes selectable with DUPLEX and in duplex rules
+const (
+	DuplexOff   = "off"
+	DuplexLong  = "long"
+	DuplexShort = "short"
+	DuplexAuto  = "auto"
+)
+
+// DuplexRule selects the duplex mode of matching documents of matching senders
+type DuplexRule struct {
+	Match      string
+	Mode       string
+	Extensions []string
+}
+
+// matches checks if rule applies to attachment with extension ext
+func (r *DuplexRule) matches(attachment *Attachment, ext string) bool {
+	if len(r.Extensions) > 0 && !inArrStr(ext, r.Extensions) {
+		return false
+	}
+	return ruleMatches(r.Match, attachment)
+}
+
+// sides returns the IPP sides value for attachment, empty to leave it to the printer default
+func (cmd *Command) sides(attachment *Attachment) string {
+
+	mode := cmd.cfg.Duplex.Mode
+	if p := cmd.profile(attachment); p != nil && p.Duplex != "" {
+		mode = p.Duplex
+	}
+
+	rules, err := loadDuplexRules(cmd.cfg.Duplex.Rules)
+	if err != nil {
+		cmd.logpad("Duplex Rules", err.Error())
+	}
+
+	ext := filter.FileExt(attachment.Name)
+	for _, r := range rules {
+		if r.matches(attachment, ext) {
+			mode = r.Mode
+			break
+		}
+	}
+
+	switch mode {
+	case DuplexOff:
+		return printer.SidesOneSided
+	case DuplexLong:
+		return printer.SidesLongEdge
+	case DuplexShort:
+		return printer.SidesShortEdge
+	case DuplexAuto:
+		// Landscape pages are turned over the short edge, otherwise their back side is upside down
+		if landscape(attachment.File) {
+			return printer.SidesShortEdge
+		}
+		return printer.SidesLongEdge
+	}
+
+	return ""
+}
+
+// landscape checks if the first page of a PDF document or an image is wider than high
+func landscape(file string) bool {
+
+	if filter.FileExt(file) == "pdf" {
+		dims, err := api.PageDimsFile(file)
+		if err != nil || len(dims) == 0 {
+			return false
+		}
+		return dims[0].Landscape()
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	c, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return false
+	}
+
+	return c.Width > c.Height
+}
+
+// loadDuplexRules reads the rules of file ("<address|domain|*> <off|long|short|auto> [extensions seperated by :]"
+// per line)
+func loadDuplexRules(file string) ([]*DuplexRule, error) {
+
+	if file == "" {
+		return nil, nil
+	}
+
+	f, err := openRules(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*DuplexRule
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		mode := strings.ToLower(fields[1])
+		if !inArrStr(mode, []string{DuplexOff, DuplexLong, DuplexShort, DuplexAuto}) {
+			return rules, fmt.Errorf("unknown duplex mode %q", fields[1])
+		}
+		r := &DuplexRule{Match: strings.ToLower(fields[0]), Mode: mode}
+		if len(fields) > 2 {
+			r.Extensions = strings.Split(strings.ToLower(fields[2]), ":")
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, scanner.Err()
+}
@@ -0,0 +1,268 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Modes of duplicate detection among the attachments of a mail
+const (
+	DedupOff   = "off"
+	DedupHash  = "hash"
+	DedupPages = "pages"
+)
+
+// Size of the page difference hash, hashCols-1 by hashRows bits, neighbouring cells within hashTolerance
+// gray levels count as equal so scanner noise in blank areas does not flip bits
+const (
+	hashCols      = 17
+	hashRows      = 16
+	hashTolerance = 4
+)
+
+// ErrNoPages is returned if a document renders to no pages
+var ErrNoPages = errors.New("no pages rendered")
+
+// pageHash is the difference hash of a page: each bit tells if a cell of a coarse grid is brighter than its right neighbour
+type pageHash [(hashCols - 1) * hashRows / 64]uint64
+
+// distance returns the number of differing bits of h and o
+func (h pageHash) distance(o pageHash) int {
+	d := 0
+	for i := range h {
+		d += bits.OnesCount64(h[i] ^ o[i])
+	}
+	return d
+}
+
+// fingerprint identifies the content of an attachment, pages is nil if it could not be rendered
+type fingerprint struct {
+	hash  string
+	pages []pageHash
+}
+
+// duplicates returns the attachments of m without the copies of the same document, some scanners attach a scan
+// both as PDF and TIFF; a PDF is kept over other types, otherwise the first copy
+func (cmd *Command) duplicates(m *Mail, attachments []*Attachment) []*Attachment {
+
+	mode := cmd.cfg.Dedup.Attachments
+	if mode == DedupOff || len(attachments) < 2 {
+		return attachments
+	}
+
+	prints := make(map[*Attachment]*fingerprint, len(attachments))
+	hashed := func(a *Attachment) *fingerprint {
+		if fp, ok := prints[a]; ok {
+			return fp
+		}
+		fp := &fingerprint{}
+		if hash, err := fileHash(a.File); err == nil {
+			fp.hash = hash
+		}
+		prints[a] = fp
+		return fp
+	}
+	rendered := func(a *Attachment) *fingerprint {
+		fp := hashed(a)
+		if fp.pages == nil {
+			pages, err := cmd.pageHashes(a.File)
+			if err != nil {
+				cmd.logverb("Fingerprint", a.Name, err.Error())
+				pages = []pageHash{}
+			}
+			fp.pages = pages
+		}
+		return fp
+	}
+
+	same := func(a *Attachment, b *Attachment) bool {
+		fa, fb := hashed(a), hashed(b)
+		if fa.hash != "" && fa.hash == fb.hash {
+			return true
+		}
+		// Page content is only compared across file types, two PDFs of the same template must both be printed
+		if mode != DedupPages || filter.FileExt(a.Name) == filter.FileExt(b.Name) {
+			return false
+		}
+		return similarPages(rendered(a).pages, rendered(b).pages, cmd.cfg.Dedup.Distance)
+	}
+
+	var kept []*Attachment
+	for _, a := range attachments {
+		i := -1
+		for j, k := range kept {
+			if same(k, a) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			kept = append(kept, a)
+			continue
+		}
+		dup := a
+		if filter.FileExt(a.File) == "pdf" && filter.FileExt(kept[i].File) != "pdf" {
+			dup, kept[i] = kept[i], a
+		}
+		cmd.logpad("Duplicate", dup.Name, kept[i].Name)
+		m.outcome(dup.Name, OutcomeSkipped, 0, fmt.Sprintf(tr("same document as %s"), kept[i].Name))
+	}
+
+	return kept
+}
+
+// similarPages checks if a and b have the same number of pages and all their pages differ in at most max bits
+func similarPages(a []pageHash, b []pageHash, max int) bool {
+
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].distance(b[i]) > max {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pageHashes renders the pages of file at low resolution and returns their difference hashes,
+// images Go can decode are read directly, PDFs and other images are rendered by the configured renderers
+func (cmd *Command) pageHashes(file string) ([]pageHash, error) {
+
+	if img, err := decodeImage(file); err == nil {
+		return []pageHash{dhash(img)}, nil
+	}
+
+	renderer := cmd.cfg.Dedup.ImageRenderer
+	if filter.FileExt(file) == "pdf" {
+		renderer = cmd.cfg.Dedup.PDFRenderer
+	}
+	if renderer == "" {
+		return nil, ErrNoPages
+	}
+
+	dir, err := ioutil.TempDir(cmd.TmpDir, "pages-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	out := filepath.Join(dir, "page-%03d.png")
+
+	var args []string
+	for _, arg := range strings.Fields(renderer) {
+		arg = strings.Replace(arg, "{in}", file, -1)
+		arg = strings.Replace(arg, "{out}", out, -1)
+		args = append(args, arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.Dedup.Timeout)
+	defer cancel()
+
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		cmd.logverb("Render Output", string(output))
+		return nil, err
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, ErrNoPages
+	}
+
+	var pages []pageHash
+	for _, f := range files {
+		img, err := decodeImage(f)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, dhash(img))
+	}
+
+	return pages, nil
+}
+
+// decodeImage decodes the image file in one of the registered formats
+func decodeImage(file string) (image.Image, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	img, _, err := image.Decode(f)
+
+	return img, err
+}
+
+// dhash returns the difference hash of img, the average brightness of a hashCols by hashRows grid
+// sampled at most 16 by 16 times per cell is compared between horizontal neighbours
+func dhash(img image.Image) pageHash {
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var grid [hashRows][hashCols]float64
+	for row := 0; row < hashRows; row++ {
+		y0, y1 := b.Min.Y+row*h/hashRows, b.Min.Y+(row+1)*h/hashRows
+		for col := 0; col < hashCols; col++ {
+			x0, x1 := b.Min.X+col*w/hashCols, b.Min.X+(col+1)*w/hashCols
+			sy, sx := (y1-y0)/16+1, (x1-x0)/16+1
+			var sum, n float64
+			for y := y0; y < y1; y += sy {
+				for x := x0; x < x1; x += sx {
+					sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+					n++
+				}
+			}
+			if n > 0 {
+				grid[row][col] = sum / n
+			}
+		}
+	}
+
+	var hash pageHash
+	i := 0
+	for row := 0; row < hashRows; row++ {
+		for col := 0; col < hashCols-1; col++ {
+			if grid[row][col] > grid[row][col+1]+hashTolerance {
+				hash[i/64] |= 1 << uint(i%64)
+			}
+			i++
+		}
+	}
+
+	return hash
+}
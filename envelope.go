@@ -0,0 +1,191 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/mrccnt/imap-print/filter"
+	"strings"
+	"time"
+)
+
+// Header fields fetched along with the envelope
+var envelopeFields = []string{CanaryHeader, AutoSubmittedHeader, MDNHeader, ReturnPathHeader}
+
+// envelopeSection returns the body section holding the additional header fields
+func envelopeSection() *imap.BodySectionName {
+	return &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: envelopeFields},
+		Peek:         true,
+	}
+}
+
+// fetchEnvelopes returns envelope, body structure, uid and size of all messages in seqset without their bodies
+func (cmd *Command) fetchEnvelopes(c *client.Client, seqset *imap.SeqSet, msgcount uint32) ([]*imap.Message, error) {
+
+	items := []imap.FetchItem{
+		imap.FetchUid,
+		imap.FetchRFC822Size,
+		imap.FetchEnvelope,
+		imap.FetchBodyStructure,
+		envelopeSection().FetchItem(),
+	}
+
+	messages := make(chan *imap.Message, 16)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- c.Fetch(seqset, items, messages)
+	}()
+
+	envelopes := make([]*imap.Message, 0, msgcount)
+	for msg := range messages {
+		envelopes = append(envelopes, msg)
+	}
+
+	if err := <-done; err != nil {
+		return nil, err
+	}
+
+	return envelopes, nil
+}
+
+// envelopeMail returns a *Mail built from the envelope of msg
+func (cmd *Command) envelopeMail(msg *imap.Message) *Mail {
+
+	m := &Mail{
+		Tracking:    trackingID(),
+		UID:         msg.Uid,
+		Seq:         msg.SeqNum,
+		Date:        time.Now(),
+		Attachments: []*Attachment{},
+	}
+
+	if env := msg.Envelope; env != nil {
+		if !env.Date.IsZero() {
+			m.Date = env.Date
+		}
+		if len(env.From) > 0 {
+			m.From = env.From[0].Address()
+		}
+		m.Subject = env.Subject
+		m.MessageID = strings.Trim(env.MessageId, "<> ")
+	}
+
+	if r := msg.GetBody(envelopeSection()); r != nil {
+		if h, err := textproto.ReadHeader(bufio.NewReader(r)); err == nil {
+			header := mail.Header{Header: message.Header{Header: h}}
+			m.Canary = cmd.canaryOf(header.Get(CanaryHeader))
+			m.AutoSubmitted = header.Get(AutoSubmittedHeader)
+			m.MDNTo = cmd.mdnRecipient(header, m.From)
+		}
+	}
+
+	return m
+}
+
+// prefilter returns the reason why m is rejected judging by envelope and body structure of msg only,
+// an empty string means the body has to be fetched
+func (cmd *Command) prefilter(m *Mail, msg *imap.Message) string {
+
+	f := cmd.filters(m)
+
+	// RFC822.SIZE spares downloading mails which are rejected anyway
+	if max := cmd.cfg.MaxMailSize; max > 0 && m.Canary == "" && int64(msg.Size) > max {
+		return RejectMailSize
+	}
+
+	// Reports and forwarded originals need the complete mail
+	if m.Canary != "" || cmd.cfg.Filter.Policy == filter.PolicyReport || (len(cmd.cfg.Admin.Email) > 0 && cmd.cfg.Admin.Forward) {
+		return ""
+	}
+
+	if !m.isValidSender(f) {
+		return RejectSender
+	}
+
+	// Mails without printable attachments are forwarded or printed as a whole
+	if cmd.cfg.NoAttach == NoAttachForward || cmd.cfg.NoAttach == NoAttachBody {
+		return ""
+	}
+
+	if msg.BodyStructure == nil {
+		return ""
+	}
+
+	// The attachments of encrypted mails are only known after decryption
+	if (cmd.smime != nil || cmd.pgp()) && isEncryptedPart(msg.BodyStructure) {
+		return ""
+	}
+
+	var names, types []string
+	msg.BodyStructure.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if isAttachmentPart(part) {
+			name, _ := part.Filename()
+			names = append(names, name)
+			types = append(types, strings.ToLower(part.MIMEType+"/"+part.MIMESubType))
+		}
+		return true
+	})
+
+	if len(names) == 0 {
+		if cmd.cfg.PrintBody {
+			return ""
+		}
+		return RejectNoAttach
+	}
+
+	for i, name := range names {
+		ext := filter.FileExt(name)
+		if cmd.pgp() && (ext == "pgp" || ext == "gpg" || ext == "asc") {
+			return ""
+		}
+		// Files without extension are sniffed, archives may contain valid files
+		if cmd.cfg.Archive.Extract && isArchive(name) {
+			return ""
+		}
+		if (ext == "" || f.Extension(ext)) && f.MimeType(types[i]) {
+			return ""
+		}
+	}
+
+	return RejectNoValidType
+}
+
+// isEncryptedPart checks if part is an S/MIME or PGP/MIME encrypted entity
+func isEncryptedPart(part *imap.BodyStructure) bool {
+	sub := strings.ToLower(part.MIMESubType)
+	switch strings.ToLower(part.MIMEType) {
+	case "application":
+		return strings.HasSuffix(sub, "pkcs7-mime")
+	case "multipart":
+		return sub == "encrypted"
+	}
+	return false
+}
+
+// isAttachmentPart checks if part is a leaf part the mail reader treats as attachment
+func isAttachmentPart(part *imap.BodyStructure) bool {
+	if len(part.Parts) > 0 {
+		return false
+	}
+	disp := strings.ToLower(part.Disposition)
+	return disp != "inline" && (disp == "attachment" || !strings.EqualFold(part.MIMEType, "text"))
+}
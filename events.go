@@ -0,0 +1,251 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Job lifecycle events posted to the event webhook
+const (
+	EventReceived  = "mail.received"
+	EventRejected  = "mail.rejected"
+	EventSubmitted = "job.submitted"
+	EventCompleted = "job.completed"
+	EventFailed    = "job.failed"
+)
+
+// Headers of signed event requests and the age after which a job without final state is given up
+const (
+	EventSignatureHeader = "X-IMAPPrint-Signature"
+	EventTimestampHeader = "X-IMAPPrint-Timestamp"
+	EventJobMaxAge       = 24 * time.Hour
+)
+
+// Event is a job lifecycle event
+type Event struct {
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Text     string            `json:"text"`
+	Tracking string            `json:"tracking,omitempty"`
+	From     string            `json:"from,omitempty"`
+	Subject  string            `json:"subject,omitempty"`
+	Document string            `json:"document,omitempty"`
+	Printer  string            `json:"printer,omitempty"`
+	Job      printer.JobID     `json:"job,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// mailEvents posts a received event for every fetched mail and a rejected event for every rejected one
+func (cmd *Command) mailEvents(mails []*Mail) {
+
+	if cmd.cfg.Events.Webhook == "" {
+		return
+	}
+
+	for _, m := range mails {
+		if m.Canary != "" {
+			continue
+		}
+		e := mailEvent(m)
+		e.Fields = cmd.fields(m)
+		e.Type = EventReceived
+		e.Text = fmt.Sprintf("Mail %s from %s received: %s", m.Tracking, m.From, m.Subject)
+		cmd.emit(e)
+		if m.Rejected != "" {
+			e.Type = EventRejected
+			e.Reason = m.Rejected
+			e.Text = fmt.Sprintf("Mail %s from %s rejected: %s", m.Tracking, m.From, m.Rejected)
+			cmd.emit(e)
+		}
+	}
+}
+
+// jobEvent posts a submitted or failed event for attachment, submitted jobs are checked for completion on later runs
+func (cmd *Command) jobEvent(attachment *Attachment, job printer.JobID, err error) {
+
+	if cmd.cfg.Events.Webhook == "" || attachment.Canary != "" {
+		return
+	}
+
+	e := &Event{}
+	if attachment.Mail != nil {
+		e = mailEvent(attachment.Mail)
+	}
+	e.Fields = cmd.fields(attachment.Mail)
+	e.Document = attachment.Name
+	e.Printer = cmd.target(attachment)
+
+	if err != nil {
+		e.Type = EventFailed
+		e.Reason = err.Error()
+		e.Text = fmt.Sprintf("Printing %s of mail %s failed: %s", e.Document, e.Tracking, e.Reason)
+		cmd.emit(e)
+		return
+	}
+
+	e.Type = EventSubmitted
+	e.Job = job
+	e.Text = fmt.Sprintf("Printing %s of mail %s on %s as job %d", e.Document, e.Tracking, e.Printer, job)
+	cmd.emit(e)
+
+	if cmd.DryRun {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+	if err := db.put(BucketJobs, e.Printer+":"+strconv.Itoa(int(job)), e); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// jobsPending posts a completed or failed event for every submitted job that reached its final state
+func (cmd *Command) jobsPending() {
+
+	if cmd.cfg.Events.Webhook == "" || cmd.cfg.Queue.Role == RoleFetch {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	pending := map[string]*Event{}
+	_ = db.each(BucketJobs, func(key string, data []byte) error {
+		var e Event
+		if json.Unmarshal(data, &e) == nil {
+			pending[key] = &e
+		}
+		return nil
+	})
+
+	for key, e := range pending {
+
+		p, err := cmd.printer(e.Printer)
+		if err != nil {
+			cmd.logverb("Job State", key, err.Error())
+			continue
+		}
+
+		state, err := p.Status(e.Job)
+		if err != nil {
+			cmd.logverb("Job State", key, err.Error())
+		}
+		cmd.logverb("Job State", key, state)
+
+		switch state {
+		case printer.JobCompleted:
+			e.Type = EventCompleted
+			e.Text = fmt.Sprintf("Printed %s of mail %s on %s (job %d)", e.Document, e.Tracking, e.Printer, e.Job)
+		case printer.JobCanceled, printer.JobAborted:
+			e.Type = EventFailed
+			e.Reason = string(state)
+			e.Text = fmt.Sprintf("Job %d printing %s of mail %s on %s %s", e.Job, e.Document, e.Tracking, e.Printer, state)
+		default:
+			// Jobs purged by the print server never report a final state
+			if time.Since(e.Time) < EventJobMaxAge {
+				continue
+			}
+			cmd.logverb("Job State", key, "Giving up")
+			_ = db.del(BucketJobs, key)
+			continue
+		}
+
+		cmd.emit(e)
+		if !cmd.DryRun {
+			_ = db.del(BucketJobs, key)
+		}
+	}
+}
+
+// mailEvent returns an event describing m
+func mailEvent(m *Mail) *Event {
+	return &Event{
+		Tracking: m.Tracking,
+		From:     m.From,
+		Subject:  m.Subject,
+	}
+}
+
+// emit posts e to the event webhook, signed with the event secret if configured
+func (cmd *Command) emit(e *Event) {
+
+	if cmd.cfg.Events.Webhook == "" || cmd.NoNotify {
+		return
+	}
+
+	e.Time = time.Now()
+
+	if err := postSigned(cmd.cfg.Events.Webhook, cmd.cfg.Events.Secret, e); err != nil {
+		cmd.logpad("Event Webhook", e.Type, err.Error())
+		return
+	}
+
+	cmd.logverb("Event", e.Type, e.Tracking, e.Document)
+}
+
+// postSigned posts v as JSON document to url with an HMAC-SHA256 signature over timestamp and body
+func postSigned(url string, secret string, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ts + "."))
+		mac.Write(data)
+		req.Header.Set(EventTimestampHeader, ts)
+		req.Header.Set(EventSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes of imap-print runs, monitoring can tell what needs attention from them
+const (
+	// ExitOK is returned if everything was printed or there was nothing to do
+	ExitOK = 0
+	// ExitError is returned for invalid configurations and unexpected errors
+	ExitError = 1
+	// ExitPrintFailed is returned if the run completed but some documents failed to print
+	ExitPrintFailed = 2
+	// ExitAuth is returned if the IMAP server or the OAuth provider refused the credentials
+	ExitAuth = 3
+	// ExitPrinter is returned if documents failed to print because the printer was unreachable
+	ExitPrinter = 4
+	// ExitIMAP is returned if the IMAP server was unreachable or the connection got lost for good
+	ExitIMAP = 5
+	// ExitLint is returned if the run was refused because of risky configurations
+	ExitLint = 6
+)
+
+// ErrPrinterDown is the exit message of runs which could not reach the printer
+var ErrPrinterDown = errors.New("printer unreachable")
+
+// LoginError is returned if logging into the IMAP server failed for other reasons than the connection
+type LoginError struct {
+	Err error
+}
+
+// Error implements error
+func (e *LoginError) Error() string {
+	return "login: " + e.Err.Error()
+}
+
+// Unwrap returns the error of the login
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectError is returned if the IMAP server could not be reached
+type ConnectError struct {
+	Err error
+}
+
+// Error implements error
+func (e *ConnectError) Error() string {
+	return "connect: " + e.Err.Error()
+}
+
+// Unwrap returns the error of the connection
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// refused checks if err is a refused login, trying again with the same credentials doesn't help
+func refused(err error) bool {
+	var le *LoginError
+	var oe *OAuthError
+	return errors.As(err, &le) || errors.As(err, &oe)
+}
+
+// exit returns the exit code and message of a run ending with err, runs which completed
+// but failed to print documents exit with ExitPrintFailed or ExitPrinter
+func (cmd *Command) exit(err error) (int, error) {
+
+	var ce *ConnectError
+	switch {
+	case err == nil:
+	case refused(err):
+		return ExitAuth, err
+	case errors.As(err, &ce):
+		return ExitIMAP, err
+	case errors.Is(err, ErrLint):
+		return ExitLint, err
+	default:
+		return ExitError, err
+	}
+
+	r := cmd.runState
+	switch {
+	case r == nil || r.Failures == 0:
+		return ExitOK, nil
+	case r.PrinterDown:
+		return ExitPrinter, ErrPrinterDown
+	}
+
+	return ExitPrintFailed, fmt.Errorf(tr("%d document(s) failed to print"), r.Failures)
+}
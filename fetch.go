@@ -0,0 +1,172 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"errors"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/mrccnt/imap-print/imapfetch"
+	"io/ioutil"
+	"time"
+)
+
+// Pause between attempts to resume a chunked fetch
+const FetchRetryDelay = 2 * time.Second
+
+// Upper bound of the pause between reconnection attempts
+const MaxReconnectDelay = time.Minute
+
+// ErrNoBody is returned when the server didn't return the requested body section
+var ErrNoBody = errors.New("server didn't return message body")
+
+// fetchChunked downloads the body of the message with uid in chunks and resumes after connection drops
+func (cmd *Command) fetchChunked(uid uint32, size uint32) (*bytes.Buffer, error) {
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	retries := 0
+
+	for buf.Len() < int(size) {
+
+		part, err := cmd.fetchPartial(uid, buf.Len(), cmd.cfg.Fetch.ChunkSize)
+		if err != nil {
+			if retries >= cmd.cfg.Fetch.Retries {
+				return nil, err
+			}
+			retries++
+			cmd.logpad("Fetch", uid, err.Error())
+			cmd.logpad("Fetch", tr("Resuming at"), buf.Len(), tr("of"), size)
+			time.Sleep(FetchRetryDelay)
+			if err := cmd.reconnect(); err != nil {
+				// Retrying the fetch doesn't help if the credentials are refused
+				if refused(err) {
+					return nil, err
+				}
+				cmd.logpad("Reconnect", err.Error())
+			}
+			continue
+		}
+
+		// The announced size may be off; an empty chunk marks the end
+		if len(part) == 0 {
+			break
+		}
+
+		buf.Write(part)
+		retries = 0
+
+		cmd.logverb("Fetch", uid, buf.Len(), "/", size)
+	}
+
+	return buf, nil
+}
+
+// fetchPartial fetches length bytes starting at offset of the body of the message with uid
+func (cmd *Command) fetchPartial(uid uint32, offset int, length int) ([]byte, error) {
+
+	if cmd.mclient == nil {
+		return nil, client.ErrNotLoggedIn
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+
+	section := &imap.BodySectionName{Partial: []int{offset, length}}
+	messages := make(chan *imap.Message, 1)
+
+	cmd.chaosIMAP(cmd.mclient)
+
+	if err := cmd.mclient.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, messages); err != nil {
+		return nil, err
+	}
+
+	msg := <-messages
+	if msg == nil {
+		return nil, ErrNoBody
+	}
+
+	r := msg.GetBody(section)
+	if r == nil {
+		return nil, ErrNoBody
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// reconnect replaces the current IMAP connection with a new one and selects the previously selected folder again
+func (cmd *Command) reconnect() error {
+
+	folder := cmd.cfg.IMAP.Mailbox
+	if cmd.mbox != nil {
+		folder = cmd.mbox.Name
+	}
+
+	if cmd.mclient != nil {
+		_ = cmd.mclient.Terminate()
+		cmd.mclient = nil
+	}
+	if err := cmd.connect(); err != nil {
+		return err
+	}
+	if cmd.mbox.Name == folder {
+		return nil
+	}
+
+	mbox, err := cmd.mclient.Select(folder, false)
+	if err != nil {
+		return err
+	}
+	cmd.setMailbox(mbox)
+
+	return nil
+}
+
+// retry runs fn with the current IMAP client, after a lost connection it reconnects with exponential backoff
+// and runs fn again until it succeeds or IMAP_RETRIES are used up
+func (cmd *Command) retry(title string, fn func(c *client.Client) error) error {
+
+	delay := cmd.cfg.IMAP.Backoff
+
+	// Without a client the reason of the failed reconnect is reported
+	var lost error = client.ErrNotLoggedIn
+
+	for attempt := 0; ; attempt++ {
+
+		err := lost
+		if cmd.mclient != nil {
+			err = fn(cmd.mclient)
+		}
+		if err == nil || !imapfetch.Lost(cmd.mclient, err) || attempt >= cmd.cfg.IMAP.Retries {
+			return err
+		}
+
+		cmd.logpad(title, err.Error())
+		cmd.logpad("Reconnect", tr("Retrying in"), delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > MaxReconnectDelay {
+			delay = MaxReconnectDelay
+		}
+
+		if err := cmd.reconnect(); err != nil {
+			// Reconnecting again doesn't help if the credentials are refused
+			if refused(err) {
+				return err
+			}
+			cmd.logpad("Reconnect", err.Error())
+			lost = err
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/mrccnt/imap-print/filter"
+)
+
+// filters returns the sender and document filter of the configuration for m, with the extensions of the profile
+// of its sender if set
+func (cmd *Command) filters(m *Mail) filter.Filter {
+	if p := cmd.mailProfile(m); p != nil && len(p.Extensions) > 0 {
+		cfg := *cmd.cfg.Filter
+		cfg.Extensions = p.Extensions
+		return filter.New(&cfg)
+	}
+	return filter.New(cmd.cfg.Filter)
+}
+
+// report logs the filter decision about m and its attachments
+func (cmd *Command) report(m *Mail) {
+
+	if cmd.cfg.Filter.Policy != filter.PolicyReport {
+		return
+	}
+
+	decision := "print"
+	if reason := m.rejection(cmd.filters(m)); reason != "" {
+		decision = "reject: " + reason
+	}
+
+	cmd.logpad("Report", m.From, m.Subject, decision)
+
+	for _, a := range m.Attachments {
+		decision := "print"
+		if !a.isValid(cmd.filters(m)) {
+			decision = "skip: " + a.Type
+		}
+		cmd.logpad("Report", "  "+a.Name, decision)
+	}
+}
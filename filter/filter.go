@@ -0,0 +1,109 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filter decides which senders and documents are printed
+package filter
+
+import (
+	"github.com/mrccnt/imap-print/config"
+	"path/filepath"
+	"strings"
+)
+
+// Filter policies
+const (
+	// PolicyStrict rejects everything not explicitly allowed
+	PolicyStrict = "strict"
+	// PolicyLenient accepts everything not explicitly denied
+	PolicyLenient = "lenient"
+	// PolicyReport applies the strict rules but only logs the decisions
+	PolicyReport = "report"
+)
+
+// Filter decides which senders and documents may be printed
+type Filter interface {
+	// Sender checks if mails from addr may be printed
+	Sender(addr string) bool
+	// Extension checks if attachments with file extension ext may be printed
+	Extension(ext string) bool
+	// Document checks if a document with extension ext and the sniffed content type may be printed
+	Document(ext string, sniffed string) bool
+	// MimeType checks if attachments declared as content type ctype may be printed
+	MimeType(ctype string) bool
+}
+
+// policy is the Filter applying a filter configuration
+type policy struct {
+	cfg *config.FilterConfig
+}
+
+// New returns the Filter applying cfg
+func New(cfg *config.FilterConfig) Filter {
+	return &policy{cfg: cfg}
+}
+
+// Sender implements Filter
+func (p *policy) Sender(addr string) bool {
+	if contains(p.cfg.Denied, addr) {
+		return false
+	}
+	return p.cfg.Policy == PolicyLenient || contains(p.cfg.Allowed, addr)
+}
+
+// Extension implements Filter
+func (p *policy) Extension(ext string) bool {
+	if ext == "" || contains(p.cfg.DeniedExtensions, ext) {
+		return false
+	}
+	return p.cfg.Policy == PolicyLenient || contains(p.cfg.Extensions, ext)
+}
+
+// Document implements Filter
+func (p *policy) Document(ext string, sniffed string) bool {
+	return p.Extension(ext) && MatchesType(ext, sniffed)
+}
+
+// MimeType implements Filter, every type is accepted unless allowed types are configured; unlike the extensions a
+// configured list applies to every policy, it has been set on purpose
+func (p *policy) MimeType(ctype string) bool {
+	if len(p.cfg.AllowedMime) == 0 {
+		return true
+	}
+	ctype = strings.ToLower(strings.TrimSpace(ctype))
+	for _, allowed := range p.cfg.AllowedMime {
+		if strings.ToLower(strings.TrimSpace(allowed)) == ctype {
+			return true
+		}
+	}
+	return false
+}
+
+// FileExt returns the lower cased file extension of file without leading dot
+func FileExt(file string) string {
+	parts := strings.Split(filepath.Base(file), ".")
+	if len(parts) > 1 {
+		return strings.ToLower(parts[len(parts)-1])
+	}
+	return ""
+}
+
+// contains checks if a contains s
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
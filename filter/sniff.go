@@ -0,0 +1,171 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Content types detected by magic bytes in addition to http.DetectContentType
+const (
+	TypeOLE        = "application/x-ole-storage"
+	TypeExecutable = "application/x-executable"
+	TypeRTF        = "text/rtf"
+	TypeTIFF       = "image/tiff"
+	TypeHEIC       = "image/heic"
+	TypeZIP        = "application/zip"
+	TypeGZIP       = "application/x-gzip"
+	TypeOctet      = "application/octet-stream"
+	TypeText       = "text/plain"
+)
+
+// Magic byte signatures not covered by http.DetectContentType
+var signatures = []struct {
+	offset int
+	magic  []byte
+	ctype  string
+}{
+	{0, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), TypeOLE},
+	{0, []byte("MZ"), TypeExecutable},
+	{0, []byte("\x7FELF"), TypeExecutable},
+	{0, []byte("\xCA\xFE\xBA\xBE"), TypeExecutable},
+	{0, []byte("\xCF\xFA\xED\xFE"), TypeExecutable},
+	{0, []byte("#!"), TypeExecutable},
+	{0, []byte("{\\rtf"), TypeRTF},
+	{0, []byte("II*\x00"), TypeTIFF},
+	{0, []byte("MM\x00*"), TypeTIFF},
+	{4, []byte("ftypheic"), TypeHEIC},
+	{4, []byte("ftypheix"), TypeHEIC},
+	{4, []byte("ftypmif1"), TypeHEIC},
+}
+
+// Sniffed content types accepted for an extension, extensions not listed are accepted unless executable
+var extensionTypes = map[string][]string{
+	"pdf":  {"application/pdf"},
+	"ps":   {"application/postscript"},
+	"jpg":  {"image/jpeg"},
+	"jpeg": {"image/jpeg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+	"bmp":  {"image/bmp"},
+	"tif":  {TypeTIFF},
+	"tiff": {TypeTIFF},
+	"heic": {TypeHEIC},
+	"heif": {TypeHEIC},
+	"txt":  {TypeText},
+	"html": {"text/html", TypeText},
+	"htm":  {"text/html", TypeText},
+	"rtf":  {TypeRTF},
+	"doc":  {TypeOLE},
+	"xls":  {TypeOLE},
+	"ppt":  {TypeOLE},
+	"docx": {TypeZIP},
+	"xlsx": {TypeZIP},
+	"pptx": {TypeZIP},
+	"odt":  {TypeZIP},
+	"ods":  {TypeZIP},
+	"odp":  {TypeZIP},
+	"zip":  {TypeZIP},
+	"gz":   {TypeGZIP},
+	"tgz":  {TypeGZIP},
+}
+
+// Extensions used for attachments without file extension
+var typeExtensions = map[string]string{
+	"application/pdf":          "pdf",
+	"application/postscript":   "ps",
+	"image/jpeg":               "jpg",
+	"image/png":                "png",
+	"image/gif":                "gif",
+	"image/bmp":                "bmp",
+	TypeTIFF:                   "tiff",
+	TypeHEIC:                   "heic",
+	TypeText:                   "txt",
+	"text/html":                "html",
+	TypeRTF:                    "rtf",
+	TypeZIP:                    "zip",
+	"application/msword":       "doc",
+	"application/vnd.ms-excel": "xls",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   "docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         "xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": "pptx",
+	"application/vnd.oasis.opendocument.text":                                   "odt",
+	"application/vnd.oasis.opendocument.spreadsheet":                            "ods",
+}
+
+// Sniff detects the content type of file by its magic bytes
+func Sniff(file string) (string, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	return SniffBytes(head[:n]), nil
+}
+
+// SniffBytes detects the content type of data
+func SniffBytes(data []byte) string {
+
+	for _, sig := range signatures {
+		if len(data) >= sig.offset+len(sig.magic) && bytes.Equal(data[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.ctype
+		}
+	}
+
+	ctype := http.DetectContentType(data)
+	if i := strings.Index(ctype, ";"); i > 0 {
+		ctype = ctype[:i]
+	}
+
+	return ctype
+}
+
+// TypeExtension returns a file extension for attachments without one, preferring the sniffed type
+func TypeExtension(sniffed string, declared string) string {
+	if ext, ok := typeExtensions[sniffed]; ok && sniffed != TypeZIP && sniffed != TypeText && sniffed != TypeOLE {
+		return ext
+	}
+	if ext, ok := typeExtensions[strings.ToLower(declared)]; ok {
+		return ext
+	}
+	if ext, ok := typeExtensions[sniffed]; ok {
+		return ext
+	}
+	return ""
+}
+
+// MatchesType checks if the sniffed content type is plausible for extension ext
+func MatchesType(ext string, sniffed string) bool {
+	if sniffed == TypeExecutable {
+		return false
+	}
+	types, ok := extensionTypes[ext]
+	if !ok {
+		return true
+	}
+	return contains(types, sniffed)
+}
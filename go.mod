@@ -3,14 +3,20 @@ module github.com/mrccnt/imap-print
 go 1.13
 
 require (
-	github.com/caarlos0/env v3.5.0+incompatible // indirect
-	github.com/emersion/go-imap v1.0.5 // indirect
-	github.com/emersion/go-message v0.12.0 // indirect
+	github.com/caarlos0/env v3.5.0+incompatible
+	github.com/emersion/go-imap v1.0.5
+	github.com/emersion/go-message v0.12.0
+	github.com/emersion/go-sasl v0.0.0-20191210011802-430746ea8b9b
 	github.com/go-playground/universal-translator v0.17.0 // indirect
-	github.com/joho/godotenv v1.3.0 // indirect
+	github.com/joho/godotenv v1.3.0
 	github.com/leodido/go-urn v1.2.0 // indirect
-	github.com/phin1x/go-ipp v1.5.0 // indirect
-	github.com/urfave/cli/v2 v2.2.0 // indirect
+	github.com/pdfcpu/pdfcpu v0.3.13
+	github.com/phin1x/go-ipp v1.5.0
+	github.com/rabbitmq/amqp091-go v1.5.0
+	github.com/urfave/cli/v2 v2.2.0
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/text v0.3.6
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
-	gopkg.in/go-playground/validator.v9 v9.31.0 // indirect
+	gopkg.in/go-playground/validator.v9 v9.31.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,194 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/urfave/cli/v2"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is a printed document recorded in the history
+type HistoryEntry struct {
+	Time      time.Time     `json:"time"`
+	Tracking  string        `json:"tracking"`
+	From      string        `json:"from"`
+	Subject   string        `json:"subject"`
+	MessageID string        `json:"message_id"`
+	Name      string        `json:"name"`
+	Job       printer.JobID `json:"job"`
+	Text      string        `json:"text"`
+	SHA256    string        `json:"sha256,omitempty"`
+	Duplicate string        `json:"duplicate_of,omitempty"`
+	Seq       int           `json:"seq,omitempty"`
+	Printer   string        `json:"printer,omitempty"`
+}
+
+// record adds the printed attachment with its text to the history
+func (cmd *Command) record(attachment *Attachment, job printer.JobID) {
+
+	if cmd.cfg.History.Retention <= 0 {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	e := &HistoryEntry{
+		Time: time.Now(),
+		Name: attachment.Name,
+		Job:  job,
+		Text: cmd.extractText(attachment.File),
+	}
+	if m := attachment.Mail; m != nil {
+		e.Tracking = m.Tracking
+		e.From = m.From
+		e.Subject = m.Subject
+		e.MessageID = m.MessageID
+	}
+	// Copies of an earlier document are linked to the mail it was printed for
+	e.SHA256 = attachment.Hash
+	e.Duplicate = attachment.DuplicateOf
+	e.Seq = attachment.Seq
+	e.Printer = cmd.target(attachment)
+
+	key := fmt.Sprintf("%s|%s|%d", e.Time.UTC().Format(time.RFC3339Nano), e.Tracking, job)
+	if err := db.put(BucketHistory, key, e); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// extractText returns the (truncated) plain text of file using the configured extractor
+func (cmd *Command) extractText(file string) string {
+
+	var text []byte
+
+	switch filter.FileExt(file) {
+	case "txt", "csv":
+		text, _ = ioutil.ReadFile(file)
+	default:
+		if cmd.cfg.History.Extractor == "" {
+			return ""
+		}
+		var args []string
+		for _, arg := range strings.Fields(cmd.cfg.History.Extractor) {
+			args = append(args, strings.Replace(arg, "{in}", file, -1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.History.Timeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			cmd.logverb("Extract Text", file, err.Error())
+			return ""
+		}
+		text = out
+	}
+
+	s := strings.Join(strings.Fields(string(text)), " ")
+	if max := cmd.cfg.History.TextMax; max > 0 && len(s) > max {
+		s = s[:max]
+	}
+
+	return s
+}
+
+// historyPrune removes history entries older than the retention
+func (cmd *Command) historyPrune() {
+
+	if cmd.DryRun {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	since := time.Now().Add(-cmd.cfg.History.Retention).UTC().Format(time.RFC3339Nano)
+
+	var expired []string
+	_ = db.each(BucketHistory, func(key string, data []byte) error {
+		if key < since {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	for _, key := range expired {
+		_ = db.del(BucketHistory, key)
+	}
+}
+
+// historySearch is used as callable for the history search sub command
+func (cmd *Command) historySearch(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	terms := strings.Fields(strings.ToLower(strings.Join(c.Args().Slice(), " ")))
+
+	db, err := cmd.store()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	found := 0
+
+	err = db.each(BucketHistory, func(key string, data []byte) error {
+		var e HistoryEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		haystack := strings.ToLower(strings.Join([]string{e.Tracking, e.Duplicate, e.From, e.Subject, e.Name, e.Text}, " "))
+		if e.Seq > 0 {
+			haystack += fmt.Sprintf(" #%d", e.Seq)
+		}
+		for _, term := range terms {
+			if !strings.Contains(haystack, term) {
+				return nil
+			}
+		}
+		found++
+		fmt.Printf("%s  %-5s  job %-6d  %s  %q  %s\n", e.Time.Local().Format("2006-01-02 15:04"), e.Tracking, e.Job, e.From, e.Subject, e.Name)
+		if e.MessageID != "" {
+			fmt.Printf("    Message-ID: <%s>\n", e.MessageID)
+		}
+		if e.Duplicate != "" {
+			fmt.Printf("    %s %s\n", tr("Satisfied by:"), e.Duplicate)
+		}
+		if e.Seq > 0 {
+			fmt.Printf("    %s #%d\n", tr("Sequence:"), e.Seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if found == 0 {
+		cmd.logpad("History", tr("No matching documents"))
+	}
+
+	return nil
+}
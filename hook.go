@@ -0,0 +1,99 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrHookSkipped is recorded on attachments the pre-print hook refused
+var ErrHookSkipped = errors.New("skipped by pre-print hook")
+
+// HookMeta is passed as JSON on stdin to the pre-print hook
+type HookMeta struct {
+	File        string    `json:"file"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Tracking    string    `json:"tracking"`
+	From        string    `json:"from"`
+	Subject     string    `json:"subject"`
+	Date        time.Time `json:"date"`
+	Label       string    `json:"label,omitempty"`
+}
+
+// prePrint runs the pre-print hook for attachment and reports if it may be printed
+func (cmd *Command) prePrint(attachment *Attachment) bool {
+
+	if cmd.cfg.Hook.PrePrint == "" {
+		return true
+	}
+
+	meta := HookMeta{
+		File:        attachment.File,
+		Name:        attachment.Name,
+		ContentType: attachment.ContentType,
+		Label:       attachment.Label,
+	}
+	if m := attachment.Mail; m != nil {
+		meta.Tracking = m.Tracking
+		meta.From = m.From
+		meta.Subject = m.Subject
+		meta.Date = m.Date
+	}
+
+	var args []string
+	for _, arg := range strings.Fields(cmd.cfg.Hook.PrePrint) {
+		args = append(args, strings.Replace(arg, "{in}", attachment.File, -1))
+	}
+
+	stdin, err := json.Marshal(meta)
+	if err != nil {
+		cmd.logpad("Pre-Print Hook", err.Error())
+		attachment.failed(err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.Hook.Timeout)
+	defer cancel()
+
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdin = bytes.NewReader(stdin)
+	c.Env = append(os.Environ(),
+		"IMAP_PRINT_FILE="+meta.File,
+		"IMAP_PRINT_NAME="+meta.Name,
+		"IMAP_PRINT_CONTENT_TYPE="+meta.ContentType,
+		"IMAP_PRINT_TRACKING="+meta.Tracking,
+		"IMAP_PRINT_FROM="+meta.From,
+		"IMAP_PRINT_SUBJECT="+meta.Subject,
+		"IMAP_PRINT_DATE="+meta.Date.Format(time.RFC3339),
+		"IMAP_PRINT_LABEL="+meta.Label,
+	)
+
+	if output, err := c.CombinedOutput(); err != nil {
+		cmd.logpad("Pre-Print Hook", attachment.jobName(), err.Error())
+		cmd.logverb("Hook Output", strings.TrimSpace(string(output)))
+		attachment.failed(ErrHookSkipped)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,508 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/urfave/cli/v2"
+	"os"
+	"strings"
+)
+
+// DefaultLocale is used if no (supported) locale is configured
+const DefaultLocale = "en"
+
+// locale is the active locale of CLI help, errors and log messages
+var locale = DefaultLocale
+
+// Translations keyed by their english original, missing entries fall back to english
+var translations = map[string]map[string]string{
+	"de": {
+		// Application and commands
+		"Query emails and print attachments":                                                                   "E-Mails abrufen und Anhänge drucken",
+		"Print a diagnostic page (device attributes, connectivity, config hash)":                               "Eine Diagnoseseite drucken (Geräteattribute, Verbindungen, Konfigurations-Hash)",
+		"Print a test page or FILE with the configured print options, without IMAP":                            "Eine Testseite oder FILE mit den konfigurierten Druckoptionen drucken, ohne IMAP",
+		"Show the last runs, mail counts, queued mails and unfinished print jobs":                              "Die letzten Läufe, Mailzahlen, wartende Mails und unfertige Druckaufträge anzeigen",
+		"Manage print jobs submitted held":                                                                     "Zurückgehaltene Druckaufträge verwalten",
+		"List the held print jobs waiting to be released":                                                      "Die zurückgehaltenen Druckaufträge auflisten, die auf Freigabe warten",
+		"Print the held job JOB right away":                                                                    "Den zurückgehaltenen Auftrag JOB sofort drucken",
+		"Cancel the held job JOB before it is released":                                                        "Den zurückgehaltenen Auftrag JOB vor der Freigabe abbrechen",
+		"Submit print jobs held and let the print server release them after `DURATION` (0 = print right away)": "Druckaufträge zurückgehalten senden und vom Druckserver nach `DURATION` freigeben lassen (0 = sofort drucken)",
+		"List the printers of the cups server with state, media and duplex support":                            "Die Drucker des cups-Servers mit Status, Medien und Duplex-Unterstützung auflisten",
+		"No printers found": "Keine Drucker gefunden",
+		"rejecting jobs":    "nimmt keine Aufträge an",
+		"simplex":           "einseitig",
+		"duplex":            "beidseitig",
+		"Description":       "Beschreibung",
+		"Location":          "Standort",
+		"Message":           "Meldung",
+		"Media":             "Medien",
+		"Default Media":     "Standardmedium",
+		"Preview what would be printed from the pending mails without touching flags or printers": "Vorschau, was von den anstehenden Mails gedruckt würde, ohne Flags oder Drucker anzufassen",
+		"allowed":                           "erlaubt",
+		"not allowed":                       "nicht erlaubt",
+		"print":                             "drucken",
+		"reject":                            "ablehnen",
+		"Decision":                          "Entscheidung",
+		"skip: already processed":           "überspringen: bereits verarbeitet",
+		"skip: extension %q not allowed":    "überspringen: Endung %q nicht erlaubt",
+		"skip: content type %s not allowed": "überspringen: Inhaltstyp %s nicht erlaubt",
+		"skip: content %s doesn't match the extension": "überspringen: Inhalt %s passt nicht zur Endung",
+		"show help":         "Hilfe anzeigen",
+		"print the version": "Version anzeigen",
+
+		// Flags
+		"The IMAP server address `HOST:PORT`": "Die Adresse des IMAP-Servers `HOST:PORT`",
+		"The IMAP account `USER`":             "Der `BENUTZER` des IMAP-Kontos",
+		"The IMAP account `PASS`":             "Das `PASSWORT` des IMAP-Kontos",
+		"The mailbox `NAME`":                  "Der `NAME` des Postfachs",
+		"Process the semicolon separated `FOLDERS` (NAME[:PRIORITY[:BUDGET]]) lowest priority first instead of the mailbox": "Die durch Semikolon getrennten `FOLDERS` (NAME[:PRIORITÄT[:BUDGET]]) mit niedrigster Priorität zuerst statt des Postfachs verarbeiten",
+		"The cups `PRINTER` name":                                                                   "Der Name des cups-`DRUCKER`s",
+		"List of allowed sender email `ADRESSES` seperated by \":\"":                                "Liste erlaubter Absender-`ADRESSEN` getrennt durch \":\"",
+		"List of allowed `EXTENSIONS` seperated by \":\"":                                           "Liste erlaubter `ENDUNGEN` getrennt durch \":\"",
+		"State database `FILE` (alert cooldowns, ...)":                                              "`DATEI` der Zustandsdatenbank (Alarm-Sperrzeiten, ...)",
+		"Fetch and print nothing while `FILE` exists":                                               "Nichts abrufen und drucken, solange `FILE` existiert",
+		"Write a JSON record of the run (decisions, jobs, errors, timings) to `FILE`":               "Einen JSON-Bericht des Laufs (Entscheidungen, Aufträge, Fehler, Zeiten) nach `FILE` schreiben",
+		"Write Prometheus metrics of all runs to `FILE`":                                            "Prometheus-Metriken aller Läufe nach `FILE` schreiben",
+		"Also print the documents of the FTP, FTPS or SFTP drop folder `URL`":                       "Zusätzlich die Dokumente des FTP-, FTPS- oder SFTP-Ablageordners `URL` drucken",
+		"Acknowledge the colon separated risky configuration `RULES` found by the lint pass":        "Die durch Doppelpunkt getrennten riskanten Konfigurationsregeln `RULES` der Prüfung bestätigen",
+		"Run despite risky configurations found by the lint pass":                                   "Trotz riskanter Konfiguration laut Prüfung ausführen",
+		"Alerts are posted as JSON to webhook `URL`":                                                "Alarme werden als JSON an die Webhook-`URL` gesendet",
+		"Job lifecycle events are posted as JSON to webhook `URL`":                                  "Ereignisse zu Druckaufträgen werden als JSON an die Webhook-`URL` gesendet",
+		"Run `CMD` for every attachment before printing, a non-zero exit skips it":                  "`CMD` vor dem Drucken für jeden Anhang ausführen, ein Exit-Code ungleich 0 überspringt ihn",
+		"Scan every attachment with clamd at `ADDR` (tcp://host:port or unix socket path)":          "Jeden Anhang mit clamd unter `ADDR` prüfen (tcp://host:port oder Unix-Socket-Pfad)",
+		"Decrypt S/MIME encrypted mails addressed to the PEM certificate `FILE`":                    "S/MIME-verschlüsselte Mails an das PEM-Zertifikat `FILE` entschlüsseln",
+		"PEM private key `FILE` of the S/MIME certificate":                                          "Privater PEM-Schlüssel `FILE` des S/MIME-Zertifikats",
+		"Decrypt OpenPGP encrypted mails and attachments with the GnuPG keyring in `DIR`":           "OpenPGP-verschlüsselte Mails und Anhänge mit dem GnuPG-Schlüsselbund in `DIR` entschlüsseln",
+		"Alerts are posted to slack incoming webhook `URL`":                                         "Alarme werden an die Slack-Webhook-`URL` gesendet",
+		"Alerts are mailed to `ADDRESSES` seperated by \":\"":                                       "Alarme werden an die `ADRESSEN` gemailt, getrennt durch \":\"",
+		"The SMTP server address `HOST:PORT` for outgoing mail":                                     "Die Adresse des SMTP-Servers `HOST:PORT` für ausgehende E-Mails",
+		"The SMTP account `USER`":                                                                   "Der `BENUTZER` des SMTP-Kontos",
+		"The SMTP account `PASS`":                                                                   "Das `PASSWORT` des SMTP-Kontos",
+		"The sender `ADDRESS` of outgoing mail":                                                     "Die Absender-`ADRESSE` ausgehender E-Mails",
+		"Print the email text of mails without attachments":                                         "Den Text von E-Mails ohne Anhänge drucken",
+		"The `RENDERER` converting HTML to PDF (wkhtmltopdf, chrome, none)":                         "Der `RENDERER` für die Umwandlung von HTML in PDF (wkhtmltopdf, chrome, none)",
+		"Convert office documents to PDF with `CONVERTER` (libreoffice, unoconv or a command)":      "Office-Dokumente mit `KONVERTER` in PDF umwandeln (libreoffice, unoconv oder ein Befehl)",
+		"Place images on the page by `MODE` (fit, fill, dpi)":                                       "Bilder im `MODUS` auf der Seite platzieren (fit, fill, dpi)",
+		"The paper `SIZE` of generated documents (a3, a4, a5, letter, legal)":                       "Das `PAPIERFORMAT` erzeugter Dokumente (a3, a4, a5, letter, legal)",
+		"Send a canary mail to ourself every `DURATION` and alert if it is not processed in time":   "Alle `DAUER` eine Test-E-Mail an uns selbst senden und alarmieren, wenn sie nicht rechtzeitig verarbeitet wird",
+		"Send read receipts (MDN) to allowed senders requesting them":                               "Lesebestätigungen (MDN) an erlaubte Absender senden, die sie anfordern",
+		"Show desktop notifications for printed and failed mails when run in a terminal":            "Desktop-Benachrichtigungen für gedruckte und fehlgeschlagene Mails anzeigen, wenn im Terminal ausgeführt",
+		"Print documents with the same content only once, later copies are linked to the first job": "Dokumente mit gleichem Inhalt nur einmal drucken, spätere Kopien werden mit dem ersten Auftrag verknüpft",
+		"Only accept mails with a valid DKIM signature of the sender domain":                        "Nur Mails mit gültiger DKIM-Signatur der Absenderdomain annehmen",
+		"With --require-dkim also accept mails passing SPF for the sender domain":                   "Mit --require-dkim auch Mails annehmen, die SPF für die Absenderdomain bestehen",
+		"Extract .zip and .tar.gz attachments and print the contained files":                        "Anhänge im Format .zip und .tar.gz entpacken und die enthaltenen Dateien drucken",
+		"Execute a dry-run": "Testlauf ohne Drucken und Löschen",
+		"Dry-run scope: leave mails untouched on the server":                        "Dry-Run-Bereich: Mails auf dem Server unverändert lassen",
+		"Dry-run scope: do not submit print jobs":                                   "Dry-Run-Bereich: keine Druckaufträge senden",
+		"Dry-run scope: do not upload to the object storage archive":                "Dry-Run-Bereich: nichts in das Objektspeicher-Archiv hochladen",
+		"Dry-run scope: send no replies, receipts, notifications, alerts or events": "Dry-Run-Bereich: keine Antworten, Bestätigungen, Benachrichtigungen, Alarme oder Ereignisse senden",
+		"Verbose output": "Ausführliche Ausgabe",
+		"The `LOCALE` of help and messages (en, de)": "Die `SPRACHE` von Hilfe und Meldungen (en, de)",
+
+		// Log titles and messages
+		"Printing":                       "Drucke",
+		"Error":                          "Fehler",
+		"No Messages":                    "Keine Nachrichten",
+		"Nothing to do...":               "Nichts zu tun...",
+		"No Documents":                   "Keine Dokumente",
+		"Nothing to do":                  "Nichts zu tun",
+		"Will be ignored...":             "Wird ignoriert...",
+		"Cleanup":                        "Aufräumen",
+		"Deleting email(s)":              "Lösche E-Mail(s)",
+		"Convert":                        "Umwandeln",
+		"Render HTML":                    "HTML umwandeln",
+		"Archive":                        "Archiv",
+		"Archive Rules":                  "Archivregeln",
+		"Tracking ID: %s":                "Auftragsnummer: %s",
+		"Tracking":                       "Auftragsnummer",
+		"Skipping":                       "Überspringe",
+		"Submitted":                      "Übermittelt",
+		"Find Job":                       "Auftrag suchen",
+		"unsupported file type %s":       "nicht unterstützter Dateityp %s",
+		"mail too large":                 "Mail zu groß",
+		"mail too large (%d > %d bytes)": "Mail zu groß (%d > %d Bytes)",
+		"the message is kept for manual processing": "die Nachricht wird zur manuellen Bearbeitung aufbewahrt",
+		"attachment too large":                      "Anhang zu groß",
+		"%s (limit %d bytes)":                       "%s (Limit %d Bytes)",
+		"Mail Size":                                 "Mailgröße",
+		"Attachment Size":                           "Anhangsgröße",
+		"Max Attachment Size":                       "Max. Anhangsgröße",
+		"Max Mail Size":                             "Max. Mailgröße",
+		"Skip attachments larger than `BYTES` (0 = unlimited)": "Anhänge größer als `BYTES` überspringen (0 = unbegrenzt)",
+		"Reject mails larger than `BYTES` (0 = unlimited)":     "Mails größer als `BYTES` ablehnen (0 = unbegrenzt)",
+		"Fetch":          "Abruf",
+		"Chunked":        "In Teilen",
+		"Parts":          "Teile",
+		"Resuming at":    "Fortsetzen bei",
+		"of":             "von",
+		"Reconnect":      "Neu verbinden",
+		"Select":         "Ordner wählen",
+		"too many pages": "zu viele Seiten",
+		"Pages":          "Seiten",
+		"Truncated to":   "Gekürzt auf",
+		"Duplex":         "Duplex",
+		"Duplex Rules":   "Duplex-Regeln",
+		"Cover":          "Deckblatt",
+		"Cover Page":     "Deckblatt",
+		"Separator":      "Trennblatt",
+		"Separator Page": "Trennblatt",
+		"Stamp":          "Stempel",
+		"Load settings from the YAML or JSON `FILE`, environment and flags take precedence":        "Einstellungen aus der YAML- oder JSON-Datei `FILE` laden, Umgebung und Optionen haben Vorrang",
+		"Stamp every page of PDF documents with `TEXT`, a template with the fields of cover pages": "Jede Seite von PDF-Dokumenten mit `TEXT` stempeln, eine Vorlage mit den Feldern der Deckblätter",
+		"Print a separator page with sender and subject between the documents of a run":            "Zwischen den Dokumenten eines Durchlaufs ein Trennblatt mit Absender und Betreff drucken",
+		"Document": "Dokument",
+		"Print a cover page with sender, subject, date and page count before every document":        "Vor jedem Dokument ein Deckblatt mit Absender, Betreff, Datum und Seitenzahl drucken",
+		"Duplex `MODE`: off, long or short binding edge, auto (short edge for landscape documents)": "Duplex-`MODE`: off, long oder short für Bindung an der langen oder kurzen Kante, auto (kurze Kante für Querformat)",
+		"Max Pages": "Max. Seiten",
+		"Skip (or truncate, see MAX_PAGES_MODE) PDF documents with more than `PAGES` pages (0 = unlimited)": "PDF-Dokumente mit mehr als `PAGES` Seiten überspringen (oder kürzen, siehe MAX_PAGES_MODE) (0 = unbegrenzt)",
+		"Max Bandwidth": "Max. Bandbreite",
+		"Limit IMAP downloads to `BYTES` per second (0 = unlimited)": "IMAP-Downloads auf `BYTES` pro Sekunde begrenzen (0 = unbegrenzt)",
+		"quota exceeded":           "Kontingent überschritten",
+		"sender not authenticated": "Absender nicht authentifiziert",
+		"daily quota of %d jobs exceeded (%d used, %d requested)":  "Tageskontingent von %d Aufträgen überschritten (%d verbraucht, %d angefordert)",
+		"daily quota of %d pages exceeded (%d used, %d requested)": "Tageskontingent von %d Seiten überschritten (%d verbraucht, %d angefordert)",
+		"Not printed: %s":                       "Nicht gedruckt: %s",
+		"Quota":                                 "Kontingent",
+		"Rejection sent to":                     "Ablehnung gesendet an",
+		"used":                                  "verbraucht",
+		"requested":                             "angefordert",
+		"Printed: %s":                           "Gedruckt: %s",
+		"%d pages from %s":                      "%d Seiten von %s",
+		"Your message %q has been rejected: %s": "Ihre Nachricht %q wurde abgelehnt: %s",
+		"Your message %q has been printed: %d pages on %s, job %s.": "Ihre Nachricht %q wurde gedruckt: %d Seiten auf %s, Auftrag %s.",
+		"%s: printed, job %d":            "%s: gedruckt, Auftrag %d",
+		"%s: printed, job %d (%s)":       "%s: gedruckt, Auftrag %d (%s)",
+		"%s: skipped: %s":                "%s: übersprungen: %s",
+		"%s: failed: %s":                 "%s: fehlgeschlagen: %s",
+		"already printed for %s":         "bereits gedruckt für %s",
+		"same document as %s":            "dasselbe Dokument wie %s",
+		"%d document(s) failed to print": "%d Dokument(e) konnten nicht gedruckt werden",
+		"Confirm":                        "Bestätigung",
+		"Notify":                         "Benachrichtigung",
+		"Reply to allowed senders whether their mail has been printed": "Erlaubten Absendern antworten, ob ihre Mail gedruckt wurde",
+		"Disk":                 "Festplatte",
+		"bytes free":           "Bytes frei",
+		"Processing paused":    "Verarbeitung pausiert",
+		"Low disk space on %s": "Wenig Speicherplatz auf %s",
+		"Only %d bytes are free on %s (minimum %d). Processing is paused until space is freed.": "Nur %d Bytes sind auf %s frei (Minimum %d). Die Verarbeitung ist pausiert, bis Speicherplatz freigegeben wird.",
+		"print failed":                                          "Druck fehlgeschlagen",
+		"A mail has not been printed: %s":                       "Eine Mail wurde nicht gedruckt: %s",
+		"A mail without printable attachments arrived from %s:": "Eine Mail ohne druckbare Anhänge ist von %s eingegangen:",
+		"No Attachments":                                        "Keine Anhänge",
+		"Handle mails of allowed senders without printable attachments by `POLICY` (delete, ignore, keep, forward, body)": "Mails erlaubter Absender ohne druckbare Anhänge nach `POLICY` behandeln (delete, ignore, keep, forward, body)",
+		"Forward":        "Weiterleitung",
+		"Admin":          "Admin",
+		"Admin Email":    "Admin E-Mail",
+		"Notified about": "Benachrichtigt über",
+		"Rejected and failed mails are reported to `ADDRESSES` seperated by \":\"": "Abgelehnte und fehlgeschlagene Mails werden an `ADDRESSES` (getrennt durch \":\") gemeldet",
+		"Policy":            "Richtlinie",
+		"Denied":            "Verboten",
+		"Denied Extensions": "Verbotene Endungen",
+		"Report":            "Bericht",
+		"Filter `POLICY`: strict (print allowed only), lenient (print all but denied), report (log decisions only)": "Filter-`POLICY`: strict (nur Erlaubtes drucken), lenient (alles außer Verbotenem drucken), report (nur Entscheidungen protokollieren)",
+		"Body Layout": "Layout Mailtext",
+		"Print mail bodies in `LAYOUT` plain or letter (letterhead, quotes stripped)": "Mailtexte im `LAYOUT` plain oder letter (Briefkopf, ohne Zitate) drucken",
+		"Duplicate":                    "Duplikat",
+		"processed":                    "verarbeitet",
+		"Keep":                         "Behalten",
+		"Search":                       "Suche",
+		"Prefilter":                    "Vorfilter",
+		"Queue":                        "Warteschlange",
+		"kept for retry":               "für neuen Versuch behalten",
+		"Reject Rules":                 "Ablehnungsregeln",
+		"Maintenance":                  "Wartung",
+		"Capabilities":                 "Fähigkeiten",
+		"Fallback":                     "Ersatz",
+		"no mailbox quota check":       "keine Prüfung des Postfach-Kontingents",
+		"EXPUNGE of all deleted mails": "EXPUNGE aller gelöschten Mails",
+		"Mailbox Quota":                "Postfach-Kontingent",
+		"Mailbox almost full":          "Postfach fast voll",
+		"Limit":                        "Limit",
+		"Timeouts":                     "Zeitlimits",
+		"Backlog":                      "Rückstand",
+		"OAuth":                        "OAuth",
+		"Access token renewed":         "Zugriffstoken erneuert",
+		"Retrying in":                  "Neuer Versuch in",
+		"Driverless":                   "Treiberlos",
+		"Falling back to":              "Weiter über",
+		"OAuth refresh token revoked":  "OAuth Refresh-Token widerrufen",
+		"The refresh token has been revoked or expired, run \"imap-print auth renew\".": "Das Refresh-Token wurde widerrufen oder ist abgelaufen, \"imap-print auth renew\" ausführen.",
+		"OAUTH_TOKEN_URL and OAUTH_DEVICE_URL are required":                             "OAUTH_TOKEN_URL und OAUTH_DEVICE_URL werden benötigt",
+		"Open %s to authorize imap-print":                                               "%s öffnen, um imap-print zu autorisieren",
+		"Open %s and enter the code %s":                                                 "%s öffnen und den Code %s eingeben",
+		"Authorization complete":                                                        "Autorisierung abgeschlossen",
+		"Waiting for authorization, the code expires in %s":                             "Warte auf Autorisierung, der Code läuft in %s ab",
+		"Already authorized, run \"auth renew\" to authorize again":                     "Bereits autorisiert, \"auth renew\" für eine erneute Autorisierung ausführen",
+		"Authorize with the device code flow, e.g. on a headless machine":               "Per Gerätecode autorisieren, z.B. auf einem Rechner ohne Bildschirm",
+		"Manage the OAuth authorization of the IMAP account":                            "Die OAuth Autorisierung des IMAP Kontos verwalten",
+		"Authorize again with the device code flow after the refresh token was revoked": "Nach widerrufenem Refresh-Token erneut per Gerätecode autorisieren",
+		"Moving to":                     "Verschiebe nach",
+		"IMAP Move Error":               "IMAP Verschiebe-Fehler",
+		"Unprocessable mail in mailbox": "Nicht verarbeitbare Mail im Postfach",
+		"A mail failed processing in %d runs since %s":                                               "Eine Mail konnte in %d Läufen seit %s nicht verarbeitet werden",
+		"Give up on IMAP dial, login and commands after `DURATION` (0 = never)":                      "IMAP Verbindungsaufbau, Login und Befehle nach `DURATION` abbrechen (0 = nie)",
+		"Trust the CAs of PEM bundle `FILE` for the IMAP server in addition to the system roots":     "Den CAs des PEM-Bündels `FILE` für den IMAP-Server zusätzlich zu den System-CAs vertrauen",
+		"Present the PEM certificate `FILE` to the IMAP server (mutual TLS)":                         "Das PEM-Zertifikat `FILE` dem IMAP-Server vorlegen (gegenseitiges TLS)",
+		"PEM key `FILE` of the IMAP client certificate":                                              "PEM-Schlüssel `FILE` des IMAP-Client-Zertifikats",
+		"Do not verify the certificate of the IMAP server":                                           "Das Zertifikat des IMAP-Servers nicht prüfen",
+		"Require at least TLS `VERSION` (1.0, 1.1, 1.2, 1.3) for IMAP":                               "Für IMAP mindestens TLS `VERSION` (1.0, 1.1, 1.2, 1.3) verlangen",
+		"Connect to the IMAP server through the SOCKS5 or HTTP proxy `URL` (none ignores ALL_PROXY)": "Über den SOCKS5- oder HTTP-Proxy `URL` mit dem IMAP-Server verbinden (none ignoriert ALL_PROXY)",
+		"Give up on IPP requests to cups after `DURATION` (0 = never)":                               "IPP Anfragen an cups nach `DURATION` abbrechen (0 = nie)",
+		"Submit documents with `BACKEND` (cups, lp, dir, ipp)":                                       "Dokumente mit `BACKEND` übermitteln (cups, lp, dir, ipp)",
+		"Write documents into `DIR` instead of printing them (dir backend)":                          "Dokumente in `DIR` schreiben statt sie zu drucken (dir Backend)",
+		"No progress, stopping": "Kein Fortschritt, Abbruch",
+		"Process the mailbox in batches of `N` mails (0 = all at once)": "Das Postfach in Stapeln von `N` Mails verarbeiten (0 = alle auf einmal)",
+		"Processing held": "Verarbeitung angehalten",
+		"rerouted to":     "umgeleitet auf",
+		"Role":            "Rolle",
+		"Run as `ROLE` all, fetch (queue documents) or print (print queued documents)": "Als `ROLLE` all, fetch (Dokumente einreihen) oder print (eingereihte Dokumente drucken) ausführen",
+		"Only fetch mails not marked as seen":                                          "Nur ungelesene Mails abrufen",
+		"Only fetch mails received within the last `DURATION`":                         "Nur innerhalb der letzten `DURATION` empfangene Mails abrufen",
+		"Flagging email(s)": "Markiere E-Mail(s)",
+		"Keep mails on the server and mark them with KEEP_FLAG (default $Printed) instead of deleting them": "Mails auf dem Server behalten und mit KEEP_FLAG (Standard $Printed) markieren, statt sie zu löschen",
+		"Footers":               "Fußzeilen",
+		"History":               "Verlauf",
+		"No matching documents": "Keine passenden Dokumente",
+		"Extract Text":          "Text extrahieren",
+		"Search the history of printed documents":                                                       "Verlauf gedruckter Dokumente durchsuchen",
+		"Find printed documents containing all TERMS (text, sender, subject, file name or tracking id)": "Gedruckte Dokumente finden, die alle TERMS enthalten (Text, Absender, Betreff, Dateiname oder Auftragsnummer)",
+		"sender not allowed":              "Absender nicht erlaubt",
+		"no attachments":                  "keine Anhänge",
+		"no valid attachments":            "keine gültigen Anhänge",
+		"Print statistics of the last %s": "Druckstatistik der letzten %s",
+		"No mails processed.":             "Keine Mails verarbeitet.",
+		"Sender":                          "Absender",
+		"Mails":                           "Mails",
+		"Last Run":                        "Letzter Lauf",
+		"Last Success":                    "Letzter Erfolg",
+		"never":                           "nie",
+		"no mails":                        "keine Mails",
+		"%d processed, %d printed, %d rejected, %d failed in %s": "%d verarbeitet, %d gedruckt, %d abgelehnt, %d fehlgeschlagen in %s",
+		"Failing Mails":    "Fehlschlagende Mails",
+		"Jobs":             "Aufträge",
+		"Stuck Jobs":       "Hängende Aufträge",
+		"Last Mail":        "Letzte Mail",
+		"Last Processed":   "Zuletzt verarbeitet",
+		"stuck":            "hängt",
+		"held until":       "zurückgehalten bis",
+		"No held jobs":     "Keine zurückgehaltenen Aufträge",
+		"printed":          "gedruckt",
+		"queued":           "eingereiht",
+		"rejected":         "abgelehnt",
+		"held":             "zurückgehalten",
+		"failed":           "fehlgeschlagen",
+		"skipped":          "übersprungen",
+		"Printed":          "Gedruckt",
+		"Rejected":         "Abgelehnt",
+		"Failed":           "Fehlgeschlagen",
+		"Rate":             "Quote",
+		"IMAPPrint digest": "IMAPPrint Zusammenfassung",
+		"Digest":           "Zusammenfassung",
+		"Sent to":          "Gesendet an",
+		"Show rejection rates and reasons per sender":                                         "Ablehnungsquoten und Gründe pro Absender anzeigen",
+		"Send the digest by email instead of printing it":                                     "Zusammenfassung per E-Mail senden statt sie auszugeben",
+		"Upgrade the state database and queue directory written by older versions":            "Zustandsdatenbank und Warteschlangen-Verzeichnis älterer Versionen aktualisieren",
+		"Only list the pending migrations":                                                    "Nur die ausstehenden Migrationen auflisten",
+		"Collect redacted config, logs, history and probes into a tarball for bug reports":    "Bereinigte Konfiguration, Logs, Verlauf und Prüfungen als Tarball für Fehlerberichte sammeln",
+		"Write the bundle to `FILE`":                                                          "Das Paket nach `FILE` schreiben",
+		"Check or create the configuration":                                                   "Konfiguration prüfen oder anlegen",
+		"Export monitoring resources for the metrics of METRICS_FILE":                         "Überwachungsressourcen für die Metriken von METRICS_FILE exportieren",
+		"Print a Grafana dashboard of the metrics as JSON":                                    "Ein Grafana-Dashboard der Metriken als JSON ausgeben",
+		"Check the configuration, IMAP login, mailboxes and printer without processing mails": "Konfiguration, IMAP-Anmeldung, Postfächer und Drucker prüfen, ohne Mails zu verarbeiten",
+		"Write a commented configuration template":                                            "Eine kommentierte Konfigurationsvorlage schreiben",
+		"Write the template to `FILE`":                                                        "Die Vorlage nach `FILE` schreiben",
+		"Configuration":                                                                       "Konfiguration",
+		"Warning":                                                                             "Warnung",
+		"IMAP Login":                                                                          "IMAP-Anmeldung",
+		"Mailboxes":                                                                           "Postfächer",
+		"Mailbox %s":                                                                          "Postfach %s",
+		"configuration check failed":                                                          "Prüfung der Konfiguration fehlgeschlagen",
+		"Config":                                                                              "Konfiguration",
+		"Support Bundle":                                                                      "Support-Paket",
+		"Render Body":                                                                         "Text umwandeln",
+		"Read Message Part":                                                                   "Nachrichtenteil lesen",
+		"Read Message Text":                                                                   "Nachrichtentext lesen",
+		"Write Attachment":                                                                    "Anhang schreiben",
+		"Unhandled Header":                                                                    "Unbekannter Header",
+		"IMAP Store Error":                                                                    "IMAP-Fehler beim Markieren",
+		"IMAP Expunge Error":                                                                  "IMAP-Fehler beim Löschen",
+		"IMAP Fetch Error":                                                                    "IMAP-Fehler beim Abrufen",
+		"Supplies":                                                                            "Verbrauchsmaterial",
+		"Supply Level":                                                                        "Füllstand",
+		"Media Empty":                                                                         "Papier leer",
+		"Alert":                                                                               "Alarm",
+		"Alert Cooldown":                                                                      "Alarm-Sperrzeit",
+		"Migrate":                                                                             "Migration",
+		"Pre-Print Hook":                                                                      "Pre-Print-Hook",
+		"Classify":                                                                            "Klassifizierung",
+		"Classify every attachment with the HTTP endpoint or command `HOOK` (experimental)": "Jeden Anhang mit dem HTTP-Endpunkt oder Befehl `HOOK` klassifizieren (experimentell)",
+		"classified as %s":          "klassifiziert als %s",
+		"Hook Output":               "Hook-Ausgabe",
+		"Quarantine":                "Quarantäne",
+		"Folder":                    "Ordner",
+		"Folders":                   "Ordner",
+		"Time budget used up":       "Zeitbudget aufgebraucht",
+		"Fingerprint":               "Fingerabdruck",
+		"Render Output":             "Ausgabe der Darstellung",
+		"Already Printed":           "Bereits gedruckt",
+		"Dedup Content":             "Inhalts-Deduplizierung",
+		"Satisfied by:":             "Erledigt durch:",
+		"Sequence:":                 "Laufnummer:",
+		"Sender Auth":               "Absender-Authentifizierung",
+		"Paused":                    "Pausiert",
+		"Pause File":                "Pausendatei",
+		"Report File":               "Berichtsdatei",
+		"Metrics File":              "Metrikdatei",
+		"Drop Folder":               "Ablageordner",
+		"Drop":                      "Ablage",
+		"Still uploading":           "Noch im Upload",
+		"Decrypt":                   "Entschlüsseln",
+		"PDF is password protected": "PDF ist passwortgeschützt",
+		"Locked":                    "Gesperrt",
+		"Unlocked":                  "Entsperrt",
+		"GPG Output":                "GPG-Ausgabe",
+		"Lint":                      "Prüfung",
+		"Accepted Risks":            "Bestätigte Risiken",
+		"ALLOWED is empty, every mail is rejected and deleted":                         "ALLOWED ist leer, jede Mail wird abgelehnt und gelöscht",
+		"ALLOWED is empty, mails of every sender are printed and deleted":              "ALLOWED ist leer, Mails jedes Absenders werden gedruckt und gelöscht",
+		"EXTENSIONS is empty, no file type filter applies":                             "EXTENSIONS ist leer, kein Dateityp-Filter greift",
+		"Mails are deleted and attachments are not archived":                           "Mails werden gelöscht und Anhänge nicht archiviert",
+		"Dry-run outside a terminal, scheduled runs never print":                       "Dry-Run außerhalb eines Terminals, geplante Läufe drucken nie",
+		"The certificate of the IMAP server is not verified":                           "Das Zertifikat des IMAP-Servers wird nicht geprüft",
+		"risky configuration, acknowledge with --accept-risk RULE or --force":          "riskante Konfiguration, mit --accept-risk RULE oder --force bestätigen",
+		"Infected attachment from %s":                                                  "Infizierter Anhang von %s",
+		"Attachment %s of mail %s from %s contains %s and has been quarantined to %s.": "Anhang %s der Mail %s von %s enthält %s und wurde nach %s in Quarantäne verschoben.",
+		"skipped by pre-print hook":                                                    "vom Pre-Print-Hook übersprungen",
+		"Up to date":                                                                   "Aktuell",
+		"Event Webhook":                                                                "Ereignis-Webhook",
+		"Event":                                                                        "Ereignis",
+		"Job State":                                                                    "Auftragsstatus",
+		"State DB":                                                                     "Zustandsdatenbank",
+		"Connectivity":                                                                 "Verbindung",
+		"Mailbox":                                                                      "Postfach",
+		"Printer":                                                                      "Drucker",
+		"Print Backend":                                                                "Druck-Backend",
+		"Dry-Run":                                                                      "Testlauf",
+		"Allowed":                                                                      "Erlaubt",
+		"Extensions":                                                                   "Endungen",
+		"From":                                                                         "Von",
+		"Subject":                                                                      "Betreff",
+		"Date":                                                                         "Datum",
+		"Text":                                                                         "Text",
+		"Attachments":                                                                  "Anhänge",
+		"ValidSender":                                                                  "Gültiger Absender",
+		"HasAttachments":                                                               "Hat Anhänge",
+		"ValidAttachments":                                                             "Gültige Anhänge",
+		"Status":                                                                       "Status",
+		"Ok!":                                                                          "Ok!",
+		"invalid sender":                                                               "ungültiger Absender",
+		"no attachment":                                                                "kein Anhang",
+		"smtp not configured":                                                          "SMTP nicht konfiguriert",
+
+		// Alerts
+		"%s low on %s":            "%s niedrig bei %s",
+		"%s out of paper":         "%s hat kein Papier",
+		"Canary overdue":          "Test-E-Mail überfällig",
+		"Mails are not processed": "Mails werden nicht verarbeitet",
+		"Mails have been waiting since %s but none has been processed, the last one at %s. Fetching, converting or printing may be broken.": "Seit %s warten Mails, aber keine wurde verarbeitet, die letzte um %s. Abruf, Konvertierung oder Druck könnten gestört sein.",
+		"No mails received": "Keine Mails empfangen",
+		"No mail has arrived since %s for %s of business hours. Mail delivery, the mailbox or the IMAP login may be broken.": "Seit %s ist während %s Geschäftszeit keine Mail eingegangen. Zustellung, Postfach oder IMAP-Anmeldung könnten gestört sein.",
+		"Canary could not be sent": "Test-E-Mail konnte nicht gesendet werden",
+		"Canary message %s was sent at %s but has not been processed within %s. Mail delivery, fetching or printing may be broken.": "Test-E-Mail %s wurde am %s gesendet, aber nicht innerhalb von %s verarbeitet. Zustellung, Abruf oder Druck funktionieren möglicherweise nicht.",
+		"Supply %q of printer %s is at %d%% (threshold %d%%).":                                                                      "Verbrauchsmaterial %q von Drucker %s steht bei %d%% (Schwelle %d%%).",
+		"Printer %s reports %s since %s.": "Drucker %s meldet %s seit %s.",
+
+		// Read receipts
+		"Your message %q has been printed.":     "Ihre Nachricht %q wurde gedruckt.",
+		"Your message %q could not be printed.": "Ihre Nachricht %q konnte nicht gedruckt werden.",
+		"Disposition notification":              "Lesebestätigung",
+
+		// Test page
+		"IMAPPrint Test Page":  "IMAPPrint Testseite",
+		"IMAPPrint Test Print": "IMAPPrint Testdruck",
+		"If you can read this, documents of allowed senders will be printed.": "Wenn Sie dies lesen können, werden Dokumente erlaubter Absender gedruckt.",
+		"Device Attributes": "Geräteattribute",
+	},
+}
+
+// Help template headings
+var helpHeadings = map[string][]string{
+	"de": {
+		"NAME:", "NAME:",
+		"USAGE:", "VERWENDUNG:",
+		"VERSION:", "VERSION:",
+		"DESCRIPTION:", "BESCHREIBUNG:",
+		"COMMANDS:", "BEFEHLE:",
+		"GLOBAL OPTIONS:", "GLOBALE OPTIONEN:",
+		"OPTIONS:", "OPTIONEN:",
+		"[global options]", "[globale Optionen]",
+		"command [command options]", "Befehl [Befehlsoptionen]",
+		"[arguments...]", "[Argumente...]",
+		"[command options]", "[Befehlsoptionen]",
+	},
+}
+
+// tr translates s into the active locale
+func tr(s string) string {
+	if t, ok := translations[locale][s]; ok {
+		return t
+	}
+	return s
+}
+
+// setLocale activates locale l (e.g. "de", "de_DE.UTF-8") and localizes the cli help templates
+func setLocale(l string) {
+
+	l = strings.ToLower(l)
+	if i := strings.IndexAny(l, "_.-@"); i > 0 {
+		l = l[:i]
+	}
+
+	if _, ok := translations[l]; !ok {
+		locale = DefaultLocale
+		return
+	}
+
+	locale = l
+
+	r := strings.NewReplacer(helpHeadings[l]...)
+	cli.AppHelpTemplate = r.Replace(cli.AppHelpTemplate)
+	cli.CommandHelpTemplate = r.Replace(cli.CommandHelpTemplate)
+	cli.SubcommandHelpTemplate = r.Replace(cli.SubcommandHelpTemplate)
+
+	cli.HelpFlag = &cli.BoolFlag{Name: "help", Aliases: []string{"h"}, Usage: tr("show help")}
+	cli.VersionFlag = &cli.BoolFlag{Name: "version", Aliases: []string{"v"}, Usage: tr("print the version")}
+}
+
+// detectLocale returns the locale given by --locale, LOCALE, LC_ALL or LANG
+func detectLocale(args []string) string {
+
+	for i, arg := range args {
+		if arg == "--"+ArgLocale && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--"+ArgLocale+"=") {
+			return strings.TrimPrefix(arg, "--"+ArgLocale+"=")
+		}
+	}
+
+	for _, name := range []string{"LOCALE", "LC_ALL", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return DefaultLocale
+}
@@ -0,0 +1,368 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Image placement modes
+const (
+	ImageFit  = "fit"
+	ImageFill = "fill"
+	ImageDPI  = "dpi"
+)
+
+// Paper sizes in PDF points
+var paperSizes = map[string][2]float64{
+	"a3":     {842, 1191},
+	"a4":     {595, 842},
+	"a5":     {420, 595},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// ErrUnknownPaper is returned for unsupported paper size names
+var ErrUnknownPaper = errors.New("unknown paper size")
+
+// ErrImageTooLarge is returned for images with more pixels than IMAGE_MAX_PIXELS
+var ErrImageTooLarge = errors.New("image too large")
+
+// normalizeImage places image attachments onto a page of the configured paper size, other attachments are returned unchanged
+func (cmd *Command) normalizeImage(attachment *Attachment) (*Attachment, error) {
+
+	cfg := cmd.cfg.Image
+
+	if cfg.Mode == "" || !inArrStr(filter.FileExt(attachment.File), cfg.Extensions) {
+		return attachment, nil
+	}
+
+	in := attachment.File
+
+	if ext := filter.FileExt(in); ext == "heic" || ext == "heif" {
+		jpg, err := cmd.convertHEIC(in)
+		if err != nil {
+			return nil, err
+		}
+		in = jpg
+	}
+
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return nil, err
+	}
+
+	jpg, w, h, err := jpegData(data, cmd.cfg.Image.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	paper, ok := paperSizes[strings.ToLower(cmd.cfg.Paper)]
+	if !ok {
+		return nil, ErrUnknownPaper
+	}
+
+	pw, ph := paper[0], paper[1]
+	// Landscape images are placed on landscape pages
+	if w > h {
+		pw, ph = ph, pw
+	}
+
+	margin := cfg.Margin / 25.4 * 72
+	aw, ah := pw-2*margin, ph-2*margin
+
+	var sw, sh float64
+	switch cfg.Mode {
+	case ImageFill:
+		scale := maxf(aw/float64(w), ah/float64(h))
+		sw, sh = float64(w)*scale, float64(h)*scale
+	case ImageDPI:
+		sw, sh = float64(w)/float64(cfg.DPI)*72, float64(h)/float64(cfg.DPI)*72
+		if sw > aw || sh > ah {
+			scale := minf(aw/sw, ah/sh)
+			sw, sh = sw*scale, sh*scale
+		}
+	default:
+		scale := minf(aw/float64(w), ah/float64(h))
+		sw, sh = float64(w)*scale, float64(h)*scale
+	}
+
+	x, y := (pw-sw)/2, (ph-sh)/2
+
+	out := in + ".pdf"
+	if err := ioutil.WriteFile(out, imagePDF(jpg, w, h, pw, ph, margin, x, y, sw, sh), 0600); err != nil {
+		return nil, err
+	}
+
+	cmd.logverb("Image", attachment.Name, fmt.Sprintf("%dx%dpx", w, h), "placed", cfg.Mode, "on", cmd.cfg.Paper)
+
+	normalized := *attachment
+	normalized.File = out
+	normalized.Name = attachment.Name + ".pdf"
+
+	return &normalized, nil
+}
+
+// convertHEIC converts a HEIC image to JPEG using the configured converter
+func (cmd *Command) convertHEIC(in string) (string, error) {
+
+	out := in + ".jpg"
+
+	var args []string
+	for _, arg := range strings.Fields(cmd.cfg.Image.HEICConverter) {
+		arg = strings.Replace(arg, "{in}", in, -1)
+		arg = strings.Replace(arg, "{out}", out, -1)
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return "", errors.New("no heic converter configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.Image.Timeout)
+	defer cancel()
+
+	cmd.chaosSlow()
+
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		cmd.logverb("Convert Output", string(output))
+		return "", err
+	}
+
+	if _, err := os.Stat(out); err != nil {
+		return "", errors.New("heic converter produced no output")
+	}
+
+	return out, nil
+}
+
+// jpegData returns baseline JPEG data of an image and its dimensions, applying EXIF orientation
+func jpegData(data []byte, maxPixels int64) ([]byte, int, int, error) {
+
+	// A few KB of compressed data may decode to gigabytes, the dimensions are checked before
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, 0, 0, fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+
+	_, ycc := img.(*image.YCbCr)
+
+	// Original JPEG data is embedded as is if possible
+	if format == "jpeg" && orientation == 1 && ycc {
+		b := img.Bounds()
+		return data, b.Dx(), b.Dy(), nil
+	}
+
+	img = orient(img, orientation)
+	b := img.Bounds()
+
+	// Flatten transparency onto white paper
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(rgba, b, img, b.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 92}); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return buf.Bytes(), b.Dx(), b.Dy(), nil
+}
+
+// imagePDF builds a single page PDF with the JPEG image placed at x, y scaled to w, h and clipped to the margins
+func imagePDF(jpg []byte, iw, ih int, pw, ph, margin, x, y, w, h float64) []byte {
+
+	var buf bytes.Buffer
+	var offsets []int
+
+	obj := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		_, _ = fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	content := fmt.Sprintf(
+		"q %.2f %.2f %.2f %.2f re W n %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q",
+		margin, margin, pw-2*margin, ph-2*margin, w, h, x, y,
+	)
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	obj("<< /Type /Pages /Kids [3 0 R] /Count 1 >>", nil)
+	obj(fmt.Sprintf(
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /XObject << /Im1 4 0 R >> >> /Contents 5 0 R >>",
+		pw, ph,
+	), nil)
+	obj(fmt.Sprintf(
+		"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>",
+		iw, ih, len(jpg),
+	), jpg)
+	obj(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+
+	xref := buf.Len()
+
+	_, _ = fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		_, _ = fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	_, _ = fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// exifOrientation returns the EXIF orientation tag of JPEG data (1 if not present)
+func exifOrientation(data []byte) int {
+
+	// Walk JPEG segments up to the APP1 Exif segment
+	i := 2
+	for i+4 < len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		// The length counts itself, a crafted segment may claim less than its own header
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if size < 2 || i+2+size > len(data) {
+			break
+		}
+		if marker == 0xE1 && size >= 8 && bytes.HasPrefix(data[i+4:], []byte("Exif\x00\x00")) {
+			return tiffOrientation(data[i+10 : i+2+size])
+		}
+		if marker == 0xDA {
+			break
+		}
+		i += 2 + size
+	}
+
+	return 1
+}
+
+// tiffOrientation reads the orientation tag (0x0112) of the first IFD of a TIFF header
+func tiffOrientation(tiff []byte) int {
+
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if string(tiff[:2]) == "II" {
+		order = binary.LittleEndian
+	}
+
+	// Offsets come from the file, compared unsigned so huge values can't wrap around
+	offset := uint64(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > uint64(len(tiff)) {
+		return 1
+	}
+	ifd := int(offset)
+
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	if ifd+2+count*12 > len(tiff) {
+		count = (len(tiff) - ifd - 2) / 12
+	}
+	for n := 0; n < count; n++ {
+		e := ifd + 2 + n*12
+		if order.Uint16(tiff[e:e+2]) == 0x0112 {
+			return int(order.Uint16(tiff[e+8 : e+10]))
+		}
+	}
+
+	return 1
+}
+
+// orient rotates img according to EXIF orientation (mirrored orientations are ignored)
+func orient(img image.Image, orientation int) image.Image {
+
+	var angle int
+	switch orientation {
+	case 3:
+		angle = 180
+	case 6:
+		angle = 90
+	case 8:
+		angle = 270
+	default:
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var dst *image.RGBA
+	if angle == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			switch angle {
+			case 90:
+				dst.Set(h-1-y, x, c)
+			case 180:
+				dst.Set(w-1-x, h-1-y, c)
+			case 270:
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+
+	return dst
+}
+
+func minf(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxf(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/utf7"
+	"sort"
+	"strings"
+)
+
+// IMAP extensions used when offered by the server
+const (
+	CapIdle      = "IDLE"
+	CapMove      = "MOVE"
+	CapUIDPlus   = "UIDPLUS"
+	CapCondStore = "CONDSTORE"
+	CapQuota     = "QUOTA"
+)
+
+// Fallbacks lists the primitives used when an extension is missing
+var Fallbacks = []struct {
+	Name     string
+	Fallback string
+}{
+	{CapMove, "COPY, STORE, EXPUNGE"},
+	{CapUIDPlus, "EXPUNGE of all deleted mails"},
+	{CapQuota, "no mailbox quota check"},
+}
+
+// Capabilities holds the extensions supported by the logged in IMAP server
+type Capabilities struct {
+	Idle      bool
+	Move      bool
+	UIDPlus   bool
+	CondStore bool
+	Quota     bool
+	all       map[string]bool
+}
+
+// Negotiate detects the capabilities of the logged in server c
+func Negotiate(c *client.Client) (*Capabilities, error) {
+
+	all, err := c.Capability()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Capabilities{
+		Idle:      all[CapIdle],
+		Move:      all[CapMove],
+		UIDPlus:   all[CapUIDPlus],
+		CondStore: all[CapCondStore],
+		Quota:     all[CapQuota],
+		all:       all,
+	}, nil
+}
+
+// Has reports if the extension name is supported
+func (caps *Capabilities) Has(name string) bool {
+	return caps != nil && caps.all[name]
+}
+
+// Names returns all capabilities announced by the server in alphabetical order
+func (caps *Capabilities) Names() []string {
+	var names []string
+	for name := range caps.all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Move moves the mails with uids into mailbox using MOVE or COPY, STORE and EXPUNGE without it
+func Move(c *client.Client, caps *Capabilities, uids *imap.SeqSet, mailbox string) error {
+
+	if caps.Has(CapMove) {
+		status, err := c.Execute(&moveCommand{SeqSet: uids, Mailbox: mailbox}, nil)
+		if err != nil {
+			return err
+		}
+		return status.Err()
+	}
+
+	if err := c.UidCopy(uids, mailbox); err != nil {
+		return err
+	}
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(uids, item, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return err
+	}
+
+	return ExpungeUIDs(c, caps, uids)
+}
+
+// Expunge removes the deleted mails of seqset, without UIDPLUS all deleted mails of the mailbox are removed
+func Expunge(c *client.Client, caps *Capabilities, seqset *imap.SeqSet) error {
+
+	if !caps.Has(CapUIDPlus) {
+		return c.Expunge(nil)
+	}
+
+	uidset, err := UIDs(c, seqset)
+	if err != nil {
+		return err
+	}
+
+	return ExpungeUIDs(c, caps, uidset)
+}
+
+// ExpungeUIDs removes the deleted mails with uids, without UIDPLUS all deleted mails of the mailbox are removed
+func ExpungeUIDs(c *client.Client, caps *Capabilities, uids *imap.SeqSet) error {
+
+	if !caps.Has(CapUIDPlus) {
+		return c.Expunge(nil)
+	}
+
+	// Mails deleted by other clients stay until they expunge them themselves
+	if uids.Empty() {
+		return nil
+	}
+
+	status, err := c.Execute(&uidExpungeCommand{SeqSet: uids}, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// UIDs returns the UIDs of the mails in seqset
+func UIDs(c *client.Client, seqset *imap.SeqSet) (*imap.SeqSet, error) {
+
+	messages := make(chan *imap.Message, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+	}()
+
+	uidset := new(imap.SeqSet)
+	for msg := range messages {
+		uidset.AddNum(msg.Uid)
+	}
+
+	return uidset, <-done
+}
+
+// Quota returns the used and maximum storage of mailbox in KiB, limit is 0 if the server reports no storage quota
+func Quota(c *client.Client, mailbox string) (used uint32, limit uint32, err error) {
+
+	handler := responses.HandlerFunc(func(resp imap.Resp) error {
+		name, fields, ok := imap.ParseNamedResp(resp)
+		if !ok || name != "QUOTA" {
+			return responses.ErrUnhandled
+		}
+		if len(fields) < 2 {
+			return nil
+		}
+		list, _ := fields[1].([]interface{})
+		for i := 0; i+2 < len(list); i += 3 {
+			if res, _ := imap.ParseString(list[i]); strings.ToUpper(res) == "STORAGE" {
+				used, _ = imap.ParseNumber(list[i+1])
+				limit, _ = imap.ParseNumber(list[i+2])
+			}
+		}
+		return nil
+	})
+
+	status, err := c.Execute(&quotaRootCommand{Mailbox: mailbox}, handler)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return used, limit, status.Err()
+}
+
+// moveCommand is a UID MOVE command as defined in RFC 6851
+type moveCommand struct {
+	SeqSet  *imap.SeqSet
+	Mailbox string
+}
+
+// Command implements imap.Commander
+func (m *moveCommand) Command() *imap.Command {
+	mailbox, _ := utf7.Encoding.NewEncoder().String(m.Mailbox)
+	return &imap.Command{
+		Name:      "UID MOVE",
+		Arguments: []interface{}{m.SeqSet, imap.FormatMailboxName(mailbox)},
+	}
+}
+
+// uidExpungeCommand is a UID EXPUNGE command as defined in RFC 4315
+type uidExpungeCommand struct {
+	SeqSet *imap.SeqSet
+}
+
+// Command implements imap.Commander
+func (u *uidExpungeCommand) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "UID EXPUNGE",
+		Arguments: []interface{}{u.SeqSet},
+	}
+}
+
+// quotaRootCommand is a GETQUOTAROOT command as defined in RFC 2087
+type quotaRootCommand struct {
+	Mailbox string
+}
+
+// Command implements imap.Commander
+func (q *quotaRootCommand) Command() *imap.Command {
+	mailbox, _ := utf7.Encoding.NewEncoder().String(q.Mailbox)
+	return &imap.Command{
+		Name:      "GETQUOTAROOT",
+		Arguments: []interface{}{imap.FormatMailboxName(mailbox)},
+	}
+}
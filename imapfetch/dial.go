@@ -0,0 +1,96 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package imapfetch connects to IMAP servers and wraps the extensions used to fetch and clean up mails
+package imapfetch
+
+import (
+	"crypto/tls"
+	"github.com/emersion/go-imap/client"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Options configures how Dial connects to the IMAP server
+type Options struct {
+	Addr      string
+	Timeout   time.Duration
+	Bandwidth int64
+	TLS       TLSOptions
+	// Proxy is the URL of a SOCKS5 or HTTP proxy, ALL_PROXY if empty and a direct connection if "none"
+	Proxy string
+}
+
+// Dial connects to the IMAP server over TLS, the returned client is not logged in yet
+func Dial(o Options) (*client.Client, error) {
+
+	cfg, err := o.TLS.config(o.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := proxyURL(o.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var c *client.Client
+	if o.Bandwidth > 0 || proxy != nil {
+		c, err = dialConn(o, proxy, cfg)
+	} else {
+		c, err = client.DialWithDialerTLS(&net.Dialer{Timeout: o.Timeout}, o.Addr, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Every following command including login gives up after the timeout
+	c.Timeout = o.Timeout
+
+	return c, nil
+}
+
+// dialConn returns a new IMAP client connected through proxy unless nil, its downloads are limited to o.Bandwidth
+// bytes per second if set
+func dialConn(o Options, proxy *url.URL, cfg *tls.Config) (*client.Client, error) {
+
+	var conn net.Conn
+	var err error
+	if proxy != nil {
+		conn, err = dialProxy(proxy, o.Addr, o.Timeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", o.Addr, o.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The greeting is read before the client timeout can be set
+	if o.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(o.Timeout))
+	}
+
+	if o.Bandwidth > 0 {
+		conn = throttle(conn, o.Bandwidth)
+	}
+
+	c, err := client.New(tls.Client(conn, cfg))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Folder is a mailbox processed in order of its priority, lower first
+type Folder struct {
+	Name     string
+	Priority int
+	Budget   time.Duration
+}
+
+// ParseFolders parses "NAME[:PRIORITY[:BUDGET]]" specs and returns the folders ordered by priority,
+// folders of equal priority keep their configured order
+func ParseFolders(specs []string) ([]Folder, error) {
+
+	var folders []Folder
+
+	for _, spec := range specs {
+
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		// Folder names may contain colons, the optional fields are taken from the right
+		f := Folder{Name: spec}
+		parts := strings.Split(spec, ":")
+		if n := len(parts); n >= 3 {
+			if budget, err := time.ParseDuration(parts[n-1]); err == nil {
+				prio, err := strconv.Atoi(parts[n-2])
+				if err != nil {
+					return nil, fmt.Errorf("folder %q: invalid priority %q", spec, parts[n-2])
+				}
+				f = Folder{Name: strings.Join(parts[:n-2], ":"), Priority: prio, Budget: budget}
+				parts = nil
+			}
+		}
+		if n := len(parts); n >= 2 {
+			if prio, err := strconv.Atoi(parts[n-1]); err == nil {
+				f = Folder{Name: strings.Join(parts[:n-1], ":"), Priority: prio}
+			}
+		}
+
+		if f.Name == "" {
+			return nil, fmt.Errorf("folder %q: missing name", spec)
+		}
+		folders = append(folders, f)
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].Priority < folders[j].Priority
+	})
+
+	return folders, nil
+}
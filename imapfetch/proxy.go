@@ -0,0 +1,260 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ProxyNone disables ALL_PROXY for IMAP connections
+const ProxyNone = "none"
+
+// ErrSOCKSAuth is returned if the SOCKS5 proxy rejects the offered authentication
+var ErrSOCKSAuth = errors.New("socks5 proxy authentication failed")
+
+// SOCKS5 replies (RFC 1928)
+var socksReplies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// proxyURL returns the proxy URL of proxy, ALL_PROXY (or all_proxy) if empty, nil for direct connections
+func proxyURL(proxy string) (*url.URL, error) {
+
+	if proxy == "" {
+		if proxy = os.Getenv("ALL_PROXY"); proxy == "" {
+			proxy = os.Getenv("all_proxy")
+		}
+	}
+	if proxy == "" || proxy == ProxyNone {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use socks5, socks5h or http", u.Scheme)
+	}
+
+	if u.Port() == "" {
+		port := "1080"
+		if u.Scheme == "http" {
+			port = "3128"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return u, nil
+}
+
+// dialProxy connects to addr through proxy, the proxy handshake gives up after timeout
+func dialProxy(proxy *url.URL, addr string, timeout time.Duration) (net.Conn, error) {
+
+	conn, err := net.DialTimeout("tcp", proxy.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if proxy.Scheme == "http" {
+		err = httpConnect(conn, proxy, addr)
+	} else {
+		err = socksConnect(conn, proxy, addr)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s", proxy.Host, err)
+	}
+
+	return conn, nil
+}
+
+// httpConnect opens a tunnel to addr with an HTTP CONNECT request
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) error {
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		pass, _ := proxy.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// Nothing passes the tunnel before the TLS client hello, so no bytes are buffered beyond the response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+
+	return nil
+}
+
+// socksConnect opens a connection to addr with the SOCKS5 protocol, socks5h lets the proxy resolve the host name
+func socksConnect(conn net.Conn, proxy *url.URL, addr string) error {
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+
+	// Greeting with the offered authentication methods, none or username/password
+	methods := []byte{0x00}
+	if proxy.User != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("no socks5 proxy")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxy.User == nil {
+			return ErrSOCKSAuth
+		}
+		user := proxy.User.Username()
+		pass, _ := proxy.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return ErrSOCKSAuth
+		}
+		b := []byte{0x01, byte(len(user))}
+		b = append(b, user...)
+		b = append(b, byte(len(pass)))
+		b = append(b, pass...)
+		if _, err := conn.Write(b); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return ErrSOCKSAuth
+		}
+	default:
+		return ErrSOCKSAuth
+	}
+
+	// Connect request, the address is an IP or a domain name
+	req := []byte{0x05, 0x01, 0x00}
+
+	ip := net.ParseIP(host)
+	if ip == nil && proxy.Scheme == "socks5" {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0]
+	}
+
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long: %s", host)
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, 0x01)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		if msg, ok := socksReplies[head[1]]; ok {
+			return fmt.Errorf("CONNECT %s: %s", addr, msg)
+		}
+		return fmt.Errorf("CONNECT %s: reply %d", addr, head[1])
+	}
+
+	// The bound address is not needed but has to be consumed
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("CONNECT %s: address type %d", addr, head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+
+	return err
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"errors"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Lost reports if err of a command on c is caused by a broken connection, the command may succeed on a new one
+func Lost(c *client.Client, err error) bool {
+
+	if err == nil {
+		return false
+	}
+	if c == nil || c.State() == imap.LogoutState {
+		return true
+	}
+
+	switch err {
+	case client.ErrNotLoggedIn, client.ErrAlreadyLoggedOut, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// go-imap doesn't export the error of commands interrupted by a closed connection
+	msg := err.Error()
+	return strings.Contains(msg, "connection closed") || strings.Contains(msg, "use of closed network connection")
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"github.com/emersion/go-imap"
+	"github.com/mrccnt/imap-print/config"
+	"strings"
+	"time"
+)
+
+// Criteria returns the IMAP search criteria for search and keep or nil if all mails are candidates
+func Criteria(s *config.SearchConfig, keep *config.KeepConfig) *imap.SearchCriteria {
+
+	if !keep.Enabled && !s.Unseen && s.Since <= 0 && len(s.From) == 0 && s.Subject == "" {
+		return nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+
+	if keep.Enabled {
+		criteria.WithoutFlags = append(criteria.WithoutFlags, keep.Flag)
+	}
+	if s.Unseen {
+		criteria.WithoutFlags = append(criteria.WithoutFlags, imap.SeenFlag)
+	}
+	if s.Since > 0 {
+		criteria.Since = time.Now().Add(-s.Since)
+	}
+	if s.Subject != "" {
+		criteria.Header.Add("Subject", s.Subject)
+	}
+
+	// Multiple senders are combined by OR, a single one is a plain FROM key
+	var from []*imap.SearchCriteria
+	for _, addr := range s.From {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		c := imap.NewSearchCriteria()
+		c.Header.Add("From", addr)
+		from = append(from, c)
+	}
+	if len(from) == 1 {
+		criteria.Header.Add("From", from[0].Header.Get("From"))
+	} else if len(from) > 1 {
+		or := from[0]
+		for _, c := range from[1:] {
+			next := imap.NewSearchCriteria()
+			next.Or = [][2]*imap.SearchCriteria{{or, c}}
+			or = next
+		}
+		criteria.Or = append(criteria.Or, or.Or...)
+	}
+
+	return criteria
+}
+
+// FirstN returns the first n sequence numbers of set
+func FirstN(set *imap.SeqSet, n uint32) *imap.SeqSet {
+
+	first := new(imap.SeqSet)
+
+	for _, seq := range set.Set {
+		for i := seq.Start; i <= seq.Stop && n > 0; i++ {
+			first.AddNum(i)
+			n--
+		}
+	}
+
+	return first
+}
+
+// Without returns set without the numbers in nums
+func Without(set *imap.SeqSet, nums map[uint32]bool) *imap.SeqSet {
+
+	rest := new(imap.SeqSet)
+
+	for _, seq := range set.Set {
+		for i := seq.Start; i <= seq.Stop; i++ {
+			if !nums[i] {
+				rest.AddNum(i)
+			}
+		}
+	}
+
+	return rest
+}
+
+// Batches splits the sequence numbers nums into sets of at most size numbers
+func Batches(nums []uint32, size int) []*imap.SeqSet {
+
+	if size < 1 {
+		size = 1
+	}
+
+	var sets []*imap.SeqSet
+	for len(nums) > 0 {
+		n := size
+		if n > len(nums) {
+			n = len(nums)
+		}
+		set := new(imap.SeqSet)
+		set.AddNum(nums[:n]...)
+		sets = append(sets, set)
+		nums = nums[n:]
+	}
+
+	return sets
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"net"
+	"time"
+)
+
+// throttledConn limits the read rate of a connection to rate bytes per second (token bucket with one second burst)
+type throttledConn struct {
+	net.Conn
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// throttle wraps conn to read at most rate bytes per second
+func throttle(conn net.Conn, rate int64) net.Conn {
+	return &throttledConn{
+		Conn: conn,
+		rate: float64(rate),
+		last: time.Now(),
+	}
+}
+
+// Read reads from the underlying connection and sleeps if the rate limit is exceeded
+func (c *throttledConn) Read(b []byte) (int, error) {
+
+	if len(b) > int(c.rate) {
+		b = b[:int(c.rate)]
+	}
+
+	n, err := c.Conn.Read(b)
+
+	now := time.Now()
+	c.tokens += now.Sub(c.last).Seconds() * c.rate
+	if c.tokens > c.rate {
+		c.tokens = c.rate
+	}
+	c.last = now
+	c.tokens -= float64(n)
+
+	if c.tokens < 0 {
+		time.Sleep(time.Duration(-c.tokens / c.rate * float64(time.Second)))
+	}
+
+	return n, err
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapfetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+)
+
+// TLS versions selectable as minimum version
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ErrNoCACerts is returned if the CA bundle does not contain a single PEM encoded certificate
+var ErrNoCACerts = errors.New("no certificates found in CA bundle")
+
+// TLSOptions configures how the IMAP server is verified and the client authenticates itself
+type TLSOptions struct {
+	// CACert is a PEM bundle of CAs trusted in addition to the system roots
+	CACert string
+	// ClientCert and ClientKey are the PEM encoded certificate and key presented for mutual TLS
+	ClientCert string
+	ClientKey  string
+	// InsecureSkipVerify accepts any server certificate
+	InsecureSkipVerify bool
+	// MinVersion is the minimum TLS version ("1.0" to "1.3"), Go's default if empty
+	MinVersion string
+}
+
+// config returns the TLS configuration for addr
+func (o TLSOptions) config(addr string) (*tls.Config, error) {
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.MinVersion != "" {
+		v, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %s", o.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if o.CACert != "" {
+		pem, err := ioutil.ReadFile(o.CACert)
+		if err != nil {
+			return nil, err
+		}
+		// Corporate CAs extend the system roots, public servers keep working
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: %s", o.CACert, ErrNoCACerts)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
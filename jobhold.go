@@ -0,0 +1,210 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/urfave/cli/v2"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// MaxHoldDelay is the longest veto window, the print server releases held jobs at a time of day
+const MaxHoldDelay = 24*time.Hour - time.Minute
+
+// Errors of the jobs sub commands
+var (
+	ErrNoHeldJob = errors.New("no held job with this id")
+	ErrNoHold    = errors.New("print backend can't release or cancel jobs")
+)
+
+// HeldJob is a print job submitted held, waiting to be released by the print server
+type HeldJob struct {
+	Job      printer.JobID `json:"job"`
+	Printer  string        `json:"printer"`
+	Until    time.Time     `json:"until"`
+	Time     time.Time     `json:"time"`
+	Tracking string        `json:"tracking"`
+	From     string        `json:"from"`
+	Name     string        `json:"name"`
+}
+
+// holdUntil returns when the print server is to release the job of attachment, zero if it is printed right away
+func (cmd *Command) holdUntil(attachment *Attachment) time.Time {
+
+	delay := cmd.cfg.Hold.Delay
+	if delay <= 0 || cmd.printerless() {
+		return time.Time{}
+	}
+
+	if rules := cmd.cfg.Hold.Match; len(rules) > 0 {
+		matched := false
+		for _, match := range rules {
+			if ruleMatches(match, attachment) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return time.Time{}
+		}
+	}
+
+	if delay > MaxHoldDelay {
+		delay = MaxHoldDelay
+	}
+
+	return time.Now().Add(delay)
+}
+
+// recordHold records the held job of attachment so it can be listed, released or cancelled
+func (cmd *Command) recordHold(attachment *Attachment, prt string, job printer.JobID, until time.Time) {
+
+	cmd.logpad("Held", attachment.jobName(), job, until.Format("15:04"))
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	h := &HeldJob{Job: job, Printer: prt, Until: until, Time: time.Now(), Name: attachment.Name}
+	if m := attachment.Mail; m != nil {
+		h.Tracking = m.Tracking
+		h.From = m.From
+	}
+
+	if err := db.put(BucketHolds, fmt.Sprintf("%s|%d", prt, job), h); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+}
+
+// heldJobs returns the recorded held jobs by release time and removes the ones released long ago
+func (cmd *Command) heldJobs(db *Store) []*HeldJob {
+
+	var jobs []*HeldJob
+	var expired []string
+	_ = db.each(BucketHolds, func(key string, data []byte) error {
+		var h HeldJob
+		if json.Unmarshal(data, &h) != nil || time.Since(h.Until) > EventJobMaxAge {
+			expired = append(expired, key)
+			return nil
+		}
+		jobs = append(jobs, &h)
+		return nil
+	})
+	for _, key := range expired {
+		_ = db.del(BucketHolds, key)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Until.Before(jobs[j].Until)
+	})
+
+	return jobs
+}
+
+// jobsHeld is used as callable for the jobs held sub command listing the jobs waiting to be released
+func (cmd *Command) jobsHeld(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	db, err := cmd.store()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	jobs := cmd.heldJobs(db)
+
+	shown := 0
+	for _, h := range jobs {
+		state := printer.JobUnknown
+		if p, err := cmd.printer(h.Printer); err == nil {
+			state, _ = p.Status(h.Job)
+		}
+		switch state {
+		case printer.JobCompleted, printer.JobCanceled, printer.JobAborted, printer.JobProcessing:
+			continue
+		}
+		fmt.Printf("%-8d %-8s %s %-5s %s %s %s\n", h.Job, state, h.Until.Local().Format("15:04"), h.Tracking, h.From, h.Name, h.Printer)
+		shown++
+	}
+
+	if shown == 0 {
+		fmt.Println(tr("No held jobs"))
+	}
+
+	return nil
+}
+
+// jobsRelease is used as callable for the jobs release sub command printing a held job right away
+func (cmd *Command) jobsRelease(c *cli.Context) error {
+	return cmd.jobAction(c, "Release", func(p printer.Holder, job printer.JobID) error {
+		return p.Release(job)
+	})
+}
+
+// jobsCancel is used as callable for the jobs cancel sub command vetoing a held job
+func (cmd *Command) jobsCancel(c *cli.Context) error {
+	return cmd.jobAction(c, "Cancel", func(p printer.Holder, job printer.JobID) error {
+		return p.Cancel(job)
+	})
+}
+
+// jobAction runs fn on the held job given as argument
+func (cmd *Command) jobAction(c *cli.Context, title string, fn func(p printer.Holder, job printer.JobID) error) error {
+
+	defer cmd.Close()
+
+	id, err := strconv.Atoi(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(ErrNoHeldJob, 1)
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	for _, h := range cmd.heldJobs(db) {
+
+		if h.Job != printer.JobID(id) {
+			continue
+		}
+
+		p, err := cmd.printer(h.Printer)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		holder, ok := p.(printer.Holder)
+		if !ok {
+			return cli.NewExitError(ErrNoHold, 1)
+		}
+		if err := fn(holder, h.Job); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		cmd.logpad(title, h.Job, h.Tracking, h.Name)
+		_ = db.del(BucketHolds, fmt.Sprintf("%s|%d", h.Printer, h.Job))
+
+		return nil
+	}
+
+	return cli.NewExitError(ErrNoHeldJob, 1)
+}
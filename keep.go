@@ -0,0 +1,36 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// flag marks processed mails with uids with the keep flag instead of deleting them
+func (cmd *Command) flag(uids *imap.SeqSet) {
+
+	cmd.logverb("Cleanup", tr("Flagging email(s)"), cmd.cfg.Keep.Flag)
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	flags := []interface{}{cmd.cfg.Keep.Flag}
+
+	err := cmd.retry("Cleanup", func(c *client.Client) error {
+		return c.UidStore(uids, item, flags, nil)
+	})
+	if err != nil {
+		cmd.logpad("IMAP Store Error", err.Error())
+	}
+}
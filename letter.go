@@ -0,0 +1,38 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import "fmt"
+
+// Body layouts
+const (
+	LayoutPlain  = "plain"
+	LayoutLetter = "letter"
+)
+
+// letter lays out m as a letter: sender, date and subject as letterhead followed by the body text
+func (cmd *Command) letter(m *Mail, text string) *PDFDoc {
+
+	doc := newPDFDoc(m.Subject)
+	doc.text(fmt.Sprintf("%-9s %s", tr("From")+":", m.From))
+	doc.text(fmt.Sprintf("%-9s %s", tr("Date")+":", m.Date.Format("2006-01-02 15:04")))
+	doc.text("")
+	doc.heading(m.Subject, 14)
+	doc.rule()
+	doc.text("")
+	doc.text(cmd.strip(m, text))
+
+	return doc
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"github.com/mrccnt/imap-print/filter"
+)
+
+// Names of the lint rules, used to acknowledge them with --accept-risk
+const (
+	LintOpenSender    = "open-sender"
+	LintNoExtensions  = "no-extensions"
+	LintNoArchive     = "no-archive"
+	LintDryUnattended = "dry-run-unattended"
+	LintInsecureTLS   = "insecure-tls"
+)
+
+// ErrLint is returned if the configuration has unacknowledged risks
+var ErrLint = errors.New("risky configuration, acknowledge with --accept-risk RULE or --force")
+
+// Finding is a risky configuration found by the lint pass
+type Finding struct {
+	Rule string
+	Text string
+}
+
+// lint returns the risky combinations of the configuration
+func (cmd *Command) lint() []Finding {
+
+	var findings []Finding
+
+	f := cmd.cfg.Filter
+	deleting := cmd.cfg.Queue.Role != RolePrint && !cmd.cfg.Keep.Enabled && !cmd.NoModify
+
+	if len(f.Allowed) == 0 && deleting {
+		switch f.Policy {
+		case filter.PolicyStrict:
+			findings = append(findings, Finding{LintOpenSender, tr("ALLOWED is empty, every mail is rejected and deleted")})
+		case filter.PolicyLenient:
+			findings = append(findings, Finding{LintOpenSender, tr("ALLOWED is empty, mails of every sender are printed and deleted")})
+		}
+	}
+
+	if len(f.Extensions) == 0 && (f.Policy == filter.PolicyStrict || len(f.DeniedExtensions) == 0) {
+		findings = append(findings, Finding{LintNoExtensions, tr("EXTENSIONS is empty, no file type filter applies")})
+	}
+
+	if deleting && cmd.cfg.S3.Endpoint == "" && cmd.cfg.S3.Rules == "" {
+		findings = append(findings, Finding{LintNoArchive, tr("Mails are deleted and attachments are not archived")})
+	}
+
+	if cmd.cfg.IMAP.Insecure {
+		findings = append(findings, Finding{LintInsecureTLS, tr("The certificate of the IMAP server is not verified")})
+	}
+
+	// The report policy is a dry-run on purpose
+	if cmd.DryRun && f.Policy != filter.PolicyReport && !interactive() {
+		findings = append(findings, Finding{LintDryUnattended, tr("Dry-run outside a terminal, scheduled runs never print")})
+	}
+
+	return findings
+}
+
+// checkLint logs the risky combinations of the configuration and fails unless all of them are acknowledged
+func (cmd *Command) checkLint() error {
+
+	accepted := map[string]bool{}
+	for _, rule := range cmd.cfg.AcceptRisks {
+		accepted[rule] = true
+	}
+
+	var err error
+	for _, finding := range cmd.lint() {
+		if cmd.cfg.Force || accepted[finding.Rule] {
+			cmd.logverb("Lint", finding.Rule, finding.Text)
+			continue
+		}
+		cmd.logpad("Lint", finding.Rule, finding.Text)
+		err = ErrLint
+	}
+
+	return err
+}
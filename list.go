@@ -0,0 +1,170 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/urfave/cli/v2"
+)
+
+// list is used as callable for the list sub command; it shows what a run would print from the candidate mails of
+// every folder without changing flags, the state DB or printing anything
+func (cmd *Command) list(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	folders, err := cmd.folders()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.mclient, err = cmd.dial()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	for _, folder := range folders {
+		if err := cmd.listFolder(cmd.mclient, folder.Name); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		cmd.cleanup()
+	}
+
+	return nil
+}
+
+// listFolder examines folder read-only and prints the preview of its candidate mails
+func (cmd *Command) listFolder(c *client.Client, folder string) error {
+
+	var err error
+
+	// Fetching from a read-only mailbox leaves the \Seen flags alone
+	if cmd.mbox, err = c.Select(folder, true); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%d)\n", folder, cmd.mbox.Messages)
+	if cmd.mbox.Messages == 0 {
+		return nil
+	}
+
+	seqset, count, err := cmd.candidates(c)
+	if err != nil || count == 0 {
+		return err
+	}
+
+	envelopes, err := cmd.fetchEnvelopes(c, seqset, count)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range envelopes {
+		m := cmd.envelopeMail(msg)
+		reason := cmd.prefilter(m, msg)
+		// Oversized mails aren't downloaded by a run either
+		if reason != RejectMailSize {
+			full, err := cmd.listMail(c, msg.Uid)
+			var me *MalformedError
+			if errors.As(err, &me) {
+				cmd.preview(m, err.Error())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			full.UID, full.Seq = m.UID, m.Seq
+			m = full
+			reason = m.Rejected
+			if reason == "" {
+				reason = m.rejection(cmd.filters(m))
+			}
+		}
+		cmd.preview(m, reason)
+	}
+
+	return nil
+}
+
+// listMail fetches and parses the mail with uid like a run does
+func (cmd *Command) listMail(c *client.Client, uid uint32) (*Mail, error) {
+
+	section := &imap.BodySectionName{Peek: true}
+
+	uidset := new(imap.SeqSet)
+	uidset.AddNum(uid)
+
+	messages := make(chan *imap.Message, 1)
+	if err := c.UidFetch(uidset, []imap.FetchItem{section.FetchItem()}, messages); err != nil {
+		return nil, err
+	}
+
+	msg := <-messages
+	if msg == nil {
+		return nil, ErrNoBody
+	}
+
+	return cmd.convert(msg.GetBody(section))
+}
+
+// preview prints sender, subject and attachments of m and what a run would do with them
+func (cmd *Command) preview(m *Mail, reason string) {
+
+	f := cmd.filters(m)
+
+	sender := tr("allowed")
+	if !m.isValidSender(f) {
+		sender = tr("not allowed")
+	}
+
+	decision := tr("print")
+	switch {
+	case cmd.isProcessed(m):
+		decision = tr("skip: already processed")
+	case reason != "":
+		decision = tr("reject") + ": " + reason
+	}
+
+	fmt.Printf("  UID %d  %s\n", m.UID, m.Date.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("    %-12s %s (%s)\n", tr("From")+":", m.From, sender)
+	fmt.Printf("    %-12s %s\n", tr("Subject")+":", m.Subject)
+	fmt.Printf("    %-12s %s\n", tr("Decision")+":", decision)
+
+	for _, a := range m.Attachments {
+		fmt.Printf("    - %-30s %-24s %s\n", a.Name, a.Type, attachmentDecision(f, a))
+	}
+	for _, e := range m.Errors {
+		fmt.Printf("    ! %s\n", e)
+	}
+}
+
+// attachmentDecision returns if attachment would be printed and why not
+func attachmentDecision(f filter.Filter, a *Attachment) string {
+	ext := filter.FileExt(a.File)
+	switch {
+	case a.Body:
+		return tr("print")
+	case !f.Extension(ext):
+		return fmt.Sprintf(tr("skip: extension %q not allowed"), ext)
+	case !f.MimeType(a.mimeType()):
+		return fmt.Sprintf(tr("skip: content type %s not allowed"), a.mimeType())
+	case !a.isValid(f):
+		return fmt.Sprintf(tr("skip: content %s doesn't match the extension"), a.Type)
+	}
+	return tr("print")
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/emersion/go-imap"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// LogFieldData holds the values the templates of LOG_FIELDS are rendered with, the mail related ones are empty in
+// records not about a mail
+type LogFieldData struct {
+	Host     string
+	Printer  string
+	Folder   string
+	Tracking string
+	From     string
+	Domain   string
+	Rule     string
+}
+
+// logField is a field added to log lines, events, alerts and run reports
+type logField struct {
+	name string
+	tmpl *template.Template
+}
+
+// parseLogFields parses the fields of specs ("<name>=<value|template>" each)
+func parseLogFields(specs []string) ([]*logField, error) {
+
+	var fields []*logField
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid log field %q", spec)
+		}
+		// Unknown fields only fail when rendered, so they are caught at startup
+		tmpl, err := template.New(parts[0]).Parse(parts[1])
+		if err == nil {
+			err = tmpl.Execute(ioutil.Discard, &LogFieldData{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid log field %q: %s", spec, err.Error())
+		}
+		fields = append(fields, &logField{name: strings.TrimSpace(parts[0]), tmpl: tmpl})
+	}
+
+	return fields, nil
+}
+
+// fields returns the rendered LOG_FIELDS of records about m, of the run if m is nil; fields rendering empty are left
+// out and nil is returned if none is left
+func (cmd *Command) fields(m *Mail) map[string]string {
+
+	if len(cmd.logFields) == 0 {
+		return nil
+	}
+
+	cmd.logMu.Lock()
+	data := &LogFieldData{Host: cmd.hostname, Printer: cmd.target(nil), Folder: cmd.logFolder}
+	cmd.logMu.Unlock()
+
+	if m != nil {
+		data.Printer = cmd.target(&Attachment{Mail: m})
+		data.Tracking = m.Tracking
+		data.From = m.From
+		if i := strings.LastIndex(m.From, "@"); i >= 0 {
+			data.Domain = m.From[i+1:]
+		}
+		if p := cmd.mailProfile(m); p != nil {
+			data.Rule = p.Match
+		}
+	}
+
+	fields := map[string]string{}
+	for _, f := range cmd.logFields {
+		var buf bytes.Buffer
+		if err := f.tmpl.Execute(&buf, data); err != nil {
+			continue
+		}
+		if v := strings.TrimSpace(buf.String()); v != "" {
+			fields[f.name] = v
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return fields
+}
+
+// setMailbox makes mbox the selected folder and renders the fields of the run for it
+func (cmd *Command) setMailbox(mbox *imap.MailboxStatus) {
+
+	cmd.mbox = mbox
+
+	cmd.logMu.Lock()
+	cmd.logFolder = mbox.Name
+	cmd.logMu.Unlock()
+
+	cmd.snapshotFields()
+}
+
+// snapshotFields renders the fields of the run prepended to log lines, they only change with the selected folder
+func (cmd *Command) snapshotFields() {
+
+	prefix := formatFields(cmd.fields(nil))
+
+	cmd.logMu.Lock()
+	cmd.logRun = prefix
+	cmd.logMu.Unlock()
+}
+
+// logPrefix returns the fields of the run prepended to log lines
+func (cmd *Command) logPrefix() string {
+	cmd.logMu.Lock()
+	defer cmd.logMu.Unlock()
+	return cmd.logRun
+}
+
+// formatFields returns fields as "name=value ..." sorted by name
+func formatFields(fields map[string]string) string {
+
+	if fields == nil {
+		return ""
+	}
+
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		v := fields[name]
+		if strings.ContainsAny(v, " \"") {
+			v = strconv.Quote(v)
+		}
+		pairs[i] = name + "=" + v
+	}
+
+	return strings.Join(pairs, " ")
+}
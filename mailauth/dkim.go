@@ -0,0 +1,344 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mailauth verifies that the claimed sender domain of a mail is authenticated by DKIM or SPF
+package mailauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum number of DKIM signatures checked per mail
+const MaxSignatures = 5
+
+// Error variables
+var (
+	ErrNoSignature  = errors.New("no DKIM signature")
+	ErrBodyHash     = errors.New("DKIM body hash mismatch")
+	ErrKeyRevoked   = errors.New("DKIM key revoked")
+	ErrBadSignature = errors.New("DKIM signature invalid")
+	ErrExpired      = errors.New("DKIM signature expired")
+)
+
+// LookupTXT resolves DNS TXT records, it is replaceable for other resolvers
+var LookupTXT = net.LookupTXT
+
+// header is a single header field as it appears in the message
+type header struct {
+	name string
+	raw  string
+}
+
+// VerifyDKIM verifies the DKIM signatures of the raw message and returns the domains (d=) of the valid ones,
+// the error describes the first failing signature if none is valid
+func VerifyDKIM(raw []byte) ([]string, error) {
+
+	headers, body := split(raw)
+
+	var domains []string
+	var first error
+	checked := 0
+
+	for i := len(headers) - 1; i >= 0; i-- {
+		if !strings.EqualFold(headers[i].name, "DKIM-Signature") {
+			continue
+		}
+		if checked++; checked > MaxSignatures {
+			break
+		}
+		domain, err := verify(headers, i, body)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		domains = append(domains, domain)
+	}
+
+	if len(domains) > 0 {
+		return domains, nil
+	}
+	if first == nil {
+		first = ErrNoSignature
+	}
+
+	return nil, first
+}
+
+// verify checks the DKIM-Signature headers[index] and returns its signing domain
+func verify(headers []header, index int, body []byte) (string, error) {
+
+	sig := headers[index]
+	tags, err := parseTags(value(sig.raw))
+	if err != nil {
+		return "", err
+	}
+
+	domain := strings.ToLower(tags["d"])
+	if tags["v"] != "1" || domain == "" || tags["s"] == "" || tags["b"] == "" || tags["bh"] == "" || tags["h"] == "" {
+		return "", fmt.Errorf("DKIM signature of %s: missing required tags", domain)
+	}
+	if algo := tags["a"]; algo != "rsa-sha256" && algo != "ed25519-sha256" {
+		return "", fmt.Errorf("DKIM signature of %s: unsupported algorithm %q", domain, algo)
+	}
+	if x, err := strconv.ParseInt(tags["x"], 10, 64); err == nil && time.Now().Unix() > x {
+		return "", fmt.Errorf("%s: %w", domain, ErrExpired)
+	}
+
+	hc, bc := "simple", "simple"
+	if c := tags["c"]; c != "" {
+		parts := strings.SplitN(c, "/", 2)
+		hc = parts[0]
+		if len(parts) == 2 {
+			bc = parts[1]
+		}
+	}
+
+	// Body
+	canon := canonBody(body, bc)
+	if l, err := strconv.Atoi(tags["l"]); err == nil && l >= 0 && l < len(canon) {
+		canon = canon[:l]
+	}
+	bh := sha256.Sum256(canon)
+	if base64.StdEncoding.EncodeToString(bh[:]) != stripSpace(tags["bh"]) {
+		return "", fmt.Errorf("%s: %w", domain, ErrBodyHash)
+	}
+
+	// Signed headers are taken bottom up, each occurrence only once
+	h := sha256.New()
+	used := map[int]bool{index: true}
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.TrimSpace(name)
+		for i := len(headers) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(headers[i].name, name) {
+				continue
+			}
+			used[i] = true
+			h.Write([]byte(canonHeader(headers[i], hc)))
+			break
+		}
+	}
+	unsigned := header{name: sig.name, raw: stripSignature(sig.raw)}
+	h.Write([]byte(strings.TrimSuffix(canonHeader(unsigned, hc), "\r\n")))
+	digest := h.Sum(nil)
+
+	signature, err := base64.StdEncoding.DecodeString(stripSpace(tags["b"]))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", domain, ErrBadSignature)
+	}
+
+	key, err := publicKey(tags["s"], domain)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", domain, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest, signature) {
+			err = ErrBadSignature
+		}
+	default:
+		err = errors.New("unsupported key type")
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", domain, ErrBadSignature)
+	}
+
+	return domain, nil
+}
+
+// publicKey fetches the DKIM key of selector in domain from DNS
+func publicKey(selector string, domain string) (crypto.PublicKey, error) {
+
+	records, err := LookupTXT(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		tags, err := parseTags(record)
+		if err != nil {
+			continue
+		}
+		if v, ok := tags["v"]; ok && v != "DKIM1" {
+			continue
+		}
+		p := stripSpace(tags["p"])
+		if p == "" {
+			return nil, ErrKeyRevoked
+		}
+		data, err := base64.StdEncoding.DecodeString(p)
+		if err != nil {
+			return nil, err
+		}
+		if tags["k"] == "ed25519" {
+			if len(data) != ed25519.PublicKeySize {
+				return nil, errors.New("invalid ed25519 key")
+			}
+			return ed25519.PublicKey(data), nil
+		}
+		if key, err := x509.ParsePKIXPublicKey(data); err == nil {
+			return key, nil
+		}
+		return x509.ParsePKCS1PublicKey(data)
+	}
+
+	return nil, fmt.Errorf("no DKIM key for selector %s", selector)
+}
+
+// split returns the header fields and the body of raw with CRLF line endings
+func split(raw []byte) ([]header, []byte) {
+
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	raw = bytes.ReplaceAll(raw, []byte("\n"), []byte("\r\n"))
+
+	head, body := raw, []byte{}
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		head, body = raw[:i+2], raw[i+4:]
+	}
+
+	var headers []header
+	for _, line := range strings.SplitAfter(string(head), "\r\n") {
+		if line == "" {
+			continue
+		}
+		// Folded continuation lines belong to the previous field
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].raw += line
+			continue
+		}
+		name := line
+		if i := strings.Index(line, ":"); i >= 0 {
+			name = line[:i]
+		}
+		headers = append(headers, header{name: strings.TrimSpace(name), raw: line})
+	}
+
+	return headers, body
+}
+
+// value returns the unfolded value of the header field raw
+func value(raw string) string {
+	if i := strings.Index(raw, ":"); i >= 0 {
+		raw = raw[i+1:]
+	}
+	return strings.NewReplacer("\r\n", "").Replace(raw)
+}
+
+// parseTags parses a "tag=value; tag=value" list
+func parseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed tag %q", part)
+		}
+		tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return tags, nil
+}
+
+// stripSignature empties the b= tag of a DKIM-Signature field keeping everything else untouched
+func stripSignature(raw string) string {
+	i := strings.Index(raw, ":")
+	for i >= 0 && i < len(raw) {
+		rest := raw[i+1:]
+		j := strings.Index(rest, "b=")
+		if j < 0 {
+			return raw
+		}
+		start := i + 1 + j
+		// Only the tag named exactly b counts, not bh
+		before := strings.TrimRight(raw[i+1:start], " \t\r\n")
+		if before == "" || strings.HasSuffix(before, ";") {
+			end := strings.Index(raw[start:], ";")
+			if end < 0 {
+				return raw[:start+2] + "\r\n"
+			}
+			return raw[:start+2] + raw[start+end:]
+		}
+		i = start + 1
+	}
+	return raw
+}
+
+// canonHeader canonicalizes a header field with the simple or relaxed algorithm
+func canonHeader(h header, algo string) string {
+	if algo != "relaxed" {
+		return h.raw
+	}
+	return strings.ToLower(h.name) + ":" + strings.Join(strings.Fields(value(h.raw)), " ") + "\r\n"
+}
+
+// canonBody canonicalizes the body with the simple or relaxed algorithm
+func canonBody(body []byte, algo string) []byte {
+
+	lines := strings.Split(string(body), "\r\n")
+
+	if algo == "relaxed" {
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(strings.Join(splitSpace(line), " "), " ")
+		}
+	}
+
+	// Trailing empty lines are ignored
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		if algo == "relaxed" {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// splitSpace splits s at runs of spaces and tabs keeping a leading empty field for leading whitespace
+func splitSpace(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '\t' })
+	if len(s) > 0 && (s[0] == ' ' || s[0] == '\t') {
+		fields = append([]string{""}, fields...)
+	}
+	if len(s) > 0 && (s[len(s)-1] == ' ' || s[len(s)-1] == '\t') {
+		fields = append(fields, "")
+	}
+	return fields
+}
+
+// stripSpace removes all whitespace of a base64 tag value
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,316 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mailauth
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// SPF results of RFC 7208
+const (
+	SPFPass      = "pass"
+	SPFFail      = "fail"
+	SPFSoftFail  = "softfail"
+	SPFNeutral   = "neutral"
+	SPFNone      = "none"
+	SPFTempError = "temperror"
+	SPFPermError = "permerror"
+)
+
+// Maximum number of DNS querying mechanisms evaluated per check
+const spfLookups = 10
+
+// Lookup functions used by the SPF check, replaceable for other resolvers
+var (
+	LookupIP = net.LookupIP
+	LookupMX = net.LookupMX
+)
+
+var errLookupLimit = errors.New("too many SPF lookups")
+
+// CheckSPF evaluates the SPF policy of domain for a mail sent from ip
+func CheckSPF(ip net.IP, domain string) string {
+	lookups := 0
+	return checkSPF(ip, strings.ToLower(domain), &lookups)
+}
+
+// checkSPF evaluates the SPF record of domain counting the DNS lookups of nested includes
+func checkSPF(ip net.IP, domain string, lookups *int) string {
+
+	records, err := LookupTXT(domain)
+	if err != nil {
+		if de, ok := err.(*net.DNSError); ok && de.IsNotFound {
+			return SPFNone
+		}
+		return SPFTempError
+	}
+
+	var record string
+	for _, r := range records {
+		if r == "v=spf1" || strings.HasPrefix(r, "v=spf1 ") {
+			if record != "" {
+				return SPFPermError
+			}
+			record = r
+		}
+	}
+	if record == "" {
+		return SPFNone
+	}
+
+	var redirect string
+
+	for _, term := range strings.Fields(record)[1:] {
+
+		if strings.HasPrefix(term, "redirect=") {
+			redirect = strings.TrimPrefix(term, "redirect=")
+			continue
+		}
+		if strings.Contains(term, "=") {
+			// Other modifiers like exp= do not change the result
+			continue
+		}
+
+		qualifier := SPFPass
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			qualifier, term = SPFFail, term[1:]
+		case '~':
+			qualifier, term = SPFSoftFail, term[1:]
+		case '?':
+			qualifier, term = SPFNeutral, term[1:]
+		}
+
+		match, result := mechanism(ip, domain, term, lookups)
+		if result != "" {
+			return result
+		}
+		if match {
+			return qualifier
+		}
+	}
+
+	if redirect != "" {
+		if *lookups++; *lookups > spfLookups {
+			return SPFPermError
+		}
+		result := checkSPF(ip, redirect, lookups)
+		if result == SPFNone {
+			return SPFPermError
+		}
+		return result
+	}
+
+	return SPFNeutral
+}
+
+// mechanism reports if term matches ip, result is set if the evaluation has to stop with an error
+func mechanism(ip net.IP, domain string, term string, lookups *int) (bool, string) {
+
+	name, arg := term, ""
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, arg = term[:i], term[i:]
+	}
+	name = strings.ToLower(name)
+
+	// Macros are not supported, mechanisms using them never match
+	if strings.Contains(arg, "%") {
+		return false, ""
+	}
+
+	target, cidr := domain, ""
+	if strings.HasPrefix(arg, ":") {
+		target = arg[1:]
+		if i := strings.Index(target, "/"); i >= 0 {
+			target, cidr = target[:i], target[i:]
+		}
+	} else {
+		cidr = arg
+	}
+
+	switch name {
+	case "all":
+		return true, ""
+	case "ip4", "ip6":
+		network := target
+		if !strings.Contains(network, "/") {
+			network += cidr
+		}
+		if !strings.Contains(network, "/") {
+			if name == "ip4" {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			return false, SPFPermError
+		}
+		return n.Contains(ip), ""
+	case "include":
+		if *lookups++; *lookups > spfLookups {
+			return false, SPFPermError
+		}
+		switch checkSPF(ip, strings.ToLower(target), lookups) {
+		case SPFPass:
+			return true, ""
+		case SPFTempError:
+			return false, SPFTempError
+		case SPFPermError, SPFNone:
+			return false, SPFPermError
+		}
+		return false, ""
+	case "a":
+		if *lookups++; *lookups > spfLookups {
+			return false, SPFPermError
+		}
+		return hostMatches(ip, target, cidr), ""
+	case "mx":
+		if *lookups++; *lookups > spfLookups {
+			return false, SPFPermError
+		}
+		mxs, err := LookupMX(target)
+		if err != nil {
+			return false, ""
+		}
+		for _, mx := range mxs {
+			if hostMatches(ip, strings.TrimSuffix(mx.Host, "."), cidr) {
+				return true, ""
+			}
+		}
+		return false, ""
+	case "exists":
+		if *lookups++; *lookups > spfLookups {
+			return false, SPFPermError
+		}
+		ips, err := LookupIP(target)
+		return err == nil && len(ips) > 0, ""
+	case "ptr":
+		// Deprecated by RFC 7208 and expensive, never matches
+		*lookups++
+		return false, ""
+	}
+
+	return false, SPFPermError
+}
+
+// hostMatches reports if ip is one of the addresses of host, optionally widened by a "/len" or "/len4//len6" suffix
+func hostMatches(ip net.IP, host string, cidr string) bool {
+
+	ips, err := LookupIP(host)
+	if err != nil {
+		return false
+	}
+
+	v4, v6 := "32", "128"
+	if cidr != "" {
+		parts := strings.SplitN(strings.TrimPrefix(cidr, "/"), "//", 2)
+		if parts[0] != "" {
+			v4 = parts[0]
+		}
+		if len(parts) == 2 {
+			v6 = parts[1]
+		}
+	}
+
+	for _, addr := range ips {
+		bits := v6
+		if addr.To4() != nil {
+			bits = v4
+		}
+		if _, n, err := net.ParseCIDR(addr.String() + "/" + bits); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Private and special purpose networks skipped when looking for the sending host
+var localNets = []string{
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "169.254.0.0/16", "100.64.0.0/10",
+	"::1/128", "fc00::/7", "fe80::/10",
+}
+
+var receivedIP = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+
+// SendingIP returns the address of the first public host in the Received headers of the raw message,
+// the one which handed the mail to the receiving server
+func SendingIP(raw []byte) net.IP {
+
+	headers, _ := split(raw)
+
+	for _, h := range headers {
+		if !strings.EqualFold(h.name, "Received") {
+			continue
+		}
+		v := value(h.raw)
+		// Only the from clause names the sending host
+		if i := strings.Index(v, " by "); i >= 0 {
+			v = v[:i]
+		}
+		for _, m := range receivedIP.FindAllStringSubmatch(v, -1) {
+			if ip := net.ParseIP(m[1]); ip != nil && !local(ip) {
+				return ip
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReturnPath returns the envelope sender domain recorded by the receiving server
+func ReturnPath(raw []byte) string {
+	headers, _ := split(raw)
+	for _, h := range headers {
+		if strings.EqualFold(h.name, "Return-Path") {
+			addr := strings.Trim(strings.TrimSpace(value(h.raw)), "<>")
+			if i := strings.LastIndex(addr, "@"); i >= 0 {
+				return strings.ToLower(addr[i+1:])
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// local reports if ip belongs to a private or special purpose network
+func local(ip net.IP) bool {
+	for _, cidr := range localNets {
+		if _, n, _ := net.ParseCIDR(cidr); n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Aligned reports if the authenticated domain matches the domain of the From address,
+// one being a subdomain of the other counts as relaxed alignment
+func Aligned(from string, domain string) bool {
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		from = from[i+1:]
+	}
+	from, domain = strings.ToLower(from), strings.ToLower(domain)
+	if from == "" || domain == "" {
+		return false
+	}
+	return from == domain || strings.HasSuffix(from, "."+domain) || strings.HasSuffix(domain, "."+from)
+}
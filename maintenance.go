@@ -0,0 +1,157 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Time layouts of maintenance windows
+const (
+	WindowDate  = "2006-01-02T15:04"
+	WindowDaily = "15:04"
+)
+
+// ErrWindow is returned for maintenance windows not matching "<printer> <from>/<until> [fallback]"
+var ErrWindow = errors.New("invalid maintenance window")
+
+// Window is a planned maintenance of a printer
+type Window struct {
+	Printer  string
+	From     string
+	Until    string
+	Fallback string
+}
+
+// parseWindow parses "<printer> <from>/<until> [fallback]" with times as 2006-01-02T15:04 or daily as 15:04
+func parseWindow(s string) (*Window, error) {
+
+	fields := strings.Fields(s)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, ErrWindow
+	}
+
+	span := strings.SplitN(fields[1], "/", 2)
+	if len(span) != 2 {
+		return nil, ErrWindow
+	}
+
+	w := &Window{Printer: fields[0], From: span[0], Until: span[1]}
+	if len(fields) == 3 {
+		w.Fallback = fields[2]
+	}
+
+	layout := w.layout()
+	if _, err := time.Parse(layout, w.From); err != nil {
+		return nil, ErrWindow
+	}
+	if _, err := time.Parse(layout, w.Until); err != nil {
+		return nil, ErrWindow
+	}
+
+	return w, nil
+}
+
+// layout returns the time layout of the window
+func (w *Window) layout() string {
+	if len(w.From) == len(WindowDaily) {
+		return WindowDaily
+	}
+	return WindowDate
+}
+
+// active checks if the window covers t; daily windows may span midnight
+func (w *Window) active(t time.Time) bool {
+
+	if w.layout() == WindowDate {
+		from, _ := time.ParseInLocation(WindowDate, w.From, t.Location())
+		until, _ := time.ParseInLocation(WindowDate, w.Until, t.Location())
+		return !t.Before(from) && t.Before(until)
+	}
+
+	now := t.Format(WindowDaily)
+	if w.From <= w.Until {
+		return now >= w.From && now < w.Until
+	}
+
+	return now >= w.From || now < w.Until
+}
+
+// maintenance returns the active maintenance window of printer or nil
+func (cmd *Command) maintenance(printer string) *Window {
+
+	now := time.Now()
+
+	for _, s := range cmd.cfg.Maintenance {
+		w, err := parseWindow(s)
+		if err != nil {
+			cmd.logpad("Maintenance", s, err.Error())
+			continue
+		}
+		if w.Printer == printer && w.active(now) {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// route reroutes jobs to the fallback of a printer under maintenance and returns false if jobs have to be held
+func (cmd *Command) route() bool {
+
+	printer := cmd.cfg.Cups.Printer
+
+	w := cmd.maintenance(printer)
+	if w == nil {
+		return true
+	}
+
+	if w.Fallback == "" || cmd.maintenance(w.Fallback) != nil {
+		cmd.logpad("Maintenance", printer, w.From+"/"+w.Until)
+		return false
+	}
+
+	cmd.logpad("Maintenance", printer, tr("rerouted to"), w.Fallback)
+	cmd.cfg.Cups.Printer = w.Fallback
+
+	return true
+}
+
+// paused reports if the pause file exists, nothing is fetched or printed until it is removed
+func (cmd *Command) paused() bool {
+
+	if cmd.cfg.PauseFile == "" {
+		return false
+	}
+
+	info, err := os.Stat(cmd.cfg.PauseFile)
+	if err != nil {
+		return false
+	}
+
+	// The first line of the file may tell why and by whom
+	reason := ""
+	if data, err := ioutil.ReadFile(cmd.cfg.PauseFile); err == nil {
+		reason = strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+	}
+
+	cmd.logpad("Paused", cmd.cfg.PauseFile, info.ModTime().Format(time.RFC1123), reason)
+
+	return true
+}
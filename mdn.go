@@ -0,0 +1,133 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/emersion/go-message/mail"
+	"mime"
+	"os"
+	"strings"
+	"time"
+)
+
+// Header names of read receipt requests
+const (
+	MDNHeader        = "Disposition-Notification-To"
+	ReturnPathHeader = "Return-Path"
+)
+
+// mdnRecipient returns the address a read receipt is requested for, empty unless it is the sender (From or
+// Return-Path) as recommended by RFC 8098, so the print address can't be used to mail third parties
+func (cmd *Command) mdnRecipient(header mail.Header, from string) string {
+
+	to, err := header.AddressList(MDNHeader)
+	if err != nil || len(to) == 0 {
+		return ""
+	}
+
+	addr := to[0].Address
+	if strings.EqualFold(addr, from) {
+		return addr
+	}
+	if rp, err := header.AddressList(ReturnPathHeader); err == nil && len(rp) > 0 && strings.EqualFold(addr, rp[0].Address) {
+		return addr
+	}
+
+	cmd.logverb("MDN", "Ignoring request for", addr, "by", from)
+
+	return ""
+}
+
+// sendMDNs sends message disposition notifications for mails requesting them
+func (cmd *Command) sendMDNs(mails []*Mail) {
+
+	if !cmd.cfg.MDN || cmd.NoNotify {
+		return
+	}
+
+	for _, m := range mails {
+
+		// Never answer unknown senders to avoid backscatter
+		if m.MDNTo == "" || !m.isValidSender(cmd.filters(m)) || cmd.unprintedByScope(m) {
+			continue
+		}
+
+		ok := m.printed()
+
+		if err := cmd.smtpsend([]string{m.MDNTo}, cmd.mdn(m, ok)); err != nil {
+			cmd.logpad("MDN", m.MDNTo, err.Error())
+			continue
+		}
+
+		cmd.logverb("MDN", m.MDNTo, ok)
+	}
+}
+
+// mdn builds a RFC 8098 message disposition notification for m
+func (cmd *Command) mdn(m *Mail, ok bool) []byte {
+
+	hostname, _ := os.Hostname()
+
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	boundary := "mdn-" + hex.EncodeToString(id)
+
+	disposition := "processed"
+	text := fmt.Sprintf(tr("Your message %q has been printed."), m.Subject)
+	if !ok {
+		disposition = "processed/error"
+		text = fmt.Sprintf(tr("Your message %q could not be printed."), m.Subject)
+		for _, e := range m.Errors {
+			text += "\r\n - " + e
+		}
+	}
+	text += "\r\n\r\n" + fmt.Sprintf(tr("Tracking ID: %s"), m.Tracking)
+
+	var msg bytes.Buffer
+
+	msg.WriteString("From: " + cmd.cfg.SMTP.From + "\r\n")
+	msg.WriteString("To: " + m.MDNTo + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", tr("Disposition notification")+" ["+m.Tracking+"]: "+m.Subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	if m.MessageID != "" {
+		msg.WriteString("In-Reply-To: <" + m.MessageID + ">\r\n")
+		msg.WriteString("References: <" + m.MessageID + ">\r\n")
+	}
+	msg.WriteString("Auto-Submitted: auto-replied\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: multipart/report; report-type=disposition-notification; boundary=\"" + boundary + "\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(text + "\r\n")
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: message/disposition-notification\r\n\r\n")
+	msg.WriteString("Reporting-UA: " + hostname + "; IMAPPrint\r\n")
+	msg.WriteString("Final-Recipient: rfc822; " + cmd.cfg.SMTP.From + "\r\n")
+	if m.MessageID != "" {
+		msg.WriteString("Original-Message-ID: <" + m.MessageID + ">\r\n")
+	}
+	msg.WriteString("Disposition: automatic-action/MDN-sent-automatically; " + disposition + "\r\n")
+	if !ok && len(m.Errors) > 0 {
+		msg.WriteString("Error: " + strings.Join(m.Errors, "; ") + "\r\n")
+	}
+	msg.WriteString("--" + boundary + "--\r\n")
+
+	return msg.Bytes()
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateMetrics is the state key of the counters summed up over all runs
+const StateMetrics = "metrics"
+
+// MetricsTotals are the counters of all runs exported to METRICS_FILE
+type MetricsTotals struct {
+	Runs        int            `json:"runs"`
+	Errors      int            `json:"errors"`
+	Decisions   map[string]int `json:"decisions"`
+	Failures    int            `json:"failures"`
+	Pages       int            `json:"pages"`
+	LastSuccess time.Time      `json:"last_success"`
+}
+
+// metricDecisions are exported even if no mail got them yet, so every series exists from the first run on
+var metricDecisions = []string{DecisionPrinted, DecisionQueued, DecisionRejected, DecisionHeld, DecisionFailed, DecisionSkipped}
+
+// writeMetrics adds the run to the counters of the state database and writes them in the Prometheus text format
+// to METRICS_FILE, e.g. for the textfile collector of node_exporter
+func (cmd *Command) writeMetrics(err error) {
+
+	r := cmd.runState
+	if cmd.cfg.Metrics == "" || r == nil || cmd.DryRun {
+		return
+	}
+
+	db, derr := cmd.store()
+	if derr != nil {
+		cmd.logpad("State DB", derr.Error())
+		return
+	}
+
+	totals := MetricsTotals{Decisions: map[string]int{}}
+	_, _ = db.get(BucketMeta, StateMetrics, &totals)
+	if totals.Decisions == nil {
+		totals.Decisions = map[string]int{}
+	}
+
+	totals.Runs++
+	if err != nil {
+		totals.Errors++
+	} else {
+		totals.LastSuccess = r.Finished
+	}
+	for decision, n := range r.Decisions {
+		totals.Decisions[decision] += n
+	}
+	totals.Failures += r.Failures
+	totals.Pages += r.Pages
+
+	if derr := db.put(BucketMeta, StateMetrics, totals); derr != nil {
+		cmd.logpad("State DB", derr.Error())
+	}
+
+	var b bytes.Buffer
+
+	metric := func(name string, kind string, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	flag := func(v bool) int {
+		if v {
+			return 1
+		}
+		return 0
+	}
+
+	metric("imap_print_runs_total", "counter", "Runs of imap-print.")
+	fmt.Fprintf(&b, "imap_print_runs_total %d\n", totals.Runs)
+	metric("imap_print_run_errors_total", "counter", "Runs aborted by an error.")
+	fmt.Fprintf(&b, "imap_print_run_errors_total %d\n", totals.Errors)
+	metric("imap_print_mails_total", "counter", "Processed mails by decision.")
+	for _, decision := range metricDecisions {
+		fmt.Fprintf(&b, "imap_print_mails_total{decision=%q} %d\n", decision, totals.Decisions[decision])
+	}
+	metric("imap_print_document_failures_total", "counter", "Documents failed to print.")
+	fmt.Fprintf(&b, "imap_print_document_failures_total %d\n", totals.Failures)
+	metric("imap_print_pages_total", "counter", "Printed pages.")
+	fmt.Fprintf(&b, "imap_print_pages_total %d\n", totals.Pages)
+	metric("imap_print_last_run_timestamp_seconds", "gauge", "End of the last run.")
+	fmt.Fprintf(&b, "imap_print_last_run_timestamp_seconds %d\n", r.Finished.Unix())
+	metric("imap_print_last_run_duration_seconds", "gauge", "Duration of the last run.")
+	fmt.Fprintf(&b, "imap_print_last_run_duration_seconds %.3f\n", r.Finished.Sub(r.Started).Seconds())
+	metric("imap_print_last_run_success", "gauge", "Whether the last run finished without an error.")
+	fmt.Fprintf(&b, "imap_print_last_run_success %d\n", flag(err == nil))
+	metric("imap_print_last_success_timestamp_seconds", "gauge", "End of the last successful run.")
+	if !totals.LastSuccess.IsZero() {
+		fmt.Fprintf(&b, "imap_print_last_success_timestamp_seconds %d\n", totals.LastSuccess.Unix())
+	}
+	metric("imap_print_printer_down", "gauge", "Whether the printer was unreachable in the last run.")
+	fmt.Fprintf(&b, "imap_print_printer_down %d\n", flag(r.PrinterDown))
+
+	// The collector never sees a partial file
+	file := cmd.cfg.Metrics
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		cmd.logpad("Metrics File", err.Error())
+		return
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		cmd.logpad("Metrics File", err.Error())
+		return
+	}
+
+	cmd.logverb("Metrics File", file)
+}
+
+// dashboardPanel is a panel of the Grafana dashboard showing the metrics of expr with their legend
+type dashboardPanel struct {
+	kind   string
+	title  string
+	unit   string
+	expr   []string
+	legend []string
+}
+
+// dashboardPanels are laid out in rows of four stats followed by one graph per row
+var dashboardPanels = []dashboardPanel{
+	{kind: "stat", title: "Time since last run", unit: "s", expr: []string{"time() - imap_print_last_run_timestamp_seconds"}},
+	{kind: "stat", title: "Time since last success", unit: "s", expr: []string{"time() - imap_print_last_success_timestamp_seconds"}},
+	{kind: "stat", title: "Last run duration", unit: "s", expr: []string{"imap_print_last_run_duration_seconds"}},
+	{kind: "stat", title: "Printer down", unit: "bool", expr: []string{"imap_print_printer_down"}},
+	{kind: "timeseries", title: "Mails per day", unit: "short",
+		expr: []string{"increase(imap_print_mails_total[1d])"}, legend: []string{"{{decision}}"}},
+	{kind: "timeseries", title: "Pages per day", unit: "short",
+		expr: []string{"increase(imap_print_pages_total[1d])"}, legend: []string{"pages"}},
+	{kind: "timeseries", title: "Failures per day", unit: "short",
+		expr:   []string{"increase(imap_print_document_failures_total[1d])", "increase(imap_print_run_errors_total[1d])"},
+		legend: []string{"failed documents", "run errors"}},
+}
+
+// dashboard returns the Grafana dashboard of the metrics written to METRICS_FILE
+func dashboard() map[string]interface{} {
+
+	datasource := map[string]interface{}{"type": "prometheus", "uid": "${datasource}"}
+
+	var panels []interface{}
+	x, y := 0, 0
+
+	for i, p := range dashboardPanels {
+
+		w, h := 6, 4
+		if p.kind != "stat" {
+			w, h = 24, 8
+		}
+
+		var targets []interface{}
+		for j, expr := range p.expr {
+			target := map[string]interface{}{"expr": expr, "refId": string(rune('A' + j)), "datasource": datasource}
+			if j < len(p.legend) {
+				target["legendFormat"] = p.legend[j]
+			}
+			targets = append(targets, target)
+		}
+
+		panels = append(panels, map[string]interface{}{
+			"id":          i + 1,
+			"type":        p.kind,
+			"title":       p.title,
+			"datasource":  datasource,
+			"gridPos":     map[string]int{"x": x, "y": y, "w": w, "h": h},
+			"fieldConfig": map[string]interface{}{"defaults": map[string]string{"unit": p.unit}, "overrides": []interface{}{}},
+			"targets":     targets,
+		})
+
+		x += w
+		if x >= 24 {
+			x, y = 0, y+h
+		}
+	}
+
+	return map[string]interface{}{
+		"title":         "imap-print",
+		"uid":           "imap-print",
+		"tags":          []string{"imap-print"},
+		"schemaVersion": 39,
+		"refresh":       "5m",
+		"time":          map[string]string{"from": "now-7d", "to": "now"},
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{"name": "datasource", "label": "Prometheus", "type": "datasource", "query": "prometheus"},
+			},
+		},
+		"panels": panels,
+	}
+}
+
+// metricsDashboard is used as callable for the metrics dashboard sub command printing the Grafana dashboard
+func (cmd *Command) metricsDashboard(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	data, err := json.MarshalIndent(dashboard(), "", "  ")
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	fmt.Println(string(data))
+
+	return nil
+}
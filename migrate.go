@@ -0,0 +1,204 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Name of the file stamping the schema version of the queue directory
+const QueueSchemaFile = ".schema"
+
+// ErrSchemaNewer is returned if persisted data was written by a newer version of imap-print
+var ErrSchemaNewer = errors.New("written by a newer version of imap-print, refusing to downgrade")
+
+// migration upgrades persisted data to version, apply is nil if only the version stamp changes
+type migration struct {
+	version int
+	name    string
+	apply   func(cmd *Command) error
+}
+
+// Migrations of the state database (history, dedup, backlog, ...) in ascending order
+var stateMigrations = []migration{
+	{1, "Stamp the state database with its schema version", nil},
+}
+
+// Migrations of the queue directory in ascending order
+var queueMigrations = []migration{
+	{1, "Stamp queue entries with their schema version", (*Command).stampQueueEntries},
+}
+
+// Current schema versions written by this version
+var (
+	StateSchema = stateMigrations[len(stateMigrations)-1].version
+	QueueSchema = queueMigrations[len(queueMigrations)-1].version
+)
+
+// ArchiveSchema is the version of the sidecars stored next to archived attachments
+const ArchiveSchema = 1
+
+// migrateState applies the pending migrations to the state database db and returns their names,
+// nothing is changed if dry is set
+func (cmd *Command) migrateState(db *Store, dry bool) ([]string, error) {
+
+	var version int
+	if _, err := db.get(BucketMeta, "schema", &version); err != nil {
+		return nil, err
+	}
+
+	return migrate("State DB", version, stateMigrations, dry, cmd, func(v int) error {
+		return db.put(BucketMeta, "schema", v)
+	})
+}
+
+// migrateQueue applies the pending migrations to the queue directory and returns their names,
+// nothing is changed if dry is set
+func (cmd *Command) migrateQueue(dry bool) ([]string, error) {
+
+	// Brokers carry the schema in every entry, new directories are created with the current one
+	if cmd.cfg.Queue.URL != "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(cmd.cfg.Queue.Dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	stamp := filepath.Join(cmd.cfg.Queue.Dir, QueueSchemaFile)
+
+	version := 0
+	if data, err := ioutil.ReadFile(stamp); err == nil {
+		if version, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			return nil, fmt.Errorf("%s: %v", stamp, err)
+		}
+	}
+
+	return migrate("Queue", version, queueMigrations, dry, cmd, func(v int) error {
+		return ioutil.WriteFile(stamp, []byte(strconv.Itoa(v)+"\n"), 0600)
+	})
+}
+
+// migrate applies the migrations newer than version and stamps each applied version
+func migrate(what string, version int, migrations []migration, dry bool, cmd *Command, stamp func(v int) error) ([]string, error) {
+
+	if latest := migrations[len(migrations)-1].version; version > latest {
+		return nil, fmt.Errorf("%s schema %d: %w", what, version, ErrSchemaNewer)
+	}
+
+	var names []string
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		name := fmt.Sprintf("%s %d: %s", what, m.version, m.name)
+		names = append(names, name)
+		if dry {
+			continue
+		}
+		cmd.logpad("Migrate", name)
+		if m.apply != nil {
+			if err := m.apply(cmd); err != nil {
+				return names, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		if err := stamp(m.version); err != nil {
+			return names, err
+		}
+	}
+
+	return names, nil
+}
+
+// stampQueueEntries adds the schema version to the entries of the queue directory written before it existed
+func (cmd *Command) stampQueueEntries() error {
+
+	files, err := filepath.Glob(filepath.Join(cmd.cfg.Queue.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		if _, ok := entry["schema"]; ok {
+			continue
+		}
+		entry["schema"] = 1
+		if data, err = json.Marshal(entry); err != nil {
+			return err
+		}
+		tmp := file + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateCommand is used as callable for the migrate sub command
+func (cmd *Command) migrateCommand(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	dry := c.Bool(ArgDry)
+
+	db, err := openStore(cmd.cfg.StateDB)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	cmd.db = db
+
+	state, err := cmd.migrateState(db, dry)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	queue, err := cmd.migrateQueue(dry)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	pending := append(state, queue...)
+	if len(pending) == 0 {
+		cmd.logpad("Migrate", tr("Up to date"))
+		return nil
+	}
+
+	if dry {
+		for _, name := range pending {
+			fmt.Println(name)
+		}
+	}
+
+	return nil
+}
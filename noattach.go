@@ -0,0 +1,115 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policies for mails of allowed senders without printable attachments
+const (
+	// NoAttachDelete rejects and deletes the mail
+	NoAttachDelete = "delete"
+	// NoAttachIgnore deletes the mail without answering or reporting it
+	NoAttachIgnore = "ignore"
+	// NoAttachKeep leaves the mail in the mailbox
+	NoAttachKeep = "keep"
+	// NoAttachForward forwards the mail to a human and deletes it
+	NoAttachForward = "forward"
+	// NoAttachBody prints the text of the mail
+	NoAttachBody = "body"
+)
+
+// unprintable applies the configured policy to m if it comes from an allowed sender without printable attachments
+func (cmd *Command) unprintable(m *Mail) {
+
+	if m.Rejected != RejectNoAttach && m.Rejected != RejectNoValidType {
+		return
+	}
+
+	switch cmd.cfg.NoAttach {
+	case NoAttachIgnore:
+		cmd.logverb("No Attachments", m.Subject, "ignored")
+		m.Quiet = true
+	case NoAttachKeep:
+		cmd.logpad("No Attachments", m.Subject, "kept in mailbox")
+		m.Held = true
+		m.Quiet = true
+	case NoAttachForward:
+		if err := cmd.forward(m); err != nil {
+			// The mail stays in the mailbox rather than getting lost
+			cmd.logpad("Forward", m.Subject, err.Error())
+			m.Held = true
+			m.Quiet = true
+			return
+		}
+		m.Quiet = true
+	}
+}
+
+// forward sends m with its original message to the NO_ATTACHMENTS_FORWARD recipients, ADMIN_EMAIL if empty
+func (cmd *Command) forward(m *Mail) error {
+
+	to := cmd.cfg.NoAttachTo
+	if len(to) == 0 {
+		to = cmd.cfg.Admin.Email
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no forward recipients configured")
+	}
+
+	if cmd.DryRun {
+		cmd.logpad("Forward", m.Subject, strings.Join(to, ", "))
+		return nil
+	}
+	if cmd.NoNotify {
+		return fmt.Errorf("outgoing mail disabled")
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(tr("A mail without printable attachments arrived from %s:"), m.From) + "\r\n\r\n")
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("From")+":", m.From))
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("Subject")+":", m.Subject))
+	text.WriteString(fmt.Sprintf("%-12s %s\r\n", tr("Tracking")+":", m.Tracking))
+	for _, e := range m.Errors {
+		text.WriteString(" - " + e + "\r\n")
+	}
+
+	// Answers of the recipient go to the sender directly
+	var headers []string
+	if m.From != "" && !strings.ContainsAny(m.From, "\r\n") {
+		headers = append(headers, "Reply-To: "+m.From)
+	}
+
+	msg := cmd.originalMessage(to, "Fwd: "+m.Subject, text.String(), m.Raw, headers...)
+	if err := cmd.smtpsend(to, msg); err != nil {
+		return err
+	}
+
+	cmd.logpad("Forward", m.Subject, strings.Join(to, ", "))
+
+	return nil
+}
+
+// printBody checks if the text of m is printed, because it has no attachments at all or by the NO_ATTACHMENTS policy
+// because none of its attachments is printable
+func (cmd *Command) printBody(m *Mail) bool {
+	f := cmd.filters(m)
+	if cmd.cfg.PrintBody && !m.hasAttachments() {
+		return true
+	}
+	return cmd.cfg.NoAttach == NoAttachBody && m.isValidSender(f) && !m.validAttachments(f)
+}
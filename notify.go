@@ -0,0 +1,58 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNotifyUnsupported is returned if desktop notifications aren't available on this platform
+var ErrNotifyUnsupported = errors.New("desktop notifications not supported on this platform")
+
+// notifyDesktop shows a native notification for every printed or failed mail when running attended in a terminal
+func (cmd *Command) notifyDesktop(mails []*Mail) {
+
+	if !cmd.cfg.Notify || cmd.NoNotify || !interactive() {
+		return
+	}
+
+	for _, m := range mails {
+
+		if m.Canary != "" || m.Rejected != "" || (len(m.Jobs) == 0 && len(m.Errors) == 0) {
+			continue
+		}
+
+		title := fmt.Sprintf(tr("Printed: %s"), m.Subject)
+		text := fmt.Sprintf(tr("%d pages from %s"), m.Pages, m.From)
+		if !m.printed() {
+			title = fmt.Sprintf(tr("Not printed: %s"), m.Subject)
+			text = strings.Join(m.Errors, "\n")
+		}
+
+		if err := desktopNotify(title, text); err != nil {
+			cmd.logverb("Notify", err.Error())
+			return
+		}
+	}
+}
+
+// interactive reports if the output goes to a terminal, i.e. someone is watching
+func interactive() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package imapprint
+
+import "os/exec"
+
+// desktopNotify shows a notification with notify-send where a desktop provides it
+func desktopNotify(title string, text string) error {
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		return ErrNotifyUnsupported
+	}
+	return exec.Command("notify-send", "--app-name=IMAPPrint", "--", title, text).Run()
+}
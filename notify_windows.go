@@ -0,0 +1,35 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"os"
+	"os/exec"
+)
+
+// toastScript shows a toast with the texts passed in the environment to avoid quoting
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$texts = $xml.GetElementsByTagName('text')
+$texts.Item(0).AppendChild($xml.CreateTextNode($env:IMAPPRINT_TITLE)) > $null
+$texts.Item(1).AppendChild($xml.CreateTextNode($env:IMAPPRINT_TEXT)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('IMAPPrint').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+
+// desktopNotify shows a toast notification
+func desktopNotify(title string, text string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "IMAPPRINT_TITLE="+title, "IMAPPRINT_TEXT="+text)
+	return cmd.Run()
+}
@@ -0,0 +1,393 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+	"github.com/urfave/cli/v2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth token endpoint error codes (RFC 6749 section 5.2, RFC 8628 section 3.5)
+const (
+	OAuthInvalidGrant = "invalid_grant"
+	OAuthPending      = "authorization_pending"
+	OAuthSlowDown     = "slow_down"
+	OAuthExpiredToken = "expired_token"
+	// OAuthDeviceGrant is the grant type of the device authorization grant
+	OAuthDeviceGrant = "urn:ietf:params:oauth:grant-type:device_code"
+	// SASL mechanisms selectable with OAUTH_MECHANISM
+	OAuthAuto    = "AUTO"
+	OAuthBearer  = sasl.OAuthBearer
+	OAuthXOAuth2 = sasl.Xoauth2
+	// OAuthExpiryMargin renews access tokens shortly before they expire
+	OAuthExpiryMargin = time.Minute
+)
+
+// ErrNoRefreshToken is returned when OAuth is configured without any refresh token
+var ErrNoRefreshToken = errors.New("no refresh token, run \"auth login\"")
+
+// OAuthError is an error of the OAuth token endpoint, it never counts as IMAP failure
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	Status      int    `json:"-"`
+}
+
+// Error implements error
+func (e *OAuthError) Error() string {
+	msg := "oauth: " + e.Code
+	if e.Code == "" {
+		msg = fmt.Sprintf("oauth: status %d", e.Status)
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// revoked reports if the refresh token is revoked or expired and a re-authorization is needed
+func (e *OAuthError) revoked() bool {
+	return e.Code == OAuthInvalidGrant
+}
+
+// temporary reports if retrying the request may succeed
+func (e *OAuthError) temporary() bool {
+	return e.Status == 0 || e.Code == OAuthSlowDown || e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// Token is an OAuth access token with the refresh token to renew it
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int       `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+	Seed         string    `json:"seed"`
+}
+
+// DeviceCode is the response of the device authorization endpoint (RFC 8628 section 3.2)
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// oauth reports if the IMAP login uses OAuth instead of a password
+func (cmd *Command) oauth() bool {
+	return cmd.cfg.OAuth.TokenURL != ""
+}
+
+// login authenticates c with OAUTHBEARER, XOAUTH2 or the configured password
+func (cmd *Command) login(c *client.Client) error {
+
+	if !cmd.oauth() {
+		return c.Login(cmd.cfg.IMAP.User, cmd.cfg.IMAP.Pass)
+	}
+
+	token, err := cmd.accessToken()
+	if err != nil {
+		return err
+	}
+
+	mech, err := cmd.oauthMechanism(c)
+	if err != nil {
+		return err
+	}
+
+	cmd.logverb("OAuth", mech)
+
+	if mech == OAuthXOAuth2 {
+		return c.Authenticate(sasl.NewXoauth2Client(cmd.cfg.IMAP.User, token))
+	}
+
+	opts := &sasl.OAuthBearerOptions{Username: cmd.cfg.IMAP.User, Token: token}
+	if host, port, err := net.SplitHostPort(cmd.cfg.IMAP.Addr); err == nil {
+		opts.Host = host
+		opts.Port, _ = strconv.Atoi(port)
+	}
+
+	return c.Authenticate(sasl.NewOAuthBearerClient(opts))
+}
+
+// oauthMechanism returns the configured SASL mechanism, in auto mode the standard OAUTHBEARER if the server
+// advertises it and XOAUTH2 otherwise
+func (cmd *Command) oauthMechanism(c *client.Client) (string, error) {
+
+	if mech := strings.ToUpper(cmd.cfg.OAuth.Mechanism); mech != OAuthAuto {
+		return mech, nil
+	}
+
+	ok, err := c.SupportAuth(sasl.OAuthBearer)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return OAuthBearer, nil
+	}
+
+	return OAuthXOAuth2, nil
+}
+
+// accessToken returns a valid access token, renewing it with the refresh token if necessary
+func (cmd *Command) accessToken() (string, error) {
+
+	db, err := cmd.store()
+	if err != nil {
+		return "", err
+	}
+
+	var t Token
+	if _, err := db.get(BucketOAuth, "token", &t); err != nil {
+		return "", err
+	}
+
+	// A refresh token changed in the configuration replaces the stored one
+	if seed := cmd.cfg.OAuth.RefreshToken; seed != "" && seed != t.Seed {
+		t = Token{RefreshToken: seed, Seed: seed}
+	}
+
+	if t.AccessToken != "" && time.Now().Add(OAuthExpiryMargin).Before(t.Expiry) {
+		return t.AccessToken, nil
+	}
+
+	if t.RefreshToken == "" {
+		return "", ErrNoRefreshToken
+	}
+
+	renewed, err := cmd.refresh(t.RefreshToken)
+	if err != nil {
+		var oe *OAuthError
+		if errors.As(err, &oe) && oe.revoked() {
+			cmd.alert("oauth-revoked", tr("OAuth refresh token revoked"), tr("The refresh token has been revoked or expired, run \"imap-print auth renew\".")+"\n\n"+err.Error())
+		}
+		return "", err
+	}
+
+	renewed.Seed = t.Seed
+	if renewed.RefreshToken == "" {
+		renewed.RefreshToken = t.RefreshToken
+	}
+	if err := db.put(BucketOAuth, "token", renewed); err != nil {
+		return "", err
+	}
+
+	return renewed.AccessToken, nil
+}
+
+// refresh renews the access token with refreshToken, temporary failures are retried with exponential backoff
+func (cmd *Command) refresh(refreshToken string) (*Token, error) {
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+
+	delay := cmd.cfg.OAuth.Backoff
+
+	for attempt := 0; ; attempt++ {
+
+		var t Token
+		err := cmd.tokenRequest(cmd.cfg.OAuth.TokenURL, form, &t)
+		if err == nil {
+			cmd.logverb("OAuth", tr("Access token renewed"))
+			return t.expiring(), nil
+		}
+
+		var oe *OAuthError
+		if errors.As(err, &oe) && !oe.temporary() {
+			return nil, err
+		}
+		if attempt >= cmd.cfg.OAuth.Retries {
+			return nil, err
+		}
+
+		cmd.logpad("OAuth", err.Error())
+		cmd.logpad("OAuth", tr("Retrying in"), delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// authLogin is the action of "auth login" obtaining the first refresh token with the device authorization grant
+func (cmd *Command) authLogin(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	db, err := cmd.store()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	var t Token
+	if _, err := db.get(BucketOAuth, "token", &t); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	if t.RefreshToken != "" || cmd.cfg.OAuth.RefreshToken != "" {
+		return cli.NewExitError(tr("Already authorized, run \"auth renew\" to authorize again"), 1)
+	}
+
+	if err := cmd.authorize(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	return nil
+}
+
+// authRenew is the action of "auth renew" obtaining a new refresh token with the device authorization grant
+func (cmd *Command) authRenew(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	if err := cmd.authorize(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	return nil
+}
+
+// authorize runs the device authorization grant on the console and stores the obtained token
+func (cmd *Command) authorize() error {
+
+	if cmd.cfg.OAuth.TokenURL == "" || cmd.cfg.OAuth.DeviceURL == "" {
+		return errors.New(tr("OAUTH_TOKEN_URL and OAUTH_DEVICE_URL are required"))
+	}
+
+	var dc DeviceCode
+	if err := cmd.tokenRequest(cmd.cfg.OAuth.DeviceURL, url.Values{"scope": {cmd.cfg.OAuth.Scope}}, &dc); err != nil {
+		return err
+	}
+
+	if dc.VerificationURIComplete != "" {
+		fmt.Printf(tr("Open %s to authorize imap-print")+"\n", dc.VerificationURIComplete)
+	} else {
+		fmt.Printf(tr("Open %s and enter the code %s")+"\n", dc.VerificationURI, dc.UserCode)
+	}
+	if dc.ExpiresIn > 0 {
+		fmt.Printf(tr("Waiting for authorization, the code expires in %s")+"\n", time.Duration(dc.ExpiresIn)*time.Second)
+	}
+
+	t, err := cmd.pollDevice(&dc)
+	if err != nil {
+		return err
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		return err
+	}
+
+	// The configured refresh token stays the seed, it must not replace the new one on the next run
+	t.Seed = cmd.cfg.OAuth.RefreshToken
+	if err := db.put(BucketOAuth, "token", t); err != nil {
+		return err
+	}
+
+	fmt.Println(tr("Authorization complete"))
+
+	return nil
+}
+
+// pollDevice polls the token endpoint until the user completed the authorization of dc
+func (cmd *Command) pollDevice(dc *DeviceCode) (*Token, error) {
+
+	interval := time.Duration(dc.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	form := url.Values{
+		"grant_type":  {OAuthDeviceGrant},
+		"device_code": {dc.DeviceCode},
+	}
+
+	deadline := time.Now().Add(time.Duration(dc.ExpiresIn) * time.Second)
+
+	for dc.ExpiresIn <= 0 || time.Now().Before(deadline) {
+
+		time.Sleep(interval)
+
+		var t Token
+		err := cmd.tokenRequest(cmd.cfg.OAuth.TokenURL, form, &t)
+		if err == nil {
+			return t.expiring(), nil
+		}
+
+		var oe *OAuthError
+		if !errors.As(err, &oe) {
+			return nil, err
+		}
+		switch oe.Code {
+		case OAuthPending:
+		case OAuthSlowDown:
+			interval += 5 * time.Second
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, &OAuthError{Code: OAuthExpiredToken, Status: http.StatusBadRequest}
+}
+
+// tokenRequest posts form with the client credentials to endpoint and decodes the response into v
+func (cmd *Command) tokenRequest(endpoint string, form url.Values, v interface{}) error {
+
+	form.Set("client_id", cmd.cfg.OAuth.ClientID)
+	if cmd.cfg.OAuth.ClientSecret != "" {
+		form.Set("client_secret", cmd.cfg.OAuth.ClientSecret)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(endpoint, form)
+	if err != nil {
+		return &OAuthError{Description: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &OAuthError{Status: resp.StatusCode, Description: err.Error()}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		oe := &OAuthError{Status: resp.StatusCode}
+		if json.Unmarshal(data, oe) != nil {
+			oe.Description = strings.TrimSpace(string(data))
+		}
+		return oe
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// expiring returns t with its expiry calculated from the lifetime of the response
+func (t Token) expiring() *Token {
+	if t.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	return &t
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Predefined office converter commands, {in}, {out} and {outdir} are replaced on execution
+var officeConverters = map[string]string{
+	"libreoffice": "soffice --headless --norestore -env:UserInstallation=file://{outdir}/.libreoffice --convert-to pdf --outdir {outdir} {in}",
+	"unoconv":     "unoconv -f pdf -o {out} {in}",
+}
+
+// convertOffice converts office documents into PDF documents, other attachments are returned unchanged
+func (cmd *Command) convertOffice(attachment *Attachment) (*Attachment, error) {
+
+	if cmd.cfg.Office.Converter == "" || !inArrStr(filter.FileExt(attachment.File), cmd.cfg.Office.Extensions) {
+		return attachment, nil
+	}
+
+	command := cmd.cfg.Office.Converter
+	if preset, ok := officeConverters[command]; ok {
+		command = preset
+	}
+
+	in := attachment.File
+	outdir := filepath.Dir(in)
+	out := strings.TrimSuffix(in, filepath.Ext(in)) + ".pdf"
+
+	var args []string
+	for _, arg := range strings.Fields(command) {
+		arg = strings.Replace(arg, "{in}", in, -1)
+		arg = strings.Replace(arg, "{out}", out, -1)
+		arg = strings.Replace(arg, "{outdir}", outdir, -1)
+		args = append(args, arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.Office.Timeout)
+	defer cancel()
+
+	cmd.chaosSlow()
+
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := c.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("office conversion timed out after %s", cmd.cfg.Office.Timeout)
+	}
+	if err != nil {
+		cmd.logverb("Convert Output", string(output))
+		return nil, err
+	}
+
+	if fi, err := os.Stat(out); err != nil || fi.Size() == 0 {
+		return nil, errors.New("office converter produced no output")
+	}
+
+	converted := *attachment
+	converted.File = out
+	converted.Name = strings.TrimSuffix(attachment.Name, filepath.Ext(attachment.Name)) + ".pdf"
+
+	return &converted, nil
+}
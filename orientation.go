@@ -0,0 +1,170 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"path/filepath"
+	"strings"
+)
+
+// Policies for PDFs mixing portrait and landscape pages
+const (
+	MixedOff    = "off"
+	MixedRotate = "rotate"
+	MixedSplit  = "split"
+)
+
+// pageRun is a range of consecutive pages of the same orientation
+type pageRun struct {
+	From      int
+	To        int
+	Landscape bool
+}
+
+// pages returns the page range of run as selected by pdfcpu
+func (r pageRun) pages() string {
+	if r.From == r.To {
+		return fmt.Sprint(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// orientation returns the orientation requested for the pages of run
+func (r pageRun) orientation() string {
+	if r.Landscape {
+		return printer.OrientationLandscape
+	}
+	return printer.OrientationPortrait
+}
+
+// pageRuns returns the runs of pages of the same orientation of the PDF file, nil for other files
+func pageRuns(file string) ([]pageRun, error) {
+
+	if filter.FileExt(file) != "pdf" {
+		return nil, nil
+	}
+
+	dims, err := api.PageDimsFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []pageRun
+	for i, d := range dims {
+		page := i + 1
+		if n := len(runs); n > 0 && runs[n-1].Landscape == d.Landscape() {
+			runs[n-1].To = page
+			continue
+		}
+		runs = append(runs, pageRun{From: page, To: page, Landscape: d.Landscape()})
+	}
+
+	return runs, nil
+}
+
+// rotatePages turns the pages of a PDF attachment mixing portrait and landscape pages to the orientation of most
+// of its pages
+func (cmd *Command) rotatePages(attachment *Attachment) (*Attachment, error) {
+
+	if cmd.cfg.Pages.Orientation != MixedRotate || attachment.Canary != "" {
+		return attachment, nil
+	}
+
+	runs, err := pageRuns(attachment.File)
+	if err != nil || len(runs) < 2 {
+		return attachment, err
+	}
+
+	landscape := 0
+	portrait := 0
+	for _, r := range runs {
+		if r.Landscape {
+			landscape += r.To - r.From + 1
+		} else {
+			portrait += r.To - r.From + 1
+		}
+	}
+
+	// Landscape pages are turned counterclockwise like printers do, portrait pages the other way
+	majority := landscape > portrait
+	rotation := 270
+	if majority {
+		rotation = 90
+	}
+
+	var pages []string
+	for _, r := range runs {
+		if r.Landscape != majority {
+			pages = append(pages, r.pages())
+		}
+	}
+
+	out := strings.TrimSuffix(attachment.File, ".pdf") + ".rotated.pdf"
+	if err := api.RotateFile(attachment.File, out, rotation, pages, pdfcpu.NewDefaultConfiguration()); err != nil {
+		return attachment, err
+	}
+
+	cmd.logpad("Orientation", attachment.Name, "Rotated pages", strings.Join(pages, ","))
+
+	rotated := *attachment
+	rotated.File = out
+
+	return &rotated, nil
+}
+
+// splitPages splits a PDF attachment mixing portrait and landscape pages into one document per run of pages of the
+// same orientation, printed as separate jobs
+func (cmd *Command) splitPages(attachment *Attachment) []*Attachment {
+
+	if cmd.cfg.Pages.Orientation != MixedSplit || attachment.Canary != "" {
+		return []*Attachment{attachment}
+	}
+
+	runs, err := pageRuns(attachment.File)
+	if err != nil {
+		cmd.logpad("Orientation", attachment.Name, err.Error())
+	}
+	if len(runs) < 2 {
+		return []*Attachment{attachment}
+	}
+
+	base := strings.TrimSuffix(attachment.File, ".pdf")
+	ext := filepath.Ext(attachment.Name)
+	name := strings.TrimSuffix(attachment.Name, ext)
+
+	var parts []*Attachment
+	for i, r := range runs {
+		out := fmt.Sprintf("%s.part%d.pdf", base, i+1)
+		if err := api.TrimFile(attachment.File, out, []string{r.pages()}, pdfcpu.NewDefaultConfiguration()); err != nil {
+			// Better printed mangled than not at all
+			cmd.logpad("Orientation", attachment.Name, err.Error())
+			return []*Attachment{attachment}
+		}
+		part := *attachment
+		part.File = out
+		part.Name = fmt.Sprintf("%s (%s)%s", name, r.pages(), ext)
+		part.Orientation = r.orientation()
+		parts = append(parts, &part)
+	}
+
+	cmd.logpad("Orientation", attachment.Name, "Split into", len(parts), "jobs")
+
+	return parts
+}
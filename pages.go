@@ -0,0 +1,91 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"strings"
+)
+
+// Page limit modes
+const (
+	PagesSkip     = "skip"
+	PagesTruncate = "truncate"
+)
+
+// ErrTooManyPages is returned for documents exceeding the page limit
+var ErrTooManyPages = errors.New("too many pages")
+
+func init() {
+	// Never read or create a pdfcpu config directory in the users home
+	pdfcpu.ConfigPath = "disable"
+}
+
+// pageCount returns the number of pages of a PDF file; other files are counted as one page
+func pageCount(file string) int {
+	if filter.FileExt(file) != "pdf" {
+		return 1
+	}
+	pages, err := api.PageCountFile(file)
+	if err != nil || pages < 1 {
+		return 1
+	}
+	return pages
+}
+
+// limitPages skips or truncates PDF attachments exceeding the configured number of pages
+func (cmd *Command) limitPages(attachment *Attachment) (*Attachment, error) {
+
+	max := cmd.cfg.Pages.Max
+	if p := cmd.profile(attachment); p != nil && p.MaxPages >= 0 {
+		max = p.MaxPages
+	}
+
+	if max <= 0 || attachment.Canary != "" || filter.FileExt(attachment.File) != "pdf" {
+		return attachment, nil
+	}
+
+	pages, err := api.PageCountFile(attachment.File)
+	if err != nil {
+		return attachment, err
+	}
+
+	cmd.logverb("Pages", attachment.Name, pages)
+
+	if pages <= max {
+		return attachment, nil
+	}
+
+	if cmd.cfg.Pages.Mode != PagesTruncate {
+		cmd.logpad("Pages", attachment.Name, pages, ">", max)
+		return attachment, fmt.Errorf("%s (%d > %d)", tr(ErrTooManyPages.Error()), pages, max)
+	}
+
+	out := strings.TrimSuffix(attachment.File, ".pdf") + ".trimmed.pdf"
+	if err := api.TrimFile(attachment.File, out, []string{fmt.Sprintf("1-%d", max)}, pdfcpu.NewDefaultConfiguration()); err != nil {
+		return attachment, err
+	}
+
+	cmd.logpad("Pages", attachment.Name, tr("Truncated to"), max)
+
+	truncated := *attachment
+	truncated.File = out
+
+	return &truncated, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message/textproto"
+	"io"
+	"strings"
+)
+
+// Boundary of messages rebuilt from single parts
+const PartsBoundary = "imapprint-parts"
+
+// attachmentParts returns the paths of the MIME parts of msg worth fetching,
+// nil means the message has to be fetched completely
+func (cmd *Command) attachmentParts(msg *imap.Message) [][]int {
+
+	bs := msg.BodyStructure
+	if bs == nil || len(bs.Parts) == 0 {
+		return nil
+	}
+
+	// Forwarded originals, signatures, encrypted messages and size limits need the complete message
+	if (len(cmd.cfg.Admin.Email) > 0 && cmd.cfg.Admin.Forward) || cmd.cfg.Auth.RequireDKIM || isEncryptedPart(bs) {
+		return nil
+	}
+	if max := cmd.cfg.MaxMailSize; max > 0 && int64(msg.Size) > max {
+		return nil
+	}
+
+	var parts [][]int
+	attachments, leafs := 0, 0
+
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if len(part.Parts) > 0 {
+			return true
+		}
+		leafs++
+		switch {
+		case isAttachmentPart(part):
+			attachments++
+		case strings.EqualFold(part.MIMEType, "text") && strings.EqualFold(part.MIMESubType, "plain"):
+			// Plain text is small and still needed for logs and body printing
+		default:
+			return true
+		}
+		parts = append(parts, append([]int(nil), path...))
+		return true
+	})
+
+	if attachments == 0 || len(parts) == leafs {
+		return nil
+	}
+
+	return parts
+}
+
+// fetchParts fetches header and the MIME parts paths of msg and rebuilds them as multipart message
+func (cmd *Command) fetchParts(c *client.Client, msg *imap.Message, paths [][]int) (*bytes.Buffer, error) {
+
+	header := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}}
+	items := []imap.FetchItem{header.FetchItem()}
+
+	var sections []*imap.BodySectionName
+	for _, path := range paths {
+		mime := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.MIMESpecifier, Path: path}}
+		body := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: path}}
+		sections = append(sections, mime, body)
+		items = append(items, mime.FetchItem(), body.FetchItem())
+	}
+
+	uidset := new(imap.SeqSet)
+	uidset.AddNum(msg.Uid)
+
+	messages := make(chan *imap.Message, 1)
+	if err := c.UidFetch(uidset, items, messages); err != nil {
+		return nil, err
+	}
+
+	fetched := <-messages
+	if fetched == nil {
+		return nil, ErrNoBody
+	}
+
+	r := fetched.GetBody(header)
+	if r == nil {
+		return nil, ErrNoBody
+	}
+
+	h, err := textproto.ReadHeader(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	h.Set("Content-Type", "multipart/mixed; boundary=\""+PartsBoundary+"\"")
+	h.Del("Content-Transfer-Encoding")
+
+	var buf bytes.Buffer
+	if err := textproto.WriteHeader(&buf, h); err != nil {
+		return nil, err
+	}
+
+	for _, section := range sections {
+		if section.Specifier == imap.MIMESpecifier {
+			buf.WriteString("--" + PartsBoundary + "\r\n")
+		}
+		r := fetched.GetBody(section)
+		if r == nil {
+			return nil, ErrNoBody
+		}
+		if _, err := io.Copy(&buf, r); err != nil {
+			return nil, err
+		}
+		if section.Specifier != imap.MIMESpecifier {
+			buf.WriteString("\r\n")
+		}
+	}
+
+	buf.WriteString("--" + PartsBoundary + "--\r\n")
+
+	cmd.logverb("Fetch", tr("Parts"), msg.Uid, len(paths), buf.Len(), "/", msg.Size)
+
+	return &buf, nil
+}
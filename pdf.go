@@ -0,0 +1,251 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"os"
+	"strings"
+)
+
+// Page geometry of generated documents in PDF points (A4)
+const (
+	PDFWidth    = 595.0
+	PDFHeight   = 842.0
+	PDFMargin   = 50.0
+	PDFFontSize = 10.0
+)
+
+// PDFLine is a single line of text on a generated PDF page
+type PDFLine struct {
+	Text  string
+	Bold  bool
+	Size  float64
+	Break bool
+}
+
+// PDFDoc is a minimal writer for generated text documents (mail bodies, diagnostic pages, ...)
+type PDFDoc struct {
+	Title string
+	lines []PDFLine
+}
+
+// newPDFDoc returns an empty document
+func newPDFDoc(title string) *PDFDoc {
+	return &PDFDoc{Title: title}
+}
+
+// text adds (wrapped) lines of regular text
+func (d *PDFDoc) text(s string) {
+	d.add(s, false, PDFFontSize)
+}
+
+// heading adds (wrapped) lines of bold text with given font size
+func (d *PDFDoc) heading(s string, size float64) {
+	d.add(s, true, size)
+}
+
+// pagebreak starts a new page
+func (d *PDFDoc) pagebreak() {
+	d.lines = append(d.lines, PDFLine{Break: true})
+}
+
+// add wraps s to the printable width and appends the resulting lines
+func (d *PDFDoc) add(s string, bold bool, size float64) {
+
+	width := columns(size)
+
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\t", "    ", -1)
+
+	for _, line := range strings.Split(s, "\n") {
+		for _, l := range wrap(line, width) {
+			d.lines = append(d.lines, PDFLine{Text: l, Bold: bold, Size: size})
+		}
+	}
+}
+
+// rule adds a horizontal line across the printable width
+func (d *PDFDoc) rule() {
+	d.lines = append(d.lines, PDFLine{Text: strings.Repeat("_", columns(PDFFontSize)), Size: PDFFontSize})
+}
+
+// columns returns the number of characters fitting into the printable width with font size
+func columns(size float64) int {
+	// Standard fonts are monospaced Courier, each glyph is 0.6em wide
+	return int((PDFWidth - 2*PDFMargin) / (size * 0.6))
+}
+
+// pages splits lines into pages
+func (d *PDFDoc) pages() [][]PDFLine {
+
+	var pages [][]PDFLine
+	var page []PDFLine
+
+	y := PDFHeight - PDFMargin
+
+	for _, l := range d.lines {
+		if l.Break || y-l.Size*1.2 < PDFMargin {
+			pages = append(pages, page)
+			page = nil
+			y = PDFHeight - PDFMargin
+			if l.Break {
+				continue
+			}
+		}
+		page = append(page, l)
+		y -= l.Size * 1.2
+	}
+
+	return append(pages, page)
+}
+
+// bytes renders the document as PDF
+func (d *PDFDoc) bytes() []byte {
+
+	var buf bytes.Buffer
+	var offsets []int
+
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		_, _ = fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	pages := d.pages()
+
+	// Objects 1-5 are fixed, each page adds a page and a content object
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (IMAPPrint) >>", pdfstr(d.Title)))
+
+	for i, page := range pages {
+
+		var content bytes.Buffer
+		y := PDFHeight - PDFMargin
+
+		content.WriteString("BT\n")
+		for _, l := range page {
+			font := "F1"
+			if l.Bold {
+				font = "F2"
+			}
+			y -= l.Size * 1.2
+			_, _ = fmt.Fprintf(&content, "/%s %.1f Tf 1 0 0 1 %.1f %.1f Tm (%s) Tj\n", font, l.Size, PDFMargin, y, pdfstr(l.Text))
+		}
+		content.WriteString("ET")
+
+		obj(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PDFWidth, PDFHeight, 7+2*i,
+		))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+
+	_, _ = fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		_, _ = fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	_, _ = fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// write renders the document into file path
+func (d *PDFDoc) write(path string) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	if _, err := w.Write(d.bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// pdfstr encodes s as WinAnsi PDF string literal content
+func pdfstr(s string) string {
+
+	var b strings.Builder
+
+	enc := charmap.Windows1252
+
+	for _, r := range s {
+		c, ok := enc.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 32 {
+				continue
+			}
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// wrap breaks s into lines of at most width characters, preferably at spaces
+func wrap(s string, width int) []string {
+
+	r := []rune(strings.TrimRight(s, " "))
+
+	if len(r) <= width {
+		return []string{string(r)}
+	}
+
+	var lines []string
+
+	for len(r) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if r[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, string(r[:cut]))
+		r = []rune(strings.TrimLeft(string(r[cut:]), " "))
+	}
+
+	return append(lines, string(r))
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/emersion/go-message"
+	"github.com/mrccnt/imap-print/filter"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Armor header of OpenPGP messages
+const pgpArmor = "-----BEGIN PGP MESSAGE-----"
+
+// ErrNoPGPPart is returned for PGP/MIME messages without an encrypted part
+var ErrNoPGPPart = errors.New("no encrypted PGP/MIME part")
+
+// pgp reports if a keyring for decrypting OpenPGP messages is configured
+func (cmd *Command) pgp() bool {
+	return cmd.cfg.PGP.Home != ""
+}
+
+// isPGPFile checks if the attachment file with the given name is OpenPGP encrypted
+func isPGPFile(file string, name string) bool {
+	switch filter.FileExt(name) {
+	case "pgp", "gpg":
+		return true
+	case "asc":
+		data := make([]byte, 512)
+		f, err := os.Open(file)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+		n, _ := f.Read(data)
+		return bytes.Contains(data[:n], []byte(pgpArmor))
+	}
+	return false
+}
+
+// decryptPGPFile decrypts the attachment file named name and returns the decrypted file and its name
+func (cmd *Command) decryptPGPFile(file string, name string) (string, string, error) {
+
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	out := strings.TrimSuffix(file, filepath.Ext(file))
+	if out == file {
+		out += ".dec"
+	}
+
+	if err := cmd.gpg(file, out); err != nil {
+		return "", "", err
+	}
+
+	return out, name, nil
+}
+
+// decryptPGPMIME returns raw with its PGP/MIME encrypted body replaced by the decrypted MIME entity,
+// nil if raw is not encrypted
+func (cmd *Command) decryptPGPMIME(raw []byte) ([]byte, error) {
+
+	entity, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return nil, err
+	}
+
+	t, params, err := entity.Header.ContentType()
+	if err != nil || t != "multipart/encrypted" || params["protocol"] != "application/pgp-encrypted" {
+		return nil, nil
+	}
+
+	mr := entity.MultipartReader()
+	if mr == nil {
+		return nil, ErrNoPGPPart
+	}
+
+	// The first part only holds the version, the second the encrypted entity
+	var data []byte
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		if t, _, _ := p.Header.ContentType(); t == "application/octet-stream" {
+			if data, err = ioutil.ReadAll(p.Body); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if data == nil {
+		return nil, ErrNoPGPPart
+	}
+
+	in, err := ioutil.TempFile(cmd.TmpDir, "*.asc")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(in.Name())
+	_, err = in.Write(data)
+	_ = in.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	out := strings.TrimSuffix(in.Name(), ".asc") + ".eml"
+	defer os.Remove(out)
+	if err := cmd.gpg(in.Name(), out); err != nil {
+		return nil, err
+	}
+
+	inner, err := ioutil.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceContent(raw, inner), nil
+}
+
+// gpg decrypts the file in to out with the configured keyring
+func (cmd *Command) gpg(in string, out string) error {
+
+	args := []string{"--batch", "--yes", "--quiet", "--no-tty", "--homedir", cmd.cfg.PGP.Home}
+	if cmd.cfg.PGP.Passphrase != "" {
+		args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+	}
+	args = append(args, "--output", out, "--decrypt", in)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.PGP.Timeout)
+	defer cancel()
+
+	c := exec.CommandContext(ctx, cmd.cfg.PGP.Bin, args...)
+	c.Stdin = strings.NewReader(cmd.cfg.PGP.Passphrase + "\n")
+
+	if output, err := c.CombinedOutput(); err != nil {
+		_ = os.Remove(out)
+		cmd.logverb("GPG Output", strings.TrimSpace(string(output)))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"context"
+	"github.com/phin1x/go-ipp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cupsStates maps IPP job-state values to job states
+var cupsStates = map[int]JobState{
+	int(ipp.JobStatePending):    JobPending,
+	int(ipp.JobStateHeld):       JobHeld,
+	int(ipp.JobStateProcessing): JobProcessing,
+	int(ipp.JobStateStopped):    JobStopped,
+	int(ipp.JobStateCanceled):   JobCanceled,
+	int(ipp.JobStateAborted):    JobAborted,
+	int(ipp.JobStateCompleted):  JobCompleted,
+}
+
+// printerStates maps IPP printer-state values to their names
+var printerStates = map[int]string{
+	int(ipp.PrinterStateIdle):       "idle",
+	int(ipp.PrinterStateProcessing): "processing",
+	int(ipp.PrinterStateStopped):    "stopped",
+}
+
+// IPP attributes of print queues
+const (
+	AttributeSides          = "sides"
+	AttributeSidesSupported = "sides-supported"
+	AttributeMediaSupported = "media-supported"
+	AttributeMediaDefault   = "media-default"
+	AttributeColorMode      = "print-color-mode"
+	AttributeJobUUID        = "job-uuid"
+)
+
+// Queue describes a printer of the cups server
+type Queue struct {
+	Name      string
+	Info      string
+	Location  string
+	Model     string
+	State     string
+	Message   string
+	Accepting bool
+	Duplex    bool
+	Media     []string
+	Default   string
+}
+
+func init() {
+	// go-ipp only encodes attributes it knows the tag of
+	ipp.AttributeTagMapping[AttributeSides] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeColorMode] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeJobUUID] = ipp.TagUri
+}
+
+// Queues returns the printers of the local cups server sorted by name, authenticated as user if set, the request gives
+// up after timeout
+func Queues(user string, pass string, timeout time.Duration) ([]*Queue, error) {
+
+	client := ipp.NewCUPSClient("localhost", 631, user, pass, false)
+
+	var printers map[string]ipp.Attributes
+	err := withTimeout(timeout, func() error {
+		var err error
+		printers, err = client.GetPrinters([]string{
+			ipp.AttributePrinterInfo,
+			ipp.AttributePrinterLocation,
+			ipp.AttributePrinterMarkAndModel,
+			ipp.AttributePrinterState,
+			ipp.AttributePrinterStateMessage,
+			ipp.AttributePrinterIsAcceptingJobs,
+			AttributeSidesSupported,
+			AttributeMediaSupported,
+			AttributeMediaDefault,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var queues []*Queue
+	for name, attrs := range printers {
+		q := &Queue{
+			Name:     name,
+			Info:     first(attrs[ipp.AttributePrinterInfo]),
+			Location: first(attrs[ipp.AttributePrinterLocation]),
+			Model:    first(attrs[ipp.AttributePrinterMarkAndModel]),
+			Message:  first(attrs[ipp.AttributePrinterStateMessage]),
+			Media:    values(attrs[AttributeMediaSupported]),
+			Default:  first(attrs[AttributeMediaDefault]),
+		}
+		for _, a := range attrs[ipp.AttributePrinterState] {
+			if v, ok := a.Value.(int); ok {
+				q.State = printerStates[v]
+			}
+		}
+		for _, a := range attrs[ipp.AttributePrinterIsAcceptingJobs] {
+			if v, ok := a.Value.(bool); ok {
+				q.Accepting = v
+			}
+		}
+		for _, sides := range values(attrs[AttributeSidesSupported]) {
+			if strings.HasPrefix(sides, "two-sided") {
+				q.Duplex = true
+			}
+		}
+		queues = append(queues, q)
+	}
+
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].Name < queues[j].Name
+	})
+
+	return queues, nil
+}
+
+// first returns the first string value of attribute a
+func first(a []ipp.Attribute) string {
+	if v := values(a); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// CUPS is a printer of the local cups server
+type CUPS struct {
+	Name    string
+	Timeout time.Duration
+	user    string
+	client  *ipp.CUPSClient
+}
+
+// NewCUPS returns the printer name of the local cups server, authenticated as user if set, requests give up after
+// timeout
+func NewCUPS(name string, user string, pass string, timeout time.Duration) *CUPS {
+	return &CUPS{
+		Name:    name,
+		Timeout: timeout,
+		user:    user,
+		client:  ipp.NewCUPSClient("localhost", 631, user, pass, false),
+	}
+}
+
+// Submit implements Printer
+func (p *CUPS) Submit(ctx context.Context, file string, opts Options) (JobID, error) {
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		return -1, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+
+	name := opts.JobName
+	if name == "" {
+		name = filepath.Base(file)
+	}
+
+	attrs := map[string]interface{}{
+		ipp.AttributeJobName: name,
+	}
+	if opts.Sides != "" {
+		attrs[AttributeSides] = opts.Sides
+	}
+	if !opts.HoldUntil.IsZero() {
+		attrs[ipp.AttributeHoldJobUntil] = holdUntil(opts.HoldUntil)
+	}
+	if o, ok := orientations[opts.Orientation]; ok {
+		attrs[ipp.AttributeOrientationRequested] = o
+	}
+	if opts.ColorMode != "" {
+		attrs[AttributeColorMode] = opts.ColorMode
+	}
+	if opts.UUID != "" {
+		attrs[AttributeJobUUID] = opts.UUID
+	}
+
+	format := ipp.MimeTypeOctetStream
+	if DocumentFormats[opts.Format] {
+		format = opts.Format
+	}
+
+	// A hung cups server must not stall the run, the job may still show up later
+	job := -1
+	err = withContext(ctx, func() error {
+		var err error
+		job, err = p.client.PrintDocuments([]ipp.Document{
+			{
+				Document: f,
+				Name:     name,
+				Size:     int(stat.Size()),
+				MimeType: format,
+			},
+		}, p.Name, attrs)
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return JobID(job), nil
+}
+
+// Status implements Printer
+func (p *CUPS) Status(job JobID) (JobState, error) {
+
+	var attrs ipp.Attributes
+	err := withTimeout(p.Timeout, func() error {
+		var err error
+		attrs, err = p.client.GetJobAttributes(int(job), []string{ipp.AttributeJobState})
+		return err
+	})
+	if err != nil {
+		return JobUnknown, err
+	}
+
+	for _, a := range attrs[ipp.AttributeJobState] {
+		if v, ok := a.Value.(int); ok {
+			if state, ok := cupsStates[v]; ok {
+				return state, nil
+			}
+		}
+	}
+
+	return JobUnknown, nil
+}
+
+// Attributes implements Device
+func (p *CUPS) Attributes(names []string) (ipp.Attributes, error) {
+	var attrs ipp.Attributes
+	err := withTimeout(p.Timeout, func() error {
+		var err error
+		attrs, err = p.client.GetPrinterAttributes(p.Name, names)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// Driverless returns the printer behind the queue if its device URI points to a printer advertising IPP Everywhere,
+// documents it can't print are rendered with the ghostscript binary
+func (p *CUPS) Driverless(ghostscript string) (*IPP, error) {
+
+	attrs, err := p.Attributes([]string{ipp.AttributeDeviceURI})
+	if err != nil {
+		return nil, err
+	}
+
+	uris := values(attrs[ipp.AttributeDeviceURI])
+	if len(uris) == 0 || !IsURI(uris[0]) {
+		return nil, ErrNotDriverless
+	}
+
+	// The cups credentials aren't meant for the printer itself
+	dev, err := NewIPP(uris[0], "", "", p.Timeout, ghostscript)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := dev.Everywhere()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotDriverless
+	}
+
+	return dev, nil
+}
+
+// Ping implements Device
+func (p *CUPS) Ping() error {
+	return withTimeout(p.Timeout, p.client.TestConnection)
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// ErrNoOutputDir is returned when the dir backend is selected without an output directory
+var ErrNoOutputDir = errors.New("OUTPUT_DIR is required for the dir backend")
+
+// dirJobs numbers the documents written by Dir within this process
+var dirJobs int64
+
+// DirFile holds the values available in OUTPUT_TEMPLATE
+type DirFile struct {
+	From     string
+	Subject  string
+	Tracking string
+	Name     string
+	Ext      string
+	Day      string
+	Date     time.Time
+}
+
+// Dir is a backend writing documents into a directory instead of printing them, e.g. a hot folder
+type Dir struct {
+	Path   string
+	Naming *template.Template
+}
+
+// NewDir returns a backend writing into path, the file names are built from the template naming
+func NewDir(path string, naming string) (*Dir, error) {
+
+	if path == "" {
+		return nil, ErrNoOutputDir
+	}
+
+	t, err := template.New("naming").Parse(naming)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dir{Path: path, Naming: t}, nil
+}
+
+// Submit implements Printer, the document is written under a temporary name and renamed when complete
+func (p *Dir) Submit(ctx context.Context, file string, opts Options) (JobID, error) {
+
+	target, err := p.target(file, opts)
+	if err != nil {
+		return -1, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return -1, err
+	}
+
+	src, err := os.Open(file)
+	if err != nil {
+		return -1, err
+	}
+	defer src.Close()
+
+	// Hot folder watchers must never pick up a partially written file
+	tmp, err := ioutil.TempFile(filepath.Dir(target), ".imap-print-")
+	if err != nil {
+		return -1, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = withContext(ctx, func() error {
+		_, err := io.Copy(tmp, src)
+		return err
+	})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	if err := os.Rename(tmp.Name(), unique(target)); err != nil {
+		return -1, err
+	}
+
+	return JobID(atomic.AddInt64(&dirJobs, 1)), nil
+}
+
+// Status implements Printer, documents are complete once Submit returned
+func (p *Dir) Status(job JobID) (JobState, error) {
+	return JobCompleted, nil
+}
+
+// target returns the path of file in the output directory according to the naming template
+func (p *Dir) target(file string, opts Options) (string, error) {
+
+	// Values come from the mail, only the template itself may create directories
+	f := DirFile{
+		From:     safeName(opts.From),
+		Subject:  safeName(opts.Subject),
+		Tracking: safeName(opts.Tracking),
+		Name:     safeName(opts.Name),
+		Date:     opts.Date,
+	}
+	if f.Name == "" {
+		f.Name = safeName(filepath.Base(file))
+	}
+	if f.Date.IsZero() {
+		f.Date = time.Now()
+	}
+	f.Ext = strings.TrimPrefix(filepath.Ext(f.Name), ".")
+	f.Day = f.Date.Format("2006-01-02")
+
+	var buf bytes.Buffer
+	if err := p.Naming.Execute(&buf, f); err != nil {
+		return "", err
+	}
+
+	// No segment may leave the output directory
+	var parts []string
+	for _, part := range strings.Split(buf.String(), "/") {
+		if part = safeName(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{safeName(filepath.Base(file))}
+	}
+
+	return filepath.Join(append([]string{p.Path}, parts...)...), nil
+}
+
+// safeName returns s usable as a single path segment
+func safeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 32 || r == '/' || r == '\\' || r == 127 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(s))
+	return strings.TrimLeft(s, ".")
+}
+
+// unique returns path or, if it already exists, path with a counter appended to the name
+func unique(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"context"
+	"fmt"
+	"github.com/phin1x/go-ipp"
+	"time"
+)
+
+// holdUntil returns the job-hold-until value of t, a time of day in UTC
+func holdUntil(t time.Time) string {
+	return t.UTC().Format("15:04:05")
+}
+
+// Release implements Holder
+func (p *CUPS) Release(job JobID) error {
+
+	req := ipp.NewRequest(ipp.OperationReleaseJob, 1)
+	req.OperationAttributes[ipp.AttributeJobURI] = fmt.Sprintf("ipp://localhost/jobs/%d", job)
+	req.OperationAttributes[ipp.AttributeRequestingUserName] = p.user
+
+	return withTimeout(p.Timeout, func() error {
+		_, err := p.client.SendRequest("http://localhost:631/jobs", req, nil)
+		return err
+	})
+}
+
+// Cancel implements Holder
+func (p *CUPS) Cancel(job JobID) error {
+	return withTimeout(p.Timeout, func() error {
+		return p.client.CancelJob(int(job), false)
+	})
+}
+
+// Release implements Holder
+func (p *IPP) Release(job JobID) error {
+	return p.jobRequest(ipp.OperationReleaseJob, job)
+}
+
+// Cancel implements Holder
+func (p *IPP) Cancel(job JobID) error {
+	return p.jobRequest(ipp.OperationCancelJob, job)
+}
+
+// jobRequest sends a request of operation on job to the printer
+func (p *IPP) jobRequest(operation int16, job JobID) error {
+
+	req := p.request(operation)
+	req.OperationAttributes[ipp.AttributeJobID] = int(job)
+
+	return withTimeout(p.Timeout, func() error {
+		_, err := p.client.SendRequest(p.endpoint, req, nil)
+		return err
+	})
+}
+
+// Release implements Holder
+func (p *LP) Release(job JobID) error {
+	_, err := p.command("lp", "-i", fmt.Sprintf("%s-%d", p.Name, job), "-H", "resume")
+	return err
+}
+
+// Cancel implements Holder
+func (p *LP) Cancel(job JobID) error {
+	_, err := p.command("cancel", fmt.Sprintf("%s-%d", p.Name, job))
+	return err
+}
+
+// command runs name with args, giving up after the timeout
+func (p *LP) command(name string, args ...string) (string, error) {
+
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	return p.run(ctx, name, args...)
+}
@@ -0,0 +1,370 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/phin1x/go-ipp"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPP attributes of driverless printers
+const (
+	AttributeFeatures = "ipp-features-supported"
+	AttributeFormats  = "document-format-supported"
+	FeatureEverywhere = "ipp-everywhere"
+)
+
+// Document formats of driverless printers, the rasters are rendered from PDFs with ghostscript
+const (
+	MimeTypePDF       = "application/pdf"
+	MimeTypeJPEG      = "image/jpeg"
+	MimeTypePWGRaster = "image/pwg-raster"
+	MimeTypeURF       = "image/urf"
+)
+
+// IPPUser is sent as requesting user if no user is configured
+const IPPUser = "imap-print"
+
+// rasterDevices are the ghostscript devices rendering the raster formats
+var rasterDevices = map[string]string{
+	MimeTypePWGRaster: "pwgraster",
+	MimeTypeURF:       "appleraster",
+}
+
+// Error variables
+var (
+	ErrNotDriverless = errors.New("printer doesn't advertise IPP Everywhere")
+	ErrNoFormat      = errors.New("printer supports none of the document formats imap-print can send")
+)
+
+// IPP is a printer addressed directly by its ipp:// or ipps:// URI without a cups queue in between
+type IPP struct {
+	URI         string
+	Timeout     time.Duration
+	Ghostscript string
+	user        string
+	endpoint    string
+	client      *ipp.IPPClient
+}
+
+// IsURI reports if name is the URI of a printer instead of the name of a cups queue
+func IsURI(name string) bool {
+	return strings.HasPrefix(name, "ipp://") || strings.HasPrefix(name, "ipps://")
+}
+
+// NewIPP returns the printer at uri, authenticated as user if set, requests give up after timeout and documents the
+// printer can't print are rendered with the ghostscript binary
+func NewIPP(uri string, user string, pass string, timeout time.Duration, ghostscript string) (*IPP, error) {
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	switch u.Scheme {
+	case "ipp":
+	case "ipps":
+		scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported printer URI scheme %q", u.Scheme)
+	}
+
+	port := 631
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, err
+		}
+	}
+
+	requester := user
+	if requester == "" {
+		requester = IPPUser
+	}
+
+	return &IPP{
+		URI:         uri,
+		Timeout:     timeout,
+		Ghostscript: ghostscript,
+		user:        requester,
+		endpoint:    fmt.Sprintf("%s://%s:%d%s", scheme, u.Hostname(), port, u.EscapedPath()),
+		client:      ipp.NewIPPClient(u.Hostname(), port, user, pass, scheme == "https"),
+	}, nil
+}
+
+// Submit implements Printer, documents are sent in the best format the printer supports
+func (p *IPP) Submit(ctx context.Context, file string, opts Options) (JobID, error) {
+
+	formats, err := p.Attributes([]string{AttributeFormats})
+	if err != nil {
+		return -1, err
+	}
+
+	format, err := documentFormat(file, opts.Format, values(formats[AttributeFormats]))
+	if err != nil {
+		return -1, err
+	}
+
+	if device, ok := rasterDevices[format]; ok {
+		raster := file + ".raster"
+		if err := p.render(ctx, device, file, raster); err != nil {
+			return -1, err
+		}
+		defer os.Remove(raster)
+		file = raster
+	}
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		return -1, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+
+	name := opts.JobName
+	if name == "" {
+		name = filepath.Base(file)
+	}
+
+	req := p.request(ipp.OperationPrintJob)
+	req.OperationAttributes[ipp.AttributeJobName] = name
+	req.OperationAttributes[ipp.AttributeDocumentFormat] = format
+	if opts.Sides != "" {
+		req.JobAttributes[AttributeSides] = opts.Sides
+	}
+	if !opts.HoldUntil.IsZero() {
+		req.JobAttributes[ipp.AttributeHoldJobUntil] = holdUntil(opts.HoldUntil)
+	}
+	if o, ok := orientations[opts.Orientation]; ok {
+		req.JobAttributes[ipp.AttributeOrientationRequested] = o
+	}
+	if opts.ColorMode != "" {
+		req.JobAttributes[AttributeColorMode] = opts.ColorMode
+	}
+	if opts.UUID != "" {
+		req.JobAttributes[AttributeJobUUID] = opts.UUID
+	}
+	req.File = f
+	req.FileSize = int(stat.Size())
+
+	// A hung printer must not stall the run, the job may still show up later
+	job := -1
+	err = withContext(ctx, func() error {
+		resp, err := p.client.SendRequest(p.endpoint, req, nil)
+		if err != nil {
+			return err
+		}
+		if len(resp.JobAttributes) == 0 || len(resp.JobAttributes[0][ipp.AttributeJobID]) == 0 {
+			return errors.New("printer didn't return a job id")
+		}
+		id, ok := resp.JobAttributes[0][ipp.AttributeJobID][0].Value.(int)
+		if !ok {
+			return errors.New("printer returned an invalid job id")
+		}
+		job = id
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return JobID(job), nil
+}
+
+// Status implements Printer
+func (p *IPP) Status(job JobID) (JobState, error) {
+
+	req := p.request(ipp.OperationGetJobAttributes)
+	req.OperationAttributes[ipp.AttributeJobID] = int(job)
+	req.OperationAttributes[ipp.AttributeRequestedAttributes] = []string{ipp.AttributeJobState}
+
+	var attrs ipp.Attributes
+	err := withTimeout(p.Timeout, func() error {
+		resp, err := p.client.SendRequest(p.endpoint, req, nil)
+		if err != nil {
+			return err
+		}
+		if len(resp.JobAttributes) > 0 {
+			attrs = resp.JobAttributes[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return JobUnknown, err
+	}
+
+	for _, a := range attrs[ipp.AttributeJobState] {
+		if v, ok := a.Value.(int); ok {
+			if state, ok := cupsStates[v]; ok {
+				return state, nil
+			}
+		}
+	}
+
+	return JobUnknown, nil
+}
+
+// Attributes implements Device
+func (p *IPP) Attributes(names []string) (ipp.Attributes, error) {
+
+	req := p.request(ipp.OperationGetPrinterAttributes)
+	if names == nil {
+		names = ipp.DefaultPrinterAttributes
+	}
+	req.OperationAttributes[ipp.AttributeRequestedAttributes] = names
+
+	var attrs ipp.Attributes
+	err := withTimeout(p.Timeout, func() error {
+		resp, err := p.client.SendRequest(p.endpoint, req, nil)
+		if err != nil {
+			return err
+		}
+		if len(resp.PrinterAttributes) == 0 {
+			return errors.New("printer didn't return any attributes")
+		}
+		attrs = resp.PrinterAttributes[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+// Ping implements Device
+func (p *IPP) Ping() error {
+	_, err := p.Attributes([]string{ipp.AttributePrinterState})
+	return err
+}
+
+// Everywhere reports if the printer advertises IPP Everywhere support
+func (p *IPP) Everywhere() (bool, error) {
+
+	attrs, err := p.Attributes([]string{AttributeFeatures, AttributeFormats})
+	if err != nil {
+		return false, err
+	}
+
+	for _, feature := range values(attrs[AttributeFeatures]) {
+		if feature == FeatureEverywhere {
+			return true, nil
+		}
+	}
+
+	// Older firmwares support the required raster format without listing the feature
+	for _, format := range values(attrs[AttributeFormats]) {
+		if format == MimeTypePWGRaster {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// request returns a new request of operation addressed to the printer
+func (p *IPP) request(operation int16) *ipp.Request {
+	req := ipp.NewRequest(operation, 1)
+	req.OperationAttributes[ipp.AttributePrinterURI] = p.URI
+	req.OperationAttributes[ipp.AttributeRequestingUserName] = p.user
+	return req
+}
+
+// render converts the PDF or PostScript file into the raster out with the ghostscript device
+func (p *IPP) render(ctx context.Context, device string, file string, out string) error {
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Ghostscript, "-q", "-dNOPAUSE", "-dBATCH", "-dSAFER",
+		"-sDEVICE="+device, "-r300", "-sOutputFile="+out, file)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ErrTimeout
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", err.Error(), msg)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// documentFormat returns the format file of the detected format is sent in, the file extension tells without one;
+// PDF and PostScript files the printer doesn't take as they are get rasterized
+func documentFormat(file string, format string, supported []string) (string, error) {
+
+	has := map[string]bool{}
+	for _, format := range supported {
+		has[format] = true
+	}
+
+	if !DocumentFormats[format] {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".jpg", ".jpeg":
+			format = MimeTypeJPEG
+		case ".pdf":
+			format = MimeTypePDF
+		case ".ps":
+			format = ipp.MimeTypePostscript
+		}
+	}
+
+	if has[format] {
+		return format, nil
+	}
+	if format != MimeTypePDF && format != ipp.MimeTypePostscript {
+		return "", ErrNoFormat
+	}
+	for _, format := range []string{MimeTypePWGRaster, MimeTypeURF} {
+		if has[format] {
+			return format, nil
+		}
+	}
+
+	return "", ErrNoFormat
+}
+
+// values returns the string values of attribute a
+func values(a []ipp.Attribute) []string {
+	var s []string
+	for _, v := range a {
+		if str, ok := v.Value.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
+
+// UnsupportedFormat reports if err is the IPP error of a printer rejecting the format of a document
+func UnsupportedFormat(err error) bool {
+	var ie ipp.IPPError
+	return errors.As(err, &ie) && ie.Status == ipp.StatusErrorDocumentFormatNotSupported
+}
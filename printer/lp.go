@@ -0,0 +1,140 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lpRequest matches the job id in the output of lp, e.g. "request id is Office-42 (1 file(s))"
+var lpRequest = regexp.MustCompile(`request id is \S+-(\d+)`)
+
+// LP is a printer submitting jobs with the lp command, e.g. for spoolers not reachable via IPP on localhost
+type LP struct {
+	Name    string
+	Timeout time.Duration
+}
+
+// NewLP returns the printer name of the lp command, status requests give up after timeout
+func NewLP(name string, timeout time.Duration) *LP {
+	return &LP{Name: name, Timeout: timeout}
+}
+
+// Submit implements Printer
+func (p *LP) Submit(ctx context.Context, file string, opts Options) (JobID, error) {
+
+	name := opts.JobName
+	if name == "" {
+		name = filepath.Base(file)
+	}
+
+	args := []string{"-d", p.Name, "-t", name}
+	if opts.Sides != "" {
+		args = append(args, "-o", "sides="+opts.Sides)
+	}
+	if o, ok := orientations[opts.Orientation]; ok {
+		args = append(args, "-o", fmt.Sprintf("orientation-requested=%d", o))
+	}
+	if opts.ColorMode != "" {
+		args = append(args, "-o", "print-color-mode="+opts.ColorMode)
+	}
+	if DocumentFormats[opts.Format] {
+		args = append(args, "-o", "document-format="+opts.Format)
+	}
+	if !opts.HoldUntil.IsZero() {
+		// lp only takes hours and minutes, the job is rather released a little late than early
+		args = append(args, "-H", opts.HoldUntil.Add(time.Minute-time.Nanosecond).UTC().Format("15:04"))
+	}
+
+	out, err := p.run(ctx, "lp", append(args, "--", file)...)
+	if err != nil {
+		return -1, err
+	}
+
+	m := lpRequest.FindStringSubmatch(out)
+	if m == nil {
+		return -1, fmt.Errorf("unexpected lp output: %s", strings.TrimSpace(out))
+	}
+
+	job, err := strconv.Atoi(m[1])
+	if err != nil {
+		return -1, err
+	}
+
+	return JobID(job), nil
+}
+
+// Status implements Printer, lpstat only tells pending and completed jobs apart
+func (p *LP) Status(job JobID) (JobState, error) {
+
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	id := fmt.Sprintf("%s-%d", p.Name, job)
+
+	for _, which := range []struct {
+		filter string
+		state  JobState
+	}{
+		{"not-completed", JobPending},
+		{"completed", JobCompleted},
+	} {
+		out, err := p.run(ctx, "lpstat", "-W", which.filter, "-o", p.Name)
+		if err != nil {
+			return JobUnknown, err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == id {
+				return which.state, nil
+			}
+		}
+	}
+
+	return JobUnknown, nil
+}
+
+// run executes the command name with args and returns its output
+func (p *LP) run(ctx context.Context, name string, args ...string) (string, error) {
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ErrTimeout
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package printer submits documents to printers
+package printer
+
+import (
+	"context"
+	"errors"
+	"github.com/mrccnt/imap-print/config"
+	"github.com/phin1x/go-ipp"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Print backends selectable with PRINT_BACKEND
+const (
+	BackendCUPS = "cups"
+	BackendLP   = "lp"
+	BackendDir  = "dir"
+	BackendIPP  = "ipp"
+)
+
+// States of submitted print jobs
+const (
+	JobPending    JobState = "pending"
+	JobHeld       JobState = "held"
+	JobProcessing JobState = "processing"
+	JobStopped    JobState = "stopped"
+	JobCanceled   JobState = "canceled"
+	JobAborted    JobState = "aborted"
+	JobCompleted  JobState = "completed"
+	JobUnknown    JobState = "unknown"
+)
+
+// Values of the IPP print-color-mode attribute
+const (
+	ColorModeColor      = "color"
+	ColorModeMonochrome = "monochrome"
+)
+
+// Orientations of documents split by the orientation of their pages
+const (
+	OrientationPortrait  = "portrait"
+	OrientationLandscape = "landscape"
+)
+
+// orientations are the values of the IPP orientation-requested attribute
+var orientations = map[string]int{
+	OrientationPortrait:  3,
+	OrientationLandscape: 4,
+}
+
+// Values of the IPP sides attribute
+const (
+	SidesOneSided  = "one-sided"
+	SidesLongEdge  = "two-sided-long-edge"
+	SidesShortEdge = "two-sided-short-edge"
+)
+
+// DocumentFormats are the MIME types sent as document-format instead of letting the print server guess from the
+// file name, other documents are left to it
+var DocumentFormats = map[string]bool{
+	MimeTypePDF:            true,
+	ipp.MimeTypePostscript: true,
+	MimeTypeJPEG:           true,
+	"image/png":            true,
+	"image/gif":            true,
+	"image/tiff":           true,
+}
+
+// Error variables
+var (
+	ErrUnknownBackend = errors.New("unknown print backend")
+	ErrNoDevice       = errors.New("print backend doesn't report device attributes")
+)
+
+// Unreachable checks if err is caused by the print server not answering rather than by the document
+func Unreachable(err error) bool {
+
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrTimeout) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) {
+		return true
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// JobID identifies a job submitted to a backend
+type JobID int
+
+// JobState is the state of a submitted job
+type JobState string
+
+// Options describes how a document is printed
+type Options struct {
+	// JobName is shown in the print queue, the base name of the file if empty
+	JobName string
+	// Name is the original file name of the document, the base name of the file if empty
+	Name string
+	// From, Subject, Tracking and Date describe the mail the document was attached to
+	From     string
+	Subject  string
+	Tracking string
+	Date     time.Time
+	// Sides is the IPP sides value selecting simplex or the duplex binding edge, the printer default if empty
+	Sides string
+	// HoldUntil holds the job until the time of day it is released by the print server, within the next 24 hours
+	HoldUntil time.Time
+	// Format is the MIME type detected from the content of the document, one of DocumentFormats or empty to let the
+	// print server guess
+	Format string
+	// Orientation is requested for all pages of the document, the pages tell if empty
+	Orientation string
+	// ColorMode is the IPP print-color-mode value, the printer default if empty
+	ColorMode string
+	// UUID is sent as job-uuid ("urn:uuid:..."), a retried submission with the same UUID can be looked up by Finder
+	UUID string
+}
+
+// Printer submits documents to a print backend
+type Printer interface {
+	// Submit prints file and returns the id of the created job, it gives up when ctx is done
+	Submit(ctx context.Context, file string, opts Options) (JobID, error)
+	// Status returns the current state of job
+	Status(job JobID) (JobState, error)
+}
+
+// Holder is a Printer whose held jobs can be released early or cancelled
+type Holder interface {
+	Printer
+	// Release prints the held job now
+	Release(job JobID) error
+	// Cancel cancels the job
+	Cancel(job JobID) error
+}
+
+// Finder is a Printer which looks up jobs by the job-uuid they were submitted with
+type Finder interface {
+	Printer
+	// Find returns the job submitted with uuid, ErrJobNotFound if there is none
+	Find(uuid string) (JobID, error)
+}
+
+// Device is a Printer that also reports its IPP attributes like supply levels
+type Device interface {
+	Printer
+	// Attributes returns the printer attributes with the given names, all if names is nil
+	Attributes(names []string) (ipp.Attributes, error)
+	// Ping checks if the print server is reachable
+	Ping() error
+}
+
+// New returns the printer name of the backend configured in cfg, printer URIs are always printed to directly
+func New(name string, cfg *config.CupsConfig) (Printer, error) {
+	if IsURI(name) || cfg.Backend == BackendIPP {
+		return NewIPP(name, cfg.User, cfg.Pass, cfg.Timeout, cfg.Ghostscript)
+	}
+	switch cfg.Backend {
+	case BackendCUPS, "":
+		return NewCUPS(name, cfg.User, cfg.Pass, cfg.Timeout), nil
+	case BackendLP:
+		return NewLP(name, cfg.Timeout), nil
+	case BackendDir:
+		return NewDir(cfg.Output, cfg.Naming)
+	}
+	return nil, ErrUnknownBackend
+}
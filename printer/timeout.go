@@ -0,0 +1,53 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTimeout is returned when an operation exceeds its configured timeout
+var ErrTimeout = errors.New("operation timed out")
+
+// withTimeout runs fn and stops waiting for it after d, a zero d waits forever
+func withTimeout(d time.Duration, fn func() error) error {
+
+	if d <= 0 {
+		return fn()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	return withContext(ctx, fn)
+}
+
+// withContext runs fn and stops waiting for it when ctx is done
+func withContext(ctx context.Context, fn func() error) error {
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrTimeout
+	}
+}
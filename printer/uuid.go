@@ -0,0 +1,115 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/phin1x/go-ipp"
+)
+
+// ErrJobNotFound is returned by Finder if no job was submitted with the UUID
+var ErrJobNotFound = errors.New("no job with this uuid")
+
+// NewUUID returns a random job-uuid
+func NewUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// NameUUID returns the job-uuid derived from name, every submission of the same document carries the same one
+func NameUUID(name string) string {
+	h := sha256.Sum256([]byte(name))
+	b := h[:16]
+	b[6] = b[6]&0x0f | 0x80
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Find implements Finder
+func (p *CUPS) Find(uuid string) (JobID, error) {
+
+	var jobs map[int]ipp.Attributes
+	err := withTimeout(p.Timeout, func() error {
+		var err error
+		jobs, err = p.client.GetJobs(p.Name, "", ipp.JobStateFilterAll, false, 0, 0, []string{AttributeJobUUID, ipp.AttributeJobState})
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return findJob(jobs, uuid)
+}
+
+// Find implements Finder
+func (p *IPP) Find(uuid string) (JobID, error) {
+
+	req := p.request(ipp.OperationGetJobs)
+	req.OperationAttributes[ipp.AttributeWhichJobs] = ipp.JobStateFilterAll
+	req.OperationAttributes[ipp.AttributeRequestedAttributes] = []string{ipp.AttributeJobID, AttributeJobUUID, ipp.AttributeJobState}
+
+	jobs := map[int]ipp.Attributes{}
+	err := withTimeout(p.Timeout, func() error {
+		resp, err := p.client.SendRequest(p.endpoint, req, nil)
+		if err != nil {
+			return err
+		}
+		for _, attrs := range resp.JobAttributes {
+			if len(attrs[ipp.AttributeJobID]) > 0 {
+				if id, ok := attrs[ipp.AttributeJobID][0].Value.(int); ok {
+					jobs[id] = attrs
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return findJob(jobs, uuid)
+}
+
+// findJob returns the id of the job of jobs with the job-uuid uuid, canceled and aborted jobs printed nothing and
+// are left out
+func findJob(jobs map[int]ipp.Attributes, uuid string) (JobID, error) {
+	for id, attrs := range jobs {
+		if first(attrs[AttributeJobUUID]) != uuid {
+			continue
+		}
+		if state, ok := jobState(attrs); ok && (state == JobCanceled || state == JobAborted) {
+			continue
+		}
+		return JobID(id), nil
+	}
+	return -1, ErrJobNotFound
+}
+
+// jobState returns the job-state of attrs
+func jobState(attrs ipp.Attributes) (JobState, bool) {
+	for _, a := range attrs[ipp.AttributeJobState] {
+		if v, ok := a.Value.(int); ok {
+			state, ok := cupsStates[v]
+			return state, ok
+		}
+	}
+	return JobUnknown, false
+}
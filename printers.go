@@ -0,0 +1,76 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/urfave/cli/v2"
+	"strings"
+)
+
+// printers is used as callable for the printers sub command listing the printers of the cups server, the configured
+// one is marked with an asterisk
+func (cmd *Command) printers(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	queues, err := printer.Queues(cmd.cfg.Cups.User, cmd.cfg.Cups.Pass, cmd.cfg.Cups.Timeout)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if len(queues) == 0 {
+		fmt.Println(tr("No printers found"))
+		return nil
+	}
+
+	for _, q := range queues {
+
+		mark := " "
+		if q.Name == cmd.cfg.Cups.Printer {
+			mark = "*"
+		}
+
+		state := q.State
+		if !q.Accepting {
+			state += ", " + tr("rejecting jobs")
+		}
+
+		duplex := tr("simplex")
+		if q.Duplex {
+			duplex = tr("duplex")
+		}
+
+		fmt.Printf("%s %-24s %-28s %s\n", mark, q.Name, state, duplex)
+
+		for _, line := range []struct {
+			name  string
+			value string
+		}{
+			{tr("Description"), strings.TrimSpace(q.Info + " " + q.Model)},
+			{tr("Location"), q.Location},
+			{tr("Message"), q.Message},
+			{tr("Media"), strings.Join(q.Media, ", ")},
+			{tr("Default Media"), q.Default},
+		} {
+			if line.value != "" {
+				fmt.Printf("    %-14s %s\n", line.name+":", line.value)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Profile overrides settings for the documents of matching senders
+type Profile struct {
+	Match      string
+	Printer    string
+	Duplex     string
+	Color      string
+	Extensions []string
+	// MaxPages is -1 if the profile keeps MAX_PAGES
+	MaxPages int
+	Archive  string
+}
+
+// profile returns the first profile matching attachment, nil if none does
+func (cmd *Command) profile(attachment *Attachment) *Profile {
+
+	for _, p := range cmd.profiles {
+		if ruleMatches(p.Match, attachment) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// mailProfile returns the first profile matching the sender of m, nil if none does
+func (cmd *Command) mailProfile(m *Mail) *Profile {
+	return cmd.profile(&Attachment{Mail: m})
+}
+
+// archive returns the archive rule of the profile, nil if the documents are not archived
+func (p *Profile) archive() (*ArchiveRule, error) {
+
+	if p.Archive == ArchiveNone {
+		return nil, nil
+	}
+
+	dest, err := url.Parse(p.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArchiveRule{
+		Match: p.Match,
+		Dest:  dest,
+		Path:  template.Must(template.New("path").Parse(ArchivePath)),
+	}, nil
+}
+
+// loadProfiles reads the profiles of file ("<address|domain|*> <setting>=<value> ..." per line with the settings
+// printer, duplex, color, extensions, max_pages and archive)
+func loadProfiles(file string) ([]*Profile, error) {
+
+	if file == "" {
+		return nil, nil
+	}
+
+	f, err := openRules(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profiles []*Profile
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		p := &Profile{Match: strings.ToLower(fields[0]), MaxPages: -1}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return profiles, fmt.Errorf("invalid profile setting %q", field)
+			}
+			if err := p.set(strings.ToLower(kv[0]), kv[1]); err != nil {
+				return profiles, err
+			}
+		}
+		profiles = append(profiles, p)
+	}
+
+	return profiles, scanner.Err()
+}
+
+// set sets the setting name of the profile to value
+func (p *Profile) set(name string, value string) error {
+
+	switch name {
+	case "printer":
+		p.Printer = value
+	case "duplex":
+		p.Duplex = strings.ToLower(value)
+		if !inArrStr(p.Duplex, []string{DuplexOff, DuplexLong, DuplexShort, DuplexAuto}) {
+			return fmt.Errorf("unknown duplex mode %q", value)
+		}
+	case "color":
+		p.Color = strings.ToLower(value)
+		if p.Color != printer.ColorModeColor && p.Color != printer.ColorModeMonochrome {
+			return fmt.Errorf("unknown color mode %q", value)
+		}
+	case "extensions":
+		p.Extensions = strings.Split(strings.ToLower(value), ":")
+	case "max_pages":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_pages %q", value)
+		}
+		p.MaxPages = n
+	case "archive":
+		if value != ArchiveNone {
+			if _, err := url.Parse(value); err != nil {
+				return err
+			}
+		}
+		p.Archive = value
+	default:
+		return fmt.Errorf("unknown profile setting %q", name)
+	}
+
+	return nil
+}
+
+// colorMode returns the IPP print-color-mode of attachment, empty for the printer default
+func (cmd *Command) colorMode(attachment *Attachment) string {
+	if p := cmd.profile(attachment); p != nil {
+		return p.Color
+	}
+	return ""
+}
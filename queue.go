@@ -0,0 +1,453 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Process roles
+const (
+	// RoleAll fetches and prints in one process
+	RoleAll = "all"
+	// RoleFetch fetches mails and puts their documents into the queue
+	RoleFetch = "fetch"
+	// RolePrint prints the documents found in the queue
+	RolePrint = "print"
+)
+
+// Queue transports queued mails from the fetch to the print role
+type Queue interface {
+	// push hands q with its documents over to the print role
+	push(q *QueuedMail) error
+	// pull returns up to limit (0 = all) waiting entries with their documents available as local files
+	pull(limit int) ([]*QueuedMail, error)
+	// done removes the handled entry q from the queue
+	done(q *QueuedMail) error
+	// retry keeps the entry q in the queue to be pulled again by the next run
+	retry(q *QueuedMail) error
+	// close releases the resources of the queue
+	close() error
+}
+
+// QueuedMail is a mail whose documents wait in the queue to be printed
+type QueuedMail struct {
+	Schema        int                 `json:"schema"`
+	Enqueued      time.Time           `json:"enqueued"`
+	Tracking      string              `json:"tracking"`
+	Date          time.Time           `json:"date"`
+	From          string              `json:"from"`
+	Subject       string              `json:"subject"`
+	MessageID     string              `json:"message_id"`
+	MDNTo         string              `json:"mdn_to"`
+	AutoSubmitted string              `json:"auto_submitted"`
+	Errors        []string            `json:"errors"`
+	Outcomes      []*Outcome          `json:"outcomes,omitempty"`
+	Attachments   []*QueuedAttachment `json:"attachments"`
+	tag           uint64
+}
+
+// QueuedAttachment is a document of a queued mail
+type QueuedAttachment struct {
+	File string `json:"file"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+	Seq  int    `json:"seq,omitempty"`
+	Data []byte `json:"data,omitempty"`
+	Path string `json:"-"`
+
+	// Orientation is requested for parts of documents split by orientation
+	Orientation string `json:"orientation,omitempty"`
+}
+
+// dirQueue is a queue in a local or shared directory
+type dirQueue struct {
+	dir    string
+	logpad func(title string, v ...interface{})
+}
+
+// queue returns the configured queue, a broker if QUEUE_URL is set or the queue directory
+func (cmd *Command) queue() (Queue, error) {
+
+	if cmd.mq != nil {
+		return cmd.mq, nil
+	}
+
+	if cmd.cfg.Queue.URL == "" {
+		// Directories of older versions are upgraded on first use
+		if _, err := cmd.migrateQueue(false); err != nil {
+			return nil, err
+		}
+		cmd.mq = &dirQueue{dir: cmd.cfg.Queue.Dir, logpad: cmd.logpad}
+		return cmd.mq, nil
+	}
+
+	q, err := dialAMQP(cmd.cfg.Queue.URL, cmd.cfg.Queue.Name, cmd.TmpDir, cmd.logpad)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.mq = q
+
+	return cmd.mq, nil
+}
+
+// enqueue hands the documents of attachments over to the print role and returns the ones to be handled locally
+func (cmd *Command) enqueue(attachments []*Attachment) ([]*Attachment, error) {
+
+	var local []*Attachment
+	var order []*Mail
+	entries := map[*Mail]*QueuedMail{}
+
+	for _, a := range attachments {
+
+		// Canaries are verified by the fetching process itself
+		if a.Canary != "" || a.Mail == nil {
+			local = append(local, a)
+			continue
+		}
+
+		q, ok := entries[a.Mail]
+		if !ok {
+			q = newQueuedMail(a.Mail)
+			entries[a.Mail] = q
+			order = append(order, a.Mail)
+		}
+
+		hash, err := fileHash(a.File)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Attachments = append(q.Attachments, &QueuedAttachment{
+			File: fmt.Sprintf("%s-%d%s", a.Mail.Tracking, len(q.Attachments)+1, filepath.Ext(a.File)),
+			Name: a.Name,
+			Type: a.Type,
+			Hash: hash,
+			Seq:  a.Seq,
+			Path: a.File,
+
+			Orientation: a.Orientation,
+		})
+	}
+
+	if len(order) == 0 {
+		return local, nil
+	}
+
+	queue, err := cmd.queue()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range order {
+		cmd.logpad("Queue", m.Tracking, len(entries[m].Attachments))
+		if !cmd.DryRun {
+			if err := queue.push(entries[m]); err != nil {
+				return nil, err
+			}
+		}
+		m.Queued = true
+	}
+
+	return local, nil
+}
+
+// printQueue is the action of the print role printing everything waiting in the queue
+func (cmd *Command) printQueue() error {
+
+	if err := cmd.validatePrinter(); err != nil {
+		return err
+	}
+
+	cmd.checkSupplies()
+	cmd.jobsPending()
+
+	// Documents stay in the queue while the printer is under maintenance
+	if !cmd.route() {
+		cmd.logpad("Maintenance", tr("Processing held"))
+		return nil
+	}
+
+	queue, err := cmd.queue()
+	if err != nil {
+		return err
+	}
+
+	entries, err := queue.pull(cmd.cfg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		cmd.logpad("No Messages", tr("Nothing to do..."))
+		return nil
+	}
+
+	var mails []*Mail
+	var attachments []*Attachment
+	for _, q := range entries {
+		m := q.mail()
+		cmd.logverb("Queue", m.Tracking, m.From, m.Subject, time.Since(q.Enqueued).Round(time.Second))
+		mails = append(mails, m)
+		for i, a := range m.Attachments {
+			// Entries may be delivered more than once, each document is printed once only
+			if cmd.consumed(q.Tracking, q.Attachments[i].Hash) {
+				cmd.logpad("Duplicate", a.Name, tr("processed"))
+				continue
+			}
+			attachments = append(attachments, a)
+		}
+	}
+
+	cmd.doprint(attachments)
+
+	// Entries are removed once all of their documents are printed, failed ones are retried by the next run
+	// without printing their successful documents again
+	if !cmd.NoPrint && !cmd.NoModify {
+		for i, q := range entries {
+			ok := true
+			for j, a := range mails[i].Attachments {
+				if a.Failed {
+					ok = false
+					continue
+				}
+				cmd.consume(q.Tracking, q.Attachments[j].Hash)
+			}
+			if !ok {
+				cmd.logpad("Queue", q.Tracking, tr("kept for retry"))
+				if err := queue.retry(q); err != nil {
+					cmd.logpad("Queue", q.Tracking, err.Error())
+				}
+				continue
+			}
+			if err := queue.done(q); err != nil {
+				cmd.logpad("Queue", q.Tracking, err.Error())
+			}
+		}
+		if db, err := cmd.store(); err == nil {
+			cmd.pruneProcessed(db)
+		}
+	}
+
+	cmd.sendMDNs(mails)
+	cmd.confirm(mails)
+	cmd.notifyAdmin(mails)
+	cmd.notifyDesktop(mails)
+	cmd.account(mails)
+	cmd.reportMails(mails)
+	cmd.historyPrune()
+
+	return nil
+}
+
+// push copies the documents of q into the directory and adds its entry
+func (d *dirQueue) push(q *QueuedMail) error {
+
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+
+	for _, a := range q.Attachments {
+		if err := copyFile(a.Path, filepath.Join(d.dir, a.File)); err != nil {
+			return err
+		}
+	}
+
+	// The entry is renamed into place last, documents without an entry are never picked up
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(d.dir, q.Tracking+".json.tmp")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(d.dir, q.Tracking+".json"))
+}
+
+// pull returns up to limit (0 = all) complete entries of the directory in order of their arrival
+func (d *dirQueue) pull(limit int) ([]*QueuedMail, error) {
+
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*QueuedMail
+	for _, file := range files {
+		// Hidden files are written by other tools or older versions, they may be incomplete
+		if strings.HasPrefix(filepath.Base(file), ".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var q QueuedMail
+		if err := json.Unmarshal(data, &q); err != nil {
+			d.logpad("Queue", filepath.Base(file), err.Error())
+			continue
+		}
+		// Entries of a newer fetch role stay until the print role is updated as well
+		if q.Schema > QueueSchema {
+			d.logpad("Queue", filepath.Base(file), ErrSchemaNewer.Error())
+			continue
+		}
+		for _, a := range q.Attachments {
+			a.Path = filepath.Join(d.dir, filepath.Base(a.File))
+		}
+		entries = append(entries, &q)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Enqueued.Before(entries[j].Enqueued)
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+// done deletes the entry q and its documents from the directory
+func (d *dirQueue) done(q *QueuedMail) error {
+	for _, a := range q.Attachments {
+		_ = os.Remove(a.Path)
+	}
+	return os.Remove(filepath.Join(d.dir, q.Tracking+".json"))
+}
+
+// retry is a no-op for directories, the entry stays until it is done
+func (d *dirQueue) retry(q *QueuedMail) error {
+	return nil
+}
+
+// close is a no-op for directories
+func (d *dirQueue) close() error {
+	return nil
+}
+
+// unqueued returns the mails not handed over to the print role
+func unqueued(mails []*Mail) []*Mail {
+	var local []*Mail
+	for _, m := range mails {
+		if !m.Queued {
+			local = append(local, m)
+		}
+	}
+	return local
+}
+
+// newQueuedMail returns the queue entry of m without attachments
+func newQueuedMail(m *Mail) *QueuedMail {
+	return &QueuedMail{
+		Schema:        QueueSchema,
+		Enqueued:      time.Now(),
+		Tracking:      m.Tracking,
+		Date:          m.Date,
+		From:          m.From,
+		Subject:       m.Subject,
+		MessageID:     m.MessageID,
+		MDNTo:         m.MDNTo,
+		AutoSubmitted: m.AutoSubmitted,
+		Errors:        m.Errors,
+		Outcomes:      m.Outcomes,
+	}
+}
+
+// mail returns q as *Mail with its documents as attachments
+func (q *QueuedMail) mail() *Mail {
+
+	m := &Mail{
+		Tracking:      q.Tracking,
+		Date:          q.Date,
+		From:          q.From,
+		Subject:       q.Subject,
+		MessageID:     q.MessageID,
+		MDNTo:         q.MDNTo,
+		AutoSubmitted: q.AutoSubmitted,
+		Errors:        q.Errors,
+		Outcomes:      q.Outcomes,
+		Attachments:   []*Attachment{},
+	}
+
+	for _, a := range q.Attachments {
+		m.Attachments = append(m.Attachments, &Attachment{
+			File: a.Path,
+			Name: a.Name,
+			Type: a.Type,
+			Seq:  a.Seq,
+			Mail: m,
+
+			Orientation: a.Orientation,
+		})
+	}
+
+	return m
+}
+
+// fileHash returns the hex encoded SHA-256 hash of file
+func fileHash(file string) (string, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies the file src to dst
+func copyFile(src string, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
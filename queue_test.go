@@ -0,0 +1,72 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDirQueuePullSkipsTempEntries checks that entries still being written by the fetch role are not pulled
+func TestDirQueuePullSkipsTempEntries(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "imap-print-queue-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Any entry the queue complains about has been read although it is incomplete
+	logpad := func(title string, v ...interface{}) {
+		t.Errorf("%s: %v", title, v)
+	}
+	d := &dirQueue{dir: dir, logpad: logpad}
+
+	doc := filepath.Join(dir, "src.pdf")
+	if err := ioutil.WriteFile(doc, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	complete := &QueuedMail{
+		Schema:      QueueSchema,
+		Enqueued:    time.Now(),
+		Tracking:    "complete",
+		Attachments: []*QueuedAttachment{{File: "complete-1.pdf", Path: doc}},
+	}
+	if err := d.push(complete); err != nil {
+		t.Fatal(err)
+	}
+
+	// A push in progress: the document is copied, the entry is half-written and not renamed yet
+	if err := copyFile(doc, filepath.Join(dir, "pending-1.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pending.json.tmp", ".pending.json"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(`{"schema":1,"tracking":"pend`), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := d.pull(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Tracking != "complete" {
+		t.Fatalf("pulled %d entries, want only the complete one", len(entries))
+	}
+}
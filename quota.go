@@ -0,0 +1,84 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Usage counts jobs and pages of a single sender on a single day
+type Usage struct {
+	Jobs  int `json:"jobs"`
+	Pages int `json:"pages"`
+}
+
+// quota checks if the attachments of m fit into the daily quota of its sender and reserves them
+func (cmd *Command) quota(m *Mail, attachments []*Attachment) error {
+
+	if cmd.cfg.Quota.Jobs <= 0 && cmd.cfg.Quota.Pages <= 0 {
+		return nil
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		return err
+	}
+
+	day := time.Now().Format(AccountingDay)
+	key := day + "|" + strings.ToLower(m.From)
+
+	// Usage of past days is no longer needed
+	var expired []string
+	_ = db.each(BucketQuota, func(k string, data []byte) error {
+		if k < day {
+			expired = append(expired, k)
+		}
+		return nil
+	})
+	for _, k := range expired {
+		_ = db.del(BucketQuota, k)
+	}
+
+	var used Usage
+	if _, err := db.get(BucketQuota, key, &used); err != nil {
+		return err
+	}
+
+	want := Usage{Jobs: len(attachments)}
+	for _, attachment := range attachments {
+		want.Pages += pageCount(attachment.File)
+	}
+
+	cmd.logverb("Quota", m.From, tr("used"), used.Jobs, used.Pages, tr("requested"), want.Jobs, want.Pages)
+
+	if limit := cmd.cfg.Quota.Jobs; limit > 0 && used.Jobs+want.Jobs > limit {
+		return fmt.Errorf(tr("daily quota of %d jobs exceeded (%d used, %d requested)"), limit, used.Jobs, want.Jobs)
+	}
+	if limit := cmd.cfg.Quota.Pages; limit > 0 && used.Pages+want.Pages > limit {
+		return fmt.Errorf(tr("daily quota of %d pages exceeded (%d used, %d requested)"), limit, used.Pages, want.Pages)
+	}
+
+	// Nothing is printed that could use up the quota
+	if cmd.NoPrint {
+		return nil
+	}
+
+	used.Jobs += want.Jobs
+	used.Pages += want.Pages
+
+	return db.put(BucketQuota, key, used)
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RejectRule selects the rejection reply template and additional recipients for matching senders
+type RejectRule struct {
+	Match    string
+	Template *template.Template
+	CC       []string
+}
+
+// RejectData is passed to rejection reply templates
+type RejectData struct {
+	Tracking string
+	Date     time.Time
+	From     string
+	Subject  string
+	Reason   string
+	Errors   []string
+}
+
+// matches checks if rule applies to mails from addr; rules match an address, a domain or "*"
+func (r *RejectRule) matches(addr string) bool {
+	return senderMatches(r.Match, addr)
+}
+
+// senderMatches checks if the lower case address, domain or "*" match applies to addr
+func senderMatches(match string, addr string) bool {
+	addr = strings.ToLower(addr)
+	if match == "*" || match == addr {
+		return true
+	}
+	return strings.HasSuffix(addr, "@"+match)
+}
+
+// reply renders the rejection reply for m, a leading "Subject:" line sets the subject
+func (r *RejectRule) reply(m *Mail) (string, string, error) {
+
+	var b bytes.Buffer
+
+	err := r.Template.Execute(&b, &RejectData{
+		Tracking: m.Tracking,
+		Date:     m.Date,
+		From:     m.From,
+		Subject:  m.Subject,
+		Reason:   tr(m.Rejected),
+		Errors:   m.Errors,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	subject := fmt.Sprintf(tr("Not printed: %s"), m.Subject)
+	text := b.String()
+
+	if strings.HasPrefix(text, "Subject:") {
+		parts := strings.SplitN(text, "\n", 2)
+		subject = strings.TrimSpace(strings.TrimPrefix(parts[0], "Subject:"))
+		text = ""
+		if len(parts) == 2 {
+			text = strings.TrimLeft(parts[1], "\r\n")
+		}
+	}
+
+	return subject, text, nil
+}
+
+// rejectRule returns the first rejection rule matching the sender of m or nil
+func (cmd *Command) rejectRule(m *Mail) *RejectRule {
+
+	rules, err := loadRejectRules(cmd.cfg.Reject.Rules, cmd.cfg.Reject.Template)
+	if err != nil {
+		cmd.logpad("Reject Rules", err.Error())
+	}
+
+	for _, r := range rules {
+		if r.matches(m.From) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// openRules opens the rules file, values spanning several lines are the rules themselves (e.g. from a config file)
+func openRules(file string) (io.ReadCloser, error) {
+	if strings.Contains(file, "\n") {
+		return ioutil.NopCloser(strings.NewReader(file)), nil
+	}
+	return os.Open(file)
+}
+
+// loadRejectRules reads the rules of file ("<address|domain|*> <template> [cc addresses seperated by :]" per line),
+// a global template is appended as catch-all rule
+func loadRejectRules(file string, global string) ([]*RejectRule, error) {
+
+	var rules []*RejectRule
+
+	if file != "" {
+		f, err := openRules(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			tmpl, err := template.ParseFiles(fields[1])
+			if err != nil {
+				return rules, err
+			}
+			r := &RejectRule{Match: strings.ToLower(fields[0]), Template: tmpl}
+			if len(fields) > 2 {
+				r.CC = strings.Split(fields[2], ":")
+			}
+			rules = append(rules, r)
+		}
+		if err := scanner.Err(); err != nil {
+			return rules, err
+		}
+	}
+
+	if global != "" {
+		tmpl, err := template.ParseFiles(global)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, &RejectRule{Match: "*", Template: tmpl})
+	}
+
+	return rules, nil
+}
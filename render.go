@@ -0,0 +1,250 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Supported HTML renderers
+const (
+	RendererWkhtmltopdf = "wkhtmltopdf"
+	RendererChrome      = "chrome"
+	RendererNone        = "none"
+)
+
+// Binaries probed for the chrome renderer
+var chromeBinaries = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"}
+
+// ErrNoRenderer is returned if the configured HTML renderer is not installed
+var ErrNoRenderer = errors.New("html renderer not found")
+
+// renderHTML converts HTML file in into PDF file out using the configured renderer
+func (cmd *Command) renderHTML(in string, out string) error {
+
+	bin, err := cmd.rendererBin()
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(in)
+	if err != nil {
+		return err
+	}
+
+	sb, err := sandbox(abs)
+	if err != nil {
+		return err
+	}
+	defer sb.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.cfg.HTMLTimeout)
+	defer cancel()
+
+	cmd.chaosSlow()
+
+	var c *exec.Cmd
+
+	switch cmd.cfg.HTMLRenderer {
+	case RendererChrome:
+		profile, err := ioutil.TempDir(cmd.TmpDir, "chrome-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(profile)
+		c = exec.CommandContext(ctx, bin, append(sb.chromeArgs(profile), "--print-to-pdf="+out, sb.url)...)
+	default:
+		c = exec.CommandContext(ctx, bin, append(sb.wkhtmltopdfArgs(), sb.url, out)...)
+	}
+
+	// Output goes to a file, a pipe would be held open by helper processes surviving the renderer after a timeout
+	logfile, err := ioutil.TempFile(cmd.TmpDir, "render-*.log")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(logfile.Name())
+	c.Stdout, c.Stderr = logfile, logfile
+
+	err = c.Run()
+	_ = logfile.Close()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("html rendering timed out after %s", cmd.cfg.HTMLTimeout)
+	}
+	if err != nil {
+		output, _ := ioutil.ReadFile(logfile.Name())
+		cmd.logverb("Render Output", string(output))
+		return err
+	}
+
+	if fi, err := os.Stat(out); err != nil || fi.Size() == 0 {
+		return errors.New("html renderer produced no output")
+	}
+
+	return nil
+}
+
+// renderHTMLString converts an HTML document into PDF file out
+func (cmd *Command) renderHTMLString(doc string, out string) error {
+
+	file, err := ioutil.TempFile(cmd.TmpDir, "*_body.html")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(doc); err != nil {
+		_ = file.Close()
+		return err
+	}
+	_ = file.Close()
+
+	return cmd.renderHTML(file.Name(), out)
+}
+
+// renderAttachment converts HTML attachments into PDF documents, other attachments are returned unchanged
+func (cmd *Command) renderAttachment(attachment *Attachment) (*Attachment, error) {
+
+	switch filter.FileExt(attachment.File) {
+	case "html", "htm":
+	default:
+		return attachment, nil
+	}
+
+	if cmd.cfg.HTMLRenderer == RendererNone {
+		return attachment, nil
+	}
+
+	out := attachment.File + ".pdf"
+	if err := cmd.renderHTML(attachment.File, out); err != nil {
+		return nil, err
+	}
+
+	rendered := *attachment
+	rendered.File = out
+	rendered.Name = attachment.Name + ".pdf"
+
+	return &rendered, nil
+}
+
+// rendererBin returns the path of the configured HTML renderer binary
+func (cmd *Command) rendererBin() (string, error) {
+
+	if cmd.cfg.HTMLRendererBin != "" {
+		return cmd.cfg.HTMLRendererBin, nil
+	}
+
+	switch cmd.cfg.HTMLRenderer {
+	case RendererChrome:
+		for _, name := range chromeBinaries {
+			if bin, err := exec.LookPath(name); err == nil {
+				return bin, nil
+			}
+		}
+		return "", ErrNoRenderer
+	case RendererWkhtmltopdf:
+		if bin, err := exec.LookPath(RendererWkhtmltopdf); err == nil {
+			return bin, nil
+		}
+		return "", ErrNoRenderer
+	}
+
+	return "", ErrNoRenderer
+}
+
+// htmlSandbox serves a single HTML document to the renderer and is its proxy for every other request, which it
+// refuses, so mail HTML can't read local files or reach the network, internal hosts included
+type htmlSandbox struct {
+	url      string
+	addr     string
+	listener net.Listener
+}
+
+// sandbox starts serving the HTML file on a random loopback port
+func sandbox(file string) (*htmlSandbox, error) {
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	path := "/" + hex.EncodeToString(token) + ".html"
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	sb := &htmlSandbox{addr: l.Addr().String(), listener: l}
+	sb.url = "http://" + sb.addr + path
+
+	go func() {
+		_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Proxied requests carry the absolute URL, only the document itself is served
+			if r.Method != http.MethodGet || (r.URL.Host != "" && r.URL.Host != sb.addr) || r.URL.Path != path {
+				http.Error(w, "blocked", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			http.ServeFile(w, r, file)
+		}))
+	}()
+
+	return sb, nil
+}
+
+// chromeArgs returns the arguments of a headless chrome with the profile directory confined to the sandbox
+func (sb *htmlSandbox) chromeArgs(profile string) []string {
+	return []string{
+		"--headless",
+		"--disable-gpu",
+		"--no-pdf-header-footer",
+		"--user-data-dir=" + profile,
+		"--proxy-server=http://" + sb.addr,
+		"--proxy-bypass-list=<-loopback>",
+		"--host-resolver-rules=MAP * ~NOTFOUND",
+		"--force-webrtc-ip-handling-policy=disable_non_proxied_udp",
+		"--no-first-run",
+		"--disable-extensions",
+		"--disable-sync",
+		"--disable-background-networking",
+		"--disable-component-update",
+		"--disable-default-apps",
+	}
+}
+
+// wkhtmltopdfArgs returns the arguments of wkhtmltopdf sending every request through the sandbox
+func (sb *htmlSandbox) wkhtmltopdfArgs() []string {
+	return []string{
+		"--quiet",
+		"--disable-javascript",
+		"--disable-local-file-access",
+		"--proxy", "http://" + sb.addr,
+	}
+}
+
+// close stops serving the document
+func (sb *htmlSandbox) close() {
+	_ = sb.listener.Close()
+}
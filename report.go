@@ -0,0 +1,200 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"github.com/mrccnt/imap-print/printer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Decisions of mails in the run report
+const (
+	DecisionPrinted  = "printed"
+	DecisionQueued   = "queued"
+	DecisionRejected = "rejected"
+	DecisionHeld     = "held"
+	DecisionFailed   = "failed"
+	DecisionSkipped  = "skipped"
+)
+
+// RunReport is the machine readable record of a run written to REPORT_FILE
+type RunReport struct {
+	Started    time.Time         `json:"started"`
+	Finished   time.Time         `json:"finished"`
+	Seconds    float64           `json:"seconds"`
+	ConfigHash string            `json:"config_hash"`
+	Role       string            `json:"role,omitempty"`
+	DryRun     []string          `json:"dry_run,omitempty"`
+	Folders    []*FolderReport   `json:"folders,omitempty"`
+	Mails      []*MailReport     `json:"mails"`
+	Error      string            `json:"error,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// FolderReport records the processing of a folder
+type FolderReport struct {
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+	Seconds float64   `json:"seconds"`
+	Mails   int       `json:"mails"`
+}
+
+// MailReport records what happened to a mail and its documents
+type MailReport struct {
+	Tracking  string            `json:"tracking"`
+	Folder    string            `json:"folder,omitempty"`
+	UID       uint32            `json:"uid,omitempty"`
+	MessageID string            `json:"message_id,omitempty"`
+	Date      time.Time         `json:"date"`
+	From      string            `json:"from"`
+	Subject   string            `json:"subject"`
+	Decision  string            `json:"decision"`
+	Reason    string            `json:"reason,omitempty"`
+	Outcomes  []*Outcome        `json:"outcomes,omitempty"`
+	Jobs      []printer.JobID   `json:"jobs,omitempty"`
+	Pages     int               `json:"pages,omitempty"`
+	Errors    []string          `json:"errors,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// startReport starts recording the run if a report file is configured
+func (cmd *Command) startReport() {
+
+	if cmd.cfg.Report == "" {
+		return
+	}
+
+	cmd.runReport = &RunReport{
+		Started:    time.Now(),
+		ConfigHash: cmd.cfghash(),
+		Role:       cmd.cfg.Queue.Role,
+		DryRun:     cmd.dryRunScope(),
+		Mails:      []*MailReport{},
+		Fields:     cmd.fields(nil),
+	}
+	if cmd.DryRun {
+		cmd.runReport.DryRun = []string{ArgDry}
+	}
+}
+
+// reportFolder starts recording the processing of folder, the returned func completes the record
+func (cmd *Command) reportFolder(folder string) func() {
+
+	if cmd.runReport == nil {
+		return func() {}
+	}
+
+	f := &FolderReport{Name: folder, Started: time.Now()}
+	cmd.runReport.Folders = append(cmd.runReport.Folders, f)
+
+	return func() {
+		f.Seconds = time.Since(f.Started).Seconds()
+	}
+}
+
+// reportMails adds the processed mails to the run report
+func (cmd *Command) reportMails(mails []*Mail) {
+
+	cmd.countMails(mails)
+
+	if cmd.runReport == nil {
+		return
+	}
+
+	folder := ""
+	if n := len(cmd.runReport.Folders); n > 0 {
+		f := cmd.runReport.Folders[n-1]
+		f.Mails += len(mails)
+		folder = f.Name
+	}
+
+	for _, m := range mails {
+		if m.Canary != "" {
+			continue
+		}
+		cmd.runReport.Mails = append(cmd.runReport.Mails, &MailReport{
+			Tracking:  m.Tracking,
+			Folder:    folder,
+			UID:       m.UID,
+			MessageID: m.MessageID,
+			Date:      m.Date,
+			From:      m.From,
+			Subject:   m.Subject,
+			Decision:  m.decision(),
+			Reason:    m.Rejected,
+			Outcomes:  m.Outcomes,
+			Jobs:      m.Jobs,
+			Pages:     m.Pages,
+			Errors:    m.Errors,
+			Fields:    cmd.fields(m),
+		})
+	}
+}
+
+// decision summarizes what happened to m
+func (m *Mail) decision() string {
+	switch {
+	case m.Rejected != "":
+		return DecisionRejected
+	case m.Queued:
+		return DecisionQueued
+	case m.Held:
+		return DecisionHeld
+	case len(m.Jobs) > 0:
+		return DecisionPrinted
+	case len(m.Errors) > 0:
+		return DecisionFailed
+	}
+	return DecisionSkipped
+}
+
+// writeReport completes the run report with the result err of the run and writes it to the report file
+func (cmd *Command) writeReport(err error) {
+
+	r := cmd.runReport
+	if r == nil {
+		return
+	}
+
+	r.Finished = time.Now()
+	r.Seconds = r.Finished.Sub(r.Started).Seconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		cmd.logpad("Report File", err.Error())
+		return
+	}
+
+	// Tools picking up the report never see a partial file
+	file := cmd.cfg.Report
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		cmd.logpad("Report File", err.Error())
+		return
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		cmd.logpad("Report File", err.Error())
+		return
+	}
+
+	cmd.logverb("Report File", file)
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// S3Timeout limits a single upload to the archive bucket
+const S3Timeout = 5 * time.Minute
+
+// ErrNoS3Endpoint is returned for uploads to S3 buckets without S3_ENDPOINT
+var ErrNoS3Endpoint = errors.New("no S3 endpoint configured")
+
+// ArchiveMeta is the JSON sidecar stored next to an archived attachment
+type ArchiveMeta struct {
+	Schema    int           `json:"schema"`
+	Tracking  string        `json:"tracking"`
+	From      string        `json:"from"`
+	Subject   string        `json:"subject"`
+	Date      time.Time     `json:"date"`
+	MessageID string        `json:"message_id"`
+	Name      string        `json:"name"`
+	Size      int           `json:"size"`
+	SHA256    string        `json:"sha256"`
+	Printer   string        `json:"printer"`
+	Job       printer.JobID `json:"job"`
+	Printed   time.Time     `json:"printed"`
+	Label     string        `json:"label,omitempty"`
+	Seq       int           `json:"seq,omitempty"`
+}
+
+// archiveMeta returns the metadata of the printed attachment with content data
+func (cmd *Command) archiveMeta(attachment *Attachment, job printer.JobID, data []byte) *ArchiveMeta {
+
+	sum := sha256.Sum256(data)
+	meta := &ArchiveMeta{
+		Schema:  ArchiveSchema,
+		Name:    attachment.Name,
+		Size:    len(data),
+		SHA256:  hex.EncodeToString(sum[:]),
+		Printer: cmd.target(attachment),
+		Job:     job,
+		Printed: time.Now(),
+		Label:   attachment.Label,
+		Seq:     attachment.Seq,
+	}
+	if meta.Name == "" {
+		meta.Name = filepath.Base(attachment.File)
+	}
+	if m := attachment.Mail; m != nil {
+		meta.Tracking = m.Tracking
+		meta.From = m.From
+		meta.Subject = m.Subject
+		meta.Date = m.Date
+		meta.MessageID = m.MessageID
+	}
+
+	return meta
+}
+
+// s3Put uploads body as object key into bucket of the configured endpoint, signed with AWS signature version 4
+func (cmd *Command) s3Put(bucket string, key string, body []byte, contentType string) error {
+
+	s := cmd.cfg.S3
+
+	if s.Endpoint == "" {
+		return ErrNoS3Endpoint
+	}
+
+	u, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return err
+	}
+
+	// Path style addressing works with AWS as well as with MinIO and other compatible stores
+	u.Path += "/" + bucket + "/" + key
+	uri := s3Escape(u.Path)
+
+	now := time.Now().UTC()
+	stamp := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+
+	headers := "content-type:" + contentType + "\n" +
+		"host:" + u.Host + "\n" +
+		"x-amz-content-sha256:" + payload + "\n" +
+		"x-amz-date:" + stamp + "\n"
+	signed := "content-type;host;x-amz-content-sha256;x-amz-date"
+
+	canonical := strings.Join([]string{http.MethodPut, uri, "", headers, signed, payload}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key4 := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{day, s.Region, "s3", "aws4_request"} {
+		key4 = hmacSHA256(key4, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key4, toSign))
+
+	req, err := http.NewRequest(http.MethodPut, u.Scheme+"://"+u.Host+uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signed, signature))
+
+	client := &http.Client{Timeout: S3Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s returned %s: %s", s.Endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// s3Escape encodes p as canonical URI, every byte except unreserved characters and slashes is escaped
+func s3Escape(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', strings.IndexByte("-._~/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
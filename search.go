@@ -0,0 +1,44 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/mrccnt/imap-print/imapfetch"
+)
+
+// candidates returns the sequence numbers of all mails matching the configured search
+func (cmd *Command) candidates(c *client.Client) (*imap.SeqSet, uint32, error) {
+
+	seqset := new(imap.SeqSet)
+
+	criteria := imapfetch.Criteria(cmd.cfg.Search, cmd.cfg.Keep)
+	if criteria == nil {
+		seqset.AddRange(uint32(1), cmd.mbox.Messages)
+		return seqset, cmd.mbox.Messages, nil
+	}
+
+	nums, err := c.Search(criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	seqset.AddNum(nums...)
+
+	cmd.logverb("Search", len(nums), tr("of"), cmd.mbox.Messages)
+
+	return seqset, uint32(len(nums)), nil
+}
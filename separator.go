@@ -0,0 +1,51 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+)
+
+// SeparatorTemplate is the default banner of separator pages
+const SeparatorTemplate = "{{.Tracking}}  {{.From}}  {{.Subject}}"
+
+// separatorPage renders the separator page ahead of attachment into a PDF file inside the temp dir
+func (cmd *Command) separatorPage(attachment *Attachment) (string, error) {
+
+	text := cmd.cfg.Separator.Template
+	if text == "" {
+		text = SeparatorTemplate
+	}
+
+	tmpl, err := template.New("separator").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, coverData(attachment)); err != nil {
+		return "", err
+	}
+
+	// A thin banner at the top is enough to split the stack at the tray
+	doc := newPDFDoc(tr("Separator Page"))
+	doc.rule()
+	doc.heading(strings.TrimSpace(b.String()), 12)
+	doc.rule()
+
+	return cmd.leadingPage(doc, attachment)
+}
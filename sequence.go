@@ -0,0 +1,67 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"strings"
+	"text/template"
+)
+
+// sequence returns the number of attachment in the sequence of documents of its sender, it is taken from the state
+// database on first use and kept for the attachment afterwards
+func (cmd *Command) sequence(attachment *Attachment) (int, error) {
+
+	if attachment.Seq > 0 {
+		return attachment.Seq, nil
+	}
+
+	sender := ""
+	if attachment.Mail != nil {
+		sender = strings.ToLower(attachment.Mail.From)
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		return 0, err
+	}
+
+	// A dry-run shows the next number without taking it
+	if cmd.DryRun {
+		var n int
+		if _, err := db.get(BucketSequence, sender, &n); err != nil {
+			return 0, err
+		}
+		return n + 1, nil
+	}
+
+	n, err := db.incr(BucketSequence, sender)
+	if err != nil {
+		return 0, err
+	}
+
+	attachment.Seq = n
+	cmd.logverb("Sequence", sender, n)
+
+	return n, nil
+}
+
+// sequenceFuncs returns the template functions giving access to the sequence number of attachment
+func (cmd *Command) sequenceFuncs(attachment *Attachment) template.FuncMap {
+	return template.FuncMap{
+		"seq": func() (int, error) {
+			return cmd.sequence(attachment)
+		},
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StateSilence is the key of the mailbox health in the meta bucket
+const StateSilence = "silence"
+
+// ErrHours is returned for business hours not matching "[<day>-<day>] <from>/<until>"
+var ErrHours = errors.New("invalid business hours")
+
+// weekdays are the abbreviations of the days of business hours
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// Silence is the mailbox health checked for processing silence
+type Silence struct {
+	LastMail      time.Time `json:"last_mail"`
+	LastProcessed time.Time `json:"last_processed"`
+
+	// WaitingSince is the first run since the last processed mail which found mails it could not process
+	WaitingSince time.Time `json:"waiting_since,omitempty"`
+}
+
+// Hours are the business hours in which mails are expected to arrive
+type Hours struct {
+	Days   [7]bool
+	Window *Window
+}
+
+// parseHours parses "[<day>-<day>] <from>/<until>" with days as Mon and times as 15:04, every day without days
+func parseHours(s string) (*Hours, error) {
+
+	fields := strings.Fields(s)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, ErrHours
+	}
+
+	h := &Hours{}
+	if len(fields) == 1 {
+		for i := range h.Days {
+			h.Days[i] = true
+		}
+	} else {
+		span := strings.SplitN(fields[0], "-", 2)
+		from, until := weekday(span[0]), weekday(span[len(span)-1])
+		if from < 0 || until < 0 {
+			return nil, ErrHours
+		}
+		for i := from; ; i = (i + 1) % 7 {
+			h.Days[i] = true
+			if i == until {
+				break
+			}
+		}
+	}
+
+	w, err := parseWindow("- " + fields[len(fields)-1])
+	if err != nil || w.layout() != WindowDaily {
+		return nil, ErrHours
+	}
+	h.Window = w
+
+	return h, nil
+}
+
+// weekday returns the index of the abbreviated day or -1
+func weekday(day string) int {
+	for i, d := range weekdays {
+		if strings.EqualFold(d, day) {
+			return i
+		}
+	}
+	return -1
+}
+
+// active checks if t is within the business hours, nil hours are always active
+func (h *Hours) active(t time.Time) bool {
+	return h == nil || h.Days[t.Weekday()] && h.Window.active(t)
+}
+
+// elapsed returns the business time between from and to, counting stops at limit
+func (h *Hours) elapsed(from time.Time, to time.Time, limit time.Duration) time.Duration {
+
+	if h == nil {
+		return to.Sub(from)
+	}
+
+	var d time.Duration
+	for t := from.Truncate(time.Minute); t.Before(to) && d < limit; t = t.Add(time.Minute) {
+		if h.active(t) {
+			d += time.Minute
+		}
+	}
+
+	return d
+}
+
+// hours returns the configured business hours, nil if mails are expected around the clock
+func (cmd *Command) hours() *Hours {
+
+	if cmd.cfg.Alert.Hours == "" {
+		return nil
+	}
+
+	h, err := parseHours(cmd.cfg.Alert.Hours)
+	if err != nil {
+		cmd.logpad("Business Hours", cmd.cfg.Alert.Hours, err.Error())
+		return nil
+	}
+
+	return h
+}
+
+// checkSilence updates the mailbox health with the mails of the run and raises an alert if mails arrive but none
+// are processed for ALERT_STALLED or no mails arrive for ALERT_QUIET of business hours
+func (cmd *Command) checkSilence() {
+
+	a := cmd.cfg.Alert
+	if (a.Stalled <= 0 && a.Quiet <= 0) || cmd.runState == nil || cmd.cfg.Queue.Role == RolePrint || cmd.DryRun {
+		return
+	}
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	var s Silence
+	if ok, _ := db.get(BucketMeta, StateSilence, &s); !ok {
+		// Counting starts with the first run
+		s.LastMail, s.LastProcessed = now, now
+	}
+
+	seen := 0
+	for _, n := range cmd.runState.Decisions {
+		seen += n
+	}
+	processed := seen - cmd.runState.Decisions[DecisionFailed]
+
+	switch {
+	case processed > 0:
+		s.LastMail, s.LastProcessed, s.WaitingSince = now, now, time.Time{}
+	case seen > 0:
+		s.LastMail = now
+		if s.WaitingSince.IsZero() {
+			s.WaitingSince = now
+		}
+	}
+
+	cmd.logverb("Silence", "last mail", s.LastMail, "last processed", s.LastProcessed)
+
+	if err := db.put(BucketMeta, StateSilence, &s); err != nil {
+		cmd.logpad("State DB", err.Error())
+	}
+
+	if a.Stalled > 0 && !s.WaitingSince.IsZero() && now.Sub(s.WaitingSince) >= a.Stalled {
+		cmd.alert(
+			"silence-stalled",
+			tr("Mails are not processed"),
+			fmt.Sprintf(
+				tr("Mails have been waiting since %s but none has been processed, the last one at %s. Fetching, converting or printing may be broken."),
+				s.WaitingSince.Format(time.RFC1123), s.LastProcessed.Format(time.RFC1123),
+			),
+		)
+	}
+
+	if h := cmd.hours(); a.Quiet > 0 && h.active(now) && h.elapsed(s.LastMail, now, a.Quiet) >= a.Quiet {
+		cmd.alert(
+			"silence-quiet",
+			tr("No mails received"),
+			fmt.Sprintf(
+				tr("No mail has arrived since %s for %s of business hours. Mail delivery, the mailbox or the IMAP login may be broken."),
+				s.LastMail.Format(time.RFC1123), a.Quiet,
+			),
+		)
+	}
+}
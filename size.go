@@ -0,0 +1,63 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/emersion/go-imap"
+	"github.com/mrccnt/imap-print/imapfetch"
+)
+
+// oversized records on m that its size judged by RFC822.SIZE exceeds MAX_MAIL_SIZE, it is held for manual processing
+// if MAX_MAIL_SIZE_FOLDER is set
+func (cmd *Command) oversized(m *Mail, size uint32) {
+
+	cmd.logpad("Mail Size", m.Subject, size, ">", cmd.cfg.MaxMailSize)
+	m.Errors = append(m.Errors, fmt.Sprintf(tr("mail too large (%d > %d bytes)"), size, cmd.cfg.MaxMailSize))
+
+	if cmd.cfg.MailSizeFolder != "" {
+		m.Held = true
+		m.Errors = append(m.Errors, tr("the message is kept for manual processing"))
+	}
+}
+
+// held removes the held mails from the sequence set to be deleted and returns the oversized ones to be moved into
+// the hold folder as uid set
+func (cmd *Command) held(seqset *imap.SeqSet, mails []*Mail) (*imap.SeqSet, *imap.SeqSet) {
+
+	uids := new(imap.SeqSet)
+	seqs := map[uint32]bool{}
+
+	for _, m := range mails {
+		if !m.Held {
+			continue
+		}
+		seqs[m.Seq] = true
+		if m.Rejected == RejectMailSize {
+			uids.AddNum(m.UID)
+		}
+	}
+
+	if len(seqs) == 0 {
+		return seqset, uids
+	}
+
+	return imapfetch.Without(seqset, seqs), uids
+}
+
+// hold moves the oversized mails with uids into the hold folder
+func (cmd *Command) hold(uids *imap.SeqSet) {
+	cmd.moveMails(uids, cmd.cfg.MailSizeFolder, "Mail Size")
+}
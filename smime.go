@@ -0,0 +1,111 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/emersion/go-message"
+	"github.com/mrccnt/imap-print/smime"
+	"io/ioutil"
+	"strings"
+)
+
+// decryptSMIME returns raw with its S/MIME encrypted body replaced by the decrypted MIME entity,
+// nil if raw is not encrypted or no recipient certificate is configured
+func (cmd *Command) decryptSMIME(raw []byte) ([]byte, error) {
+
+	if cmd.smime == nil {
+		return nil, nil
+	}
+
+	entity, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return nil, err
+	}
+
+	if !isSMIME(entity.Header) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(entity.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := cmd.smime.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceContent(raw, inner), nil
+}
+
+// replaceContent returns the headers of raw without its content headers followed by the decrypted entity inner,
+// the outer headers (From, Subject, ...) are kept, the content headers come with inner
+func replaceContent(raw []byte, inner []byte) []byte {
+
+	var out bytes.Buffer
+	skip := false
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), len(raw)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			skip = strings.HasPrefix(strings.ToLower(line), "content-")
+		}
+		if !skip {
+			out.WriteString(line + "\r\n")
+		}
+	}
+	out.Write(inner)
+
+	return out.Bytes()
+}
+
+// isSMIME checks if h is the header of an S/MIME encrypted entity
+func isSMIME(h message.Header) bool {
+	t, params, err := h.ContentType()
+	if err != nil {
+		return false
+	}
+	if t != "application/pkcs7-mime" && t != "application/x-pkcs7-mime" {
+		return false
+	}
+	// Signed-only entities use the same content type
+	typ := strings.ToLower(params["smime-type"])
+	return typ == "" || typ == "enveloped-data"
+}
+
+// loadRecipient loads the configured S/MIME certificate and key used to decrypt mails
+func (cmd *Command) loadRecipient() error {
+
+	if cmd.cfg.SMIME.Cert == "" || cmd.smime != nil {
+		return nil
+	}
+
+	r, err := smime.Load(cmd.cfg.SMIME.Cert, cmd.cfg.SMIME.Key)
+	if err != nil {
+		return err
+	}
+	cmd.smime = r
+
+	cmd.logverb("S/MIME", r.Cert.Subject.String(), r.Cert.NotAfter.Format("2006-01-02"))
+
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smime
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errTruncated = errors.New("truncated BER data")
+
+// node is a decoded BER element, indefinite lengths and constructed strings are supported
+type node struct {
+	class       int
+	tag         int
+	constructed bool
+	content     []byte
+	children    []*node
+}
+
+// ASN.1 universal tags used by CMS
+const (
+	tagInteger     = 2
+	tagOctetString = 4
+	tagOID         = 6
+	tagSequence    = 16
+	tagSet         = 17
+)
+
+// parseBER decodes a single element from data and returns it with the remaining bytes
+func parseBER(data []byte) (*node, []byte, error) {
+
+	if len(data) < 2 {
+		return nil, nil, errTruncated
+	}
+
+	n := &node{class: int(data[0] >> 6), constructed: data[0]&0x20 != 0, tag: int(data[0] & 0x1f)}
+	data = data[1:]
+
+	// High tag numbers are encoded base 128
+	if n.tag == 0x1f {
+		n.tag = 0
+		for {
+			if len(data) == 0 {
+				return nil, nil, errTruncated
+			}
+			b := data[0]
+			data = data[1:]
+			n.tag = n.tag<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	l := int(data[0])
+	data = data[1:]
+
+	// Indefinite length, children up to the end-of-contents marker
+	if l == 0x80 {
+		if !n.constructed {
+			return nil, nil, errors.New("indefinite length of primitive BER element")
+		}
+		for {
+			if len(data) >= 2 && data[0] == 0 && data[1] == 0 {
+				return n, data[2:], nil
+			}
+			child, rest, err := parseBER(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			n.children = append(n.children, child)
+			data = rest
+		}
+	}
+
+	if l > 0x80 {
+		size := l & 0x7f
+		if size > 4 || len(data) < size {
+			return nil, nil, errTruncated
+		}
+		l = 0
+		for _, b := range data[:size] {
+			l = l<<8 | int(b)
+		}
+		data = data[size:]
+	}
+
+	if l < 0 || len(data) < l {
+		return nil, nil, errTruncated
+	}
+
+	n.content = data[:l]
+	rest := data[l:]
+
+	if n.constructed {
+		body := n.content
+		for len(body) > 0 {
+			child, r, err := parseBER(body)
+			if err != nil {
+				return nil, nil, err
+			}
+			n.children = append(n.children, child)
+			body = r
+		}
+	}
+
+	return n, rest, nil
+}
+
+// universal reports if n is the universal element tag
+func (n *node) universal(tag int) bool {
+	return n != nil && n.class == 0 && n.tag == tag
+}
+
+// context reports if n is the context specific element [tag]
+func (n *node) context(tag int) bool {
+	return n != nil && n.class == 2 && n.tag == tag
+}
+
+// bytes returns the content of a primitive element or the concatenated chunks of a constructed string
+func (n *node) bytes() []byte {
+	if !n.constructed {
+		return n.content
+	}
+	var b []byte
+	for _, c := range n.children {
+		b = append(b, c.bytes()...)
+	}
+	return b
+}
+
+// oid returns the dotted notation of an OBJECT IDENTIFIER element
+func (n *node) oid() string {
+
+	if !n.universal(tagOID) || len(n.content) == 0 {
+		return ""
+	}
+
+	var ids []int
+	v := 0
+	for _, b := range n.content {
+		v = v<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			ids = append(ids, v)
+			v = 0
+		}
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+
+	first := ids[0]
+	parts := []int{first / 40, first % 40}
+	if first >= 80 {
+		parts = []int{2, first - 80}
+	}
+	parts = append(parts, ids[1:]...)
+
+	s := make([]string, len(parts))
+	for i, p := range parts {
+		s[i] = strconv.Itoa(p)
+	}
+
+	return strings.Join(s, ".")
+}
+
+// child returns the i-th child of n or nil
+func (n *node) child(i int) *node {
+	if n == nil || i >= len(n.children) {
+		return nil
+	}
+	return n.children[i]
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package smime decrypts S/MIME (CMS enveloped-data) messages addressed to a configured recipient
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Object identifiers of the supported CMS structures and algorithms
+const (
+	oidEnvelopedData = "1.2.840.113549.1.7.3"
+	oidRSA           = "1.2.840.113549.1.1.1"
+	oidRSAOAEP       = "1.2.840.113549.1.1.7"
+	oidSHA256        = "2.16.840.1.101.3.4.2.1"
+	oidAES128CBC     = "2.16.840.1.101.3.4.1.2"
+	oidAES192CBC     = "2.16.840.1.101.3.4.1.22"
+	oidAES256CBC     = "2.16.840.1.101.3.4.1.42"
+	oidDESEDE3CBC    = "1.2.840.113549.3.7"
+)
+
+// Error variables
+var (
+	ErrNotEnveloped = errors.New("not a CMS enveloped-data structure")
+	ErrNoRecipient  = errors.New("message is not encrypted for the configured certificate")
+	ErrUnsupported  = errors.New("unsupported encryption algorithm")
+	ErrPadding      = errors.New("invalid padding of decrypted content")
+)
+
+// Recipient is the certificate and private key messages are decrypted with
+type Recipient struct {
+	Cert *x509.Certificate
+	Key  *rsa.PrivateKey
+}
+
+// Load reads a PEM encoded certificate and RSA private key
+func Load(certFile string, keyFile string) (*Recipient, error) {
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: only RSA keys are supported", keyFile)
+	}
+
+	return &Recipient{Cert: cert, Key: key}, nil
+}
+
+// Decrypt decrypts the BER or DER encoded CMS enveloped-data in data and returns the inner MIME entity
+func (r *Recipient) Decrypt(data []byte) ([]byte, error) {
+
+	info, _, err := parseBER(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// ContentInfo ::= SEQUENCE { contentType, [0] EXPLICIT content }
+	if !info.universal(tagSequence) || info.child(0).oid() != oidEnvelopedData || !info.child(1).context(0) {
+		return nil, ErrNotEnveloped
+	}
+	env := info.child(1).child(0)
+	if !env.universal(tagSequence) {
+		return nil, ErrNotEnveloped
+	}
+
+	// EnvelopedData ::= SEQUENCE { version, [0] originatorInfo OPTIONAL, recipientInfos, encryptedContentInfo, ... }
+	i := 1
+	if env.child(i).context(0) {
+		i++
+	}
+	recipients, content := env.child(i), env.child(i+1)
+	if !recipients.universal(tagSet) || !content.universal(tagSequence) {
+		return nil, ErrNotEnveloped
+	}
+
+	key, err := r.contentKey(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptContent(content, key)
+}
+
+// contentKey decrypts the content encryption key of the recipient info addressed to r
+func (r *Recipient) contentKey(recipients *node) ([]byte, error) {
+
+	var candidates, others []*node
+
+	for _, ri := range recipients.children {
+		// Only KeyTransRecipientInfo is an untagged SEQUENCE
+		if !ri.universal(tagSequence) || len(ri.children) < 4 {
+			continue
+		}
+		rid := ri.child(1)
+		if rid.universal(tagSequence) && r.issuedBy(rid) {
+			candidates = append(candidates, ri)
+		} else if rid.context(0) && bytes.Equal(rid.bytes(), r.Cert.SubjectKeyId) {
+			candidates = append(candidates, ri)
+		} else {
+			others = append(others, ri)
+		}
+	}
+
+	// Recipient identifiers are not always reliable, the remaining infos are tried as well
+	for _, ri := range append(candidates, others...) {
+		if key, err := r.decryptKey(ri.child(2), ri.child(3).bytes()); err == nil {
+			return key, nil
+		}
+	}
+
+	return nil, ErrNoRecipient
+}
+
+// issuedBy reports if IssuerAndSerialNumber rid identifies the certificate of r
+func (r *Recipient) issuedBy(rid *node) bool {
+	serial := rid.child(1)
+	if !serial.universal(tagInteger) {
+		return false
+	}
+	return new(big.Int).SetBytes(serial.bytes()).Cmp(r.Cert.SerialNumber) == 0
+}
+
+// decryptKey decrypts an encrypted content encryption key with the algorithm alg
+func (r *Recipient) decryptKey(alg *node, encrypted []byte) ([]byte, error) {
+
+	switch alg.child(0).oid() {
+	case oidRSA:
+		return rsa.DecryptPKCS1v15(nil, r.Key, encrypted)
+	case oidRSAOAEP:
+		// RSAES-OAEP-params ::= SEQUENCE { [0] hashAlgorithm DEFAULT sha1, ... }
+		var h crypto.Hash = crypto.SHA1
+		if params := alg.child(1); params.universal(tagSequence) {
+			for _, p := range params.children {
+				if p.context(0) && p.child(0).child(0).oid() == oidSHA256 {
+					h = crypto.SHA256
+				}
+			}
+		}
+		if h == crypto.SHA256 {
+			return rsa.DecryptOAEP(sha256.New(), nil, r.Key, encrypted, nil)
+		}
+		return rsa.DecryptOAEP(sha1.New(), nil, r.Key, encrypted, nil)
+	}
+
+	return nil, ErrUnsupported
+}
+
+// decryptContent decrypts EncryptedContentInfo ::= SEQUENCE { contentType, algorithm, [0] IMPLICIT encryptedContent }
+func decryptContent(content *node, key []byte) ([]byte, error) {
+
+	alg, encrypted := content.child(1), content.child(2)
+	if !alg.universal(tagSequence) || !encrypted.context(0) {
+		return nil, ErrNotEnveloped
+	}
+
+	iv := alg.child(1).bytes()
+
+	var block cipher.Block
+	var err error
+
+	switch alg.child(0).oid() {
+	case oidAES128CBC, oidAES192CBC, oidAES256CBC:
+		block, err = aes.NewCipher(key)
+	case oidDESEDE3CBC:
+		block, err = des.NewTripleDESCipher(key)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := encrypted.bytes()
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrNotEnveloped
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, ErrPadding
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, ErrPadding
+		}
+	}
+
+	return plain[:len(plain)-pad], nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoSMTP is returned when mail should be sent but no SMTP server is configured
+var ErrNoSMTP = errors.New("smtp not configured")
+
+// sendmail sends a plain text email with optional additional header lines via the configured SMTP server
+func (cmd *Command) sendmail(to []string, subject string, body string, headers ...string) error {
+	return cmd.smtpsend(to, cmd.message(to, subject, body, headers...))
+}
+
+// message builds a raw plain text email with optional additional header lines
+func (cmd *Command) message(to []string, subject string, body string, headers ...string) []byte {
+
+	var msg bytes.Buffer
+
+	msg.WriteString("From: " + cmd.cfg.SMTP.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	for _, h := range headers {
+		msg.WriteString(h + "\r\n")
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	return msg.Bytes()
+}
+
+// smtpsend delivers a raw message via the configured SMTP server (implicit TLS on port 465, STARTTLS otherwise)
+func (cmd *Command) smtpsend(to []string, msg []byte) error {
+
+	if cmd.cfg.SMTP.Addr == "" {
+		return ErrNoSMTP
+	}
+
+	host, port, err := net.SplitHostPort(cmd.cfg.SMTP.Addr)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if cmd.cfg.SMTP.User != "" {
+		auth = smtp.PlainAuth("", cmd.cfg.SMTP.User, cmd.cfg.SMTP.Pass, host)
+	}
+
+	if port != "465" {
+		return smtp.SendMail(cmd.cfg.SMTP.Addr, auth, cmd.cfg.SMTP.From, to, msg)
+	}
+
+	conn, err := tls.Dial("tcp", cmd.cfg.SMTP.Addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cmd.cfg.SMTP.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt %s: %v", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bytes"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"strings"
+	"text/template"
+)
+
+// stampPDF stamps every page of PDF attachments with the configured text
+func (cmd *Command) stampPDF(attachment *Attachment) (*Attachment, error) {
+
+	if cmd.cfg.Stamp.Text == "" || attachment.Canary != "" || filter.FileExt(attachment.File) != "pdf" {
+		return attachment, nil
+	}
+
+	tmpl, err := template.New("stamp").Funcs(cmd.sequenceFuncs(attachment)).Parse(cmd.cfg.Stamp.Text)
+	if err != nil {
+		return attachment, err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, coverData(attachment)); err != nil {
+		return attachment, err
+	}
+
+	wm, err := pdfcpu.ParseTextWatermarkDetails(strings.TrimSpace(b.String()), cmd.cfg.Stamp.Style, true, pdfcpu.POINTS)
+	if err != nil {
+		return attachment, err
+	}
+
+	out := strings.TrimSuffix(attachment.File, ".pdf") + ".stamped.pdf"
+	if err := api.AddWatermarksFile(attachment.File, out, nil, wm, pdfcpu.NewDefaultConfiguration()); err != nil {
+		return attachment, err
+	}
+
+	cmd.logverb("Stamp", attachment.Name, b.String())
+
+	stamped := *attachment
+	stamped.File = out
+
+	return &stamped, nil
+}
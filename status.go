@@ -0,0 +1,271 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/urfave/cli/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// State keys of the recorded runs
+const (
+	StateLastRun     = "last-run"
+	StateLastSuccess = "last-success"
+)
+
+// JobStuckAge is the age after which an unfinished print job is reported as stuck
+const JobStuckAge = time.Hour
+
+// RunState is the outcome of a run recorded in the state database for the status command
+type RunState struct {
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Role      string         `json:"role"`
+	Decisions map[string]int `json:"decisions"`
+	Failures  int            `json:"failures,omitempty"`
+	Pages     int            `json:"pages,omitempty"`
+	Error     string         `json:"error,omitempty"`
+
+	// PrinterDown is set if a document failed to print because the printer was unreachable
+	PrinterDown bool `json:"printer_down,omitempty"`
+}
+
+// startRun starts recording the outcome of the run
+func (cmd *Command) startRun() {
+	cmd.runState = &RunState{
+		Started:   time.Now(),
+		Role:      cmd.cfg.Queue.Role,
+		Decisions: map[string]int{},
+	}
+}
+
+// countMails adds the decisions of mails to the run state
+func (cmd *Command) countMails(mails []*Mail) {
+
+	if cmd.runState == nil {
+		return
+	}
+
+	for _, m := range mails {
+		if m.Canary != "" {
+			continue
+		}
+		cmd.runState.Decisions[m.decision()]++
+		cmd.runState.Pages += m.Pages
+		for _, o := range m.Outcomes {
+			if o.Status == OutcomeFailed {
+				cmd.runState.Failures++
+			}
+		}
+	}
+}
+
+// recordRun stores the run state with the result err of the run, successful runs are kept separately as well
+func (cmd *Command) recordRun(err error) {
+
+	r := cmd.runState
+	if r == nil || cmd.DryRun {
+		return
+	}
+
+	r.Finished = time.Now()
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	db, derr := cmd.store()
+	if derr != nil {
+		cmd.logpad("State DB", derr.Error())
+		return
+	}
+
+	if derr := db.put(BucketMeta, StateLastRun, r); derr != nil {
+		cmd.logpad("State DB", derr.Error())
+	}
+	if err == nil {
+		if derr := db.put(BucketMeta, StateLastSuccess, r); derr != nil {
+			cmd.logpad("State DB", derr.Error())
+		}
+	}
+}
+
+// status is used as callable for the status sub command showing the last runs, the mails of the digest window,
+// failing mails, queued mails and the print jobs of the last day which are not finished yet
+func (cmd *Command) status(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	db, err := cmd.store()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	line := func(name string, value interface{}) {
+		fmt.Printf("%-18s %v\n", tr(name)+":", value)
+	}
+
+	for _, run := range []struct {
+		name string
+		key  string
+	}{
+		{"Last Run", StateLastRun},
+		{"Last Success", StateLastSuccess},
+	} {
+		var r RunState
+		if ok, _ := db.get(BucketMeta, run.key, &r); !ok {
+			line(run.name, tr("never"))
+			continue
+		}
+		text := fmt.Sprintf("%s (%s, %s)", r.Finished.Format(time.RFC1123), r.Finished.Sub(r.Started).Round(time.Second), decisions(r.Decisions))
+		if r.Error != "" {
+			text += " " + tr("Error") + ": " + r.Error
+		}
+		line(run.name, text)
+	}
+
+	var silence Silence
+	if ok, _ := db.get(BucketMeta, StateSilence, &silence); ok {
+		line("Last Mail", silence.LastMail.Format(time.RFC1123))
+		line("Last Processed", silence.LastProcessed.Format(time.RFC1123))
+	}
+
+	// Sender statistics are summed up without pruning them, that is left to the runs
+	since := time.Now().Add(-cmd.cfg.Digest.Window).Format(AccountingDay)
+	total := &SenderStats{Reasons: map[string]int{}}
+	_ = db.each(BucketSenders, func(key string, data []byte) error {
+		var stats SenderStats
+		if strings.SplitN(key, "|", 2)[0] >= since && json.Unmarshal(data, &stats) == nil {
+			total.add(&stats)
+		}
+		return nil
+	})
+	line("Mails", fmt.Sprintf(tr("%d processed, %d printed, %d rejected, %d failed in %s"),
+		total.Mails, total.Printed, total.Rejected, total.Failed, cmd.cfg.Digest.Window))
+
+	failing := 0
+	_ = db.each(BucketBacklog, func(key string, data []byte) error {
+		failing++
+		return nil
+	})
+	line("Failing Mails", failing)
+
+	if cmd.cfg.Queue.Role != RoleAll && cmd.cfg.Queue.URL == "" {
+		queued, err := (&dirQueue{dir: cmd.cfg.Queue.Dir, logpad: cmd.logpad}).pull(0)
+		if err != nil {
+			line("Queue", err.Error())
+		} else {
+			line("Queue", len(queued))
+		}
+	}
+
+	cmd.jobStatus(db)
+
+	return nil
+}
+
+// jobStatus prints the state of the print jobs of the history within EventJobMaxAge which are not completed
+func (cmd *Command) jobStatus(db *Store) {
+
+	since := time.Now().Add(-EventJobMaxAge).UTC().Format(time.RFC3339Nano)
+
+	var entries []*HistoryEntry
+	_ = db.each(BucketHistory, func(key string, data []byte) error {
+		var e HistoryEntry
+		if key >= since && json.Unmarshal(data, &e) == nil && e.Job > 0 && e.Duplicate == "" {
+			entries = append(entries, &e)
+		}
+		return nil
+	})
+
+	if len(entries) == 0 {
+		fmt.Printf("%-18s %d\n", tr("Jobs")+":", 0)
+		return
+	}
+
+	held := map[printer.JobID]time.Time{}
+	for _, h := range cmd.heldJobs(db) {
+		held[h.Job] = h.Until
+	}
+
+	var lines []string
+	stuck := 0
+	printers := map[string]printer.Printer{}
+	for _, e := range entries {
+		// Entries of older versions went to the configured printer
+		prt := e.Printer
+		if prt == "" {
+			prt = cmd.target(nil)
+		}
+		p, ok := printers[prt]
+		if !ok {
+			var err error
+			if p, err = cmd.printer(prt); err != nil {
+				fmt.Printf("%-18s %s\n", tr("Jobs")+":", err.Error())
+				return
+			}
+			printers[prt] = p
+		}
+		state, err := p.Status(e.Job)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("  %-8d %-10s %s %s: %s", e.Job, printer.JobUnknown, e.Tracking, e.Name, err.Error()))
+			continue
+		}
+		if state == printer.JobCompleted {
+			continue
+		}
+		mark := ""
+		if (state == printer.JobHeld || state == printer.JobPending) && time.Now().Before(held[e.Job]) {
+			mark = " " + tr("held until") + " " + held[e.Job].Local().Format("15:04")
+		} else if state == printer.JobStopped || state == printer.JobHeld ||
+			((state == printer.JobPending || state == printer.JobProcessing) && time.Since(e.Time) > JobStuckAge) {
+			mark = " " + tr("stuck")
+			stuck++
+		}
+		lines = append(lines, fmt.Sprintf("  %-8d %-10s %s %s (%s)%s", e.Job, state, e.Tracking, e.Name,
+			time.Since(e.Time).Round(time.Minute), mark))
+	}
+
+	fmt.Printf("%-18s %d\n", tr("Jobs")+":", len(lines))
+	fmt.Printf("%-18s %d\n", tr("Stuck Jobs")+":", stuck)
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+}
+
+// decisions returns the counts of decisions as "n decision" list
+func decisions(counts map[string]int) string {
+
+	if len(counts) == 0 {
+		return tr("no mails")
+	}
+
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[name], tr(name)))
+	}
+
+	return strings.Join(parts, ", ")
+}
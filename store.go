@@ -0,0 +1,156 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"encoding/json"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// Bucket names of the state database
+var (
+	BucketAlerts    = []byte("alerts")
+	BucketMedia     = []byte("media")
+	BucketCanary    = []byte("canary")
+	BucketSenders   = []byte("senders")
+	BucketDigest    = []byte("digest")
+	BucketQuota     = []byte("quota")
+	BucketProcessed = []byte("processed")
+	BucketHistory   = []byte("history")
+	BucketBacklog   = []byte("backlog")
+	BucketOAuth     = []byte("oauth")
+	BucketJobs      = []byte("jobs")
+	BucketMeta      = []byte("meta")
+	BucketSequence  = []byte("sequence")
+	BucketHolds     = []byte("holds")
+)
+
+// Store is a small key-value state database persisted between runs
+type Store struct {
+	db *bolt.DB
+}
+
+// openStore opens (or creates) the state database at path
+func openStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// close closes the underlying database
+func (s *Store) close() error {
+	return s.db.Close()
+}
+
+// get decodes the value stored under key into v and reports if the key exists
+func (s *Store) get(bucket []byte, key string, v interface{}) (bool, error) {
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	return found, err
+}
+
+// put encodes v and stores it under key
+func (s *Store) put(bucket []byte, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// incr increments the counter stored under key in a single transaction and returns its new value
+func (s *Store) incr(bucket []byte, key string) (int, error) {
+	var n int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		if data := b.Get([]byte(key)); data != nil {
+			if err := json.Unmarshal(data, &n); err != nil {
+				return err
+			}
+		}
+		n++
+		data, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	return n, err
+}
+
+// del removes key from bucket
+func (s *Store) del(bucket []byte, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// each calls fn with the raw value of every key in bucket
+func (s *Store) each(bucket []byte, fn func(key string, data []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// store returns the lazily opened state database
+func (cmd *Command) store() (*Store, error) {
+	if cmd.db != nil {
+		return cmd.db, nil
+	}
+	db, err := openStore(cmd.cfg.StateDB)
+	if err != nil {
+		return nil, err
+	}
+	// Databases of older versions are upgraded on first use
+	if _, err := cmd.migrateState(db, false); err != nil {
+		_ = db.close()
+		return nil, err
+	}
+	cmd.db = db
+	return cmd.db, nil
+}
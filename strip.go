@@ -0,0 +1,167 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Expressions used to detect boilerplate in mail bodies
+var (
+	// Attribution line introducing a quoted reply ("On Mon, 1 Jan 2020, Jane wrote:")
+	reAttribution = regexp.MustCompile(`(?i)^(on|am) .*(wrote|schrieb)[^:]*:\s*$`)
+	// Separators of forwarded or replied messages quoted without ">" (Outlook and friends)
+	reOriginal = regexp.MustCompile(`(?i)^(-{2,}\s*(original message|ursprüngliche nachricht|forwarded message|weitergeleitete nachricht)\s*-{2,}|_{10,})\s*$`)
+	// Signatures added by mobile mail clients
+	reMobileSig = regexp.MustCompile(`(?i)^(sent from my \w+|von meinem \w+ gesendet|get outlook for \w+)`)
+)
+
+// Legal footers used if no footer patterns are configured
+var defaultFooters = []string{
+	`(?i)^(confidentiality notice|disclaimer)\b`,
+	`(?i)^this (e-?mail|message) (and any attachments? )?(is|are|may contain) (confidential|intended)`,
+	`(?i)^diese (e-?mail|nachricht) (enthält|kann) vertrauliche`,
+}
+
+// Footer is a pattern of a legal footer, optionally restricted to senders of a domain
+type Footer struct {
+	Domain  string
+	Pattern *regexp.Regexp
+}
+
+// strip removes quoted messages, signatures and legal footers from the body text of m
+func (cmd *Command) strip(m *Mail, text string) string {
+
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+
+	lines = stripQuotes(lines)
+	lines = stripFooters(lines, cmd.footers(m))
+	if !cmd.cfg.Body.Signature {
+		lines = stripSignature(lines)
+	}
+
+	return strings.TrimSpace(reBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// stripQuotes removes quoted lines of replies with their attribution line and everything below a quoted original message
+func stripQuotes(lines []string) []string {
+
+	var kept []string
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if reOriginal.MatchString(trimmed) {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			// Drop the attribution line introducing the quote as well
+			if n := len(kept); n > 0 && reAttribution.MatchString(strings.TrimSpace(kept[n-1])) {
+				kept = kept[:n-1]
+			}
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return kept
+}
+
+// stripSignature cuts lines at the standard signature separator "-- " or a mobile client signature
+func stripSignature(lines []string) []string {
+	for i, line := range lines {
+		if line == "-- " || line == "--" || reMobileSig.MatchString(strings.TrimSpace(line)) {
+			return lines[:i]
+		}
+	}
+	return lines
+}
+
+// stripFooters cuts lines at the first line matching one of footers
+func stripFooters(lines []string, footers []*regexp.Regexp) []string {
+	for i, line := range lines {
+		for _, re := range footers {
+			if re.MatchString(strings.TrimSpace(line)) {
+				return lines[:i]
+			}
+		}
+	}
+	return lines
+}
+
+// footers returns the footer patterns applying to the sender of m
+func (cmd *Command) footers(m *Mail) []*regexp.Regexp {
+
+	var patterns []*regexp.Regexp
+
+	all, err := loadFooters(cmd.cfg.Body.Footers)
+	if err != nil {
+		cmd.logpad("Footers", err.Error())
+	}
+
+	domain := ""
+	if i := strings.LastIndex(m.From, "@"); i >= 0 {
+		domain = strings.ToLower(m.From[i+1:])
+	}
+
+	for _, f := range all {
+		if f.Domain == "*" || f.Domain == domain {
+			patterns = append(patterns, f.Pattern)
+		}
+	}
+
+	return patterns
+}
+
+// loadFooters reads footer patterns from file, one "<domain|*> <regexp>" per line
+func loadFooters(file string) ([]*Footer, error) {
+
+	if file == "" {
+		var footers []*Footer
+		for _, p := range defaultFooters {
+			footers = append(footers, &Footer{Domain: "*", Pattern: regexp.MustCompile(p)})
+		}
+		return footers, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var footers []*Footer
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		re, err := regexp.Compile(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return footers, err
+		}
+		footers = append(footers, &Footer{Domain: strings.ToLower(parts[0]), Pattern: re})
+	}
+
+	return footers, scanner.Err()
+}
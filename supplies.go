@@ -0,0 +1,189 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/phin1x/go-ipp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPP printer attributes describing supply levels and media state
+var supplyAttributes = []string{
+	"marker-names",
+	"marker-levels",
+	"marker-low-levels",
+	ipp.AttributePrinterStateReasons,
+}
+
+// checkSupplies queries marker levels and media state of every printer documents may be sent to and raises alerts
+func (cmd *Command) checkSupplies() {
+
+	if !cmd.alerting() || cmd.cfg.Alert.MarkerLevel < 0 || cmd.cfg.Queue.Role == RoleFetch {
+		return
+	}
+
+	for _, prt := range cmd.supplyPrinters() {
+		cmd.checkPrinterSupplies(prt)
+	}
+}
+
+// supplyPrinters returns CUPS_PRINTER and the printers of the sender profiles
+func (cmd *Command) supplyPrinters() []string {
+	printers := []string{cmd.cfg.Cups.Printer}
+	for _, p := range cmd.profiles {
+		if p.Printer != "" && !inArrStr(p.Printer, printers) {
+			printers = append(printers, p.Printer)
+		}
+	}
+	return printers
+}
+
+// checkPrinterSupplies queries marker levels and media state of the printer prt and raises alerts
+func (cmd *Command) checkPrinterSupplies(prt string) {
+
+	// Planned toner swaps and paper refills must not raise alerts
+	if cmd.maintenance(prt) != nil {
+		cmd.logverb("Supplies", prt, tr("Maintenance"))
+		return
+	}
+
+	dev, err := cmd.device(cmd.resolve(prt))
+	if err == printer.ErrNoDevice {
+		cmd.logverb("Supplies", prt, err.Error())
+		return
+	}
+	if err != nil {
+		cmd.logpad("Supplies", prt, err.Error())
+		return
+	}
+
+	attrs, err := dev.Attributes(supplyAttributes)
+	if err != nil {
+		cmd.logpad("Supplies", prt, err.Error())
+		return
+	}
+
+	configured, explicit := cmd.threshold(prt)
+	names := attrStrings(attrs["marker-names"])
+	lows := attrInts(attrs["marker-low-levels"])
+
+	for i, level := range attrInts(attrs["marker-levels"]) {
+		name := fmt.Sprintf("marker-%d", i+1)
+		if i < len(names) {
+			name = names[i]
+		}
+		// The printer knows best when a supply is low unless a threshold is configured
+		threshold := configured
+		if !explicit && i < len(lows) && lows[i] >= 0 {
+			threshold = lows[i]
+		}
+		cmd.logverb("Supply Level", prt, name, level, threshold)
+		// Negative values mean unknown/unavailable levels
+		if level < 0 || level > threshold {
+			continue
+		}
+		cmd.alert(
+			"marker:"+prt+":"+name,
+			fmt.Sprintf(tr("%s low on %s"), name, prt),
+			fmt.Sprintf(tr("Supply %q of printer %s is at %d%% (threshold %d%%)."), name, prt, level, threshold),
+		)
+	}
+
+	cmd.checkMedia(prt, attrStrings(attrs[ipp.AttributePrinterStateReasons]))
+}
+
+// checkMedia alerts if the printer reports an empty paper tray for longer than the configured duration
+func (cmd *Command) checkMedia(printer string, reasons []string) {
+
+	db, err := cmd.store()
+	if err != nil {
+		cmd.logpad("State DB", err.Error())
+		return
+	}
+
+	empty := false
+	for _, r := range reasons {
+		if strings.HasPrefix(r, "media-empty") || strings.HasPrefix(r, "media-needed") {
+			empty = true
+			break
+		}
+	}
+
+	if !empty {
+		_ = db.del(BucketMedia, printer)
+		return
+	}
+
+	var since time.Time
+	if ok, _ := db.get(BucketMedia, printer, &since); !ok {
+		since = time.Now()
+		if err := db.put(BucketMedia, printer, since); err != nil {
+			cmd.logpad("State DB", err.Error())
+		}
+	}
+
+	cmd.logverb("Media Empty", printer, "since", since)
+
+	if time.Since(since) < cmd.cfg.Alert.MediaEmpty {
+		return
+	}
+
+	cmd.alert(
+		"media:"+printer,
+		fmt.Sprintf(tr("%s out of paper"), printer),
+		fmt.Sprintf(tr("Printer %s reports %s since %s."), printer, strings.Join(reasons, ", "), since.Format(time.RFC1123)),
+	)
+}
+
+// threshold returns the marker level threshold for printer and if it is configured explicitly, for the printer in
+// particular or as ALERT_MARKER_LEVEL
+func (cmd *Command) threshold(printer string) (int, bool) {
+	for _, item := range cmd.cfg.Alert.Thresholds {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != printer {
+			continue
+		}
+		if v, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+			return v, true
+		}
+	}
+	return cmd.cfg.Alert.MarkerLevel, cmd.cfg.Alert.MarkerLevelSet
+}
+
+// attrStrings returns string values of an IPP attribute
+func attrStrings(attrs []ipp.Attribute) []string {
+	var values []string
+	for _, a := range attrs {
+		if v, ok := a.Value.(string); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// attrInts returns integer values of an IPP attribute
+func attrInts(attrs []ipp.Attribute) []int {
+	var values []int
+	for _, a := range attrs {
+		if v, ok := a.Value.(int); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SupportHistory is the number of most recent history entries in a support bundle
+const SupportHistory = 50
+
+var (
+	// secretFields matches configuration fields whose values never end up in a support bundle
+	secretFields = regexp.MustCompile(`(?i)pass|secret|refreshtoken|accesskey|webhook|slack`)
+	// urlCredentials matches user and password in URLs
+	urlCredentials = regexp.MustCompile(`://[^/@\s]+@`)
+)
+
+// bundleFile is a file in a support bundle
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// supportBundle is used as callable for the support-bundle sub command
+func (cmd *Command) supportBundle(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	// Everything logged while probing ends up in the bundle
+	var logs bytes.Buffer
+	log.SetOutput(io.MultiWriter(os.Stderr, &logs))
+	defer log.SetOutput(os.Stderr)
+	cmd.Verbose = true
+
+	file := c.String("output")
+	if file == "" {
+		file = fmt.Sprintf("imap-print-support-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+
+	var files []bundleFile
+	add := func(name string, data []byte) {
+		files = append(files, bundleFile{name: name, data: data})
+	}
+
+	add("version.txt", []byte(fmt.Sprintf("imap-print %s\n%s %s/%s\nconfig hash %s\n", c.App.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH, cmd.cfghash())))
+	add("config.json", cmd.redactedConfig())
+	add("connectivity.txt", []byte(strings.Join(cmd.connectivity(), "\n")+"\n"))
+	add("imap-capabilities.txt", cmd.probeIMAP())
+	add("ipp-attributes.txt", cmd.probeIPP())
+	add("history.json", cmd.historyExcerpt())
+	add("log.txt", logs.Bytes())
+
+	if err := writeBundle(file, files, cmd.secrets()); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logpad("Support Bundle", file)
+
+	return nil
+}
+
+// redactedConfig returns the configuration as JSON with secrets and URL credentials removed
+func (cmd *Command) redactedConfig() []byte {
+
+	data, err := json.Marshal(cmd.cfg)
+	if err != nil {
+		return []byte(err.Error())
+	}
+
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return []byte(err.Error())
+	}
+
+	var redact func(v map[string]interface{})
+	redact = func(v map[string]interface{}) {
+		for k, val := range v {
+			switch val := val.(type) {
+			case map[string]interface{}:
+				redact(val)
+			case string:
+				if val != "" && secretFields.MatchString(k) {
+					v[k] = "*****"
+				} else {
+					v[k] = urlCredentials.ReplaceAllString(val, "://*****@")
+				}
+			}
+		}
+	}
+	redact(cfg)
+
+	data, _ = json.MarshalIndent(cfg, "", "  ")
+	return data
+}
+
+// secrets returns the configured secret values scrubbed from every file of a support bundle
+func (cmd *Command) secrets() []string {
+	var secrets []string
+	for _, s := range []string{
+		cmd.cfg.IMAP.Pass,
+		cmd.cfg.SMTP.Pass,
+		cmd.cfg.OAuth.ClientSecret,
+		cmd.cfg.OAuth.RefreshToken,
+		cmd.cfg.S3.SecretKey,
+		cmd.cfg.Queue.URL,
+		cmd.cfg.Alert.Webhook,
+		cmd.cfg.Alert.Slack,
+	} {
+		if len(s) >= 4 {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// probeIMAP returns the capabilities announced by the IMAP server
+func (cmd *Command) probeIMAP() []byte {
+
+	if cmd.cfg.IMAP.Addr == "" {
+		return []byte("IMAP_ADDR not configured\n")
+	}
+
+	c, err := cmd.dial()
+	if err != nil {
+		return []byte("Error: " + err.Error() + "\n")
+	}
+	defer c.Logout()
+
+	if err := cmd.negotiate(c); err != nil {
+		return []byte("Error: " + err.Error() + "\n")
+	}
+
+	return []byte(strings.Join(cmd.caps.Names(), "\n") + "\n")
+}
+
+// probeIPP returns the IPP attributes of the configured printer
+func (cmd *Command) probeIPP() []byte {
+
+	lines, err := cmd.deviceAttributes(cmd.cfg.Cups.Printer)
+	if err != nil {
+		lines = append(lines, "Error: "+err.Error())
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// historyExcerpt returns the most recent history entries without the text of the documents
+func (cmd *Command) historyExcerpt() []byte {
+
+	db, err := cmd.store()
+	if err != nil {
+		return []byte(err.Error())
+	}
+
+	var entries []HistoryEntry
+	err = db.each(BucketHistory, func(key string, data []byte) error {
+		var e HistoryEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		e.Text = ""
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return []byte(err.Error())
+	}
+
+	if len(entries) > SupportHistory {
+		entries = entries[len(entries)-SupportHistory:]
+	}
+
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	return data
+}
+
+// writeBundle writes files as gzipped tarball to path, replacing all secrets in their content
+func writeBundle(path string, files []bundleFile, secrets []string) error {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	now := time.Now().Truncate(time.Second)
+
+	for _, file := range files {
+		data := file.data
+		for _, secret := range secrets {
+			data = bytes.Replace(data, []byte(secret), []byte("*****"), -1)
+		}
+		hdr := &tar.Header{
+			Name:    file.name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/urfave/cli/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Name of the generated diagnostic page
+const TestPageName = "testpage.pdf"
+
+// testpage is used as callable for the testpage sub command
+func (cmd *Command) testpage(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	cmd.c = c
+	cmd.setarg(ArgPrt)
+
+	if err := cmd.validatePrinter(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	prt := cmd.cfg.Cups.Printer
+	hostname, _ := os.Hostname()
+
+	doc := newPDFDoc(tr("IMAPPrint Test Page"))
+	doc.heading(tr("IMAPPrint Test Page"), 18)
+	doc.text("")
+	doc.text(fmt.Sprintf("Timestamp:   %s", time.Now().Format(time.RFC1123)))
+	doc.text(fmt.Sprintf("Host:        %s", hostname))
+	doc.text(fmt.Sprintf("Version:     %s", c.App.Version))
+	doc.text(fmt.Sprintf("Config Hash: %s", cmd.cfghash()))
+	doc.text(fmt.Sprintf("Printer:     %s", prt))
+	doc.text("")
+
+	doc.heading(tr("Connectivity"), 12)
+	for _, line := range cmd.connectivity() {
+		doc.text(line)
+	}
+	doc.text("")
+
+	doc.heading(tr("Device Attributes"), 12)
+	lines, err := cmd.deviceAttributes(prt)
+	if err != nil {
+		doc.text("Error: " + err.Error())
+	}
+	for _, line := range lines {
+		doc.text(line)
+	}
+
+	file := filepath.Join(cmd.TmpDir, TestPageName)
+	if err := doc.write(file); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logpad("Printing", file)
+
+	if cmd.NoPrint {
+		cmd.logverb("JobID", "123456")
+		return nil
+	}
+
+	p, err := cmd.printer(prt)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	ctx, cancel := cmd.printContext()
+	defer cancel()
+
+	job, err := p.Submit(ctx, file, printer.Options{})
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logpad("JobID", job)
+
+	return nil
+}
+
+// connectivity checks reachability of cups, IMAP and SMTP servers and returns the results
+func (cmd *Command) connectivity() []string {
+
+	var results []string
+
+	check := func(name string, fn func() error) {
+		start := time.Now()
+		err := fn()
+		status := "ok"
+		if err != nil {
+			status = "FAILED: " + err.Error()
+		}
+		line := fmt.Sprintf("%-12s %s (%s)", name+":", status, time.Since(start).Round(time.Millisecond))
+		cmd.logverb("Connectivity", line)
+		results = append(results, line)
+	}
+
+	check("CUPS", func() error {
+		dev, err := cmd.device(cmd.cfg.Cups.Printer)
+		if err != nil {
+			return err
+		}
+		return dev.Ping()
+	})
+
+	if cmd.cfg.IMAP.Addr != "" {
+		check("IMAP", func() error {
+			c, err := cmd.dial()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			if _, err := c.Select(cmd.cfg.IMAP.Mailbox, true); err != nil {
+				return err
+			}
+			return c.Logout()
+		})
+	}
+
+	if cmd.cfg.SMTP.Addr != "" {
+		check("SMTP", func() error {
+			conn, err := net.DialTimeout("tcp", cmd.cfg.SMTP.Addr, 10*time.Second)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+	}
+
+	return results
+}
+
+// deviceAttributes returns all IPP attributes of prt including supply levels as sorted "name: values" lines
+func (cmd *Command) deviceAttributes(prt string) ([]string, error) {
+
+	dev, err := cmd.device(prt)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := dev.Attributes(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	supplies, _ := dev.Attributes(supplyAttributes)
+	for k, v := range supplies {
+		attrs[k] = v
+	}
+
+	var names []string
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		var values []interface{}
+		for _, a := range attrs[name] {
+			values = append(values, a.Value)
+		}
+		lines = append(lines, fmt.Sprintf("%-28s %v", name+":", values))
+	}
+
+	return lines, nil
+}
+
+// cfghash returns a short hash of the current configuration (secrets excluded)
+func (cmd *Command) cfghash() string {
+	data, _ := json.Marshal(cmd.cfg)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"fmt"
+	"github.com/mrccnt/imap-print/printer"
+	"github.com/urfave/cli/v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name of the generated test print
+const TestPrintName = "testprint.pdf"
+
+// testprint is used as callable for the test-print sub command, it sends the built-in test page or the given file
+// through the conversions and print options of regular attachments to verify the print path without IMAP
+func (cmd *Command) testprint(c *cli.Context) error {
+
+	defer cmd.Close()
+
+	cmd.c = c
+	cmd.setarg(ArgPrt)
+
+	if err := cmd.validatePrinter(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	m := &Mail{
+		Tracking: trackingID(),
+		Date:     time.Now(),
+		Subject:  tr("IMAPPrint Test Print"),
+	}
+
+	attachment, err := cmd.testprintFile(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	attachment.Mail = m
+	cmd.sniff(attachment)
+
+	if attachment, err = cmd.prepare(attachment); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logpad("Printing", attachment.Name, cmd.target(attachment), cmd.sides(attachment))
+
+	if cmd.NoPrint {
+		cmd.logverb("JobID", "123456")
+		return nil
+	}
+
+	job, err := cmd.printfile(attachment)
+	if printer.Unreachable(err) {
+		return cli.NewExitError(err, ExitPrinter)
+	} else if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	cmd.logpad("JobID", job)
+
+	return nil
+}
+
+// testprintFile returns a copy of file in the temp dir, the generated test page if file is empty
+func (cmd *Command) testprintFile(file string) (*Attachment, error) {
+
+	if file != "" {
+		name := filepath.Base(file)
+		dst := filepath.Join(cmd.TmpDir, name)
+		if err := copyFile(file, dst); err != nil {
+			return nil, err
+		}
+		return &Attachment{File: dst, Name: name}, nil
+	}
+
+	hostname, _ := os.Hostname()
+
+	doc := newPDFDoc(tr("IMAPPrint Test Print"))
+	doc.heading(tr("IMAPPrint Test Print"), 18)
+	doc.text("")
+	doc.text(fmt.Sprintf("Timestamp:   %s", time.Now().Format(time.RFC1123)))
+	doc.text(fmt.Sprintf("Host:        %s", hostname))
+	doc.text(fmt.Sprintf("Printer:     %s", cmd.target(nil)))
+	doc.text(fmt.Sprintf("Backend:     %s", cmd.cfg.Cups.Backend))
+	doc.text(fmt.Sprintf("Paper Size:  %s", cmd.cfg.Paper))
+	doc.text(fmt.Sprintf("Duplex:      %s", cmd.cfg.Duplex.Mode))
+	doc.text("")
+	doc.text(tr("If you can read this, documents of allowed senders will be printed."))
+
+	file = filepath.Join(cmd.TmpDir, TestPrintName)
+	if err := doc.write(file); err != nil {
+		return nil, err
+	}
+
+	return &Attachment{File: file, Name: TestPrintName}, nil
+}
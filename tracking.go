@@ -0,0 +1,154 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/mrccnt/imap-print/printer"
+	"path/filepath"
+)
+
+// Tracking id settings; the alphabet leaves out easily confused characters (0/O, 1/I)
+const (
+	TrackingAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	TrackingLength   = 5
+)
+
+// trackingID returns a short human friendly id to reference a mail and its print jobs
+func trackingID() string {
+	b := make([]byte, TrackingLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = TrackingAlphabet[int(b[i])%len(TrackingAlphabet)]
+	}
+	return string(b)
+}
+
+// jobName returns the cups job name of attachment including the tracking id of its mail
+func (a *Attachment) jobName() string {
+	name := a.Name
+	if name == "" {
+		name = filepath.Base(a.File)
+	}
+	if a.Mail == nil || a.Mail.Tracking == "" {
+		return name
+	}
+	return a.Mail.Tracking + " " + name
+}
+
+// documentFormat returns the MIME type detected from the content of file if print servers are told about it,
+// conversions may have changed the type since the attachment was sniffed
+func documentFormat(file string) string {
+	if sniffed, err := filter.Sniff(file); err == nil && printer.DocumentFormats[sniffed] {
+		return sniffed
+	}
+	return ""
+}
+
+// printfile sends attachment to the configured printer using its job name
+func (cmd *Command) printfile(attachment *Attachment) (printer.JobID, error) {
+
+	prt := cmd.target(attachment)
+	p, err := cmd.printer(prt)
+	if err != nil {
+		return -1, err
+	}
+
+	ctx, cancel := cmd.printContext()
+	defer cancel()
+
+	opts := printer.Options{
+		JobName:   attachment.jobName(),
+		Name:      attachment.Name,
+		Sides:     cmd.sides(attachment),
+		HoldUntil: cmd.holdUntil(attachment),
+		Format:    documentFormat(attachment.File),
+
+		Orientation: attachment.Orientation,
+		ColorMode:   cmd.colorMode(attachment),
+	}
+	if m := attachment.Mail; m != nil {
+		opts.From = m.From
+		opts.Subject = m.Subject
+		opts.Tracking = m.Tracking
+		opts.Date = m.Date
+	}
+
+	// A submission timing out may still have created its job, the document keeps its job-uuid across attempts and
+	// runs, so a job created by an earlier attempt is found instead of printing the document twice
+	finder, idempotent := p.(printer.Finder)
+	if idempotent {
+		opts.UUID = cmd.jobUUID(attachment)
+		if job, ok := cmd.findSubmission(finder, attachment, opts.UUID); ok {
+			return job, nil
+		}
+	}
+
+	job, err := p.Submit(ctx, attachment.File, opts)
+	if printer.UnsupportedFormat(err) {
+		if dev := cmd.driverless(p); dev != nil {
+			prt, finder = dev.URI, dev
+			job, err = dev.Submit(ctx, attachment.File, opts)
+		}
+	}
+
+	if idempotent && printer.Unreachable(err) {
+		if found, ok := cmd.findSubmission(finder, attachment, opts.UUID); ok {
+			job, err = found, nil
+		}
+	}
+
+	if err == nil && !opts.HoldUntil.IsZero() {
+		cmd.recordHold(attachment, prt, job, opts.HoldUntil)
+	}
+
+	return job, err
+}
+
+// jobUUID returns the job-uuid of attachment, the same for every attempt to print it; documents without a mail get a
+// random one. Converted documents differ from run to run, so the document is identified by mail, name and part, its
+// separator and cover pages printed as jobs of their own by their number
+func (cmd *Command) jobUUID(attachment *Attachment) string {
+
+	m := attachment.Mail
+	if m == nil {
+		return printer.NewUUID()
+	}
+
+	id := m.Tracking
+	if m.MessageID != "" {
+		id = "msgid:" + m.MessageID
+	}
+
+	return printer.NameUUID(fmt.Sprintf("%s|%s|%d|%s|%d", id, attachment.Name, attachment.Seq, attachment.Orientation, attachment.Lead))
+}
+
+// findSubmission returns the job the submission of attachment with uuid created despite failing
+func (cmd *Command) findSubmission(f printer.Finder, attachment *Attachment, uuid string) (printer.JobID, bool) {
+
+	job, err := f.Find(uuid)
+	if err != nil {
+		if err != printer.ErrJobNotFound {
+			cmd.logverb("Find Job", attachment.Name, err.Error())
+		}
+		return -1, false
+	}
+
+	cmd.logpad("Submitted", attachment.jobName(), job)
+
+	return job, true
+}
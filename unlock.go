@@ -0,0 +1,115 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"errors"
+	"github.com/mrccnt/imap-print/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"os"
+	"strings"
+)
+
+// ErrPDFLocked is returned for encrypted PDF documents none of the configured passwords opens
+var ErrPDFLocked = errors.New("PDF is password protected")
+
+// pdfPasswords returns the passwords to try for PDF documents of sender, the ones of the sender first
+func (cmd *Command) pdfPasswords(sender string) []string {
+
+	sender = strings.ToLower(sender)
+	domain := ""
+	if i := strings.LastIndex(sender, "@"); i >= 0 {
+		domain = sender[i:]
+	}
+
+	// An empty user password opens documents which only restrict permissions
+	passwords := []string{""}
+	var global []string
+
+	for _, entry := range cmd.cfg.PDF.Passwords {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[0], "@") {
+			global = append(global, entry)
+			continue
+		}
+		match := strings.ToLower(parts[0])
+		if sender != "" && (match == sender || match == domain) {
+			passwords = append(passwords, parts[1])
+		}
+	}
+
+	return append(passwords, global...)
+}
+
+// unlockPDF removes the encryption of PDF attachments so printers are able to open them
+func (cmd *Command) unlockPDF(attachment *Attachment) (*Attachment, error) {
+
+	if attachment.Canary != "" || filter.FileExt(attachment.File) != "pdf" {
+		return attachment, nil
+	}
+
+	encrypted, err := isEncryptedPDF(attachment.File)
+	if err != nil || !encrypted {
+		return attachment, err
+	}
+
+	sender := ""
+	if attachment.Mail != nil {
+		sender = attachment.Mail.From
+	}
+
+	out := strings.TrimSuffix(attachment.File, ".pdf") + ".unlocked.pdf"
+
+	for _, pw := range cmd.pdfPasswords(sender) {
+		conf := pdfcpu.NewDefaultConfiguration()
+		conf.UserPW = pw
+		conf.OwnerPW = pw
+		if err := api.DecryptFile(attachment.File, out, conf); err != nil {
+			continue
+		}
+		if pw != "" {
+			cmd.logpad("Unlocked", attachment.Name)
+		}
+		unlocked := *attachment
+		unlocked.File = out
+		return &unlocked, nil
+	}
+
+	cmd.logpad("Locked", attachment.Name, tr(ErrPDFLocked.Error()))
+
+	return attachment, errors.New(tr(ErrPDFLocked.Error()))
+}
+
+// isEncryptedPDF checks if the PDF file is encrypted, errors of damaged documents are returned as is
+func isEncryptedPDF(file string) (bool, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	ctx, err := api.ReadContext(f, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		// Documents requiring a user password can not be read without one
+		if strings.Contains(err.Error(), "password") {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return ctx.Encrypt != nil, nil
+}
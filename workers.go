@@ -0,0 +1,108 @@
+// Copyright 2020 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imapprint
+
+import (
+	"github.com/emersion/go-imap"
+	"sort"
+	"sync"
+)
+
+// fetchedBody is a downloaded message waiting to be converted
+type fetchedBody struct {
+	seq  uint32
+	uid  uint32
+	body imap.Literal
+}
+
+// converter converts downloaded messages into *Mail objects with a pool of workers
+type converter struct {
+	cmd   *Command
+	jobs  chan *fetchedBody
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	mails []*Mail
+	seqs  map[*Mail]uint32
+	fails []*Failure
+}
+
+// newConverter starts a converter with the given number of workers
+func (cmd *Command) newConverter(workers int) *converter {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	cv := &converter{
+		cmd:  cmd,
+		jobs: make(chan *fetchedBody, workers),
+		seqs: map[*Mail]uint32{},
+	}
+
+	for i := 0; i < workers; i++ {
+		cv.wg.Add(1)
+		go cv.work()
+	}
+
+	return cv
+}
+
+// work converts queued messages until the converter is closed
+func (cv *converter) work() {
+	defer cv.wg.Done()
+	for f := range cv.jobs {
+		m, err := cv.cmd.convert(f.body)
+		if err != nil {
+			cv.cmd.logpad("Error", err.Error())
+			cv.fail(f.seq, err)
+			continue
+		}
+		m.UID, m.Seq = f.uid, f.seq
+		cv.done(m, f.seq)
+	}
+}
+
+// add queues the downloaded body of message seq for conversion
+func (cv *converter) add(seq uint32, uid uint32, body imap.Literal) {
+	cv.jobs <- &fetchedBody{seq: seq, uid: uid, body: body}
+}
+
+// done adds the ready mail m with sequence number seq to the result
+func (cv *converter) done(m *Mail, seq uint32) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	cv.mails = append(cv.mails, m)
+	cv.seqs[m] = seq
+}
+
+// fail records that message seq could not be fetched or converted
+func (cv *converter) fail(seq uint32, err error) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	cv.fails = append(cv.fails, &Failure{Seq: seq, Err: err})
+}
+
+// wait waits for all workers and returns the mails in mailbox order
+func (cv *converter) wait() []*Mail {
+
+	close(cv.jobs)
+	cv.wg.Wait()
+
+	sort.SliceStable(cv.mails, func(i, j int) bool {
+		return cv.seqs[cv.mails[i]] < cv.seqs[cv.mails[j]]
+	})
+
+	return cv.mails
+}